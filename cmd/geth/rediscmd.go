@@ -0,0 +1,458 @@
+// Copyright 2026 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/redisstore"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	redisFromFlag = &cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to backfill",
+	}
+	redisToFlag = &cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to backfill (default = current head)",
+	}
+	redisTTLFlag = &cli.DurationFlag{
+		Name:  "ttl",
+		Usage: "Expiry of the backfilled block data (0 = keep until purged)",
+	}
+	redisChainIDFlag = &cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "Chain id of the Redis data",
+		Value: params.MainnetChainConfig.ChainID.Uint64(),
+	}
+	redisOlderThanFlag = &cli.DurationFlag{
+		Name:  "older-than",
+		Usage: "Purge blocks and pending transactions older than this",
+		Value: 24 * time.Hour,
+	}
+
+	redisCommand = &cli.Command{
+		Name:      "redis",
+		Usage:     "Redis export maintenance",
+		ArgsUsage: "",
+		Subcommands: []*cli.Command{
+			redisBackfillCmd,
+			redisVerifyCmd,
+			redisPurgeCmd,
+			redisMigrateCmd,
+		},
+	}
+	redisBackfillCmd = &cli.Command{
+		Action:    redisBackfill,
+		Name:      "backfill",
+		Usage:     "Export a range of historical blocks into Redis",
+		ArgsUsage: "",
+		Flags: slices.Concat([]cli.Flag{
+			redisFromFlag,
+			redisToFlag,
+			redisTTLFlag,
+		}, utils.NetworkFlags, utils.DatabaseFlags, utils.RedisFlags),
+		Description: `This command exports the canonical blocks in the given range, along with their
+receipts and logs, from the local database into Redis. Blocks no longer available in
+the database are read from the era1 archives, if present. The data is written by the
+same code as the live export. The node must not be running.`,
+	}
+	redisVerifyCmd = &cli.Command{
+		Action:    redisVerify,
+		Name:      "verify",
+		Usage:     "Compare the Redis contents against a running node",
+		ArgsUsage: "[endpoint]",
+		Flags:     slices.Concat([]cli.Flag{utils.DataDirFlag, utils.HttpHeaderFlag}, utils.RedisFlags),
+		Description: `This command compares all canonical blocks stored in Redis with the canonical
+chain of the node at the given RPC endpoint (the IPC endpoint of the data directory by
+default), reporting gaps and mismatches. The mirrored pending transactions are
+compared against the node's transaction pool.`,
+	}
+	redisPurgeCmd = &cli.Command{
+		Action:    redisPurge,
+		Name:      "purge",
+		Usage:     "Delete blocks and pending transactions older than a given age from Redis",
+		ArgsUsage: "",
+		Flags:     slices.Concat([]cli.Flag{redisOlderThanFlag, redisChainIDFlag}, utils.RedisFlags),
+		Description: `This command deletes all blocks, along with their indices and receipts, and all
+mirrored pending transactions of a chain older than the given age from Redis.`,
+	}
+	redisMigrateCmd = &cli.Command{
+		Action:    redisMigrate,
+		Name:      "migrate",
+		Usage:     "Move Redis data written without key prefix under the prefix of a chain",
+		ArgsUsage: "",
+		Flags:     slices.Concat([]cli.Flag{redisChainIDFlag}, utils.RedisFlags),
+		Description: `This command renames all keys written before Redis keys were prefixed, so that
+they are found under the configured prefix of the given chain ("<chainId>:" by default),
+and records the schema descriptor of the prefix. Keys already present under the prefix
+take precedence. The exporters writing to Redis must not be running.`,
+	}
+)
+
+// openRedisStore connects to the Redis instance configured on the command line,
+// regardless of whether the live export is enabled, to access the data of the
+// given chain.
+func openRedisStore(ctx *cli.Context, chainID *big.Int) (*redisstore.RedisBlockStore, error) {
+	cfg := loadBaseConfig(ctx).Eth.Redis
+	utils.SetRedisConfig(ctx, &cfg)
+	cfg.Enabled = true
+
+	// Report failed writes instead of spooling them to a file relative to the
+	// working directory, or to the spool of a node running on the same datadir.
+	cfg.Spool = ""
+
+	store, err := redisstore.NewRedisStore(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	store.SetChainID(chainID)
+	return store, nil
+}
+
+func redisBackfill(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, true)
+	defer db.Close()
+
+	store, err := openRedisStore(ctx, chain.Config().ChainID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	store.SetTTL(ctx.Duration(redisTTLFlag.Name))
+
+	// Drop the exported transactions from the mempool mirror as they get mined
+	txMgr := redisstore.NewTxManager(store)
+	defer txMgr.Close()
+
+	var (
+		from = ctx.Uint64(redisFromFlag.Name)
+		to   = chain.CurrentBlock().Number.Uint64()
+	)
+	if ctx.IsSet(redisToFlag.Name) {
+		to = ctx.Uint64(redisToFlag.Name)
+	}
+	if from > to {
+		return fmt.Errorf("invalid range: from %d > to %d", from, to)
+	}
+	ancients := stack.ResolveAncient("chaindata", "")
+	dir := filepath.Join(ancients, rawdb.ChainFreezerName, "era")
+	if ctx.IsSet(utils.EraFlag.Name) {
+		dir = filepath.Join(ancients, ctx.String(utils.EraFlag.Name))
+	}
+	history := &eraHistory{dir: dir, network: params.NetworkNames[chain.Config().ChainID.String()]}
+	defer history.close()
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := from; number <= to; number++ {
+		block, receipts, err := readHistory(chain, history, number)
+		if err != nil {
+			return err
+		}
+		if err := store.ExportBlock(block, receipts, chain.Config()); err != nil {
+			return fmt.Errorf("failed to export block %d: %v", number, err)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Backfilling Redis", "number", number, "to", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Redis backfill done", "blocks", to-from+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// readHistory retrieves a canonical block with its receipts from the database,
+// falling back to the era1 archives for pruned history.
+func readHistory(chain *core.BlockChain, history *eraHistory, number uint64) (*types.Block, types.Receipts, error) {
+	if hash := chain.GetCanonicalHash(number); hash != (common.Hash{}) {
+		if block := chain.GetBlock(hash, number); block != nil {
+			return block, chain.GetReceiptsByHash(hash), nil
+		}
+	}
+	return history.block(number, chain.Config())
+}
+
+// eraHistory reads blocks and receipts from the era1 archives of a network.
+type eraHistory struct {
+	dir     string
+	network string
+	files   []string
+
+	epoch int
+	era   *era.Era
+}
+
+// block retrieves a block with its derived receipts from the era1 archives.
+func (h *eraHistory) block(number uint64, config *params.ChainConfig) (*types.Block, types.Receipts, error) {
+	epoch := int(number / uint64(era.MaxEra1Size))
+	if h.era == nil || h.epoch != epoch {
+		if h.files == nil {
+			files, err := era.ReadDir(h.dir, h.network)
+			if err != nil {
+				return nil, nil, err
+			}
+			h.files = files
+		}
+		if epoch >= len(h.files) {
+			return nil, nil, fmt.Errorf("block %d not available in the database or the era1 archives", number)
+		}
+		h.close()
+		e, err := era.Open(filepath.Join(h.dir, h.files[epoch]))
+		if err != nil {
+			return nil, nil, err
+		}
+		h.epoch, h.era = epoch, e
+	}
+	block, err := h.era.GetBlockByNumber(number)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := h.era.GetRawReceiptsByNumber(number)
+	if err != nil {
+		return nil, nil, err
+	}
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(raw, &receipts); err != nil {
+		return nil, nil, fmt.Errorf("invalid receipts of block %d: %v", number, err)
+	}
+	if err := receipts.DeriveFields(config, block.Hash(), number, block.Time(), block.BaseFee(), nil, block.Transactions()); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive receipts of block %d: %v", number, err)
+	}
+	return block, receipts, nil
+}
+
+func (h *eraHistory) close() {
+	if h.era != nil {
+		h.era.Close()
+		h.era = nil
+	}
+}
+
+func redisVerify(ctx *cli.Context) error {
+	if ctx.Args().Len() > 1 {
+		utils.Fatalf("invalid command-line: too many arguments")
+	}
+	endpoint := ctx.Args().First()
+	if endpoint == "" {
+		cfg := defaultNodeConfig()
+		utils.SetDataDir(ctx, &cfg)
+		endpoint = cfg.IPCEndpoint()
+	}
+	client, err := utils.DialRPCWithHeaders(endpoint, ctx.StringSlice(utils.HttpHeaderFlag.Name))
+	if err != nil {
+		return fmt.Errorf("unable to attach to geth: %v", err)
+	}
+	defer client.Close()
+
+	var chainID hexutil.Big
+	if err := client.CallContext(context.Background(), &chainID, "eth_chainId"); err != nil {
+		return fmt.Errorf("failed to retrieve chain id: %v", err)
+	}
+	store, err := openRedisStore(ctx, chainID.ToInt())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	blocks, err := verifyRedisBlocks(client, store)
+	if err != nil {
+		return err
+	}
+	txs, err := verifyRedisTxs(client, store)
+	if err != nil {
+		return err
+	}
+	if blocks+txs > 0 {
+		return fmt.Errorf("found %d block and %d transaction mismatches", blocks, txs)
+	}
+	log.Info("Redis contents verified")
+	return nil
+}
+
+// verifyRedisBlocks compares the canonical blocks stored in Redis against the
+// node's canonical chain, returning the number of mismatches.
+func verifyRedisBlocks(client *rpc.Client, store *redisstore.RedisBlockStore) (int, error) {
+	numbers, err := store.BlockNumbers()
+	if err != nil {
+		return 0, err
+	}
+	if len(numbers) == 0 {
+		log.Info("No blocks stored in Redis")
+		return 0, nil
+	}
+	var mismatches int
+	for i, number := range numbers {
+		if i > 0 && number > numbers[i-1]+1 {
+			log.Warn("Blocks missing from Redis", "from", numbers[i-1]+1, "to", number-1)
+			mismatches++
+		}
+		fields, err := store.GetBlockFieldsByNumber(number, "hash", "parentHash", "txs")
+		if err != nil {
+			return mismatches, err
+		}
+		var want struct {
+			Hash         common.Hash   `json:"hash"`
+			ParentHash   common.Hash   `json:"parentHash"`
+			Transactions []common.Hash `json:"transactions"`
+		}
+		if err := client.CallContext(context.Background(), &want, "eth_getBlockByNumber", hexutil.EncodeUint64(number), false); err != nil {
+			return mismatches, err
+		}
+		if want.Hash == (common.Hash{}) {
+			log.Warn("Redis block beyond the chain head", "number", number, "hash", fields["hash"])
+			mismatches++
+			continue
+		}
+		if common.HexToHash(fields["hash"]) != want.Hash || common.HexToHash(fields["parentHash"]) != want.ParentHash {
+			log.Warn("Redis block not canonical", "number", number, "have", fields["hash"], "want", want.Hash)
+			mismatches++
+			continue
+		}
+		var have []struct {
+			Hash common.Hash `json:"hash"`
+		}
+		blob, err := redisstore.Decompress([]byte(fields["txs"]))
+		if err == nil {
+			err = json.Unmarshal(blob, &have)
+		}
+		if err != nil {
+			log.Warn("Redis block transactions unreadable", "number", number, "err", err)
+			mismatches++
+			continue
+		}
+		if len(have) != len(want.Transactions) {
+			log.Warn("Redis block transaction count mismatch", "number", number, "have", len(have), "want", len(want.Transactions))
+			mismatches++
+			continue
+		}
+		for j := range have {
+			if have[j].Hash != want.Transactions[j] {
+				log.Warn("Redis block transaction mismatch", "number", number, "index", j, "have", have[j].Hash, "want", want.Transactions[j])
+				mismatches++
+				break
+			}
+		}
+	}
+	log.Info("Verified Redis blocks", "first", numbers[0], "last", numbers[len(numbers)-1], "stored", len(numbers), "mismatches", mismatches)
+	return mismatches, nil
+}
+
+// verifyRedisTxs compares the mirrored pending transactions against the node's
+// transaction pool, returning the number of mismatches.
+func verifyRedisTxs(client *rpc.Client, store *redisstore.RedisBlockStore) (int, error) {
+	var content map[string]map[string]map[string]struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := client.CallContext(context.Background(), &content, "txpool_content"); err != nil {
+		return 0, err
+	}
+	pool := make(map[common.Hash]bool)
+	for _, accounts := range content {
+		for _, txs := range accounts {
+			for _, tx := range txs {
+				pool[tx.Hash] = true
+			}
+		}
+	}
+	hashes, err := redisstore.NewTxManager(store).ListRedisTransactions()
+	if err != nil {
+		return 0, err
+	}
+	var stale, missing int
+	mirror := make(map[common.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		if mirror[hash] = true; !pool[hash] {
+			log.Debug("Redis transaction not in pool", "hash", hash)
+			stale++
+		}
+	}
+	for hash := range pool {
+		if !mirror[hash] {
+			log.Debug("Pool transaction not in Redis", "hash", hash)
+			missing++
+		}
+	}
+	if stale > 0 || missing > 0 {
+		log.Warn("Redis mempool mirror out of sync", "mirrored", len(mirror), "pooled", len(pool), "stale", stale, "missing", missing)
+	} else {
+		log.Info("Verified Redis mempool mirror", "transactions", len(mirror))
+	}
+	return stale + missing, nil
+}
+
+func redisPurge(ctx *cli.Context) error {
+	age := ctx.Duration(redisOlderThanFlag.Name)
+	if age <= 0 {
+		return errors.New("purge age must be positive")
+	}
+	store, err := openRedisStore(ctx, new(big.Int).SetUint64(ctx.Uint64(redisChainIDFlag.Name)))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	start := time.Now()
+	blocks, txs, err := store.Purge(start.Add(-age))
+	if err != nil {
+		return err
+	}
+	log.Info("Purged Redis data", "blocks", blocks, "txs", txs, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func redisMigrate(ctx *cli.Context) error {
+	store, err := openRedisStore(ctx, new(big.Int).SetUint64(ctx.Uint64(redisChainIDFlag.Name)))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	start := time.Now()
+	moved, err := store.MigrateLegacyKeys()
+	if err != nil {
+		return err
+	}
+	log.Info("Migrated Redis keys", "moved", moved, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
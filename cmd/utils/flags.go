@@ -43,6 +43,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/redisstore"
 	"github.com/ethereum/go-ethereum/core/txpool/blobpool"
 	"github.com/ethereum/go-ethereum/core/txpool/legacypool"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -446,6 +447,229 @@ var (
 		Value:    ethconfig.Defaults.BlobPool.PriceBump,
 		Category: flags.BlobPoolCategory,
 	}
+	// Redis export settings
+	RedisEnabledFlag = &cli.BoolFlag{
+		Name:     "redis.enabled",
+		Usage:    "Enable exporting chain and mempool data into Redis",
+		Value:    ethconfig.Defaults.Redis.Enabled,
+		Category: flags.RedisCategory,
+	}
+	RedisModeFlag = &cli.StringFlag{
+		Name:     "redis.mode",
+		Usage:    `Redis deployment mode ("standalone", "sentinel" or "cluster")`,
+		Value:    ethconfig.Defaults.Redis.Mode,
+		Category: flags.RedisCategory,
+	}
+	RedisMasterNameFlag = &cli.StringFlag{
+		Name:     "redis.master",
+		Usage:    "Name of the Redis primary monitored by the sentinels (sentinel mode)",
+		Category: flags.RedisCategory,
+	}
+	RedisNetworkFlag = &cli.StringFlag{
+		Name:     "redis.network",
+		Usage:    `Redis connection type ("tcp" or "unix")`,
+		Value:    ethconfig.Defaults.Redis.Network,
+		Category: flags.RedisCategory,
+	}
+	RedisAddrFlag = &cli.StringFlag{
+		Name:     "redis.addr",
+		Usage:    "Redis server address (host:port for tcp, socket path for unix, comma separated sentinel or cluster nodes)",
+		Value:    ethconfig.Defaults.Redis.Address,
+		Category: flags.RedisCategory,
+	}
+	RedisUserFlag = &cli.StringFlag{
+		Name:     "redis.user",
+		Usage:    "Redis ACL user name",
+		Category: flags.RedisCategory,
+	}
+	RedisPasswordFileFlag = &flags.DirectoryFlag{
+		Name:     "redis.password.file",
+		Usage:    "File containing the Redis ACL password",
+		Category: flags.RedisCategory,
+	}
+	RedisDBFlag = &cli.IntFlag{
+		Name:     "redis.db",
+		Usage:    "Redis logical database index",
+		Value:    ethconfig.Defaults.Redis.DB,
+		Category: flags.RedisCategory,
+	}
+	RedisKeyPrefixFlag = &cli.StringFlag{
+		Name:     "redis.prefix",
+		Usage:    "Prefix of all Redis keys (default = \"<chainId>:\")",
+		Category: flags.RedisCategory,
+	}
+	RedisTLSFlag = &cli.BoolFlag{
+		Name:     "redis.tls",
+		Usage:    "Connect to Redis over TLS",
+		Category: flags.RedisCategory,
+	}
+	RedisTLSCAFlag = &flags.DirectoryFlag{
+		Name:     "redis.tls.ca",
+		Usage:    "CA certificate bundle used to verify the Redis server",
+		Category: flags.RedisCategory,
+	}
+	RedisTLSCertFlag = &flags.DirectoryFlag{
+		Name:     "redis.tls.cert",
+		Usage:    "Client certificate for mutual TLS with Redis",
+		Category: flags.RedisCategory,
+	}
+	RedisTLSKeyFlag = &flags.DirectoryFlag{
+		Name:     "redis.tls.key",
+		Usage:    "Client private key for mutual TLS with Redis",
+		Category: flags.RedisCategory,
+	}
+	RedisTLSInsecureFlag = &cli.BoolFlag{
+		Name:     "redis.tls.insecure",
+		Usage:    "Skip verification of the Redis server certificate",
+		Category: flags.RedisCategory,
+	}
+	RedisPoolSizeFlag = &cli.IntFlag{
+		Name:     "redis.poolsize",
+		Usage:    "Maximum number of Redis connections",
+		Value:    ethconfig.Defaults.Redis.PoolSize,
+		Category: flags.RedisCategory,
+	}
+	RedisMinIdleFlag = &cli.IntFlag{
+		Name:     "redis.minidle",
+		Usage:    "Minimum number of idle Redis connections kept open",
+		Value:    ethconfig.Defaults.Redis.MinIdle,
+		Category: flags.RedisCategory,
+	}
+	RedisRetriesFlag = &cli.IntFlag{
+		Name:     "redis.retries",
+		Usage:    "Maximum number of retries for a failed Redis command",
+		Value:    ethconfig.Defaults.Redis.MaxRetries,
+		Category: flags.RedisCategory,
+	}
+	RedisRetryDelayFlag = &cli.DurationFlag{
+		Name:     "redis.retrydelay",
+		Usage:    "Minimum backoff between Redis command retries",
+		Value:    ethconfig.Defaults.Redis.RetryDelay,
+		Category: flags.RedisCategory,
+	}
+	RedisDialTimeoutFlag = &cli.DurationFlag{
+		Name:     "redis.dialtimeout",
+		Usage:    "Timeout for establishing new Redis connections",
+		Value:    ethconfig.Defaults.Redis.DialTimeout,
+		Category: flags.RedisCategory,
+	}
+	RedisQueueSizeFlag = &cli.IntFlag{
+		Name:     "redis.queue",
+		Usage:    "Maximum number of chain heads waiting for Redis export",
+		Value:    ethconfig.Defaults.Redis.QueueSize,
+		Category: flags.RedisCategory,
+	}
+	RedisSpoolFlag = &cli.StringFlag{
+		Name:     "redis.spool",
+		Usage:    "Disk spool of mempool writes that failed to reach Redis (empty to disable)",
+		Value:    ethconfig.Defaults.Redis.Spool,
+		Category: flags.RedisCategory,
+	}
+	RedisBlobSidecarsFlag = &cli.BoolFlag{
+		Name:     "redis.blobsidecars",
+		Usage:    "Store the sidecar commitments and proofs of pooled blob transactions in Redis",
+		Category: flags.RedisCategory,
+	}
+	RedisStreamMaxLenFlag = &cli.Int64Flag{
+		Name:     "redis.stream.maxlen",
+		Usage:    "Approximate number of entries retained per Redis event stream (0 = unbounded)",
+		Value:    ethconfig.Defaults.Redis.StreamMaxLen,
+		Category: flags.RedisCategory,
+	}
+	RedisStreamGroupsFlag = &cli.StringFlag{
+		Name:     "redis.stream.groups",
+		Usage:    "Comma separated consumer groups to create on every Redis event stream",
+		Category: flags.RedisCategory,
+	}
+	RedisLogIndexFlag = &cli.BoolFlag{
+		Name:     "redis.logindex",
+		Usage:    "Index exported logs by address and first topic in Redis",
+		Category: flags.RedisCategory,
+	}
+	RedisLogIndexRetentionFlag = &cli.Uint64Flag{
+		Name:     "redis.logindex.retention",
+		Usage:    "Number of recent blocks kept in the Redis log index (0 = all)",
+		Value:    ethconfig.Defaults.Redis.LogIndexRetention,
+		Category: flags.RedisCategory,
+	}
+	RedisLogIndexRPCFlag = &cli.BoolFlag{
+		Name:     "redis.logindex.rpc",
+		Usage:    "Serve eth_getLogs ranges not yet covered by the local log index from the Redis log index",
+		Category: flags.RedisCategory,
+	}
+	RedisRetentionBlocksFlag = &cli.StringFlag{
+		Name:     "redis.retention.blocks",
+		Usage:    "Retention of exported blocks, as duration, depth behind the finalized block or both (0 = keep)",
+		Value:    ethconfig.Defaults.Redis.Retention.Blocks.String(),
+		Category: flags.RedisCategory,
+	}
+	RedisRetentionLogsFlag = &cli.StringFlag{
+		Name:     "redis.retention.logs",
+		Usage:    "Retention of the Redis log index, as duration, depth behind the finalized block or both (0 = keep)",
+		Value:    ethconfig.Defaults.Redis.Retention.Logs.String(),
+		Category: flags.RedisCategory,
+	}
+	RedisRetentionReceiptsFlag = &cli.StringFlag{
+		Name:     "redis.retention.receipts",
+		Usage:    "Retention of exported receipts, as duration, depth behind the finalized block or both (0 = keep)",
+		Value:    ethconfig.Defaults.Redis.Retention.Receipts.String(),
+		Category: flags.RedisCategory,
+	}
+	RedisRetentionPendingTxsFlag = &cli.StringFlag{
+		Name:     "redis.retention.pendingtxs",
+		Usage:    "Retention of mirrored pool transactions and their history, as duration (0 = keep)",
+		Value:    ethconfig.Defaults.Redis.Retention.PendingTxs.String(),
+		Category: flags.RedisCategory,
+	}
+	RedisRetentionMinedTxsFlag = &cli.StringFlag{
+		Name:     "redis.retention.minedtxs",
+		Usage:    "Retention of the block pointers and address index of mined transactions, as duration, depth behind the finalized block or both (0 = keep)",
+		Value:    ethconfig.Defaults.Redis.Retention.MinedTxs.String(),
+		Category: flags.RedisCategory,
+	}
+	RedisIngestFlag = &cli.BoolFlag{
+		Name:     "redis.ingest",
+		Usage:    "Submit the transactions appended to the Redis ingest stream to the pool",
+		Category: flags.RedisCategory,
+	}
+	RedisIngestGroupFlag = &cli.StringFlag{
+		Name:     "redis.ingest.group",
+		Usage:    "Consumer group the Redis ingest stream is read in, shared by the nodes submitting",
+		Value:    ethconfig.Defaults.Redis.IngestGroup,
+		Category: flags.RedisCategory,
+	}
+	RedisSimulateFlag = &cli.BoolFlag{
+		Name:     "redis.simulate",
+		Usage:    "Execute pending transactions on the head state and store their outcome in Redis",
+		Category: flags.RedisCategory,
+	}
+	RedisSimulateBudgetFlag = &cli.DurationFlag{
+		Name:     "redis.simulate.budget",
+		Usage:    "Execution time spent on simulating pending transactions per head",
+		Value:    ethconfig.Defaults.Redis.SimulateBudget,
+		Category: flags.RedisCategory,
+	}
+	RedisElectionFlag = &cli.BoolFlag{
+		Name:     "redis.election",
+		Usage:    "Elect a single exporter among the nodes sharing the Redis deployment",
+		Category: flags.RedisCategory,
+	}
+	RedisElectionLeaseFlag = &cli.DurationFlag{
+		Name:     "redis.election.lease",
+		Usage:    "Duration of the Redis exporter lease, renewed every third of it",
+		Value:    ethconfig.Defaults.Redis.ElectionLease,
+		Category: flags.RedisCategory,
+	}
+	RedisNodeIDFlag = &cli.StringFlag{
+		Name:     "redis.nodeid",
+		Usage:    "Identity of this node in the Redis exporter election (default = random per run)",
+		Category: flags.RedisCategory,
+	}
+	RedisCompressFlag = &cli.BoolFlag{
+		Name:     "redis.compress",
+		Usage:    "Compress exported transaction and log lists with zlib",
+		Category: flags.RedisCategory,
+	}
 	// Performance tuning settings
 	CacheFlag = &cli.IntFlag{
 		Name:     "cache",
@@ -988,6 +1212,50 @@ var (
 		StateSchemeFlag,
 		HttpHeaderFlag,
 	}
+
+	// RedisFlags is the flag group of all Redis export flags.
+	RedisFlags = []cli.Flag{
+		RedisEnabledFlag,
+		RedisModeFlag,
+		RedisMasterNameFlag,
+		RedisNetworkFlag,
+		RedisAddrFlag,
+		RedisUserFlag,
+		RedisPasswordFileFlag,
+		RedisDBFlag,
+		RedisKeyPrefixFlag,
+		RedisTLSFlag,
+		RedisTLSCAFlag,
+		RedisTLSCertFlag,
+		RedisTLSKeyFlag,
+		RedisTLSInsecureFlag,
+		RedisPoolSizeFlag,
+		RedisMinIdleFlag,
+		RedisRetriesFlag,
+		RedisRetryDelayFlag,
+		RedisDialTimeoutFlag,
+		RedisQueueSizeFlag,
+		RedisSpoolFlag,
+		RedisBlobSidecarsFlag,
+		RedisStreamMaxLenFlag,
+		RedisStreamGroupsFlag,
+		RedisLogIndexFlag,
+		RedisLogIndexRetentionFlag,
+		RedisLogIndexRPCFlag,
+		RedisRetentionBlocksFlag,
+		RedisRetentionLogsFlag,
+		RedisRetentionReceiptsFlag,
+		RedisRetentionPendingTxsFlag,
+		RedisRetentionMinedTxsFlag,
+		RedisIngestFlag,
+		RedisIngestGroupFlag,
+		RedisSimulateFlag,
+		RedisSimulateBudgetFlag,
+		RedisElectionFlag,
+		RedisElectionLeaseFlag,
+		RedisNodeIDFlag,
+		RedisCompressFlag,
+	}
 )
 
 // default account to prefund when running Geth in dev mode
@@ -1509,6 +1777,130 @@ func setBlobPool(ctx *cli.Context, cfg *blobpool.Config) {
 	}
 }
 
+// SetRedisConfig applies Redis export related command line flags to the config.
+func SetRedisConfig(ctx *cli.Context, cfg *redisstore.Config) {
+	if ctx.IsSet(RedisEnabledFlag.Name) {
+		cfg.Enabled = ctx.Bool(RedisEnabledFlag.Name)
+	}
+	if ctx.IsSet(RedisModeFlag.Name) {
+		cfg.Mode = ctx.String(RedisModeFlag.Name)
+	}
+	if ctx.IsSet(RedisMasterNameFlag.Name) {
+		cfg.MasterName = ctx.String(RedisMasterNameFlag.Name)
+	}
+	if ctx.IsSet(RedisNetworkFlag.Name) {
+		cfg.Network = ctx.String(RedisNetworkFlag.Name)
+	}
+	if ctx.IsSet(RedisAddrFlag.Name) {
+		cfg.Address = ctx.String(RedisAddrFlag.Name)
+	}
+	if ctx.IsSet(RedisUserFlag.Name) {
+		cfg.Username = ctx.String(RedisUserFlag.Name)
+	}
+	if ctx.IsSet(RedisPasswordFileFlag.Name) {
+		cfg.PasswordFile = ctx.Path(RedisPasswordFileFlag.Name)
+	}
+	if ctx.IsSet(RedisDBFlag.Name) {
+		cfg.DB = ctx.Int(RedisDBFlag.Name)
+	}
+	if ctx.IsSet(RedisKeyPrefixFlag.Name) {
+		cfg.KeyPrefix = ctx.String(RedisKeyPrefixFlag.Name)
+	}
+	if ctx.IsSet(RedisTLSFlag.Name) {
+		cfg.TLS = ctx.Bool(RedisTLSFlag.Name)
+	}
+	if ctx.IsSet(RedisTLSCAFlag.Name) {
+		cfg.TLSCAFile = ctx.Path(RedisTLSCAFlag.Name)
+	}
+	if ctx.IsSet(RedisTLSCertFlag.Name) {
+		cfg.TLSCertFile = ctx.Path(RedisTLSCertFlag.Name)
+	}
+	if ctx.IsSet(RedisTLSKeyFlag.Name) {
+		cfg.TLSKeyFile = ctx.Path(RedisTLSKeyFlag.Name)
+	}
+	if ctx.IsSet(RedisTLSInsecureFlag.Name) {
+		cfg.TLSInsecureSkipVerify = ctx.Bool(RedisTLSInsecureFlag.Name)
+	}
+	if ctx.IsSet(RedisPoolSizeFlag.Name) {
+		cfg.PoolSize = ctx.Int(RedisPoolSizeFlag.Name)
+	}
+	if ctx.IsSet(RedisMinIdleFlag.Name) {
+		cfg.MinIdle = ctx.Int(RedisMinIdleFlag.Name)
+	}
+	if ctx.IsSet(RedisRetriesFlag.Name) {
+		cfg.MaxRetries = ctx.Int(RedisRetriesFlag.Name)
+	}
+	if ctx.IsSet(RedisRetryDelayFlag.Name) {
+		cfg.RetryDelay = ctx.Duration(RedisRetryDelayFlag.Name)
+	}
+	if ctx.IsSet(RedisDialTimeoutFlag.Name) {
+		cfg.DialTimeout = ctx.Duration(RedisDialTimeoutFlag.Name)
+	}
+	if ctx.IsSet(RedisQueueSizeFlag.Name) {
+		cfg.QueueSize = ctx.Int(RedisQueueSizeFlag.Name)
+	}
+	if ctx.IsSet(RedisSpoolFlag.Name) {
+		cfg.Spool = ctx.String(RedisSpoolFlag.Name)
+	}
+	if ctx.IsSet(RedisBlobSidecarsFlag.Name) {
+		cfg.BlobSidecars = ctx.Bool(RedisBlobSidecarsFlag.Name)
+	}
+	if ctx.IsSet(RedisStreamMaxLenFlag.Name) {
+		cfg.StreamMaxLen = ctx.Int64(RedisStreamMaxLenFlag.Name)
+	}
+	if ctx.IsSet(RedisStreamGroupsFlag.Name) {
+		cfg.StreamGroups = SplitAndTrim(ctx.String(RedisStreamGroupsFlag.Name))
+	}
+	if ctx.IsSet(RedisLogIndexFlag.Name) {
+		cfg.LogIndex = ctx.Bool(RedisLogIndexFlag.Name)
+	}
+	if ctx.IsSet(RedisLogIndexRetentionFlag.Name) {
+		cfg.LogIndexRetention = ctx.Uint64(RedisLogIndexRetentionFlag.Name)
+	}
+	if ctx.IsSet(RedisLogIndexRPCFlag.Name) {
+		cfg.LogIndexRPC = ctx.Bool(RedisLogIndexRPCFlag.Name)
+	}
+	for flag, policy := range map[*cli.StringFlag]*redisstore.RetentionPolicy{
+		RedisRetentionBlocksFlag:     &cfg.Retention.Blocks,
+		RedisRetentionLogsFlag:       &cfg.Retention.Logs,
+		RedisRetentionReceiptsFlag:   &cfg.Retention.Receipts,
+		RedisRetentionPendingTxsFlag: &cfg.Retention.PendingTxs,
+		RedisRetentionMinedTxsFlag:   &cfg.Retention.MinedTxs,
+	} {
+		if ctx.IsSet(flag.Name) {
+			retention, err := redisstore.ParseRetentionPolicy(ctx.String(flag.Name))
+			if err != nil {
+				Fatalf("Option %q: %v", flag.Name, err)
+			}
+			*policy = retention
+		}
+	}
+	if ctx.IsSet(RedisIngestFlag.Name) {
+		cfg.Ingest = ctx.Bool(RedisIngestFlag.Name)
+	}
+	if ctx.IsSet(RedisIngestGroupFlag.Name) {
+		cfg.IngestGroup = ctx.String(RedisIngestGroupFlag.Name)
+	}
+	if ctx.IsSet(RedisSimulateFlag.Name) {
+		cfg.Simulate = ctx.Bool(RedisSimulateFlag.Name)
+	}
+	if ctx.IsSet(RedisSimulateBudgetFlag.Name) {
+		cfg.SimulateBudget = ctx.Duration(RedisSimulateBudgetFlag.Name)
+	}
+	if ctx.IsSet(RedisElectionFlag.Name) {
+		cfg.Election = ctx.Bool(RedisElectionFlag.Name)
+	}
+	if ctx.IsSet(RedisElectionLeaseFlag.Name) {
+		cfg.ElectionLease = ctx.Duration(RedisElectionLeaseFlag.Name)
+	}
+	if ctx.IsSet(RedisNodeIDFlag.Name) {
+		cfg.NodeID = ctx.String(RedisNodeIDFlag.Name)
+	}
+	if ctx.IsSet(RedisCompressFlag.Name) {
+		cfg.CompressEnabled = ctx.Bool(RedisCompressFlag.Name)
+	}
+}
+
 func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.Bool(MiningEnabledFlag.Name) {
 		log.Warn("The flag --mine is deprecated and will be removed")
@@ -1570,6 +1962,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	setGPO(ctx, &cfg.GPO)
 	setTxPool(ctx, &cfg.TxPool)
 	setBlobPool(ctx, &cfg.BlobPool)
+	SetRedisConfig(ctx, &cfg.Redis)
 	setMiner(ctx, &cfg.Miner)
 	setRequiredBlocks(ctx, cfg)
 
@@ -1987,9 +2380,18 @@ func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, filterSyst
 
 // RegisterFilterAPI adds the eth log filtering RPC API to the node.
 func RegisterFilterAPI(stack *node.Node, backend ethapi.Backend, ethcfg *ethconfig.Config) *filters.FilterSystem {
-	filterSystem := filters.NewFilterSystem(backend, filters.Config{
+	filterConfig := filters.Config{
 		LogCacheSize: ethcfg.FilterLogCacheSize,
-	})
+	}
+	if ethcfg.Redis.IsEnabled() && ethcfg.Redis.LogIndexRPC {
+		// Log queries share the connection of the exporter
+		if b, ok := backend.(*eth.EthAPIBackend); ok && b.RedisExporter() != nil {
+			filterConfig.LogIndex = b.RedisExporter()
+		} else {
+			log.Warn("Redis log index unavailable for log queries, export not running")
+		}
+	}
+	filterSystem := filters.NewFilterSystem(backend, filterConfig)
 	stack.RegisterAPIs([]rpc.API{{
 		Namespace: "eth",
 		Service:   filters.NewFilterAPI(filterSystem),
@@ -39,7 +39,6 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
 	"github.com/ethereum/go-ethereum/core/history"
 	"github.com/ethereum/go-ethereum/core/rawdb"
-	"github.com/ethereum/go-ethereum/core/redisstore"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/stateless"
@@ -109,12 +108,6 @@ var (
 	blockPrefetchTxsInvalidMeter = metrics.NewRegisteredMeter("chain/prefetch/txs/invalid", nil)
 	blockPrefetchTxsValidMeter   = metrics.NewRegisteredMeter("chain/prefetch/txs/valid", nil)
 
-	// Redis transaction metrics
-	redisTxRemovalMeter      = metrics.NewRegisteredMeter("chain/redis/txremoval", nil)
-	redisTxRemovalErrorMeter = metrics.NewRegisteredMeter("chain/redis/txremoval/errors", nil)
-	redisTxReorgAddMeter     = metrics.NewRegisteredMeter("chain/redis/reorg/add", nil)
-	redisTxReorgErrorMeter   = metrics.NewRegisteredMeter("chain/redis/reorg/errors", nil)
-
 	errInsertionInterrupted = errors.New("insertion is interrupted")
 	errChainStopped         = errors.New("blockchain is stopped")
 	errInvalidOldChain      = errors.New("invalid old chain")
@@ -299,10 +292,6 @@ type BlockChain struct {
 	statedb       *state.CachingDB                 // State database to reuse between imports (contains state cache)
 	txIndexer     *txIndexer                       // Transaction indexer, might be nil if not enabled
 
-	// Redis integration
-	redisStore *redisstore.RedisBlockStore // Redis block and log storage
-	redisTxMgr *redisstore.TxManager       // Redis transaction manager
-
 	hc               *HeaderChain
 	rmLogsFeed       event.Feed
 	chainFeed        event.Feed
@@ -374,20 +363,6 @@ func NewBlockChain(db ethdb.Database, genesis *Genesis, engine consensus.Engine,
 	log.Info(strings.Repeat("-", 153))
 	log.Info("")
 
-	// Initialize Redis store with hardcoded configuration
-	redisStore, err := redisstore.NewRedisStore(redisstore.DefaultConfig())
-	if err != nil {
-		log.Error("Failed to initialize Redis store", "err", err)
-		return nil, fmt.Errorf("failed to initialize Redis store: %v", err)
-	}
-
-	// Initialize Redis transaction manager
-	redisTxMgr := redisstore.NewTxManager(redisStore)
-	if err := redisTxMgr.Init(); err != nil {
-		log.Error("Failed to initialize Redis transaction manager", "err", err)
-		return nil, fmt.Errorf("failed to initialize Redis transaction manager: %v", err)
-	}
-
 	bc := &BlockChain{
 		chainConfig:   chainConfig,
 		cfg:           cfg,
@@ -402,8 +377,6 @@ func NewBlockChain(db ethdb.Database, genesis *Genesis, engine consensus.Engine,
 		txLookupCache: lru.NewCache[common.Hash, txLookup](txLookupCacheLimit),
 		engine:        engine,
 		logger:        cfg.VmConfig.Tracer,
-		redisStore:    redisStore,
-		redisTxMgr:    redisTxMgr,
 	}
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.insertStopped)
 	if err != nil {
@@ -1244,63 +1217,6 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 		log.Crit("Failed to update chain indexes and markers", "err", err)
 	}
 
-	// Store block and logs in Redis, and remove mined transactions
-	if bc.redisStore != nil {
-		receipts := rawdb.ReadRawReceipts(bc.db, block.Hash(), block.NumberU64())
-		var logs []*types.Log
-
-		// Process logs from receipts while preserving transaction association
-		for txIndex, receipt := range receipts {
-			if txIndex < len(block.Transactions()) {
-				txHash := block.Transactions()[txIndex].Hash()
-				for logIndex, log := range receipt.Logs {
-					// Create a copy of the log with proper transaction association
-					fixedLog := &types.Log{
-						Address:     log.Address,
-						Topics:      log.Topics,
-						Data:        log.Data,
-						BlockNumber: block.NumberU64(),
-						TxHash:      txHash,
-						TxIndex:     uint(txIndex),
-						BlockHash:   block.Hash(),
-						Index:       uint(logIndex),
-						Removed:     log.Removed,
-					}
-					logs = append(logs, fixedLog)
-				}
-			}
-		}
-
-		// Store block, logs, and receipts in Redis
-		err := bc.redisStore.StoreBlock(block, logs)
-		if err != nil {
-			log.Error("Failed to store block in Redis", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
-		}
-
-		// Remove mined transactions from Redis mempool
-		if bc.redisTxMgr != nil {
-			// Update current block number in transaction manager
-			bc.redisTxMgr.UpdateCurrentBlockNumber(block.NumberU64())
-
-			txHashes := make([]common.Hash, len(block.Transactions()))
-			for i, tx := range block.Transactions() {
-				txHashes[i] = tx.Hash()
-			}
-
-			if len(txHashes) > 0 {
-				// Use goroutine to avoid blocking blockchain operations
-				go func(hashes []common.Hash, blockNum uint64) {
-					if err := bc.redisTxMgr.RemoveTxs(hashes); err != nil {
-						log.Error("Failed to remove mined transactions from Redis", "number", blockNum, "txCount", len(hashes), "err", err)
-						redisTxRemovalErrorMeter.Mark(1)
-					} else {
-						redisTxRemovalMeter.Mark(int64(len(hashes)))
-					}
-				}(txHashes, block.NumberU64())
-			}
-		}
-	}
-
 	// Update all in-memory chain markers in the last step
 	bc.hc.SetCurrentHeader(block.Header())
 
@@ -1345,18 +1261,6 @@ func (bc *BlockChain) stopWithoutSaving() {
 func (bc *BlockChain) Stop() {
 	bc.stopWithoutSaving()
 
-	// Close Redis connections
-	if bc.redisTxMgr != nil {
-		if err := bc.redisTxMgr.Close(); err != nil {
-			log.Error("Failed to close Redis transaction manager", "err", err)
-		}
-	}
-	if bc.redisStore != nil {
-		if err := bc.redisStore.Close(); err != nil {
-			log.Error("Failed to close Redis store", "err", err)
-		}
-	}
-
 	// Ensure that the entirety of the state snapshot is journaled to disk.
 	var snapBase common.Hash
 	if bc.snaps != nil {
@@ -2592,51 +2496,6 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Header) error
 	// Reset the tx lookup cache to clear stale txlookup cache.
 	bc.txLookupCache.Purge()
 
-	// Handle Redis transaction changes during reorg
-	if bc.redisTxMgr != nil {
-		// Transactions that were removed from canonical chain should be added back to mempool
-		orphanedTxs := types.HashDifference(deletedTxs, rebirthTxs)
-		if len(orphanedTxs) > 0 {
-			log.Debug("Re-adding orphaned transactions to Redis mempool during reorg", "count", len(orphanedTxs))
-
-			// Re-add orphaned transactions back to the mempool asynchronously
-			go func(txHashes []common.Hash, oldBlocks []*types.Header) {
-				addedCount := 0
-				for _, txHash := range txHashes {
-					// Find the transaction in the old blocks
-					var foundTx *types.Transaction
-					for i := 0; i < len(oldBlocks) && foundTx == nil; i++ {
-						block := bc.GetBlock(oldBlocks[i].Hash(), oldBlocks[i].Number.Uint64())
-						if block != nil {
-							for _, tx := range block.Transactions() {
-								if tx.Hash() == txHash {
-									foundTx = tx
-									break
-								}
-							}
-						}
-					}
-
-					if foundTx != nil {
-						if err := bc.redisTxMgr.StoreTx(foundTx); err != nil {
-							log.Error("Failed to re-add orphaned transaction to Redis", "hash", txHash, "err", err)
-							redisTxReorgErrorMeter.Mark(1)
-						} else {
-							addedCount++
-						}
-					} else {
-						log.Warn("Could not find orphaned transaction to re-add", "hash", txHash)
-					}
-				}
-				if addedCount > 0 {
-					redisTxReorgAddMeter.Mark(int64(addedCount))
-				}
-			}(orphanedTxs, oldChain)
-		}
-
-		// Note: Newly mined transactions are already handled by writeHeadBlock calls above
-	}
-
 	// Release the tx-lookup lock after mutation.
 	bc.txLookupLock.Unlock()
 
@@ -2913,50 +2772,3 @@ func (bc *BlockChain) SetTrieFlushInterval(interval time.Duration) {
 func (bc *BlockChain) GetTrieFlushInterval() time.Duration {
 	return time.Duration(bc.flushInterval.Load())
 }
-
-// RedisTxMgr returns the Redis transaction manager
-func (bc *BlockChain) RedisTxMgr() *redisstore.TxManager {
-	return bc.redisTxMgr
-}
-
-// ListRedisTransactions returns all transaction hashes currently in Redis (for debugging)
-func (bc *BlockChain) ListRedisTransactions() ([]string, error) {
-	if bc.redisTxMgr == nil {
-		return nil, fmt.Errorf("Redis transaction manager not initialized")
-	}
-	return bc.redisTxMgr.ListRedisTransactions()
-}
-
-// DebugRedisTransactionRemoval manually removes specific transaction hashes from Redis (for testing)
-func (bc *BlockChain) DebugRedisTransactionRemoval(txHashes []common.Hash) error {
-	if bc.redisTxMgr == nil {
-		return fmt.Errorf("Redis transaction manager not initialized")
-	}
-
-	log.Info("DEBUG: Manual Redis transaction removal", "txCount", len(txHashes), "hashes", txHashes)
-
-	// List what's in Redis before removal
-	beforeKeys, err := bc.redisTxMgr.ListRedisTransactions()
-	if err != nil {
-		log.Error("Failed to list Redis transactions before removal", "err", err)
-	} else {
-		log.Info("Redis transactions before removal", "count", len(beforeKeys))
-	}
-
-	// Perform removal
-	err = bc.redisTxMgr.RemoveTxs(txHashes)
-	if err != nil {
-		log.Error("DEBUG: Failed to remove transactions", "err", err)
-		return err
-	}
-
-	// List what's in Redis after removal
-	afterKeys, err := bc.redisTxMgr.ListRedisTransactions()
-	if err != nil {
-		log.Error("Failed to list Redis transactions after removal", "err", err)
-	} else {
-		log.Info("Redis transactions after removal", "count", len(afterKeys))
-	}
-
-	return nil
-}
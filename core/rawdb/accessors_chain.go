@@ -232,6 +232,22 @@ func WriteFinalizedBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// ReadRedisExportHash retrieves the hash of the last block exported into Redis.
+func ReadRedisExportHash(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(redisExportHeadKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteRedisExportHash stores the hash of the last block exported into Redis.
+func WriteRedisExportHash(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(redisExportHeadKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last redis export hash", "err", err)
+	}
+}
+
 // ReadLastPivotNumber retrieves the number of the last pivot block. If the node
 // full synced, the last pivot will always be nil.
 func ReadLastPivotNumber(db ethdb.KeyValueReader) *uint64 {
@@ -0,0 +1,140 @@
+package redisstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/go-redis/redis/v8"
+)
+
+// errExportStopped is returned by the API if the exporter is not running, either
+// because it failed to reach Redis on startup or because it is shutting down.
+var errExportStopped = errors.New("redis export not running")
+
+// APIs returns the RPC APIs controlling the exporter.
+func (e *Exporter) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "redis",
+			Service:   &API{e},
+		},
+	}
+}
+
+// API offers an RPC API to inspect and control the Redis export, e.g. to stop it
+// during Redis maintenance.
+type API struct {
+	e *Exporter
+}
+
+// ExportStatus reports the progress and health of the Redis export.
+type ExportStatus struct {
+	Node         string           `json:"node"`         // Identity of the node in the exporter election
+	Paused       bool             `json:"paused"`       // Whether the export was paused
+	Leading      bool             `json:"leading"`      // Whether the node exports, false if another node was elected
+	Queue        hexutil.Uint     `json:"queue"`        // Heads waiting for export
+	Head         hexutil.Uint64   `json:"head"`         // Current chain head
+	Exported     *hexutil.Uint64  `json:"exported"`     // Last exported block, nil if none yet
+	ExportedHash *common.Hash     `json:"exportedHash"` // Hash of the last exported block
+	Lag          hexutil.Uint64   `json:"lag"`          // Blocks the export is behind the head
+	Errors       hexutil.Uint64   `json:"errors"`       // Failed export attempts
+	TxQueue      hexutil.Uint     `json:"txQueue"`      // Pool transactions waiting to be mirrored
+	TxProcessed  hexutil.Uint64   `json:"txProcessed"`  // Pool transactions mirrored
+	TxErrors     hexutil.Uint64   `json:"txErrors"`     // Failed mempool mirror writes
+	Spooled      hexutil.Uint     `json:"spooled"`      // Mempool writes spooled for replay
+	Pool         *redis.PoolStats `json:"pool"`         // Redis connection pool statistics
+}
+
+// Status returns the progress of the export and the state of the connection.
+func (api *API) Status() (*ExportStatus, error) {
+	e := api.e
+	if e.store == nil {
+		return nil, errExportStopped
+	}
+	status := &ExportStatus{
+		Node:        e.node,
+		Paused:      e.paused.Load(),
+		Leading:     e.leading(),
+		Queue:       hexutil.Uint(len(e.heads)),
+		Errors:      hexutil.Uint64(e.failures.Load()),
+		TxQueue:     hexutil.Uint(len(e.txMgr.txQueue)),
+		TxProcessed: hexutil.Uint64(e.txMgr.processed.Load()),
+		TxErrors:    hexutil.Uint64(e.txMgr.errors.Load()),
+		Spooled:     hexutil.Uint(e.txMgr.spool.size()),
+		Pool:        e.store.client.PoolStats(),
+	}
+	if head := e.chain.CurrentBlock(); head != nil {
+		status.Head = hexutil.Uint64(head.Number.Uint64())
+	}
+	if exported := e.progress.Load(); exported != nil {
+		number, hash := hexutil.Uint64(exported.Number.Uint64()), exported.Hash()
+		status.Exported, status.ExportedHash = &number, &hash
+		if status.Head > number {
+			status.Lag = status.Head - number
+		}
+	}
+	return status, nil
+}
+
+// Resync exports the canonical block with the given number and all blocks after
+// it again, overwriting what Redis holds for them. Consumers see the blocks on
+// the event streams again.
+func (api *API) Resync(from hexutil.Uint64) error {
+	e := api.e
+	if e.store == nil {
+		return errExportStopped
+	}
+	if head := e.chain.CurrentBlock(); head == nil || uint64(from) > head.Number.Uint64() {
+		return fmt.Errorf("block #%d beyond the chain head", from)
+	}
+	req := &resyncRequest{from: uint64(from), errc: make(chan error, 1)}
+	select {
+	case e.resyncs <- req:
+	case <-e.quit:
+		return errExportStopped
+	}
+	if err := <-req.errc; err != nil {
+		return err
+	}
+	e.wake()
+	return nil
+}
+
+// Pause stops the export until resumed. Blocks imported meanwhile are exported
+// afterwards, pool transactions arriving meanwhile are picked up by the next
+// reconciliation of the mempool mirror.
+func (api *API) Pause() error {
+	e := api.e
+	if e.store == nil {
+		return errExportStopped
+	}
+	if !e.paused.Swap(true) {
+		log.Info("Paused Redis export")
+	}
+	return nil
+}
+
+// Resume restarts a paused export, verifying it against Redis first.
+func (api *API) Resume() error {
+	e := api.e
+	if e.store == nil {
+		return errExportStopped
+	}
+	if e.paused.Swap(false) {
+		log.Info("Resumed Redis export")
+		e.wake()
+	}
+	return nil
+}
+
+// wake queues the current head for export without waiting for the next block.
+func (e *Exporter) wake() {
+	select {
+	case e.kick <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,88 @@
+package redisstore
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// waitExported waits until the export worker acknowledged the given header.
+func waitExported(t *testing.T, e *Exporter, header *types.Header) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if exported := e.progress.Load(); exported != nil && exported.Hash() == header.Hash() {
+			return
+		}
+	}
+	t.Fatalf("Block #%d not exported", header.Number)
+}
+
+// Tests that the export can be paused, rewound and resumed through the API, and
+// that the status reflects it.
+func TestExportControl(t *testing.T) {
+	store, _ := newElectionStores(t)
+
+	var (
+		chain    = newTestChain()
+		headers  = chain.extend(&types.Header{Number: big.NewInt(100)}, 5, 0)
+		exporter = NewExporter(&DefaultConfig, rawdb.NewMemoryDatabase(), chain, nil)
+		api      = &API{exporter}
+	)
+	if _, err := api.Status(); err != errExportStopped {
+		t.Fatalf("Status of stopped export: %v", err)
+	}
+	exporter.store, exporter.txMgr = store, NewTxManager(store)
+
+	exporter.wg.Add(1)
+	go exporter.exportLoop()
+	defer exporter.wg.Wait()
+	defer close(exporter.heads)
+
+	exporter.enqueue(headers[2])
+	waitExported(t, exporter, headers[2])
+
+	status, err := api.Status()
+	if err != nil {
+		t.Fatalf("Failed to retrieve status: %v", err)
+	}
+	if status.Paused || !status.Leading || status.Exported == nil || uint64(*status.Exported) != headers[2].Number.Uint64() || status.Lag != 2 {
+		t.Errorf("Status mismatch: %+v", status)
+	}
+	if status.Pool == nil {
+		t.Errorf("Connection pool statistics missing")
+	}
+	// Rewind while paused, nothing is exported until resumed
+	if err := api.Pause(); err != nil {
+		t.Fatalf("Failed to pause export: %v", err)
+	}
+	exporter.enqueue(headers[4])
+
+	if err := api.Resync(hexutil.Uint64(headers[4].Number.Uint64() + 1)); err == nil {
+		t.Errorf("Resync beyond head accepted")
+	}
+	if err := api.Resync(hexutil.Uint64(headers[1].Number.Uint64())); err != nil {
+		t.Fatalf("Failed to resync export: %v", err)
+	}
+	if status, _ = api.Status(); !status.Paused || *status.ExportedHash != headers[0].Hash() || status.Lag != 4 {
+		t.Errorf("Status mismatch after resync: %+v", status)
+	}
+	if number, hash, _ := store.ExportCursor(); hash != headers[0].Hash() {
+		t.Errorf("Committed cursor not rewound: have #%d %x", number, hash)
+	}
+	if err := api.Resume(); err != nil {
+		t.Fatalf("Failed to resume export: %v", err)
+	}
+	exporter.enqueue(headers[4])
+	waitExported(t, exporter, headers[4])
+
+	for _, header := range headers[1:] {
+		if hash, _ := store.GetCanonicalHash(header.Number.Uint64()); hash != header.Hash() {
+			t.Errorf("Block #%d not exported again: have %x", header.Number, hash)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package redisstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Ways a pending transaction may reach the node.
+const (
+	TxSourceAnnounced = "announced" // Retrieved from a peer after it announced the hash
+	TxSourceBroadcast = "broadcast" // Pushed by a peer in full
+	TxSourceLocal     = "local"     // Not received from a peer, e.g. submitted over RPC
+)
+
+// arrivalCacheSize is the number of recent transaction deliveries remembered
+// until their transactions are mirrored. Deliveries are recorded before pool
+// admission, so the cache also holds transactions the pool rejected.
+const arrivalCacheSize = 1 << 16
+
+// TxArrival describes how the node first received a transaction.
+type TxArrival struct {
+	Time   time.Time // Time the transaction was first received
+	Peer   string    // ID of the delivering peer, empty for local transactions
+	Source string    // TxSourceAnnounced, TxSourceBroadcast or TxSourceLocal
+}
+
+// arrivalCache remembers the first arrival of recently received transactions.
+type arrivalCache struct {
+	cache lru.BasicLRU[common.Hash, TxArrival]
+	lock  sync.Mutex // Guards the check and insert of deliveries from concurrent peers
+}
+
+func newArrivalCache() *arrivalCache {
+	return &arrivalCache{cache: lru.NewBasicLRU[common.Hash, TxArrival](arrivalCacheSize)}
+}
+
+// add records the arrival of a batch of transactions delivered by a peer,
+// keeping earlier arrivals of the same transactions.
+func (c *arrivalCache) add(peer string, txs []*types.Transaction, announced bool, at time.Time) {
+	source := TxSourceBroadcast
+	if announced {
+		source = TxSourceAnnounced
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, tx := range txs {
+		if !c.cache.Contains(tx.Hash()) {
+			c.cache.Add(tx.Hash(), TxArrival{Time: at, Peer: peer, Source: source})
+		}
+	}
+}
+
+// get returns the first arrival of a transaction. Transactions not delivered by
+// a peer are reported as local ones, first seen when they were created or
+// decoded by the node.
+func (c *arrivalCache) get(tx *types.Transaction) TxArrival {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if arrival, ok := c.cache.Get(tx.Hash()); ok {
+		return arrival
+	}
+	return TxArrival{Time: tx.Time(), Source: TxSourceLocal}
+}
+
+// TxArrived records the delivery of a batch of transactions by a peer, before
+// they are admitted to the pool, so that the mirror reports when and where they
+// were first seen. Announced is set for transactions retrieved after their hash
+// was announced, and cleared for broadcasts.
+func (e *Exporter) TxArrived(peer string, txs []*types.Transaction, announced bool, at time.Time) {
+	e.arrivals.add(peer, txs, announced, at)
+}
@@ -0,0 +1,107 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that mirrored transactions carry the time and origin of their first
+// arrival, rather than the time they were written.
+func TestTxArrival(t *testing.T) {
+	node := newTestNode(t)
+
+	var (
+		remote = emitTx(0)
+		local  = emitTx(1)
+		first  = time.Unix(1700000000, 123000000)
+	)
+	node.exporter.TxArrived("peer-a", []*types.Transaction{remote}, true, first)
+	node.exporter.TxArrived("peer-b", []*types.Transaction{remote}, false, first.Add(time.Second))
+
+	for _, err := range node.pool.Add([]*types.Transaction{remote, local}, true) {
+		if err != nil {
+			t.Fatalf("Failed to add transaction: %v", err)
+		}
+	}
+	store := node.exporter.store
+	tests := []struct {
+		tx     *types.Transaction
+		peer   string
+		source string
+		seen   time.Time
+	}{
+		{tx: remote, peer: "peer-a", source: TxSourceAnnounced, seen: first},
+		{tx: local, peer: "", source: TxSourceLocal, seen: local.Time()},
+	}
+	for _, tt := range tests {
+		var fields map[string]string
+		waitFor(t, "mirrored transaction", func() bool {
+			fields, _ = node.backend.HGetAll(context.Background(), store.keys.txKey(tt.tx.Hash())).Result()
+			return len(fields) > 0
+		})
+		if fields["peer"] != tt.peer {
+			t.Errorf("%x: peer mismatch: have %q, want %q", tt.tx.Hash(), fields["peer"], tt.peer)
+		}
+		if fields["source"] != tt.source {
+			t.Errorf("%x: source mismatch: have %q, want %q", tt.tx.Hash(), fields["source"], tt.source)
+		}
+		if have := fields["timestamp"]; have != strconv.FormatInt(tt.seen.Unix(), 10) {
+			t.Errorf("%x: timestamp mismatch: have %s, want %d", tt.tx.Hash(), have, tt.seen.Unix())
+		}
+		if have := fields["seenMs"]; have != strconv.FormatInt(tt.seen.UnixMilli(), 10) {
+			t.Errorf("%x: seen time mismatch: have %s, want %d", tt.tx.Hash(), have, tt.seen.UnixMilli())
+		}
+	}
+	waitFor(t, "pending transaction events", func() bool {
+		return len(node.stream(t, PendingTxsStream)) == 2
+	})
+	for _, entry := range node.stream(t, PendingTxsStream) {
+		if entry["hash"] == strings.ToLower(remote.Hash().Hex()) && (entry["peer"] != "peer-a" || entry["source"] != TxSourceAnnounced) {
+			t.Errorf("Pending event origin mismatch: have %v/%v", entry["peer"], entry["source"])
+		}
+	}
+}
+
+// Tests that concurrent deliveries of the same transaction by several peers
+// keep exactly one of them as the first arrival.
+func TestTxArrivalConcurrent(t *testing.T) {
+	var (
+		cache = newArrivalCache()
+		tx    = emitTx(0)
+		start = time.Unix(1700000000, 0)
+		peers = 16
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < peers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.add(fmt.Sprintf("peer-%d", i), []*types.Transaction{tx}, false, start.Add(time.Duration(i)*time.Second))
+		}(i)
+	}
+	wg.Wait()
+
+	arrival := cache.get(tx)
+	if arrival.Source != TxSourceBroadcast {
+		t.Fatalf("Source mismatch: have %q, want %q", arrival.Source, TxSourceBroadcast)
+	}
+	var peer int
+	if _, err := fmt.Sscanf(arrival.Peer, "peer-%d", &peer); err != nil {
+		t.Fatalf("Unexpected peer %q", arrival.Peer)
+	}
+	// Later deliveries must not overwrite the peer or time of the kept arrival
+	if want := start.Add(time.Duration(peer) * time.Second); !arrival.Time.Equal(want) {
+		t.Errorf("Arrival of %s mismatch: have %v, want %v", arrival.Peer, arrival.Time, want)
+	}
+	cache.add("late", []*types.Transaction{tx}, true, start.Add(time.Hour))
+	if have := cache.get(tx); have != arrival {
+		t.Errorf("Arrival overwritten: have %+v, want %+v", have, arrival)
+	}
+}
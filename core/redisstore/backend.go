@@ -0,0 +1,113 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Cmdable is the subset of Redis commands the store relies on, with the same
+// signatures as in go-redis. It is available both directly on a Backend and on
+// its pipelines.
+type Cmdable interface {
+	Ping(ctx context.Context) *redis.StatusCmd
+
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	PTTL(ctx context.Context, key string) *redis.DurationCmd
+	RenameNX(ctx context.Context, key, newkey string) *redis.BoolCmd
+
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HMSet(ctx context.Context, key string, values ...interface{}) *redis.BoolCmd
+
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+	ZScore(ctx context.Context, key, member string) *redis.FloatCmd
+	ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd
+
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XLen(ctx context.Context, stream string) *redis.IntCmd
+	XRange(ctx context.Context, stream, start, stop string) *redis.XMessageSliceCmd
+	XRead(ctx context.Context, a *redis.XReadArgs) *redis.XStreamSliceCmd
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+}
+
+// Pipeliner queues commands until executed at once.
+type Pipeliner interface {
+	Cmdable
+
+	// Exec sends all queued commands, returning them along with the first
+	// error any of them failed with.
+	Exec(ctx context.Context) ([]redis.Cmder, error)
+}
+
+// Backend is the storage the store writes to. It is either a Redis deployment
+// reached through go-redis (NewRedisBackend), or an in-process emulation of the
+// commands the store relies on (NewMemoryBackend).
+type Backend interface {
+	Cmdable
+
+	// Pipeline starts a new pipeline of commands.
+	Pipeline() Pipeliner
+
+	// Scan iterates over the keys matching a pattern.
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+
+	// Info returns information and statistics about the server.
+	Info(ctx context.Context, section ...string) *redis.StringCmd
+
+	// PoolStats returns the statistics of the connection pool.
+	PoolStats() *redis.PoolStats
+
+	// Close releases all resources of the backend.
+	Close() error
+}
+
+// redisBackend is a Backend talking to a Redis deployment.
+type redisBackend struct {
+	redis.UniversalClient
+}
+
+// NewRedisBackend creates a Backend issuing its commands through a go-redis
+// client of a standalone, sentinel or cluster deployment.
+func NewRedisBackend(client redis.UniversalClient) Backend {
+	return &redisBackend{client}
+}
+
+// Pipeline implements Backend, starting a go-redis pipeline.
+func (b *redisBackend) Pipeline() Pipeliner {
+	return b.UniversalClient.Pipeline()
+}
+
+// clusterClient returns the go-redis cluster client behind a backend, if the
+// backend is a Redis Cluster.
+func clusterClient(backend Backend) (*redis.ClusterClient, bool) {
+	b, ok := backend.(*redisBackend)
+	if !ok {
+		return nil, false
+	}
+	cluster, ok := b.UniversalClient.(*redis.ClusterClient)
+	return cluster, ok
+}
@@ -0,0 +1,83 @@
+package redisstore
+
+import (
+	"fmt"
+)
+
+// exportBatch collects all writes of a block export, so that they reach Redis at
+// once. Outside of Redis Cluster the whole batch runs as a single script, so
+// consumers never observe a partially exported block. In a cluster the keys of a
+// block span many slots: the keys of the height and the derived keys are written
+// first in one pipeline, and the event streams and the export cursor, sharing the
+// slot of the chain, atomically once all of them succeeded.
+type exportBatch struct {
+	height *slotBatch // Keys of the block's height, fenced by the height fence
+	writes *slotBatch // Derived keys spread across slots (receipts, indexes, the mempool mirror)
+	chain  *slotBatch // Event streams and export cursor of the chain
+	done   []func()   // Callbacks run once the batch is committed
+}
+
+// newExportBatch creates an empty batch of writes.
+func newExportBatch() *exportBatch {
+	return &exportBatch{
+		height: new(slotBatch),
+		writes: new(slotBatch),
+		chain:  new(slotBatch),
+	}
+}
+
+// onCommit registers a callback to run once the batch is committed.
+func (b *exportBatch) onCommit(fn func()) {
+	b.done = append(b.done, fn)
+}
+
+// commit writes a batch into Redis, rejecting it with errFenced if a newer
+// exporter was elected meanwhile.
+func (s *RedisBlockStore) commit(batch *exportBatch) error {
+	if _, ok := clusterClient(s.client); !ok {
+		all := new(slotBatch)
+		all.merge(batch.height)
+		all.merge(batch.writes)
+		all.merge(batch.chain)
+		if err := s.writeSlot(all); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to write block: %w", err)
+		}
+	} else {
+		pipe := s.client.Pipeline()
+		if len(batch.height.cmds) > 0 {
+			s.evalSlot(pipe, batch.height)
+		}
+		for _, cmd := range batch.writes.cmds {
+			pipe.Do(s.ctx, cmd...)
+		}
+		if _, err := pipe.Exec(s.ctx); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to write block data: %w", fencedError(err))
+		}
+		if len(batch.chain.cmds) > 0 {
+			if err := s.writeSlot(batch.chain); err != nil {
+				redisErrorCounter.Inc(1)
+				return fmt.Errorf("failed to write block events: %w", err)
+			}
+		}
+	}
+	for _, fn := range batch.done {
+		fn()
+	}
+	return nil
+}
+
+// pipeline executes a batch of unfenced writes in a single round trip, without
+// atomicity. The written keys may span cluster slots.
+func (s *RedisBlockStore) pipeline(batch *slotBatch) error {
+	if len(batch.cmds) == 0 {
+		return nil
+	}
+	pipe := s.client.Pipeline()
+	for _, cmd := range batch.cmds {
+		pipe.Do(s.ctx, cmd...)
+	}
+	_, err := pipe.Exec(s.ctx)
+	return err
+}
@@ -0,0 +1,105 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/go-redis/redis/v8"
+)
+
+// scriptCounter is an in-process backend counting the scripts run on it.
+type scriptCounter struct {
+	*MemoryBackend
+	scripts int
+}
+
+func (c *scriptCounter) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	c.scripts++
+	return c.MemoryBackend.Eval(ctx, script, keys, args...)
+}
+
+// Tests that all writes of a block export are committed at once, and that a
+// fenced export leaves nothing behind.
+func TestCommitBlock(t *testing.T) {
+	backend := &scriptCounter{MemoryBackend: NewMemoryBackend()}
+
+	stores := make([]*RedisBlockStore, 2)
+	for i := range stores {
+		store, err := NewStore(testConfig(), backend)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		store.SetChainID(big.NewInt(1))
+		store.config.LogIndex = true
+		NewTxManager(store)
+		stores[i] = store
+	}
+	stale, fresh := stores[0], stores[1]
+	stale.SetFence(1)
+	fresh.SetFence(2)
+
+	_, blocks, receipts := core.GenerateChainWithGenesis(testGenesis, ethash.NewFaker(), 1, func(i int, gen *core.BlockGen) {
+		gen.AddTx(emitTx(0))
+	})
+	var (
+		block = blocks[0]
+		tx    = block.Transactions()[0]
+	)
+	if err := fresh.txManager.storeTxSync(tx); err != nil {
+		t.Fatalf("Failed to mirror transaction: %v", err)
+	}
+	// Claim the height for the fresh exporter, the stale one must not write anything
+	backend.Set(context.Background(), fresh.keys.heightFenceKey(1), 2, 0)
+
+	if err := stale.CommitBlock(block, receipts[0], testGenesis.Config); !errors.Is(err, errFenced) {
+		t.Fatalf("Stale export not fenced: %v", err)
+	}
+	for _, key := range []string{
+		fresh.keys.blockKey(1),
+		fresh.keys.blockHashKey(block.Hash()),
+		fresh.keys.receiptKey(tx.Hash()),
+		fresh.keys.txBlockKey(tx.Hash()),
+		fresh.keys.logIndexBlockKey(1),
+		fresh.keys.streamKey(BlocksStream),
+		fresh.keys.exportCursorKey(),
+	} {
+		if n, _ := backend.Exists(context.Background(), key).Result(); n != 0 {
+			t.Errorf("Fenced export wrote %s", key)
+		}
+	}
+	if n, _ := backend.Exists(context.Background(), fresh.keys.txKey(tx.Hash())).Result(); n != 1 {
+		t.Errorf("Fenced export removed mirrored transaction")
+	}
+	// The fresh exporter writes everything with a single script
+	backend.scripts = 0
+	if err := fresh.CommitBlock(block, receipts[0], testGenesis.Config); err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+	if backend.scripts != 1 {
+		t.Errorf("Scripts run mismatch: have %d, want 1", backend.scripts)
+	}
+	if receipt, _ := fresh.GetTxReceipt(tx.Hash()); receipt == nil {
+		t.Errorf("Receipt missing")
+	}
+	if n, _ := backend.Exists(context.Background(), fresh.keys.txKey(tx.Hash())).Result(); n != 0 {
+		t.Errorf("Mined transaction left in mirror")
+	}
+	checkHistory(t, fresh.txManager, tx.Hash(), TxStatusPending, TxStatusMined)
+
+	if number, hash, _ := fresh.ExportCursor(); number != 1 || hash != block.Hash() {
+		t.Errorf("Export cursor mismatch: have #%d %x", number, hash)
+	}
+	if n, _ := backend.XLen(context.Background(), fresh.keys.streamKey(LogsStream)).Result(); n != 1 {
+		t.Errorf("Log events mismatch: have %d, want 1", n)
+	}
+	// The block data expires as before
+	backend.FastForward(blockTTL + time.Second)
+	if hash, _ := fresh.GetCanonicalHash(1); hash == block.Hash() {
+		t.Errorf("Canonical marker did not expire")
+	}
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/go-redis/redis/v8"
+)
+
+// errNoHeader is returned for blocks written before headers were stored, by
+// schema versions below 5.
+var errNoHeader = errors.New("block stored without header")
+
+// blockKeyByHash returns the key of a block, canonical or not, via the hash
+// index.
+func (c *Client) blockKeyByHash(ctx context.Context, hash common.Hash) (string, error) {
+	number, err := c.rdb.Get(ctx, c.blockHashKey(hash)).Uint64()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read block hash index: %v", err)
+	}
+	canonical, err := c.rdb.Get(ctx, c.canonicalKey(number)).Result()
+	if err != nil && err != redis.Nil {
+		return "", fmt.Errorf("failed to read canonical marker: %v", err)
+	}
+	if canonical == strings.ToLower(hash.Hex()) {
+		return c.blockKey(number), nil
+	}
+	return c.siblingKey(number, hash), nil
+}
+
+// field returns a field of a block, decompressed if it is one of the large JSON
+// fields.
+func (c *Client) field(ctx context.Context, key, name string, compressed bool) ([]byte, error) {
+	blob, err := c.rdb.HGet(ctx, key, name).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %v", name, err)
+	}
+	if compressed {
+		if blob, err = c.decompress(blob); err != nil {
+			return nil, fmt.Errorf("failed to decompress block %s: %v", name, err)
+		}
+	}
+	return blob, nil
+}
+
+// HeaderByHash returns the header of a stored block, canonical or not.
+func (c *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	key, err := c.blockKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.header(ctx, key)
+}
+
+// HeaderByNumber returns the header of the canonical block at a height.
+func (c *Client) HeaderByNumber(ctx context.Context, number uint64) (*types.Header, error) {
+	return c.header(ctx, c.blockKey(number))
+}
+
+func (c *Client) header(ctx context.Context, key string) (*types.Header, error) {
+	fields, err := c.rdb.HMGet(ctx, key, "header", "hash").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block header: %v", err)
+	}
+	if fields[0] == nil {
+		if fields[1] == nil {
+			return nil, ErrNotFound
+		}
+		return nil, errNoHeader
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes([]byte(fields[0].(string)), header); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %v", err)
+	}
+	return header, nil
+}
+
+// BlockByHash returns a stored block, canonical or not, reconstructed from its
+// header, its uncles and withdrawals and its transactions. Transactions of type
+// 3 lack their blob sidecars.
+func (c *Client) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	key, err := c.blockKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.block(ctx, key)
+}
+
+// BlockByNumber returns the canonical block at a height, like BlockByHash.
+func (c *Client) BlockByNumber(ctx context.Context, number uint64) (*types.Block, error) {
+	return c.block(ctx, c.blockKey(number))
+}
+
+func (c *Client) block(ctx context.Context, key string) (*types.Block, error) {
+	fields, err := c.rdb.HMGet(ctx, key, "header", "body", "txs", "hash").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block: %v", err)
+	}
+	if fields[0] == nil {
+		if fields[3] == nil {
+			return nil, ErrNotFound
+		}
+		return nil, errNoHeader
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes([]byte(fields[0].(string)), header); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %v", err)
+	}
+	var body types.Body
+	if blob, ok := fields[1].(string); ok {
+		if err := rlp.DecodeBytes([]byte(blob), &body); err != nil {
+			return nil, fmt.Errorf("failed to decode block body: %v", err)
+		}
+	}
+	if blob, ok := fields[2].(string); ok {
+		txs, err := c.decompress([]byte(blob))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress transactions: %v", err)
+		}
+		if err := json.Unmarshal(txs, &body.Transactions); err != nil {
+			return nil, fmt.Errorf("failed to decode transactions: %v", err)
+		}
+	}
+	return types.NewBlockWithHeader(header).WithBody(body), nil
+}
+
+// BlockReceipts returns the receipts of a stored block, canonical or not.
+func (c *Client) BlockReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	key, err := c.blockKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.field(ctx, key, "receipts", true)
+	if err != nil {
+		return nil, err
+	}
+	var receipts types.Receipts
+	if err := json.Unmarshal(blob, &receipts); err != nil {
+		return nil, fmt.Errorf("failed to decode receipts: %v", err)
+	}
+	return receipts, nil
+}
+
+// BlockLogs returns the logs of a stored block, canonical or not.
+func (c *Client) BlockLogs(ctx context.Context, hash common.Hash) ([]*types.Log, error) {
+	key, err := c.blockKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.field(ctx, key, "logs", true)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	if err := json.Unmarshal(blob, &logs); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %v", err)
+	}
+	return logs, nil
+}
+
+// BlockStateDiff returns the net state changes of a stored block, keyed by
+// account. It is only available if the exporting node ran the statediff live
+// tracer.
+func (c *Client) BlockStateDiff(ctx context.Context, hash common.Hash) (map[common.Address]*AccountDiff, error) {
+	blob, err := c.rdb.Get(ctx, c.stateDiffKey(hash)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state diff: %v", err)
+	}
+	if blob, err = c.decompress(blob); err != nil {
+		return nil, fmt.Errorf("failed to decompress state diff: %v", err)
+	}
+	var accounts map[common.Address]*AccountDiff
+	if err := json.Unmarshal(blob, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode state diff: %v", err)
+	}
+	return accounts, nil
+}
+
+// TxLocation is the position of a transaction in the canonical chain.
+type TxLocation struct {
+	BlockHash   common.Hash
+	BlockNumber uint64
+	Index       uint64
+}
+
+// TransactionLocation returns the position of a transaction in the canonical
+// chain.
+func (c *Client) TransactionLocation(ctx context.Context, hash common.Hash) (*TxLocation, error) {
+	fields, err := c.rdb.HGetAll(ctx, c.txBlockKey(hash)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction location: %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+	loc := &TxLocation{BlockHash: common.HexToHash(fields["blockHash"])}
+	if loc.BlockNumber, err = strconv.ParseUint(fields["blockNumber"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid block number of transaction %x: %v", hash, err)
+	}
+	if loc.Index, err = strconv.ParseUint(fields["transactionIndex"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid index of transaction %x: %v", hash, err)
+	}
+	return loc, nil
+}
+
+// TransactionByHash returns a transaction of the canonical chain or of the pool
+// mirror, and whether it is still pending.
+func (c *Client) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	loc, err := c.TransactionLocation(ctx, hash)
+	if errors.Is(err, ErrNotFound) {
+		tx, err := c.PoolTransaction(ctx, hash)
+		if err != nil {
+			return nil, false, err
+		}
+		return tx.Tx, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := c.blockKeyByHash(ctx, loc.BlockHash)
+	if err != nil {
+		return nil, false, err
+	}
+	blob, err := c.field(ctx, key, "txs", true)
+	if err != nil {
+		return nil, false, err
+	}
+	var txs []json.RawMessage
+	if err := json.Unmarshal(blob, &txs); err != nil {
+		return nil, false, fmt.Errorf("failed to decode transactions: %v", err)
+	}
+	if loc.Index >= uint64(len(txs)) {
+		return nil, false, fmt.Errorf("transaction index %d out of range of block %x", loc.Index, loc.BlockHash)
+	}
+	tx := new(types.Transaction)
+	if err := json.Unmarshal(txs[loc.Index], tx); err != nil {
+		return nil, false, fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	return tx, false, nil
+}
+
+// TransactionReceipt returns the receipt of a canonical transaction.
+func (c *Client) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	blob, err := c.rdb.Get(ctx, c.receiptKey(hash)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipt: %v", err)
+	}
+	receipt := new(types.Receipt)
+	if err := json.Unmarshal(blob, receipt); err != nil {
+		return nil, fmt.Errorf("failed to decode receipt: %v", err)
+	}
+	return receipt, nil
+}
+
+// PoolTx is a transaction of the mempool mirror, along with what the exporting
+// node knows about it.
+type PoolTx struct {
+	Tx     *types.Transaction
+	From   common.Address
+	Status string    // Pool status: pending or queued
+	Seen   time.Time // Time the node first received the transaction
+	Peer   string    // ID of the peer that delivered it first, empty for local transactions
+	Source string    // announced, broadcast or local
+	Head   uint64    // Chain head when the transaction was mirrored
+}
+
+// PoolTransaction returns a transaction of the mempool mirror.
+func (c *Client) PoolTransaction(ctx context.Context, hash common.Hash) (*PoolTx, error) {
+	fields, err := c.rdb.HGetAll(ctx, c.txKey(hash)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool transaction: %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+	raw, err := hexutil.Decode(fields["raw"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding of pool transaction %x: %v", hash, err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode pool transaction: %v", err)
+	}
+	ptx := &PoolTx{
+		Tx:     tx,
+		From:   common.HexToAddress(fields["from"]),
+		Status: fields["status"],
+		Peer:   fields["peer"],
+		Source: fields["source"],
+	}
+	if ms, err := strconv.ParseInt(fields["seenMs"], 10, 64); err == nil {
+		ptx.Seen = time.UnixMilli(ms)
+	} else if sec, err := strconv.ParseInt(fields["timestamp"], 10, 64); err == nil {
+		ptx.Seen = time.Unix(sec, 0)
+	}
+	ptx.Head, _ = strconv.ParseUint(fields["blockNumber"], 10, 64)
+	return ptx, nil
+}
@@ -0,0 +1,171 @@
+// Package client reads the chain data, mempool mirror and event streams
+// exported to Redis by package redisstore, decoding them into core/types values.
+//
+// The package only depends on go-redis and the core data types, so that services
+// consuming the exported data can do so without linking geth itself. The layout
+// it reads is documented in package redisstore.
+package client
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-redis/redis/v8"
+)
+
+// SchemaVersion is the newest layout version the client can read. It matches
+// redisstore.SchemaVersion.
+const SchemaVersion = 5
+
+var (
+	// ErrNotFound is returned when the requested data is not stored, or no
+	// longer retained.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNoSchema is returned by Open if no schema descriptor was recorded
+	// under the key prefix.
+	ErrNoSchema = errors.New("no schema descriptor")
+)
+
+// Reader is the subset of Redis commands the client relies on, with the same
+// signatures as in go-redis. It is implemented by all go-redis clients.
+type Reader interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	XRead(ctx context.Context, a *redis.XReadArgs) *redis.XStreamSliceCmd
+}
+
+// All go-redis clients can be read from.
+var _ Reader = (redis.UniversalClient)(nil)
+
+// Schema describes the data stored under a key prefix, so that consumers can
+// tell which chain and layout they are reading.
+type Schema struct {
+	Version    int      // Layout version, see SchemaVersion
+	ChainID    *big.Int // Chain the data belongs to
+	Prefix     string   // Prefix of all keys
+	Compressed bool     // Whether large JSON fields are zlib compressed
+	Updated    uint64   // Unix time the descriptor was last written
+}
+
+// ReadSchema returns the descriptor of the data stored under a key prefix, or
+// nil if none was recorded.
+func ReadSchema(ctx context.Context, rdb Reader, prefix string) (*Schema, error) {
+	fields, err := rdb.HGetAll(ctx, prefix+"schema").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema descriptor: %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	version, err := strconv.Atoi(fields["version"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema version: %v", err)
+	}
+	chainID, ok := new(big.Int).SetString(fields["chainId"], 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid schema chain id %q", fields["chainId"])
+	}
+	updated, _ := strconv.ParseUint(fields["updated"], 10, 64)
+	return &Schema{
+		Version:    version,
+		ChainID:    chainID,
+		Prefix:     fields["prefix"],
+		Compressed: fields["compressed"] == "1",
+		Updated:    updated,
+	}, nil
+}
+
+// Client reads the data of a chain exported to Redis.
+type Client struct {
+	rdb    Reader
+	schema Schema
+}
+
+// New creates a client reading the data described by a schema.
+func New(rdb Reader, schema *Schema) *Client {
+	return &Client{rdb: rdb, schema: *schema}
+}
+
+// Open creates a client reading the data stored under a key prefix, "<chainId>:"
+// unless configured otherwise in the exporter, as described by its schema
+// descriptor. Data written by a newer layout is rejected.
+func Open(ctx context.Context, rdb Reader, prefix string) (*Client, error) {
+	schema, err := ReadSchema(ctx, rdb, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("%w under prefix %q", ErrNoSchema, prefix)
+	}
+	if schema.Version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d, newest supported %d", schema.Version, SchemaVersion)
+	}
+	return New(rdb, schema), nil
+}
+
+// Schema returns the descriptor of the data read by the client.
+func (c *Client) Schema() Schema {
+	return c.schema
+}
+
+// Keys of the data read, see package redisstore for their layout.
+
+func (c *Client) blockKey(number uint64) string {
+	return fmt.Sprintf("%sblock:{%d}", c.schema.Prefix, number)
+}
+
+func (c *Client) siblingKey(number uint64, hash common.Hash) string {
+	return fmt.Sprintf("%sblock:{%d}:%s", c.schema.Prefix, number, strings.ToLower(hash.Hex()))
+}
+
+func (c *Client) blockHashKey(hash common.Hash) string {
+	return fmt.Sprintf("%sblockhash:%s", c.schema.Prefix, strings.ToLower(hash.Hex()))
+}
+
+func (c *Client) canonicalKey(number uint64) string {
+	return fmt.Sprintf("%scanonical:{%d}", c.schema.Prefix, number)
+}
+
+func (c *Client) receiptKey(hash common.Hash) string {
+	return fmt.Sprintf("%sreceipt:%s", c.schema.Prefix, strings.ToLower(hash.Hex()))
+}
+
+func (c *Client) txBlockKey(hash common.Hash) string {
+	return fmt.Sprintf("%stxblock:%s", c.schema.Prefix, hash.Hex())
+}
+
+func (c *Client) txKey(hash common.Hash) string {
+	return fmt.Sprintf("%stx:%s", c.schema.Prefix, hash.Hex())
+}
+
+func (c *Client) stateDiffKey(hash common.Hash) string {
+	return fmt.Sprintf("%sstatediff:%s", c.schema.Prefix, strings.ToLower(hash.Hex()))
+}
+
+func (c *Client) streamKey(name string) string {
+	return fmt.Sprintf("%sstream:{%s}:%s", c.schema.Prefix, c.schema.ChainID, name)
+}
+
+// decompress returns a large JSON field as stored, uncompressed.
+func (c *Client) decompress(blob []byte) ([]byte, error) {
+	if !c.schema.Compressed {
+		return blob, nil
+	}
+	r, err := zlib.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,265 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/redisstore"
+	"github.com/ethereum/go-ethereum/core/redisstore/client"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testEmitter = common.Address{0xee} // LOG0 of no data
+	testConfig  = params.MergedTestChainConfig
+	testSigner  = types.LatestSigner(testConfig)
+)
+
+// testExport is a chain exported into an in-process Redis emulation.
+type testExport struct {
+	backend  redisstore.Backend
+	store    *redisstore.RedisBlockStore
+	blocks   []*types.Block
+	receipts []types.Receipts
+}
+
+// newTestExport generates a chain of blocks, each with a log emitting call, a
+// transfer and a withdrawal, and exports the first few of them.
+func newTestExport(t *testing.T, n int, exported int) *testExport {
+	t.Helper()
+
+	gspec := &core.Genesis{
+		Config: testConfig,
+		Alloc: types.GenesisAlloc{
+			testAddr:    {Balance: big.NewInt(params.Ether)},
+			testEmitter: {Code: []byte{byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.LOG0), byte(vm.STOP)}},
+		},
+	}
+	_, blocks, receipts := core.GenerateChainWithGenesis(gspec, beacon.New(ethash.NewFaker()), n, func(i int, b *core.BlockGen) {
+		b.SetPoS()
+		for j, to := range []common.Address{testEmitter, {0xbb}} {
+			b.AddTx(types.MustSignNewTx(testKey, testSigner, &types.DynamicFeeTx{
+				ChainID:   testConfig.ChainID,
+				Nonce:     uint64(2*i + j),
+				To:        &to,
+				Value:     big.NewInt(int64(j)),
+				Gas:       50000,
+				GasFeeCap: b.BaseFee(),
+			}))
+		}
+		b.AddWithdrawal(&types.Withdrawal{Validator: uint64(i), Address: common.Address{0xcc}, Amount: 1})
+	})
+	config := redisstore.DefaultConfig
+	config.Spool = ""
+
+	backend := redisstore.NewMemoryBackend()
+	store, err := redisstore.NewStore(&config, backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(testConfig.ChainID)
+	if err := store.WriteSchema(); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	export := &testExport{backend: backend, store: store, blocks: blocks, receipts: receipts}
+	for i := 0; i < exported; i++ {
+		if err := export.commit(i); err != nil {
+			t.Fatalf("Failed to export block %d: %v", i, err)
+		}
+	}
+	return export
+}
+
+// commit exports the i-th block of the chain.
+func (e *testExport) commit(i int) error {
+	return e.store.CommitBlock(e.blocks[i], e.receipts[i], testConfig)
+}
+
+// open creates a client reading the exported chain.
+func (e *testExport) open(t *testing.T) *client.Client {
+	t.Helper()
+
+	c, err := client.Open(context.Background(), e.backend, redisstore.DefaultKeyPrefix(testConfig.ChainID))
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	return c
+}
+
+// Tests that exported blocks, transactions, receipts and logs are read back as
+// the values they were exported from.
+func TestReadChain(t *testing.T) {
+	var (
+		export = newTestExport(t, 2, 2)
+		c      = export.open(t)
+		ctx    = context.Background()
+	)
+	for i, want := range export.blocks {
+		byNumber, err := c.BlockByNumber(ctx, want.NumberU64())
+		if err != nil {
+			t.Fatalf("block %d: failed to read by number: %v", i, err)
+		}
+		byHash, err := c.BlockByHash(ctx, want.Hash())
+		if err != nil {
+			t.Fatalf("block %d: failed to read by hash: %v", i, err)
+		}
+		for _, have := range []*types.Block{byNumber, byHash} {
+			if have.Hash() != want.Hash() {
+				t.Errorf("block %d: hash mismatch: have %x, want %x", i, have.Hash(), want.Hash())
+			}
+			if len(have.Withdrawals()) != 1 || *have.Withdrawals()[0] != *want.Withdrawals()[0] {
+				t.Errorf("block %d: withdrawals mismatch: have %v", i, have.Withdrawals())
+			}
+			if len(have.Transactions()) != len(want.Transactions()) {
+				t.Fatalf("block %d: transaction count mismatch: have %d, want %d", i, len(have.Transactions()), len(want.Transactions()))
+			}
+			for j, tx := range have.Transactions() {
+				if tx.Hash() != want.Transactions()[j].Hash() {
+					t.Errorf("block %d: transaction %d mismatch: have %x, want %x", i, j, tx.Hash(), want.Transactions()[j].Hash())
+				}
+			}
+		}
+		if header, err := c.HeaderByNumber(ctx, want.NumberU64()); err != nil || header.Hash() != want.Hash() {
+			t.Errorf("block %d: header mismatch: %v", i, err)
+		}
+		receipts, err := c.BlockReceipts(ctx, want.Hash())
+		if err != nil || len(receipts) != len(want.Transactions()) {
+			t.Fatalf("block %d: failed to read receipts: %d, %v", i, len(receipts), err)
+		}
+		for j, receipt := range receipts {
+			if receipt.TxHash != want.Transactions()[j].Hash() || receipt.Status != types.ReceiptStatusSuccessful || receipt.BlockHash != want.Hash() {
+				t.Errorf("block %d: receipt %d mismatch: %+v", i, j, receipt)
+			}
+		}
+		logs, err := c.BlockLogs(ctx, want.Hash())
+		if err != nil || len(logs) != 1 || logs[0].Address != testEmitter || logs[0].TxHash != want.Transactions()[0].Hash() {
+			t.Errorf("block %d: logs mismatch: %v, %v", i, logs, err)
+		}
+		for j, tx := range want.Transactions() {
+			have, pending, err := c.TransactionByHash(ctx, tx.Hash())
+			if err != nil || pending || have.Hash() != tx.Hash() {
+				t.Errorf("block %d: transaction %d lookup mismatch: pending %v, %v", i, j, pending, err)
+			}
+			loc, err := c.TransactionLocation(ctx, tx.Hash())
+			if err != nil || loc.BlockHash != want.Hash() || loc.BlockNumber != want.NumberU64() || loc.Index != uint64(j) {
+				t.Errorf("block %d: transaction %d location mismatch: %+v, %v", i, j, loc, err)
+			}
+			receipt, err := c.TransactionReceipt(ctx, tx.Hash())
+			if err != nil || receipt.TxHash != tx.Hash() || receipt.GasUsed != export.receipts[i][j].GasUsed {
+				t.Errorf("block %d: transaction %d receipt mismatch: %+v, %v", i, j, receipt, err)
+			}
+		}
+	}
+	if _, err := c.BlockByNumber(ctx, 99); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Missing block error mismatch: have %v, want %v", err, client.ErrNotFound)
+	}
+	if _, _, err := c.TransactionByHash(ctx, common.Hash{0x01}); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Missing transaction error mismatch: have %v, want %v", err, client.ErrNotFound)
+	}
+	if _, err := client.Open(ctx, export.backend, "unknown:"); !errors.Is(err, client.ErrNoSchema) {
+		t.Errorf("Missing schema error mismatch: have %v, want %v", err, client.ErrNoSchema)
+	}
+}
+
+// Tests that transactions of the mempool mirror are read back along with their
+// sender and origin.
+func TestReadPoolTransaction(t *testing.T) {
+	export := newTestExport(t, 0, 0)
+
+	txs := redisstore.NewTxManager(export.store)
+	if err := txs.Init(); err != nil {
+		t.Fatalf("Failed to start transaction manager: %v", err)
+	}
+	defer txs.Close()
+
+	tx := types.MustSignNewTx(testKey, testSigner, &types.DynamicFeeTx{
+		ChainID:   testConfig.ChainID,
+		To:        &testEmitter,
+		Gas:       50000,
+		GasFeeCap: big.NewInt(params.InitialBaseFee),
+	})
+	if err := txs.StoreTx(tx); err != nil {
+		t.Fatalf("Failed to store transaction: %v", err)
+	}
+	c := export.open(t)
+
+	var (
+		ptx *client.PoolTx
+		err error
+	)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ptx, err = c.PoolTransaction(context.Background(), tx.Hash()); !errors.Is(err, client.ErrNotFound) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("Failed to read pool transaction: %v", err)
+	}
+	if ptx.Tx.Hash() != tx.Hash() || ptx.From != testAddr || ptx.Status != "pending" || ptx.Source != redisstore.TxSourceLocal {
+		t.Errorf("Pool transaction mismatch: %+v", ptx)
+	}
+	if have, pending, err := c.TransactionByHash(context.Background(), tx.Hash()); err != nil || !pending || have.Hash() != tx.Hash() {
+		t.Errorf("Pending transaction lookup mismatch: pending %v, %v", pending, err)
+	}
+}
+
+// Tests that subscriptions deliver the entries of several streams in publishing
+// order, and resume after the last one consumed.
+func TestSubscription(t *testing.T) {
+	var (
+		export = newTestExport(t, 4, 3)
+		c      = export.open(t)
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	next := func(sub *client.Subscription, stream string, number uint64) {
+		t.Helper()
+
+		ev, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		if ev.Stream != stream || ev.Number() != number {
+			t.Fatalf("Event mismatch: have %s #%d, want %s #%d", ev.Stream, ev.Number(), stream, number)
+		}
+		if stream == client.LogsStream {
+			if logs, err := ev.Logs(); err != nil || len(logs) != 1 || ev.Removed() {
+				t.Errorf("Logs event mismatch: %v, %v", logs, err)
+			}
+		}
+	}
+	sub := c.Subscribe(nil, client.BlocksStream, client.LogsStream)
+	next(sub, client.BlocksStream, 1)
+	next(sub, client.LogsStream, 1)
+	next(sub, client.BlocksStream, 2)
+
+	// A subscription resumed from a position continues after it
+	resumed := c.Subscribe(sub.Position(), client.BlocksStream, client.LogsStream)
+	next(resumed, client.LogsStream, 2)
+	next(resumed, client.BlocksStream, 3)
+	next(resumed, client.LogsStream, 3)
+
+	// Events published later are waited for
+	errc := make(chan error, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		errc <- export.commit(3)
+	}()
+	next(resumed, client.BlocksStream, 4)
+	if err := <-errc; err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AccountDiff is the net change a block made to an account. Unchanged fields
+// are nil.
+type AccountDiff struct {
+	Balance *BalanceDiff                 `json:"balance,omitempty"`
+	Nonce   *NonceDiff                   `json:"nonce,omitempty"`
+	Code    *CodeDiff                    `json:"code,omitempty"`
+	Storage map[common.Hash]*StorageDiff `json:"storage,omitempty"`
+}
+
+// BalanceDiff is the change of the balance of an account.
+type BalanceDiff struct {
+	From *hexutil.Big `json:"from"`
+	To   *hexutil.Big `json:"to"`
+}
+
+// NonceDiff is the change of the nonce of an account.
+type NonceDiff struct {
+	From hexutil.Uint64 `json:"from"`
+	To   hexutil.Uint64 `json:"to"`
+}
+
+// CodeDiff is the change of the code of an account, carrying both the previous
+// and the new code so that it can be rolled back.
+type CodeDiff struct {
+	From     common.Hash   `json:"from"`
+	To       common.Hash   `json:"to"`
+	FromCode hexutil.Bytes `json:"fromCode,omitempty"`
+	ToCode   hexutil.Bytes `json:"toCode,omitempty"`
+}
+
+// StorageDiff is the change of a storage slot.
+type StorageDiff struct {
+	From common.Hash `json:"from"`
+	To   common.Hash `json:"to"`
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-redis/redis/v8"
+)
+
+// Names of the event streams published for every chain.
+const (
+	BlocksStream     = "blocks"     // New canonical blocks
+	LogsStream       = "logs"       // Logs of new canonical blocks, and removed logs of reorged ones
+	PendingTxsStream = "pendingTxs" // Transactions entering the mempool mirror
+	DroppedTxsStream = "droppedTxs" // Transactions leaving the mempool mirror without being mined
+	ReorgsStream     = "reorgs"     // Chain reorganisations
+	StateDiffsStream = "stateDiffs" // State diffs of new canonical blocks, and rollbacks of reorged ones
+)
+
+const (
+	// subscriptionBatch is the maximum number of entries read from a stream
+	// at once.
+	subscriptionBatch = 256
+
+	// subscriptionWait is how long a read waits for new entries before the
+	// subscription checks whether it was cancelled.
+	subscriptionWait = time.Second
+)
+
+// Event is an entry of an exported event stream. Its fields are described in
+// package redisstore.
+type Event struct {
+	Stream string            // Name of the stream, e.g. BlocksStream
+	ID     string            // Entry ID within the stream
+	Cursor uint64            // Position of the entry among all streams of the chain
+	Values map[string]string // Fields of the entry
+}
+
+// newEvent converts a stream entry into an event.
+func newEvent(stream string, msg redis.XMessage) *Event {
+	ev := &Event{Stream: stream, ID: msg.ID, Values: make(map[string]string, len(msg.Values))}
+	for name, value := range msg.Values {
+		ev.Values[name] = fmt.Sprint(value)
+	}
+	ev.Cursor, _ = strconv.ParseUint(ev.Values["cursor"], 10, 64)
+	return ev
+}
+
+// Number returns the block number of a block, logs or state diff event.
+func (ev *Event) Number() uint64 {
+	number, _ := strconv.ParseUint(ev.Values["number"], 10, 64)
+	return number
+}
+
+// Hash returns the block hash of a block, logs or state diff event, or the
+// transaction hash of a pool event.
+func (ev *Event) Hash() common.Hash {
+	return common.HexToHash(ev.Values["hash"])
+}
+
+// Removed reports whether a logs or state diff event rolls back a block dropped
+// by a reorg.
+func (ev *Event) Removed() bool {
+	return ev.Values["removed"] == "1"
+}
+
+// Unavailable reports whether a state diff event announces a block whose diff
+// was not recorded, e.g. as the exporter fell too far behind. Such events carry
+// no accounts.
+func (ev *Event) Unavailable() bool {
+	return ev.Values["unavailable"] == "1"
+}
+
+// Logs decodes the logs of a logs event.
+func (ev *Event) Logs() ([]*types.Log, error) {
+	var logs []*types.Log
+	if err := json.Unmarshal([]byte(ev.Values["logs"]), &logs); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %v", err)
+	}
+	return logs, nil
+}
+
+// Accounts decodes the changed accounts of a state diff event.
+func (ev *Event) Accounts() (map[common.Address]*AccountDiff, error) {
+	var accounts map[common.Address]*AccountDiff
+	if err := json.Unmarshal([]byte(ev.Values["accounts"]), &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode state diff: %v", err)
+	}
+	return accounts, nil
+}
+
+// Position is the point a subscription resumes from: the ID of the last entry
+// consumed per stream. Streams missing from it are read from their oldest
+// retained entry.
+type Position map[string]string
+
+// Subscription follows a set of event streams of a chain, delivering their
+// entries in publishing order. It is not safe for concurrent use.
+type Subscription struct {
+	client  *Client
+	streams []string          // Names of the streams followed
+	read    map[string]string // ID of the last entry read per stream
+	pos     Position          // ID of the last entry delivered per stream
+	queue   []*Event          // Entries read but not delivered yet, in publishing order
+}
+
+// Subscribe follows the named event streams of the chain, starting after the
+// given position. Entries trimmed from a stream before they are read are
+// skipped.
+func (c *Client) Subscribe(from Position, streams ...string) *Subscription {
+	sub := &Subscription{
+		client:  c,
+		streams: streams,
+		read:    make(map[string]string, len(streams)),
+		pos:     make(Position, len(streams)),
+	}
+	for _, name := range streams {
+		id := from[name]
+		if id == "" {
+			id = "0-0"
+		}
+		sub.read[name], sub.pos[name] = id, id
+	}
+	return sub
+}
+
+// Next returns the next event of the followed streams, waiting for one until
+// the context is cancelled.
+func (s *Subscription) Next(ctx context.Context) (*Event, error) {
+	for len(s.queue) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.fill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ev := s.queue[0]
+	s.queue = s.queue[1:]
+	s.pos[ev.Stream] = ev.ID
+	return ev, nil
+}
+
+// Position returns the position after the last event returned by Next, to
+// resume from later.
+func (s *Subscription) Position() Position {
+	return maps.Clone(s.pos)
+}
+
+// fill reads the next entries of the followed streams into the queue, ordered
+// by cursor. The streams of a chain share a cluster slot, so a read observes
+// them all at the same point. Entries beyond the last one of a stream that had
+// more to read than a batch are left for the next read, which may return more
+// entries preceding them.
+func (s *Subscription) fill(ctx context.Context) error {
+	var (
+		keys  = make([]string, 0, 2*len(s.streams))
+		ids   = make([]string, 0, len(s.streams))
+		names = make(map[string]string, len(s.streams))
+	)
+	for _, name := range s.streams {
+		key := s.client.streamKey(name)
+		keys, ids = append(keys, key), append(ids, s.read[name])
+		names[key] = name
+	}
+	streams, err := s.client.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: append(keys, ids...),
+		Count:   subscriptionBatch,
+		Block:   subscriptionWait,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read streams: %v", err)
+	}
+	var (
+		events []*Event
+		limit  = uint64(math.MaxUint64)
+	)
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			events = append(events, newEvent(names[stream.Stream], msg))
+		}
+		if len(stream.Messages) == subscriptionBatch {
+			limit = min(limit, events[len(events)-1].Cursor)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Cursor < events[j].Cursor
+	})
+	for _, ev := range events {
+		if ev.Cursor > limit {
+			break
+		}
+		s.queue = append(s.queue, ev)
+		s.read[ev.Stream] = ev.ID
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package redisstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// In cluster mode, every command touching multiple keys must keep them within a
+// single hash slot. Multi-key deletions are therefore issued key by key through
+// pipelines, which the cluster client splits by node, and scripts only ever get
+// the keys of one slot.
+
+// deleteIfEqualScript deletes a key if it holds the given value, returning the
+// number of deleted keys.
+//
+//	KEYS[1]  key
+//	ARGV[1]  expected value
+const deleteIfEqualScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// scanKeys calls fn with every key matching a pattern. In cluster mode all
+// primaries are scanned, as SCAN only covers the node it is sent to. The calls
+// to fn are serialized, but keys may be reported out of order.
+func scanKeys(ctx context.Context, client Backend, pattern string, fn func(key string) error) error {
+	var lock sync.Mutex
+	scan := func(ctx context.Context, client interface {
+		Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	}) error {
+		iter := client.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			lock.Lock()
+			err := fn(iter.Val())
+			lock.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+	if cluster, ok := clusterClient(client); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	}
+	return scan(ctx, client)
+}
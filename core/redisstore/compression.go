@@ -13,7 +13,7 @@ func SetConfig(cfg *Config) {
 }
 
 func Compress(data []byte) ([]byte, error) {
-	if config != nil && !config.CompressEnabled {
+	if config == nil || !config.CompressEnabled {
 		return data, nil
 	}
 	var b bytes.Buffer
@@ -27,7 +27,7 @@ func Compress(data []byte) ([]byte, error) {
 }
 
 func Decompress(data []byte) ([]byte, error) {
-	if config != nil && !config.CompressEnabled {
+	if config == nil || !config.CompressEnabled {
 		return data, nil
 	}
 	b := bytes.NewReader(data)
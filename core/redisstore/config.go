@@ -1,41 +1,334 @@
 package redisstore
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/go-redis/redis/v8"
+)
+
+// Deployment modes of the Redis server.
+const (
+	ModeStandalone = "standalone" // Single server, possibly a replicated primary behind a fixed address
+	ModeSentinel   = "sentinel"   // Primary discovered and failed over by Redis Sentinel
+	ModeCluster    = "cluster"    // Redis Cluster, keys sharded across primaries by hash slot
 )
 
-// Config holds the Redis configuration with hardcoded values
+// Config holds the Redis export configuration.
 type Config struct {
-	Enabled         bool
-	Network         string // "unix"
-	Address         string // Unix socket path
-	Username        string
-	Password        string
-	DB              int
-	PoolSize        int
-	MinIdle         int
-	MaxRetries      int
-	RetryDelay      time.Duration
-	CompressEnabled bool // Enable/disable compression
-}
-
-func DefaultConfig() *Config {
-	return &Config{
-		Enabled:         true,
-		Network:         "unix",
-		Address:         "/media/redis/local.sock",
-		Username:        "root",
-		Password:        "root",
-		DB:              0,
-		PoolSize:        100,
-		MinIdle:         10,
-		MaxRetries:      3,
-		RetryDelay:      time.Second * 2,
-		CompressEnabled: false,
-	}
+	Enabled bool   // Whether chain data is exported to Redis at all
+	Mode    string // Deployment mode, "standalone", "sentinel" or "cluster"
+	Network string // Connection type, "tcp" or "unix"
+	Address string // Host:port for tcp, socket path for unix, comma separated sentinel or seed nodes otherwise
+
+	MasterName       string // Name of the primary monitored by the sentinels
+	SentinelPassword string `toml:",omitempty"` // Password of the sentinels, if different from the server's
+
+	Username     string // ACL user name, empty for the default user
+	Password     string `toml:",omitempty"` // ACL password, prefer PasswordFile
+	PasswordFile string `toml:",omitempty"` // File containing the ACL password
+	DB           int    // Logical database index
+	KeyPrefix    string // Prefix of all keys, "<chainId>:" if empty
+
+	TLS                   bool   // Whether to connect over TLS
+	TLSCAFile             string `toml:",omitempty"` // CA bundle used to verify the server
+	TLSCertFile           string `toml:",omitempty"` // Client certificate for mutual TLS
+	TLSKeyFile            string `toml:",omitempty"` // Client key for mutual TLS
+	TLSInsecureSkipVerify bool   `toml:",omitempty"` // Skip server certificate verification
+
+	PoolSize    int           // Maximum number of socket connections
+	MinIdle     int           // Minimum number of idle connections kept open
+	MaxRetries  int           // Maximum number of retries before giving up on a command
+	RetryDelay  time.Duration // Minimum backoff between retries
+	DialTimeout time.Duration // Timeout for establishing new connections
+
+	QueueSize int    // Maximum number of chain heads waiting for export
+	Spool     string // Disk spool of mempool writes that failed to reach Redis
+
+	BlobSidecars bool // Whether blob sidecar commitments and proofs of pool transactions are stored
+
+	StreamMaxLen int64    // Approximate number of entries retained per event stream, 0 for unbounded
+	StreamGroups []string `toml:",omitempty"` // Consumer groups created on every event stream
+
+	LogIndex          bool   // Whether canonical logs are indexed by address and first topic
+	LogIndexRetention uint64 // Number of recent blocks kept in the log index, 0 for all
+	LogIndexRPC       bool   // Whether eth_getLogs falls back to the log index for ranges not indexed locally
+
+	Retention Retention // Retention of the exported data, per class
+
+	Ingest      bool   // Whether transactions appended to the ingest stream are submitted to the pool
+	IngestGroup string // Consumer group the ingest stream is read in, shared by the nodes submitting
+
+	Simulate       bool          // Whether pending transactions are executed on the head state and their outcome stored
+	SimulateBudget time.Duration // Execution time spent on simulations per head
+
+	Election      bool          // Whether the nodes sharing the deployment elect a single exporter
+	ElectionLease time.Duration // Duration of the exporter lease, renewed every third of it
+	NodeID        string        `toml:",omitempty"` // Identity of the node in the election, random per run if empty
+
+	CompressEnabled bool // Whether large JSON fields are zlib compressed
+}
+
+// DefaultConfig contains the default Redis export settings. Exporting is
+// disabled unless explicitly requested.
+var DefaultConfig = Config{
+	Enabled:      false,
+	Mode:         ModeStandalone,
+	Network:      "tcp",
+	Address:      "127.0.0.1:6379",
+	DB:           0,
+	PoolSize:     100,
+	MinIdle:      10,
+	MaxRetries:   3,
+	RetryDelay:   2 * time.Second,
+	DialTimeout:  5 * time.Second,
+	QueueSize:    64,
+	Spool:        "redis-spool.rlp",
+	StreamMaxLen: 100000,
+
+	Retention: Retention{
+		Blocks:     RetentionPolicy{Age: blockTTL},
+		Logs:       RetentionPolicy{Age: blockTTL},
+		Receipts:   RetentionPolicy{Age: blockTTL},
+		PendingTxs: RetentionPolicy{Age: txTTL},
+		MinedTxs:   RetentionPolicy{Age: blockTTL},
+	},
+
+	IngestGroup: "geth",
+
+	SimulateBudget: 500 * time.Millisecond,
+
+	ElectionLease: 10 * time.Second,
 }
 
 // IsEnabled returns whether Redis storage is enabled
 func (c *Config) IsEnabled() bool {
-	return c.Enabled
+	return c != nil && c.Enabled
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (c *Config) sanitize() Config {
+	conf := *c
+	if path, ok := strings.CutPrefix(conf.Address, "unix://"); ok {
+		conf.Network, conf.Address = "unix", path
+	}
+	if conf.Mode == "" {
+		conf.Mode = ModeStandalone
+	}
+	if conf.Mode != ModeStandalone && conf.Mode != ModeSentinel && conf.Mode != ModeCluster {
+		log.Warn("Sanitizing invalid redis mode", "provided", conf.Mode, "updated", DefaultConfig.Mode)
+		conf.Mode = DefaultConfig.Mode
+	}
+	if conf.Mode != ModeStandalone && conf.Network == "unix" {
+		log.Warn("Sanitizing invalid redis network", "mode", conf.Mode, "provided", conf.Network, "updated", "tcp")
+		conf.Network = "tcp"
+	}
+	if conf.Mode == ModeCluster && conf.DB != 0 {
+		log.Warn("Sanitizing invalid redis database for cluster", "provided", conf.DB, "updated", 0)
+		conf.DB = 0
+	}
+	if conf.Network == "" {
+		if strings.HasPrefix(conf.Address, "/") {
+			conf.Network = "unix"
+		} else {
+			conf.Network = "tcp"
+		}
+	}
+	if conf.Network != "tcp" && conf.Network != "unix" {
+		log.Warn("Sanitizing invalid redis network", "provided", conf.Network, "updated", DefaultConfig.Network)
+		conf.Network = DefaultConfig.Network
+	}
+	if strings.ContainsAny(conf.KeyPrefix, "{}*?[]\\") {
+		log.Warn("Sanitizing invalid redis key prefix", "provided", conf.KeyPrefix, "updated", DefaultConfig.KeyPrefix)
+		conf.KeyPrefix = DefaultConfig.KeyPrefix
+	}
+	if conf.Address == "" {
+		log.Warn("Sanitizing invalid redis address", "provided", conf.Address, "updated", DefaultConfig.Address)
+		conf.Address = DefaultConfig.Address
+	}
+	if conf.PoolSize < 1 {
+		log.Warn("Sanitizing invalid redis pool size", "provided", conf.PoolSize, "updated", DefaultConfig.PoolSize)
+		conf.PoolSize = DefaultConfig.PoolSize
+	}
+	if conf.MinIdle < 0 || conf.MinIdle > conf.PoolSize {
+		log.Warn("Sanitizing invalid redis idle connections", "provided", conf.MinIdle, "updated", min(DefaultConfig.MinIdle, conf.PoolSize))
+		conf.MinIdle = min(DefaultConfig.MinIdle, conf.PoolSize)
+	}
+	if conf.MaxRetries < 0 {
+		log.Warn("Sanitizing invalid redis retry count", "provided", conf.MaxRetries, "updated", DefaultConfig.MaxRetries)
+		conf.MaxRetries = DefaultConfig.MaxRetries
+	}
+	if conf.RetryDelay <= 0 {
+		log.Warn("Sanitizing invalid redis retry delay", "provided", conf.RetryDelay, "updated", DefaultConfig.RetryDelay)
+		conf.RetryDelay = DefaultConfig.RetryDelay
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = DefaultConfig.DialTimeout
+	}
+	if conf.QueueSize < 1 {
+		log.Warn("Sanitizing invalid redis export queue size", "provided", conf.QueueSize, "updated", DefaultConfig.QueueSize)
+		conf.QueueSize = DefaultConfig.QueueSize
+	}
+	if conf.StreamMaxLen < 0 {
+		log.Warn("Sanitizing invalid redis stream length", "provided", conf.StreamMaxLen, "updated", DefaultConfig.StreamMaxLen)
+		conf.StreamMaxLen = DefaultConfig.StreamMaxLen
+	}
+	conf.Retention = conf.Retention.sanitize()
+	if conf.Ingest && conf.IngestGroup == "" {
+		log.Warn("Sanitizing invalid redis ingest group", "provided", conf.IngestGroup, "updated", DefaultConfig.IngestGroup)
+		conf.IngestGroup = DefaultConfig.IngestGroup
+	}
+	if conf.Simulate && conf.SimulateBudget <= 0 {
+		log.Warn("Sanitizing invalid redis simulation budget", "provided", conf.SimulateBudget, "updated", DefaultConfig.SimulateBudget)
+		conf.SimulateBudget = DefaultConfig.SimulateBudget
+	}
+	if conf.Election && conf.ElectionLease < time.Second {
+		log.Warn("Sanitizing invalid redis election lease", "provided", conf.ElectionLease, "updated", DefaultConfig.ElectionLease)
+		conf.ElectionLease = DefaultConfig.ElectionLease
+	}
+	return conf
+}
+
+// password returns the configured ACL password, reading it from PasswordFile
+// if one was specified.
+func (c *Config) password() (string, error) {
+	if c.PasswordFile == "" {
+		return c.Password, nil
+	}
+	if c.Password != "" {
+		return "", errors.New("both redis password and password file specified")
+	}
+	blob, err := os.ReadFile(c.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read redis password file: %v", err)
+	}
+	return strings.TrimRight(strings.SplitN(string(blob), "\n", 2)[0], "\r"), nil
+}
+
+// tlsConfig assembles the TLS client configuration, or nil if TLS is disabled.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if c.Mode == ModeStandalone && c.Network == "tcp" {
+		if host, _, err := net.SplitHostPort(c.Address); err == nil {
+			conf.ServerName = host
+		}
+	}
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", c.TLSCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// addresses returns the configured sentinel or cluster seed node addresses.
+func (c *Config) addresses() []string {
+	var addrs []string
+	for _, addr := range strings.Split(c.Address, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// newClient connects to Redis in the configured deployment mode. Sentinel and
+// cluster clients follow failovers and slot migrations on their own, retrying
+// the commands interrupted by them.
+func (c *Config) newClient() (redis.UniversalClient, error) {
+	opts, err := c.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	switch c.Mode {
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return nil, errors.New("redis sentinel mode requires a master name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    c.addresses(),
+			SentinelPassword: c.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        opts.TLSConfig,
+			PoolSize:         opts.PoolSize,
+			MinIdleConns:     opts.MinIdleConns,
+			MaxRetries:       opts.MaxRetries,
+			MinRetryBackoff:  opts.MinRetryBackoff,
+			MaxRetryBackoff:  opts.MaxRetryBackoff,
+			DialTimeout:      opts.DialTimeout,
+		}), nil
+
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           c.addresses(),
+			Username:        opts.Username,
+			Password:        opts.Password,
+			TLSConfig:       opts.TLSConfig,
+			PoolSize:        opts.PoolSize,
+			MinIdleConns:    opts.MinIdleConns,
+			MaxRetries:      opts.MaxRetries,
+			MinRetryBackoff: opts.MinRetryBackoff,
+			MaxRetryBackoff: opts.MaxRetryBackoff,
+			DialTimeout:     opts.DialTimeout,
+		}), nil
+
+	default:
+		return redis.NewClient(opts), nil
+	}
+}
+
+// clientOptions converts the configuration into go-redis client options.
+func (c *Config) clientOptions() (*redis.Options, error) {
+	password, err := c.password()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &redis.Options{
+		Network:         c.Network,
+		Addr:            c.Address,
+		Username:        c.Username,
+		Password:        password,
+		DB:              c.DB,
+		TLSConfig:       tlsConf,
+		PoolSize:        c.PoolSize,
+		MinIdleConns:    c.MinIdle,
+		MaxRetries:      c.MaxRetries,
+		MinRetryBackoff: c.RetryDelay,
+		MaxRetryBackoff: c.RetryDelay * 2,
+		DialTimeout:     c.DialTimeout,
+	}, nil
 }
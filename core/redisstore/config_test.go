@@ -0,0 +1,104 @@
+package redisstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSanitize(t *testing.T) {
+	tests := []struct {
+		network, addr     string
+		wantNet, wantAddr string
+	}{
+		{"tcp", "10.0.0.1:6379", "tcp", "10.0.0.1:6379"},
+		{"", "/run/redis.sock", "unix", "/run/redis.sock"},
+		{"", "localhost:6379", "tcp", "localhost:6379"},
+		{"tcp", "unix:///run/redis.sock", "unix", "/run/redis.sock"},
+		{"udp", "localhost:6379", "tcp", "localhost:6379"},
+		{"tcp", "", "tcp", DefaultConfig.Address},
+	}
+	for i, tt := range tests {
+		cfg := DefaultConfig
+		cfg.Network, cfg.Address = tt.network, tt.addr
+		conf := cfg.sanitize()
+		if conf.Network != tt.wantNet || conf.Address != tt.wantAddr {
+			t.Errorf("test %d: have %s/%s, want %s/%s", i, conf.Network, conf.Address, tt.wantNet, tt.wantAddr)
+		}
+	}
+}
+
+func TestConfigPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cret\r\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig
+	cfg.PasswordFile = path
+
+	opts, err := cfg.clientOptions()
+	if err != nil {
+		t.Fatalf("failed to assemble client options: %v", err)
+	}
+	if opts.Password != "s3cret" {
+		t.Errorf("password mismatch: have %q, want %q", opts.Password, "s3cret")
+	}
+	cfg.Password = "inline"
+	if _, err := cfg.clientOptions(); err == nil {
+		t.Error("expected error for both password and password file")
+	}
+}
+
+func TestConfigDisabled(t *testing.T) {
+	var nilcfg *Config
+	if nilcfg.IsEnabled() {
+		t.Error("nil config reported as enabled")
+	}
+	if _, err := NewRedisStore(&DefaultConfig); err == nil {
+		t.Error("expected error creating store from disabled config")
+	}
+}
+
+func TestConfigModes(t *testing.T) {
+	tests := []struct {
+		mode, network, addr string
+		wantType            string
+	}{
+		{"", "tcp", "localhost:6379", "*redis.Client"},
+		{ModeStandalone, "unix", "/run/redis.sock", "*redis.Client"},
+		{ModeSentinel, "tcp", "10.0.0.1:26379, 10.0.0.2:26379", "*redis.Client"},
+		{ModeCluster, "tcp", "10.0.0.1:6379,10.0.0.2:6379", "*redis.ClusterClient"},
+	}
+	for i, tt := range tests {
+		cfg := DefaultConfig
+		cfg.Mode, cfg.Network, cfg.Address, cfg.MasterName = tt.mode, tt.network, tt.addr, "primary"
+		conf := cfg.sanitize()
+
+		client, err := conf.newClient()
+		if err != nil {
+			t.Fatalf("test %d: failed to create client: %v", i, err)
+		}
+		if have := fmt.Sprintf("%T", client); have != tt.wantType {
+			t.Errorf("test %d: client type mismatch: have %s, want %s", i, have, tt.wantType)
+		}
+		client.Close()
+	}
+	// Sentinel mode needs a master name, cluster mode a single database
+	cfg := DefaultConfig
+	cfg.Mode = ModeSentinel
+	if _, err := cfg.newClient(); err == nil {
+		t.Error("expected error for sentinel mode without master name")
+	}
+	cfg.Mode, cfg.DB = ModeCluster, 3
+	if conf := cfg.sanitize(); conf.DB != 0 {
+		t.Errorf("cluster database not sanitized: have %d", conf.DB)
+	}
+	cfg.Mode = "replicated"
+	if conf := cfg.sanitize(); conf.Mode != ModeStandalone {
+		t.Errorf("invalid mode not sanitized: have %s", conf.Mode)
+	}
+	if addrs := (&Config{Address: " a:1, ,b:2"}).addresses(); len(addrs) != 2 || addrs[0] != "a:1" || addrs[1] != "b:2" {
+		t.Errorf("address list mismatch: have %q", addrs)
+	}
+}
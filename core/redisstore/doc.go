@@ -0,0 +1,198 @@
+/*
+Package redisstore mirrors chain data and pending transactions into Redis.
+
+Every block and transaction hash carries a schema_version field holding the
+SchemaVersion of the layout it was written with. Quantities stored directly in
+hash fields are decimal big integer strings, quantities inside JSON documents
+use the hex encoding of the eth RPC namespace. No quantity is ever truncated
+to 64 bits.
+
+All keys start with the configured key prefix, "<chainId>:" by default, so that
+several chains can share a database. The prefix is omitted below. Each prefix
+holds a descriptor of the data stored under it:
+
+	schema  hash with the fields version (SchemaVersion), chainId, prefix, compressed
+	        (1 if large JSON fields are zlib compressed) and updated (unix time)
+
+Data written before keys were prefixed is moved under the prefix of its chain by
+the geth redis migrate command.
+
+Block data is laid out as follows:
+
+	block:{<number>}         hash with the fields of the canonical block at a height
+	block:{<number>}:<hash>  hash with the fields of a non-canonical sibling block
+	siblings:{<number>}      set of the hashes of the sibling blocks at a height
+	blockhash:<hash>         number of the block with the given hash
+	canonical:{<number>}     hash of the canonical block at a height
+	removedlogs:<hash>       logs of a block dropped by a reorg, flagged as removed
+	receipt:<txhash>         receipt of a canonical transaction, as eth_getTransactionReceipt
+	txblock:<txhash>         hash with the blockNumber, blockHash and transactionIndex of a
+	                         canonical transaction
+	addr:<address>:mined     sorted set of canonical transactions sent from or to an address,
+	                         or creating it, scored by block number
+	exportcursor:{<chainId>} hash with the number and hash of the last block committed by
+	                         the exporter
+
+The keys of a height carry the block number as hash tag, so that they map to the
+same Redis Cluster slot.
+
+Optionally, the nodes sharing a Redis deployment elect a single exporter. Each
+acquisition of the lease draws a new fencing token, which the writes of the
+height keys, the export cursor and the event streams are checked against:
+
+	exportlease:{<chainId>}  <token>:<node> of the node holding the export lease
+	exportfence:{<chainId>}  last fencing token drawn
+	fence:{<number>}         highest fencing token that wrote a height
+	stream:{<chainId>}:fence highest fencing token that published an event
+
+Optionally, canonical logs are indexed by emitting address and first topic. The
+entries point into the logs field of the block hash and are trimmed once their
+block falls out of the configured retention window:
+
+	logaddr:<address>   sorted set of <number>:<logIndex> entries of the logs emitted
+	                    by an address, scored by block number
+	logtopic:<topic>    sorted set of the entries of the logs with a first topic
+	logindex:{<number>} hash of the block whose logs are indexed at a height
+	logindex:tail       first block the index may cover
+	logindex:keys       sorted set of the address and topic keys, scored by the last
+	                    block adding to them
+
+The block hashes contain the following fields:
+
+	schema_version  layout version
+	hash            block hash
+	parentHash      parent block hash
+	number          block number
+	timestamp       block timestamp
+	gasPrice        base fee in wei, 0 before London
+	header          RLP encoded header
+	body            RLP encoded body without transactions, i.e. the uncles and withdrawals
+	txs             transactions as returned by eth_getBlockByHash, each with an
+	                additional contractAddress for contract creations
+	logs            logs as returned by eth_getLogs
+	receipts        receipts as returned by eth_getBlockReceipts
+	canonical       1 if the block is canonical, 0 for siblings
+
+Pending transactions are stored in tx:<hash> hashes with the fields:
+
+	schema_version        layout version
+	hash                  transaction hash
+	type                  transaction type
+	chainId               chain id, 0 for unprotected legacy transactions
+	nonce                 sender nonce
+	from                  sender address
+	to                    recipient address, empty for contract creations
+	contractAddress       created contract address, empty for calls
+	value                 transferred value in wei
+	gasLimit              gas limit
+	gasPrice              gas price, or fee cap for dynamic fee transactions
+	maxFeePerGas          fee cap (types 2, 3 and 4)
+	maxPriorityFeePerGas  tip cap (types 2, 3 and 4)
+	accessList            JSON access list (types 1, 2, 3 and 4)
+	maxFeePerBlobGas      blob fee cap (type 3)
+	blobVersionedHashes   JSON list of blob versioned hashes (type 3)
+	authorizationList     JSON list of EIP-7702 authorizations (type 4)
+	authorities           JSON list of recovered authorization signers, null if invalid (type 4)
+	v, r, s               signature values
+	raw                   hex encoded canonical transaction encoding, without blob sidecar
+	blockNumber           chain head at the time the transaction was seen
+	timestamp             unix time the node first received the transaction
+	seenMs                same in milliseconds
+	peer                  ID of the peer that delivered it first, empty for local transactions
+	source                announced (retrieved after a hash announcement), broadcast or local
+	status                pool status, pending or queued
+	statusTime            unix time of the last status change
+
+Pool transactions are indexed by address in the same way as mined ones:
+
+	addr:<address>:pending  sorted set of pool transactions sent from or to an address, or
+	                        creating it, scored by sender nonce
+
+Optionally, the sidecar of a pooled blob transaction is stored without the blobs
+themselves, for as long as the transaction is in the mirror:
+
+	blobsidecar:<hash>  hash with the fields version, commitments and proofs (JSON lists)
+
+Optionally, pending transactions are executed on the state of the chain head as
+soon as they are mirrored, and again on every new head, within an execution time
+budget per head. The outcome is kept as long as the transaction:
+
+	txsim:<hash>  hash with the fields head (number), headHash, status (1 or 0), gasUsed,
+	              error, revertReason, time (unix), and the JSON fields logs (as
+	              eth_getLogs), calls (as the callTracer) and storage (slots touched per
+	              address, with their values on the head)
+
+Optionally, the net state changes of every block are exported along with it.
+They are recorded by the statediff live tracer (--vmtrace statediff), changes
+reverted within the block cancel out:
+
+	statediff:<hash>  JSON object keyed by address, holding per touched account the changed
+	                  balance, nonce, code (with fromCode and toCode) and storage slots,
+	                  each as {from, to}
+
+The mirror only holds transactions accepted by one of the subpools of the pool.
+It is kept in sync with pool events, and with the full pool contents on startup,
+after resyncs and every 64 exported heads. After every exported head, the pool
+transactions of the senders of mined transactions are checked for demotion to
+the queue, and a sample of the mirrored transactions is checked for presence in
+the pool. Transactions leaving the pool
+are removed, and every status change is appended to a JSON list kept for as
+long as the transaction itself:
+
+	txhistory:<hash>  transitions as {status, time, by, reason, block, blockHash}
+
+The statuses are pending, queued, replaced (by the transaction holding the same
+nonce), dropped (with a reason inferred from the sender nonce), mined (in a
+block) and reorged (out of a block).
+
+Chain and mempool events are additionally appended to per-chain streams, meant
+to be consumed with XREADGROUP:
+
+	stream:{<chainId>}:blocks      new canonical blocks (number, hash, parentHash, timestamp, txs)
+	stream:{<chainId>}:logs        logs of a block as eth_getLogs (number, hash, removed, logs)
+	stream:{<chainId>}:pendingTxs  transactions entering the mirror (hash, from, nonce, type, status, timestamp, peer, source)
+	stream:{<chainId>}:droppedTxs  transactions leaving it unmined (hash, status, reason, by, timestamp)
+	stream:{<chainId>}:reorgs      reorganisations (ancestor, oldNumber, oldHash, newNumber, newHash, dropped, added)
+	stream:{<chainId>}:stateDiffs  state diffs of a block as statediff:<hash> (number, hash, parentHash, removed, accounts, or unavailable)
+	stream:{<chainId>}:cursor      last cursor assigned
+
+Optionally, signed transactions appended to an ingest stream are submitted to
+the pool, and the outcome of every entry is published (see IngestStream):
+
+	stream:{<chainId>}:ingest         raw signed transactions (raw, local), read in a consumer group
+	stream:{<chainId>}:ingestResults  outcome of every entry (id, hash, status, error)
+
+Every entry carries a cursor field, strictly increasing across all streams of a
+chain in publishing order. The logs of a block dropped by a reorg are published
+again with removed set, after the reorg entry and before the new blocks, and
+so are their state diffs, inverted to roll the changes back. Streams
+are trimmed approximately to the configured length.
+
+Every class of data is retained according to its own policy (see Retention):
+blocks with their hash index, removed logs and state diffs, the log index, receipts, pool
+transactions with their history, and the block pointers and address index of
+mined transactions. Keys expire a configured time after they were written, and
+the exporter prunes the heights falling a configured number of blocks behind
+the finalized block, recording its progress in:
+
+	retention:{<chainId>}  hash with the last height pruned per class
+
+All writes exporting a block, from the block hash to its stream entries and the
+export cursor, are committed at once in a single script. In Redis Cluster, where
+a script cannot span slots, the block data is written first and the stream
+entries along with the cursor only once it succeeded.
+
+Package client reads this layout back as core/types values, reconstructing
+full blocks from their header, body and transactions, and follows the event
+streams in publishing order, resuming from the last entries consumed. It does
+not depend on the rest of geth.
+
+The store reaches Redis through a Backend. Besides go-redis clients, it can run
+on an in-process emulation of the commands and scripts it uses (NewMemoryBackend),
+which lets the export be exercised end to end without a Redis server.
+*/
+package redisstore
+
+// SchemaVersion is the version of the Redis data layout written by this package.
+// It must be bumped whenever the meaning or encoding of a stored field changes.
+const SchemaVersion = 5
@@ -0,0 +1,83 @@
+package redisstore
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/common/mclock"
+)
+
+// dupCacheSize is the number of mirrored transactions remembered by the
+// duplicate cache. Transactions falling out of it are looked up in Redis.
+const dupCacheSize = 1 << 18
+
+// dupCache remembers which transactions are stored in Redis, until the expiry of
+// their keys. It is bounded in size, evicting the least recently used entries.
+// The cache starts empty and is filled as transactions are written or found in
+// Redis, a miss only means Redis has to be asked.
+type dupCache struct {
+	entries lru.BasicLRU[common.Hash, mclock.AbsTime] // Expiry of the keys of each transaction
+	clock   mclock.Clock
+	hits    uint64
+	misses  uint64
+	lock    sync.Mutex
+}
+
+// newDupCache creates a duplicate cache holding up to size transactions.
+func newDupCache(size int, clock mclock.Clock) *dupCache {
+	return &dupCache{
+		entries: lru.NewBasicLRU[common.Hash, mclock.AbsTime](size),
+		clock:   clock,
+	}
+}
+
+// add remembers a transaction stored in Redis until its keys expire, or until
+// removed if they do not.
+func (c *dupCache) add(hash common.Hash, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if ttl == 0 {
+		c.entries.Add(hash, math.MaxInt64)
+		return
+	}
+	c.entries.Add(hash, c.clock.Now().Add(ttl))
+}
+
+// contains returns whether a transaction is known to be stored in Redis.
+func (c *dupCache) contains(hash common.Hash) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	expiry, ok := c.entries.Get(hash)
+	if ok && expiry <= c.clock.Now() {
+		c.entries.Remove(hash)
+		ok = false
+	}
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return ok
+}
+
+// remove forgets a transaction deleted from Redis.
+func (c *dupCache) remove(hash common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries.Remove(hash)
+}
+
+// stats returns the number of cached transactions, and the hits and misses of
+// all lookups so far.
+func (c *dupCache) stats() (size int, hits, misses uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.entries.Len(), c.hits, c.misses
+}
@@ -0,0 +1,90 @@
+package redisstore
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that the duplicate cache is bounded, forgets expired transactions and
+// counts its hits.
+func TestDupCache(t *testing.T) {
+	var (
+		clock = new(mclock.Simulated)
+		cache = newDupCache(2, clock)
+	)
+	cache.add(common.Hash{1}, time.Hour)
+	cache.add(common.Hash{2}, time.Minute)
+	if !cache.contains(common.Hash{1}) {
+		t.Fatalf("Cached transaction missing")
+	}
+	// The least recently used transaction is evicted
+	cache.add(common.Hash{3}, time.Hour)
+	if cache.contains(common.Hash{2}) {
+		t.Errorf("Evicted transaction still cached")
+	}
+	// Transactions are forgotten once their keys expire
+	clock.Run(time.Hour - time.Second)
+	if !cache.contains(common.Hash{3}) {
+		t.Errorf("Transaction forgotten before expiry")
+	}
+	clock.Run(time.Second)
+	if cache.contains(common.Hash{1}) || cache.contains(common.Hash{3}) {
+		t.Errorf("Expired transaction still cached")
+	}
+	if size, hits, misses := cache.stats(); size != 0 || hits != 2 || misses != 3 {
+		t.Errorf("Stats mismatch: have size %d, %d hits, %d misses", size, hits, misses)
+	}
+}
+
+// Tests that transactions mirrored before a restart are found in Redis once
+// looked up, without loading the keyspace on startup.
+func TestDupCacheRestart(t *testing.T) {
+	backend := NewMemoryBackend()
+	newManager := func() *TxManager {
+		store, err := NewStore(testConfig(), backend)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		store.SetChainID(big.NewInt(1))
+		return NewTxManager(store)
+	}
+	var (
+		prev   = newManager()
+		tx     = emitTx(0)
+		other  = emitTx(1)
+		signer = types.LatestSignerForChainID(tx.ChainId())
+	)
+	if err := prev.storeTxSync(tx); err != nil {
+		t.Fatalf("Failed to store transaction: %v", err)
+	}
+	txMgr := newManager()
+	if size, _, _ := txMgr.dupCache.stats(); size != 0 {
+		t.Fatalf("Cache filled on startup: %d transactions", size)
+	}
+	// Key expiry is taken over from Redis
+	backend.FastForward(time.Hour)
+	if stored := txMgr.stored(tx.Hash(), other.Hash()); !stored[0] || stored[1] {
+		t.Fatalf("Lookup mismatch: have %v, want [true false]", stored)
+	}
+	if expiry, _ := txMgr.dupCache.entries.Peek(tx.Hash()); time.Duration(expiry-mclock.Now()) > txTTL-time.Hour {
+		t.Errorf("Cached expiry beyond key expiry")
+	}
+	// Mined transactions of the previous run get their history completed
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, &types.Body{Transactions: types.Transactions{tx, other}}, nil, trie.NewStackTrie(nil))
+	if err := txMgr.MinedTxs(block, signer); err != nil {
+		t.Fatalf("Failed to mark mined transactions: %v", err)
+	}
+	checkHistory(t, txMgr, tx.Hash(), TxStatusPending, TxStatusMined)
+	if history, _ := txMgr.TxHistory(other.Hash()); len(history) != 0 {
+		t.Errorf("History recorded for unmirrored transaction: %v", history)
+	}
+	if stats := txMgr.Stats(); stats["cache_hits"] != uint64(1) || stats["cache_misses"] != uint64(3) {
+		t.Errorf("Cache stats mismatch: %v", stats)
+	}
+}
@@ -0,0 +1,234 @@
+package redisstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Replicas sharing a Redis deployment elect a single exporter through a lease
+// key. Every acquisition of the lease draws a new fencing token, and the writes
+// of the elected exporter carry that token. The token is checked and recorded
+// next to the data it guards, so a former leader that lost its lease without
+// noticing (e.g. after a long pause) cannot overwrite what its successor wrote.
+//
+// Writes are fenced per cluster slot: the keys of a height against fence:{n},
+// the event streams against the stream fence of the chain and the export cursor
+// against the token counter itself. Derived keys spread across slots (receipts,
+// indexes, the mempool mirror) are only written by the node holding the lease
+// and rewritten by its successor, which resumes from the committed cursor.
+
+// errFenced is returned if a write was rejected because a newer exporter was
+// elected meanwhile.
+var errFenced = errors.New("fenced off by a newer exporter")
+
+// exportLeaseKey returns the key of the export lease of a chain, holding the
+// fencing token and the id of the node holding it.
+func (k keyspace) exportLeaseKey() string {
+	return fmt.Sprintf("%sexportlease:{%s}", k.prefix, k.chainID)
+}
+
+// exportFenceKey returns the key of the last fencing token drawn for a chain.
+func (k keyspace) exportFenceKey() string {
+	return fmt.Sprintf("%sexportfence:{%s}", k.prefix, k.chainID)
+}
+
+// heightFenceKey returns the key of the highest fencing token that wrote a
+// height.
+func (k keyspace) heightFenceKey(number uint64) string {
+	return fmt.Sprintf("%sfence:{%d}", k.prefix, number)
+}
+
+// acquireLeaseScript acquires or renews the export lease of a chain. A free
+// lease is taken with a new fencing token, a lease held by the same node is
+// extended keeping its token. The token is returned, or 0 if the lease is held
+// by another node.
+//
+//	KEYS[1]  lease key
+//	KEYS[2]  fencing token counter
+//	ARGV[1]  node id
+//	ARGV[2]  lease duration in milliseconds
+const acquireLeaseScript = `
+local held = redis.call('GET', KEYS[1])
+if held then
+	local sep = string.find(held, ':', 1, true)
+	if string.sub(held, sep + 1) ~= ARGV[1] then
+		return 0
+	end
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return tonumber(string.sub(held, 1, sep - 1))
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], token .. ':' .. ARGV[1], 'PX', ARGV[2])
+return token
+`
+
+// batchScript runs a batch of writes, unless a newer fencing token than the
+// given one was recorded at one of the fence keys. The token is recorded at all
+// of them otherwise. Besides Redis commands, a batch may append stream entries
+// with the XPUBLISH pseudo command, assigning them the next cursor of the chain
+// like publishScript.
+//
+//	KEYS[1:n]    fence keys
+//	KEYS[n+1:]   keys written by the batch
+//	ARGV[1]      fencing token, 0 if unfenced
+//	ARGV[2]      number of fence keys
+//	ARGV[3:n+2]  expiry of each fence key in milliseconds, 0 to keep it
+//	ARGV[n+3:]   commands, each given as its argument count followed by the arguments
+//
+//	XPUBLISH <cursor key> <stream key> <maximum stream length, 0 for no trimming> <field/value pairs>
+const batchScript = `
+local token = tonumber(ARGV[1])
+local fences = tonumber(ARGV[2])
+if token > 0 then
+	for i = 1, fences do
+		local fence = tonumber(redis.call('GET', KEYS[i]) or 0)
+		if fence > token then
+			return redis.error_reply('FENCED ' .. fence)
+		end
+	end
+	for i = 1, fences do
+		if tonumber(redis.call('GET', KEYS[i]) or 0) < token then
+			if tonumber(ARGV[2 + i]) > 0 then
+				redis.call('SET', KEYS[i], token, 'PX', ARGV[2 + i])
+			else
+				redis.call('SET', KEYS[i], token)
+			end
+		end
+	end
+end
+local i = fences + 3
+while i <= #ARGV do
+	local n = tonumber(ARGV[i])
+	if ARGV[i + 1] == 'XPUBLISH' then
+		local cursor = redis.call('INCR', ARGV[i + 2])
+		local args = {'XADD', ARGV[i + 3]}
+		local maxlen = tonumber(ARGV[i + 4])
+		if maxlen > 0 then
+			table.insert(args, 'MAXLEN')
+			table.insert(args, '~')
+			table.insert(args, maxlen)
+		end
+		table.insert(args, '*')
+		table.insert(args, 'cursor')
+		table.insert(args, cursor)
+		for j = i + 5, i + n do
+			table.insert(args, ARGV[j])
+		end
+		redis.call(unpack(args))
+	else
+		redis.call(unpack(ARGV, i + 1, i + n))
+	end
+	i = i + n + 1
+end
+return 0
+`
+
+// slotBatch collects writes to the keys of a single cluster slot, executed
+// atomically by writeSlot.
+type slotBatch struct {
+	fences []string        // Fence keys the writes are checked against
+	ttls   []time.Duration // Expiry of each fence key, 0 to keep it
+	keys   []string
+	cmds   [][]interface{}
+}
+
+// fence checks the batch against a fence key, recording the token of the store
+// there with the given expiry.
+func (b *slotBatch) fence(key string, ttl time.Duration) {
+	if !slices.Contains(b.fences, key) {
+		b.fences = append(b.fences, key)
+		b.ttls = append(b.ttls, ttl)
+	}
+}
+
+// add appends a command writing a key to the batch.
+func (b *slotBatch) add(key string, args ...interface{}) {
+	b.keys = append(b.keys, key)
+	b.cmds = append(b.cmds, args)
+}
+
+// merge appends the fences and writes of another batch.
+func (b *slotBatch) merge(other *slotBatch) {
+	for i, key := range other.fences {
+		b.fence(key, other.ttls[i])
+	}
+	b.keys = append(b.keys, other.keys...)
+	b.cmds = append(b.cmds, other.cmds...)
+}
+
+// fence returns the fencing token the writes of the store carry, 0 if they are
+// not fenced.
+func (s *RedisBlockStore) fence() uint64 {
+	return s.token.Load()
+}
+
+// SetFence sets the fencing token carried by the writes of the store from now
+// on. Zero disables fencing.
+func (s *RedisBlockStore) SetFence(token uint64) {
+	s.token.Store(token)
+}
+
+// writeSlot executes a batch of writes atomically. If the store is fenced, the
+// batch is rejected with errFenced if a newer token was recorded at one of its
+// fence keys.
+func (s *RedisBlockStore) writeSlot(batch *slotBatch) error {
+	return fencedError(s.evalSlot(s.client, batch).Err())
+}
+
+// evalSlot issues the script executing a batch of writes on a client or pipeline.
+func (s *RedisBlockStore) evalSlot(client Cmdable, batch *slotBatch) *redis.Cmd {
+	args := []interface{}{s.fence(), len(batch.fences)}
+	for _, ttl := range batch.ttls {
+		args = append(args, ttl.Milliseconds())
+	}
+	for _, cmd := range batch.cmds {
+		args = append(args, len(cmd))
+		args = append(args, cmd...)
+	}
+	keys := append(slices.Clone(batch.fences), batch.keys...)
+	return client.Eval(s.ctx, batchScript, keys, args...)
+}
+
+// fencedError converts the rejection of a fenced write into errFenced.
+func fencedError(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), "FENCED") {
+		return errFenced
+	}
+	return err
+}
+
+// AcquireLease acquires the export lease of the store's chain for a node, or
+// renews it if the node already holds it. The fencing token of the lease is
+// returned, or 0 if another node holds it.
+func (s *RedisBlockStore) AcquireLease(node string, lease time.Duration) (uint64, error) {
+	keys := []string{s.keys.exportLeaseKey(), s.keys.exportFenceKey()}
+	token, err := s.client.Eval(s.ctx, acquireLeaseScript, keys, node, lease.Milliseconds()).Int64()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return 0, fmt.Errorf("failed to acquire export lease: %v", err)
+	}
+	return uint64(token), nil
+}
+
+// ReleaseLease gives up the export lease of the store's chain, if it is still
+// held by the node with the given token.
+func (s *RedisBlockStore) ReleaseLease(node string, token uint64) error {
+	held := strconv.FormatUint(token, 10) + ":" + node
+	if err := s.client.Eval(s.ctx, deleteIfEqualScript, []string{s.keys.exportLeaseKey()}, held).Err(); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to release export lease: %v", err)
+	}
+	return nil
+}
+
+// exportLease is the export lease held by a node.
+type exportLease struct {
+	token  uint64    // Fencing token drawn when the lease was acquired
+	expiry time.Time // Local time after which the lease must be considered lost
+}
@@ -0,0 +1,158 @@
+package redisstore
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newElectionStores creates two stores of the same chain, standing in for two
+// nodes sharing a Redis deployment.
+func newElectionStores(t *testing.T) (*RedisBlockStore, *RedisBlockStore) {
+	t.Helper()
+
+	backend := NewMemoryBackend()
+	stores := make([]*RedisBlockStore, 2)
+	for i := range stores {
+		store, err := NewStore(testConfig(), backend)
+		if err != nil {
+			t.Fatalf("Failed to create Redis store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		store.SetChainID(params.TestChainConfig.ChainID)
+		store.SetTTL(0)
+		stores[i] = store
+	}
+	return stores[0], stores[1]
+}
+
+// Tests that the export lease is held by a single node at a time, renewed with
+// the same fencing token and taken over with a new one.
+func TestExportLease(t *testing.T) {
+	store, _ := newElectionStores(t)
+
+	first, err := store.AcquireLease("a", time.Minute)
+	if err != nil || first == 0 {
+		t.Fatalf("Failed to acquire lease: token %d, %v", first, err)
+	}
+	if token, _ := store.AcquireLease("a", time.Minute); token != first {
+		t.Errorf("Renewal token mismatch: have %d, want %d", token, first)
+	}
+	if token, _ := store.AcquireLease("b", time.Minute); token != 0 {
+		t.Errorf("Lease acquired while held: token %d", token)
+	}
+	if err := store.ReleaseLease("a", first); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+	second, _ := store.AcquireLease("b", time.Minute)
+	if second <= first {
+		t.Fatalf("Takeover token not increased: have %d, previous %d", second, first)
+	}
+	// A stale release must not drop the lease of the new holder
+	store.ReleaseLease("a", first)
+	if token, _ := store.AcquireLease("a", time.Minute); token != 0 {
+		t.Errorf("Lease released by previous holder")
+	}
+}
+
+// Tests that the writes of an exporter are rejected once a newer exporter
+// wrote the same height, published events or was elected at all.
+func TestFencedWrites(t *testing.T) {
+	stale, fresh := newElectionStores(t)
+
+	old, _ := stale.AcquireLease("stale", time.Minute)
+	stale.client.Del(stale.ctx, stale.keys.exportLeaseKey()) // lease ran out
+	token, _ := fresh.AcquireLease("fresh", time.Minute)
+	stale.SetFence(old)
+	fresh.SetFence(token)
+
+	var (
+		number = big.NewInt(1)
+		block  = types.NewBlockWithHeader(&types.Header{Number: number})
+		fork   = types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte{1}})
+	)
+	if err := fresh.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block: %v", err)
+	}
+	if err := stale.StoreBlock(fork, nil, params.TestChainConfig); !errors.Is(err, errFenced) {
+		t.Errorf("Stale block write not fenced: %v", err)
+	}
+	if err := stale.RemoveBlock(block, nil); !errors.Is(err, errFenced) {
+		t.Errorf("Stale block removal not fenced: %v", err)
+	}
+	if hash, _ := fresh.GetCanonicalHash(number.Uint64()); hash != block.Hash() {
+		t.Errorf("Canonical block overwritten: have %x, want %x", hash, block.Hash())
+	}
+	if err := stale.SetExportCursor(number.Uint64(), fork.Hash()); !errors.Is(err, errFenced) {
+		t.Errorf("Stale cursor write not fenced: %v", err)
+	}
+	if err := fresh.SetExportCursor(number.Uint64(), block.Hash()); err != nil {
+		t.Fatalf("Failed to commit cursor: %v", err)
+	}
+	if err := stale.publish(BlocksStream, "number", number.Uint64()); !errors.Is(err, errFenced) {
+		t.Errorf("Stale event not fenced: %v", err)
+	}
+	// Unfenced writes are unaffected
+	stale.SetFence(0)
+	if err := stale.StoreBlock(fork, nil, params.TestChainConfig); err != nil {
+		t.Errorf("Unfenced write rejected: %v", err)
+	}
+}
+
+// Tests that only the elected exporter exports, and that a follower taking over
+// resumes from the cursor committed by its predecessor.
+func TestExportElection(t *testing.T) {
+	storeA, storeB := newElectionStores(t)
+
+	config := DefaultConfig
+	config.Election = true
+
+	var (
+		chain   = newTestChain()
+		headers = chain.extend(&types.Header{Number: big.NewInt(100)}, 4, 0)
+		elected = make(chan struct{}, 1)
+
+		exporterA = NewExporter(&config, rawdb.NewMemoryDatabase(), chain, nil)
+		exporterB = NewExporter(&config, rawdb.NewMemoryDatabase(), chain, nil)
+	)
+	exporterA.store, exporterA.txMgr = storeA, NewTxManager(storeA)
+	exporterB.store, exporterB.txMgr = storeB, NewTxManager(storeB)
+
+	exporterA.campaign(elected)
+	exporterB.campaign(elected)
+	if len(elected) != 1 || !exporterA.lead() || exporterB.lead() {
+		t.Fatalf("Election mismatch: A leading %v, B leading %v", exporterA.leading(), exporterB.leading())
+	}
+	<-elected
+
+	exporterA.export(headers[2])
+	if exporterA.exported == nil || exporterA.exported.Hash() != headers[2].Hash() {
+		t.Fatalf("Leader did not export")
+	}
+	// Let the lease of A run out and have B take over from its cursor
+	storeA.client.Del(storeA.ctx, storeA.keys.exportLeaseKey())
+	exporterB.campaign(elected)
+	if len(elected) != 1 || !exporterB.lead() {
+		t.Fatalf("Follower not elected")
+	}
+	if err := exporterB.verify(); err != nil {
+		t.Fatalf("Failed to verify export: %v", err)
+	}
+	if exporterB.exported == nil || exporterB.exported.Hash() != headers[2].Hash() {
+		t.Fatalf("Follower did not resume from committed cursor")
+	}
+	exporterB.export(headers[3])
+	if number, hash, _ := storeB.ExportCursor(); hash != headers[3].Hash() {
+		t.Errorf("Committed cursor mismatch: have #%d %x, want #%d", number, hash, headers[3].Number)
+	}
+	// The former leader is fenced off, even before noticing the lost lease
+	exporterA.export(chain.extend(headers[3], 1, 1)[0])
+	if _, hash, _ := storeB.ExportCursor(); hash != headers[3].Hash() {
+		t.Errorf("Former leader overwrote the export")
+	}
+}
@@ -0,0 +1,889 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// chainEventChanSize is the size of channel listening to chain events.
+	chainEventChanSize = 10
+
+	// txEventChanSize is the size of channel listening to NewTxsEvent.
+	txEventChanSize = 4096
+
+	// maxExportGap is the maximum number of blocks the exporter walks back from
+	// a new head to connect it to the previously exported one. Larger gaps are
+	// backfilled in batches of this size along the canonical chain.
+	maxExportGap = 1024
+
+	// failoverCheckDepth is the maximum number of blocks the exporter walks back
+	// from its cursor after a failover, looking for the last block that made it
+	// to the new primary.
+	failoverCheckDepth = 64
+
+	// poolSyncInterval is the number of exported heads after which the mempool
+	// mirror is synced with the full contents of the pool again, picking up the
+	// transactions the pool queued without announcing them.
+	poolSyncInterval = 64
+)
+
+// errMissingBlock is returned if a block to export is not available in the
+// chain database, e.g. due to history pruning.
+var errMissingBlock = errors.New("block not found")
+
+// errNotLeading is returned if the export is requested to write to Redis while
+// another node holds the export lease.
+var errNotLeading = errors.New("not the elected exporter")
+
+var (
+	exportTimer         = metrics.NewRegisteredTimer("redis/export/time", nil)
+	exportQueueGauge    = metrics.NewRegisteredGauge("redis/export/queue", nil)
+	exportLagGauge      = metrics.NewRegisteredGauge("redis/export/lag", nil)
+	exportBlockMeter    = metrics.NewRegisteredMeter("redis/export/blocks", nil)
+	exportCoalesced     = metrics.NewRegisteredMeter("redis/export/coalesced", nil)
+	exportDroppedMeter  = metrics.NewRegisteredMeter("redis/export/dropped", nil)
+	exportReorgMeter    = metrics.NewRegisteredMeter("redis/export/reorg", nil)
+	exportErrorMeter    = metrics.NewRegisteredMeter("redis/export/errors", nil)
+	exportFailoverMeter = metrics.NewRegisteredMeter("redis/export/failover", nil)
+	exportElectedMeter  = metrics.NewRegisteredMeter("redis/export/elected", nil)
+)
+
+// BlockChain defines the chain methods the exporter needs.
+type BlockChain interface {
+	// Config retrieves the chain's fork configuration.
+	Config() *params.ChainConfig
+
+	// CurrentBlock returns the current head of the canonical chain.
+	CurrentBlock() *types.Header
+
+	// CurrentFinalBlock returns the latest finalized block, nil if none is known.
+	CurrentFinalBlock() *types.Header
+
+	// GetHeader retrieves a block header by hash and number.
+	GetHeader(hash common.Hash, number uint64) *types.Header
+
+	// GetHeaderByHash retrieves a block header by hash.
+	GetHeaderByHash(hash common.Hash) *types.Header
+
+	// GetHeaderByNumber retrieves a canonical block header by number.
+	GetHeaderByNumber(number uint64) *types.Header
+
+	// GetBlock retrieves a block by hash and number.
+	GetBlock(hash common.Hash, number uint64) *types.Block
+
+	// GetReceiptsByHash retrieves the derived receipts of a block.
+	GetReceiptsByHash(hash common.Hash) types.Receipts
+
+	// SubscribeChainEvent subscribes to new canonical blocks.
+	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+
+	// SubscribeChainHeadEvent subscribes to head changes, including rewinds.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// TxPool defines the transaction pool methods the exporter needs. It is meant
+// to be the aggregate txpool.TxPool, so every subpool is mirrored.
+type TxPool interface {
+	// SubscribeTransactions subscribes to new transactions entering the pool.
+	SubscribeTransactions(ch chan<- core.NewTxsEvent, reorgs bool) event.Subscription
+
+	// Content retrieves the pending and queued transactions of the pool,
+	// grouped by sender. Subpools may not enumerate their content (e.g. the
+	// blob pool), their transactions are only known through events.
+	Content() (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction)
+
+	// ContentFrom retrieves the pending and queued transactions of an account.
+	ContentFrom(addr common.Address) ([]*types.Transaction, []*types.Transaction)
+
+	// Has returns whether the pool contains a transaction.
+	Has(hash common.Hash) bool
+
+	// Get retrieves a pool transaction, including its blob sidecar.
+	Get(hash common.Hash) *types.Transaction
+
+	// Nonce returns the next nonce of an account at the current chain head,
+	// ignoring pool transactions.
+	Nonce(addr common.Address) uint64
+
+	// Add submits a batch of transactions to the pool, returning the error of
+	// every rejected one.
+	Add(txs []*types.Transaction, sync bool) []error
+}
+
+// Exporter is a node service mirroring the canonical chain and the transaction
+// pool into Redis. It is driven entirely by chain and pool events and does all
+// Redis work on background goroutines, so Redis latency never affects block
+// import.
+//
+// Head events are not exported one by one. Every new head is handed to the
+// export worker over a bounded queue, and the worker connects it to the last
+// exported block by walking the parent hashes. Intermediate blocks that never
+// got their own ChainEvent (reorgs, batch inserts) are thus exported too, and
+// heads dropped due to a full queue are covered by any subsequent one.
+//
+// The last exported block is persisted in the chain database and committed to
+// Redis after every block. If Redis becomes unreachable, or the node restarts,
+// the export resumes from there, so the Redis view never has silent gaps. After
+// a failover the export resumes from the last block the new primary holds.
+//
+// If several nodes share the Redis deployment, they may elect a single exporter
+// holding a lease in Redis. The others neither export nor mirror the pool, and
+// resume from the committed cursor once they get elected.
+//
+// Data retained to a depth behind the finalized block is pruned by the export
+// worker whenever it caught up with the head, see Retention.
+//
+// Optionally, the exporter submits the transactions appended to the ingest
+// stream to the pool, independently of the election.
+type Exporter struct {
+	config  *Config
+	db      ethdb.KeyValueStore
+	chain   BlockChain
+	pool    TxPool
+	node    string  // Identity of the node in the exporter election
+	backend Backend // Backend to export to instead of dialing Redis, used by tests
+
+	lease    atomic.Pointer[exportLease]  // Export lease held by the node, if elected
+	paused   atomic.Bool                  // Whether the export was paused through the API
+	progress atomic.Pointer[types.Header] // Last exported header, for status reports
+	failures atomic.Uint64                // Number of failed export attempts
+	txsLost  atomic.Bool                  // Whether pool transactions were dropped since the last mirror sync
+
+	store *RedisBlockStore
+	txMgr *TxManager
+	index atomic.Pointer[RedisBlockStore] // Store serving log queries, while connected
+
+	locals  LocalTracker                      // Tracker of local ingested transactions, if any
+	private *lru.Cache[common.Hash, struct{}] // Local ingested transactions not to be gossiped
+
+	arrivals   *arrivalCache      // First arrivals of transactions delivered by peers
+	sim        *simulator         // Simulator of pending transactions, nil if disabled
+	stateDiffs *StateDiffRecorder // Recorder of the state diffs to export, nil if not recorded
+
+	heads   chan *types.Header  // Bounded queue of heads waiting for export
+	kick    chan struct{}       // Requests the current head to be queued for export
+	resyncs chan *resyncRequest // Requests to restart the export at a block
+
+	// Only accessed by the export worker
+	exported   *types.Header // Last exported canonical header
+	primaries  string        // Redis primaries the export was last verified on
+	verified   bool          // Whether the export was verified since the last error
+	poolSynced bool          // Whether the mempool mirror was synced since pool events were last missed
+	poolHeads  int           // Number of heads exported since the last full mempool mirror sync
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewExporter creates a Redis exporter for the given chain and pool, tracking
+// its progress in db. The connection is only established when the service is
+// started.
+func NewExporter(config *Config, db ethdb.KeyValueStore, chain BlockChain, pool TxPool) *Exporter {
+	conf := config.sanitize()
+	node := conf.NodeID
+	if node == "" {
+		host, _ := os.Hostname()
+		node = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), lockToken()[:8])
+	}
+	return &Exporter{
+		config:   &conf,
+		db:       db,
+		chain:    chain,
+		pool:     pool,
+		node:     node,
+		private:  lru.NewCache[common.Hash, struct{}](privateTxsSize),
+		arrivals: newArrivalCache(),
+		heads:    make(chan *types.Header, conf.QueueSize),
+		kick:     make(chan struct{}, 1),
+		resyncs:  make(chan *resyncRequest),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start implements node.Lifecycle, connecting to Redis and starting the event
+// processing goroutines. Failing to reach Redis is not fatal, the node keeps
+// running without the export.
+func (e *Exporter) Start() error {
+	var (
+		store *RedisBlockStore
+		err   error
+	)
+	if e.backend != nil {
+		store, err = NewStore(e.config, e.backend)
+	} else {
+		store, err = NewRedisStore(e.config)
+	}
+	if err != nil {
+		log.Error("Failed to connect to Redis, export disabled", "addr", e.config.Address, "err", err)
+		return nil
+	}
+	store.SetChainID(e.chain.Config().ChainID)
+	store.SetStateDiffRecorder(e.stateDiffs)
+
+	schema, err := store.ReadSchema()
+	if err != nil {
+		log.Error("Failed to read Redis schema, export disabled", "err", err)
+		store.Close()
+		return nil
+	}
+	if schema != nil && schema.Version > SchemaVersion {
+		log.Error("Redis data written by a newer schema, export disabled", "prefix", schema.Prefix, "stored", schema.Version, "supported", SchemaVersion)
+		store.Close()
+		return nil
+	}
+	if err := store.WriteSchema(); err != nil {
+		log.Error("Failed to write Redis schema, export disabled", "err", err)
+		store.Close()
+		return nil
+	}
+	for _, group := range e.config.StreamGroups {
+		if err := store.CreateStreamGroup(group); err != nil {
+			log.Warn("Failed to create Redis consumer group", "group", group, "err", err)
+		}
+	}
+	txMgr := NewTxManager(store)
+	if err := txMgr.Init(); err != nil {
+		log.Error("Failed to initialize Redis transaction manager, export disabled", "err", err)
+		store.Close()
+		return nil
+	}
+	txMgr.SetPool(e.pool)
+	txMgr.arrivals = e.arrivals
+	e.store, e.txMgr = store, txMgr
+	e.index.Store(store)
+
+	// Resume from the last acknowledged block of a previous run, if any
+	if hash := rawdb.ReadRedisExportHash(e.db); hash != (common.Hash{}) {
+		if header := e.chain.GetHeaderByHash(hash); header != nil {
+			e.exported = header
+			e.progress.Store(header)
+			log.Info("Resuming Redis export", "number", header.Number, "hash", hash)
+		} else {
+			log.Warn("Last Redis export not found, restarting at head", "hash", hash)
+		}
+	}
+	e.enqueue(e.chain.CurrentBlock())
+
+	var (
+		chainCh = make(chan core.ChainEvent, chainEventChanSize)
+		headCh  = make(chan core.ChainHeadEvent, chainEventChanSize)
+		txsCh   = make(chan core.NewTxsEvent, txEventChanSize)
+	)
+	chainSub := e.chain.SubscribeChainEvent(chainCh)
+	headSub := e.chain.SubscribeChainHeadEvent(headCh)
+	txsSub := e.pool.SubscribeTransactions(txsCh, true)
+
+	var elected chan struct{}
+	if e.config.Election {
+		elected = make(chan struct{}, 1)
+		e.wg.Add(1)
+		go e.electionLoop(elected)
+	}
+	e.wg.Add(2)
+	go e.eventLoop(chainCh, headCh, txsCh, elected, chainSub, headSub, txsSub)
+	go e.exportLoop()
+
+	if e.config.Simulate {
+		if chain, ok := e.chain.(SimulationChain); !ok {
+			log.Error("Chain does not support simulations, disabled")
+		} else {
+			e.sim = newSimulator(chain, e.pool, store, e.config.SimulateBudget)
+			e.sim.setHead(e.chain.CurrentBlock())
+			txMgr.sim = e.sim
+
+			e.wg.Add(1)
+			go func() {
+				defer e.wg.Done()
+				e.sim.loop(e.quit)
+			}()
+		}
+	}
+	if e.config.Ingest {
+		if err := store.CreateIngestGroup(e.config.IngestGroup); err != nil {
+			log.Error("Failed to create Redis ingest group, ingestion disabled", "group", e.config.IngestGroup, "err", err)
+		} else {
+			e.wg.Add(1)
+			go e.ingestLoop()
+		}
+	}
+
+	log.Info("Started Redis exporter", "mode", e.config.Mode, "network", e.config.Network, "addr", e.config.Address, "db", e.config.DB, "prefix", store.keys.prefix, "election", e.config.Election, "ingest", e.config.Ingest, "simulate", e.config.Simulate, "node", e.node)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating all goroutines and closing the
+// Redis connection. Heads still queued are exported before returning.
+func (e *Exporter) Stop() error {
+	if e.store == nil {
+		return nil
+	}
+	e.index.Store(nil)
+	close(e.quit)
+	e.wg.Wait()
+
+	if lease := e.lease.Load(); lease != nil {
+		if err := e.store.ReleaseLease(e.node, lease.token); err != nil {
+			log.Warn("Failed to release Redis export lease", "err", err)
+		}
+	}
+
+	if err := e.txMgr.Close(); err != nil {
+		log.Error("Failed to close Redis transaction manager", "err", err)
+	}
+	return e.store.Close()
+}
+
+// FilterLogs implements the external log index of the filter system, serving
+// log queries from the Redis log index over the connection of the export. No
+// range is served while the exporter is not connected.
+func (e *Exporter) FilterLogs(ctx context.Context, begin, end uint64, hashOf func(uint64) common.Hash, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, bool, error) {
+	store := e.index.Load()
+	if store == nil {
+		return nil, false, nil
+	}
+	return store.FilterLogs(ctx, begin, end, hashOf, addresses, topics)
+}
+
+// eventLoop receives chain and pool events and forwards them to the export
+// worker and the transaction manager.
+func (e *Exporter) eventLoop(chainCh chan core.ChainEvent, headCh chan core.ChainHeadEvent, txsCh chan core.NewTxsEvent, elected chan struct{}, subs ...event.Subscription) {
+	defer e.wg.Done()
+	defer close(e.heads)
+	defer func() {
+		for _, sub := range subs {
+			sub.Unsubscribe()
+		}
+	}()
+	for {
+		select {
+		case ev := <-chainCh:
+			e.enqueue(ev.Header)
+
+		case ev := <-headCh:
+			// Head events overlap with chain events, except for rewinds
+			// via SetHead which only emit a head event.
+			e.enqueue(ev.Header)
+			if e.sim != nil && e.leading() && !e.paused.Load() {
+				e.sim.setHead(ev.Header)
+			}
+
+		case ev := <-txsCh:
+			if !e.leading() || e.paused.Load() {
+				continue
+			}
+			e.mirrorTxs(ev.Txs)
+
+		case <-elected:
+			// Take over the export right away instead of waiting for
+			// the next head.
+			e.enqueue(e.chain.CurrentBlock())
+
+		case <-e.kick:
+			e.enqueue(e.chain.CurrentBlock())
+
+		case <-subs[0].Err():
+			return
+		case <-subs[1].Err():
+			return
+		case <-subs[2].Err():
+			return
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// mirrorTxs queues transactions announced by the pool for the mempool mirror.
+// Transactions that cannot be queued are mirrored by a full sync of the pool on
+// the next head.
+func (e *Exporter) mirrorTxs(txs []*types.Transaction) {
+	for _, tx := range txs {
+		if err := e.txMgr.StoreTx(tx); err != nil {
+			e.txsLost.Store(true)
+		}
+	}
+}
+
+// enqueue hands a new head over to the export worker. If the queue is full the
+// head is dropped, the export catches up on the next head.
+func (e *Exporter) enqueue(head *types.Header) {
+	select {
+	case e.heads <- head:
+		exportQueueGauge.Update(int64(len(e.heads)))
+	default:
+		exportCoalesced.Mark(1)
+	}
+}
+
+// exportLoop exports queued heads until the queue is closed, and serves resync
+// requests in between.
+func (e *Exporter) exportLoop() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case head, ok := <-e.heads:
+			if !ok {
+				return
+			}
+			exportQueueGauge.Update(int64(len(e.heads)))
+
+			// Heads arriving while paused are dropped, the export
+			// catches up after resuming. Redis may have failed over
+			// meanwhile, so verify first.
+			if e.paused.Load() {
+				e.verified, e.poolSynced = false, false
+				continue
+			}
+			// Skip heads made obsolete by a newer queued one, unless it
+			// is a rewind which needs to be observed.
+			if len(e.heads) > 0 && (e.exported == nil || head.Number.Cmp(e.exported.Number) > 0) {
+				exportCoalesced.Mark(1)
+				continue
+			}
+			if !e.lead() {
+				e.poolSynced = false
+				continue
+			}
+			e.export(head)
+			if e.exported != nil && e.exported.Hash() == head.Hash() {
+				e.syncPool()
+				if err := e.prune(); err != nil {
+					exportErrorMeter.Mark(1)
+					log.Error("Failed to prune Redis data", "err", err)
+				}
+			}
+			if current := e.chain.CurrentBlock(); current != nil && e.exported != nil {
+				exportLagGauge.Update(int64(current.Number.Uint64()) - int64(e.exported.Number.Uint64()))
+			}
+
+		case req := <-e.resyncs:
+			req.errc <- e.rewind(req.from)
+		}
+	}
+}
+
+// electionLoop campaigns for the export lease until the exporter is stopped,
+// renewing it while held. Gaining the lease is signalled on elected.
+func (e *Exporter) electionLoop(elected chan<- struct{}) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.config.ElectionLease / 3)
+	defer ticker.Stop()
+
+	for {
+		// Redis is left alone while paused, the lease may pass on to
+		// another node meanwhile
+		if !e.paused.Load() {
+			e.campaign(elected)
+		}
+		select {
+		case <-ticker.C:
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// campaign acquires or renews the export lease. The lease is considered lost a
+// quarter of its duration before it runs out in Redis, leaving room for clock
+// drift. Failing to reach Redis keeps the lease until then.
+func (e *Exporter) campaign(elected chan<- struct{}) {
+	start := time.Now()
+	token, err := e.store.AcquireLease(e.node, e.config.ElectionLease)
+	if err != nil {
+		log.Warn("Failed to renew Redis export lease", "err", err)
+		return
+	}
+	prev := e.lease.Load()
+	if token == 0 {
+		if prev != nil {
+			e.lease.Store(nil)
+			log.Warn("Lost Redis export lease", "token", prev.token)
+		}
+		return
+	}
+	e.lease.Store(&exportLease{token: token, expiry: start.Add(e.config.ElectionLease * 3 / 4)})
+	if prev == nil || prev.token != token {
+		exportElectedMeter.Mark(1)
+		log.Info("Elected as Redis exporter", "node", e.node, "token", token)
+
+		select {
+		case elected <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// leading returns whether the node may write to Redis, either because no
+// exporter is elected or because it holds an unexpired lease.
+func (e *Exporter) leading() bool {
+	if !e.config.Election {
+		return true
+	}
+	lease := e.lease.Load()
+	return lease != nil && time.Now().Before(lease.expiry)
+}
+
+// lead returns whether the export worker may write to Redis, fencing its writes
+// with the token of the current lease. Whenever the lease changes hands, the
+// export is verified against the cursor committed by the previous exporter.
+func (e *Exporter) lead() bool {
+	if !e.config.Election {
+		return true
+	}
+	lease := e.lease.Load()
+	if lease == nil || !time.Now().Before(lease.expiry) {
+		e.verified = false
+		return false
+	}
+	if lease.token != e.store.fence() {
+		e.store.SetFence(lease.token)
+		e.verified = false
+	}
+	return true
+}
+
+// export brings the Redis view up to the given head. Spooled mempool writes are
+// replayed first, so that transactions mined while Redis was unreachable get
+// removed again by the block export. Failures are retried on the next head.
+func (e *Exporter) export(head *types.Header) {
+	if err := e.verify(); err != nil {
+		exportErrorMeter.Mark(1)
+		e.failures.Add(1)
+		log.Error("Failed to verify Redis export", "err", err)
+		return
+	}
+	for {
+		if err := e.txMgr.FlushSpool(); err != nil {
+			exportErrorMeter.Mark(1)
+			e.failures.Add(1)
+			log.Error("Failed to replay Redis spool", "err", err)
+			return
+		}
+		prev := e.exported
+		err := e.exportHead(head)
+		if errors.Is(err, errMissingBlock) && prev != nil && e.exported == prev {
+			// The history between the last export and the head is not
+			// available, nothing to do but to restart at the head.
+			log.Warn("Redis export history unavailable, restarting at head", "from", prev.Number, "to", head.Number)
+			exportDroppedMeter.Mark(int64(head.Number.Uint64() - prev.Number.Uint64()))
+			e.exported = nil
+			continue
+		}
+		if errors.Is(err, errFenced) {
+			log.Warn("Redis export taken over by another node", "number", head.Number, "hash", head.Hash())
+			e.verified = false
+			return
+		}
+		if err != nil {
+			exportErrorMeter.Mark(1)
+			e.failures.Add(1)
+			log.Error("Failed to export block to Redis", "number", head.Number, "hash", head.Hash(), "err", err)
+
+			// Errors are expected during a failover, verify before retrying
+			e.verified = false
+			return
+		}
+		// Keep going while backfilling, unless shutting down
+		if e.exported == nil || e.exported.Hash() == head.Hash() || e.exported == prev {
+			return
+		}
+		select {
+		case <-e.quit:
+			return
+		default:
+		}
+		if e.paused.Load() {
+			return
+		}
+	}
+}
+
+// exportHead exports the canonical blocks between the last exported block and
+// the given head, or the next batch of them if the export fell far behind.
+func (e *Exporter) exportHead(head *types.Header) error {
+	added, dropped, err := e.segment(head)
+	if err != nil {
+		return err
+	}
+	if len(dropped) > 0 {
+		exportReorgMeter.Mark(1)
+		log.Debug("Redis export detected reorg", "dropped", len(dropped), "added", len(added))
+		if err := e.store.PublishReorg(dropped, added); err != nil {
+			return err
+		}
+	}
+	for _, header := range dropped {
+		if err := e.removeBlock(header); err != nil {
+			return err
+		}
+		if parent := e.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); parent != nil {
+			if err := e.acknowledge(parent); err != nil {
+				return err
+			}
+		}
+	}
+	for _, header := range added {
+		if err := e.exportBlock(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acknowledge records a block as the last one successfully exported, both in
+// Redis and locally.
+func (e *Exporter) acknowledge(header *types.Header) error {
+	if err := e.store.SetExportCursor(header.Number.Uint64(), header.Hash()); err != nil {
+		return err
+	}
+	e.advance(header)
+	return nil
+}
+
+// advance records a block as the last one successfully exported locally, once
+// the cursor in Redis was moved to it.
+func (e *Exporter) advance(header *types.Header) {
+	e.exported = header
+	e.progress.Store(header)
+	rawdb.WriteRedisExportHash(e.db, header.Hash())
+}
+
+// resyncRequest asks the export worker to export a block and all canonical blocks
+// following it again.
+type resyncRequest struct {
+	from uint64
+	errc chan error
+}
+
+// rewind moves the export cursor back to the parent of the given canonical block,
+// so that the next head exports it and its descendants again. Rewinding to the
+// genesis exports it right away, as it has no parent to resume from.
+func (e *Exporter) rewind(from uint64) error {
+	if !e.lead() {
+		return errNotLeading
+	}
+	// Sync the mempool mirror in full again along with the blocks
+	e.poolSynced = false
+
+	if from == 0 {
+		genesis := e.chain.GetHeaderByNumber(0)
+		if genesis == nil {
+			return errMissingBlock
+		}
+		return e.exportBlock(genesis)
+	}
+	parent := e.chain.GetHeaderByNumber(from - 1)
+	if parent == nil {
+		return errMissingBlock
+	}
+	log.Info("Rewinding Redis export", "from", from)
+	if err := e.acknowledge(parent); err != nil {
+		return err
+	}
+	// Blocks exported again must be pruned again
+	return e.store.unprune(from - 1)
+}
+
+// verify reconciles the export cursor with Redis on startup, after errors and
+// whenever the primaries serving Redis changed. The cursor committed to Redis
+// takes precedence over the local one, and is rewound to the last block whose
+// canonical marker survived a failover.
+func (e *Exporter) verify() error {
+	primaries, err := e.store.Primaries()
+	if err != nil {
+		// Not every server reveals its identity, rely on errors to detect
+		// failovers then
+		log.Debug("Failed to identify Redis primaries", "err", err)
+		primaries = e.primaries
+	}
+	if e.verified && primaries == e.primaries {
+		return nil
+	}
+	if e.verified {
+		exportFailoverMeter.Mark(1)
+		log.Warn("Redis primary changed, verifying export", "primaries", primaries)
+	}
+	cursor := e.exported
+	number, hash, err := e.store.ExportCursor()
+	if err != nil {
+		return err
+	}
+	if hash != (common.Hash{}) && (cursor == nil || cursor.Hash() != hash) {
+		if header := e.chain.GetHeader(hash, number); header != nil {
+			cursor = header
+		} else {
+			log.Warn("Redis export cursor not found locally", "number", number, "hash", hash)
+		}
+	}
+	// Markers also expire with the block TTL, so a cursor without any marker
+	// within reach is kept as is
+	for header, depth := cursor, 0; header != nil && depth < failoverCheckDepth; depth++ {
+		canonical, err := e.store.GetCanonicalHash(header.Number.Uint64())
+		if err != nil {
+			return err
+		}
+		if canonical == header.Hash() {
+			cursor = header
+			break
+		}
+		header = e.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if cursor != nil && (e.exported == nil || cursor.Hash() != e.exported.Hash()) {
+		log.Warn("Resuming Redis export from committed cursor", "number", cursor.Number, "hash", cursor.Hash())
+		if err := e.acknowledge(cursor); err != nil {
+			return err
+		}
+	}
+	e.primaries, e.verified = primaries, true
+	return nil
+}
+
+// segment collects the headers between the last exported block and the new
+// head. The added headers are returned in ascending order, the dropped ones
+// (previously exported but no longer canonical) in descending order.
+func (e *Exporter) segment(head *types.Header) (added, dropped []*types.Header, err error) {
+	old := e.exported
+	if old == nil {
+		return []*types.Header{head}, nil, nil
+	}
+	// If the export fell far behind (Redis outage, restart), backfill along the
+	// canonical chain instead of walking back from the head
+	if head.Number.Uint64() > old.Number.Uint64()+maxExportGap {
+		if canon := e.chain.GetHeaderByNumber(old.Number.Uint64()); canon != nil && canon.Hash() == old.Hash() {
+			return e.backfill(old), nil, nil
+		}
+	}
+	newHead := head
+	for newHead.Number.Uint64() > old.Number.Uint64() {
+		if len(added) >= maxExportGap {
+			log.Warn("Redis export gap too large, exporting head only", "from", old.Number, "to", head.Number)
+			exportDroppedMeter.Mark(int64(head.Number.Uint64() - old.Number.Uint64() - 1))
+			return []*types.Header{head}, nil, nil
+		}
+		added = append(added, newHead)
+		if newHead = e.chain.GetHeader(newHead.ParentHash, newHead.Number.Uint64()-1); newHead == nil {
+			return nil, nil, errors.New("missing ancestor of new head")
+		}
+	}
+	for old.Number.Uint64() > newHead.Number.Uint64() {
+		dropped = append(dropped, old)
+		if old = e.chain.GetHeader(old.ParentHash, old.Number.Uint64()-1); old == nil {
+			return nil, nil, errors.New("missing ancestor of exported head")
+		}
+	}
+	for old.Hash() != newHead.Hash() {
+		if len(added) >= maxExportGap {
+			log.Warn("Redis export reorg too deep, exporting head only", "number", head.Number)
+			return []*types.Header{head}, dropped, nil
+		}
+		added, dropped = append(added, newHead), append(dropped, old)
+
+		old = e.chain.GetHeader(old.ParentHash, old.Number.Uint64()-1)
+		newHead = e.chain.GetHeader(newHead.ParentHash, newHead.Number.Uint64()-1)
+		if old == nil || newHead == nil {
+			return nil, nil, errors.New("missing ancestor during reorg")
+		}
+	}
+	for i, j := 0, len(added)-1; i < j; i, j = i+1, j-1 {
+		added[i], added[j] = added[j], added[i]
+	}
+	return added, dropped, nil
+}
+
+// backfill returns the next batch of canonical headers following the given one.
+func (e *Exporter) backfill(from *types.Header) []*types.Header {
+	var headers []*types.Header
+	for parent := from; len(headers) < maxExportGap; {
+		header := e.chain.GetHeaderByNumber(parent.Number.Uint64() + 1)
+		if header == nil || header.ParentHash != parent.Hash() {
+			break
+		}
+		headers = append(headers, header)
+		parent = header
+	}
+	return headers
+}
+
+// syncPool reconciles the mempool mirror with the pool. It runs after every
+// exported head, so the transactions of the head are already marked as mined
+// before the pool is checked for disappeared ones. The full contents of the pool
+// are only synced on startup, after resyncs, every poolSyncInterval heads and
+// whenever pool events were not mirrored meanwhile (paused, not elected or the
+// transaction queue overflowed). The mirror otherwise follows the pool events,
+// and refreshes the senders of mined transactions for demotions.
+func (e *Exporter) syncPool() {
+	if e.txsLost.Swap(false) || e.poolHeads >= poolSyncInterval {
+		e.poolSynced = false
+	}
+	var err error
+	if e.poolSynced {
+		e.poolHeads++
+		if err = e.txMgr.Refresh(); err == nil {
+			err = e.txMgr.Reconcile()
+		}
+	} else if err = e.txMgr.Sync(); err == nil {
+		e.poolSynced, e.poolHeads = true, 0
+	}
+	if err != nil {
+		// Statuses may have been skipped, sync in full on the next head
+		e.poolSynced = false
+
+		exportErrorMeter.Mark(1)
+		e.failures.Add(1)
+		log.Error("Failed to sync Redis mempool mirror", "err", err)
+	}
+}
+
+// removeBlock marks a previously exported block as dropped by a reorg.
+func (e *Exporter) removeBlock(header *types.Header) error {
+	block := e.chain.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return errMissingBlock
+	}
+	return e.store.RemoveBlock(block, blockLogs(e.chain.GetReceiptsByHash(block.Hash())))
+}
+
+// blockLogs collects the logs of all receipts of a block.
+func blockLogs(receipts types.Receipts) []*types.Log {
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	return logs
+}
+
+// exportBlock writes a single block with its logs into Redis, removes its
+// transactions from the mempool mirror and moves the export cursor to it.
+func (e *Exporter) exportBlock(header *types.Header) error {
+	defer exportTimer.UpdateSince(time.Now())
+
+	block := e.chain.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return errMissingBlock
+	}
+	if err := e.store.CommitBlock(block, e.chain.GetReceiptsByHash(block.Hash()), e.chain.Config()); err != nil {
+		return err
+	}
+	e.advance(header)
+	exportBlockMeter.Mark(1)
+	return nil
+}
@@ -0,0 +1,234 @@
+package redisstore
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testChain is a header-only chain used to test the export segment logic.
+type testChain struct {
+	headers map[common.Hash]*types.Header
+	head    *types.Header
+}
+
+func newTestChain() *testChain {
+	return &testChain{headers: make(map[common.Hash]*types.Header)}
+}
+
+// extend appends n headers on top of parent, using extra to fork the chain.
+func (c *testChain) extend(parent *types.Header, n int, extra byte) []*types.Header {
+	var headers []*types.Header
+	for i := 0; i < n; i++ {
+		header := &types.Header{Number: big.NewInt(0), Extra: []byte{extra}}
+		if parent != nil {
+			header.ParentHash = parent.Hash()
+			header.Number = new(big.Int).Add(parent.Number, common.Big1)
+		}
+		c.headers[header.Hash()] = header
+		headers = append(headers, header)
+		parent = header
+	}
+	c.head = parent
+	return headers
+}
+
+func (c *testChain) Config() *params.ChainConfig { return params.TestChainConfig }
+
+func (c *testChain) CurrentBlock() *types.Header { return c.head }
+
+func (c *testChain) CurrentFinalBlock() *types.Header { return nil }
+
+func (c *testChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header { return c.headers[hash] }
+
+func (c *testChain) GetHeaderByNumber(number uint64) *types.Header {
+	for header := c.head; header != nil; header = c.headers[header.ParentHash] {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+func (c *testChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	if header := c.GetHeader(hash, number); header != nil {
+		return types.NewBlockWithHeader(header)
+	}
+	return nil
+}
+
+func (c *testChain) GetReceiptsByHash(hash common.Hash) types.Receipts { return nil }
+
+func (c *testChain) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return event.NewSubscription(func(<-chan struct{}) error { return nil })
+}
+
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return event.NewSubscription(func(<-chan struct{}) error { return nil })
+}
+
+func checkHeaders(t *testing.T, kind string, have, want []*types.Header) {
+	t.Helper()
+	if len(have) != len(want) {
+		t.Fatalf("%s headers count mismatch: have %d, want %d", kind, len(have), len(want))
+	}
+	for i := range have {
+		if have[i].Hash() != want[i].Hash() {
+			t.Errorf("%s header %d mismatch: have #%d, want #%d", kind, i, have[i].Number, want[i].Number)
+		}
+	}
+}
+
+func TestExportSegment(t *testing.T) {
+	chain := newTestChain()
+	main := chain.extend(nil, 6, 0)          // #0..#5
+	fork := chain.extend(main[3], 3, 1)      // #4..#6 on top of #3
+	rewind := chain.extend(main[1], 1, 2)[0] // #2 on top of #1
+	exporter := NewExporter(&DefaultConfig, rawdb.NewMemoryDatabase(), chain, nil)
+
+	// First export only includes the head
+	added, dropped, err := exporter.segment(main[2])
+	if err != nil {
+		t.Fatalf("failed to compute segment: %v", err)
+	}
+	checkHeaders(t, "added", added, main[2:3])
+	checkHeaders(t, "dropped", dropped, nil)
+
+	// Linear extension includes all skipped blocks
+	exporter.exported = main[2]
+	added, dropped, _ = exporter.segment(main[5])
+	checkHeaders(t, "added", added, main[3:6])
+	checkHeaders(t, "dropped", dropped, nil)
+
+	// Reorg onto a longer fork drops the old blocks in descending order
+	exporter.exported = main[5]
+	added, dropped, _ = exporter.segment(fork[2])
+	checkHeaders(t, "added", added, fork)
+	checkHeaders(t, "dropped", dropped, []*types.Header{main[5], main[4]})
+
+	// Rewind to a lower sibling
+	exporter.exported = main[5]
+	added, dropped, _ = exporter.segment(rewind)
+	checkHeaders(t, "added", added, []*types.Header{rewind})
+	checkHeaders(t, "dropped", dropped, []*types.Header{main[5], main[4], main[3], main[2]})
+
+	// Re-announcing the exported head is a noop
+	exporter.exported = main[5]
+	added, dropped, _ = exporter.segment(main[5])
+	checkHeaders(t, "added", added, nil)
+	checkHeaders(t, "dropped", dropped, nil)
+}
+
+func TestExportBackfill(t *testing.T) {
+	chain := newTestChain()
+	headers := chain.extend(nil, 2*maxExportGap+10, 0)
+	exporter := NewExporter(&DefaultConfig, rawdb.NewMemoryDatabase(), chain, nil)
+
+	// A gap beyond the walk limit is backfilled in canonical batches
+	exporter.exported = headers[5]
+	added, dropped, err := exporter.segment(chain.head)
+	if err != nil {
+		t.Fatalf("failed to compute segment: %v", err)
+	}
+	checkHeaders(t, "added", added, headers[6:6+maxExportGap])
+	checkHeaders(t, "dropped", dropped, nil)
+
+	// A non-canonical export position can't be backfilled, export the head
+	fork := chain.extend(headers[5], 1, 1)
+	chain.head = headers[len(headers)-1]
+	exporter.exported = fork[0]
+	added, _, _ = exporter.segment(chain.head)
+	checkHeaders(t, "added", added, headers[len(headers)-1:])
+}
+
+func TestExportAcknowledge(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		db       = rawdb.NewMemoryDatabase()
+		chain    = newTestChain()
+		headers  = chain.extend(nil, 3, 0)
+		exporter = NewExporter(&DefaultConfig, db, chain, nil)
+	)
+	exporter.store = store
+
+	if hash := rawdb.ReadRedisExportHash(db); hash != (common.Hash{}) {
+		t.Fatalf("unexpected export cursor: %x", hash)
+	}
+	if err := exporter.acknowledge(headers[1]); err != nil {
+		t.Fatalf("failed to acknowledge block: %v", err)
+	}
+	if hash := rawdb.ReadRedisExportHash(db); hash != headers[1].Hash() {
+		t.Fatalf("export cursor mismatch: have %x, want %x", hash, headers[1].Hash())
+	}
+	if number, hash, _ := store.ExportCursor(); number != 1 || hash != headers[1].Hash() {
+		t.Fatalf("committed cursor mismatch: have #%d %x, want #1 %x", number, hash, headers[1].Hash())
+	}
+	if exporter.exported != headers[1] {
+		t.Fatalf("exported header mismatch: have #%d, want #1", exporter.exported.Number)
+	}
+}
+
+// Tests that after a failover the export resumes from the cursor committed to
+// Redis, rewound to the last block the new primary still holds.
+func TestExportFailover(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+	store.SetTTL(0)
+
+	var (
+		db       = rawdb.NewMemoryDatabase()
+		chain    = newTestChain()
+		base     = chain.extend(&types.Header{Number: big.NewInt(100)}, 6, 0)
+		exporter = NewExporter(&DefaultConfig, db, chain, nil)
+	)
+	exporter.store = store
+
+	// The primary holds all blocks, the replica only the first four
+	for _, header := range base[:4] {
+		if err := store.StoreBlock(types.NewBlockWithHeader(header), nil, params.TestChainConfig); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+	}
+	if err := store.SetExportCursor(base[5].Number.Uint64(), base[5].Hash()); err != nil {
+		t.Fatalf("Failed to commit cursor: %v", err)
+	}
+	exporter.exported = base[5]
+
+	if err := exporter.verify(); err != nil {
+		t.Fatalf("Failed to verify export: %v", err)
+	}
+	if exporter.exported.Hash() != base[3].Hash() {
+		t.Fatalf("Export not rewound: have #%d, want #%d", exporter.exported.Number, base[3].Number)
+	}
+	if hash := rawdb.ReadRedisExportHash(db); hash != base[3].Hash() {
+		t.Errorf("Local cursor not rewound: have %x, want %x", hash, base[3].Hash())
+	}
+	if _, hash, _ := store.ExportCursor(); hash != base[3].Hash() {
+		t.Errorf("Committed cursor not rewound: have %x, want %x", hash, base[3].Hash())
+	}
+	// Without errors or a primary change, the export is not verified again
+	exporter.exported = base[5]
+	if err := exporter.verify(); err != nil {
+		t.Fatalf("Failed to verify export: %v", err)
+	}
+	if exporter.exported != base[5] {
+		t.Errorf("Export verified without failover")
+	}
+}
@@ -0,0 +1,111 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-redis/redis/v8"
+)
+
+// Replication to Redis replicas is asynchronous, so a failover may promote a
+// replica missing the last writes of the old primary. The exporter therefore
+// commits its cursor to Redis after every block and, whenever the primaries
+// serving the store change, resumes from the cursor and the canonical markers
+// that survived instead of its own record.
+
+// exportCursorKey returns the key of the last block committed by the exporter
+// of a chain.
+func (k keyspace) exportCursorKey() string {
+	return fmt.Sprintf("%sexportcursor:{%s}", k.prefix, k.chainID)
+}
+
+// SetExportCursor records a block as the last one exported for the store's
+// chain. It must only be called once all data of the block is written. Fenced
+// writes are rejected as soon as a newer exporter was elected.
+func (s *RedisBlockStore) SetExportCursor(number uint64, hash common.Hash) error {
+	batch := new(slotBatch)
+	s.setCursor(batch, number, hash)
+	if err := s.writeSlot(batch); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to store export cursor: %w", err)
+	}
+	return nil
+}
+
+// setCursor adds the write of the export cursor of the chain to a batch. The
+// cursor is fenced against the token counter itself.
+func (s *RedisBlockStore) setCursor(batch *slotBatch, number uint64, hash common.Hash) {
+	key := s.keys.exportCursorKey()
+	batch.fence(s.keys.exportFenceKey(), 0)
+	batch.add(key, "HSET", key, "number", number, "hash", strings.ToLower(hash.Hex()))
+}
+
+// ExportCursor returns the last block exported for the store's chain, or a zero
+// hash if none was recorded.
+func (s *RedisBlockStore) ExportCursor() (uint64, common.Hash, error) {
+	fields, err := s.client.HGetAll(s.ctx, s.keys.exportCursorKey()).Result()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return 0, common.Hash{}, fmt.Errorf("failed to read export cursor: %v", err)
+	}
+	if len(fields) == 0 {
+		return 0, common.Hash{}, nil
+	}
+	number, err := strconv.ParseUint(fields["number"], 10, 64)
+	if err != nil {
+		return 0, common.Hash{}, fmt.Errorf("invalid export cursor number: %v", err)
+	}
+	return number, common.HexToHash(fields["hash"]), nil
+}
+
+// Primaries returns an identifier of the primaries currently serving the store,
+// which changes whenever a failover promotes a replica.
+func (s *RedisBlockStore) Primaries() (string, error) {
+	return primaryIDs(s.ctx, s.client)
+}
+
+// primaryIDs returns the sorted run ids of the primaries serving a client.
+func primaryIDs(ctx context.Context, client Backend) (string, error) {
+	runID := func(ctx context.Context, client interface {
+		Info(ctx context.Context, section ...string) *redis.StringCmd
+	}) (string, error) {
+		info, err := client.Info(ctx, "server").Result()
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(info, "\n") {
+			if id, ok := strings.CutPrefix(strings.TrimSpace(line), "run_id:"); ok {
+				return id, nil
+			}
+		}
+		return "", nil
+	}
+	cluster, ok := clusterClient(client)
+	if !ok {
+		return runID(ctx, client)
+	}
+	var (
+		ids  []string
+		lock sync.Mutex
+	)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		id, err := runID(ctx, client)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		ids = append(ids, id)
+		lock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	slices.Sort(ids)
+	return strings.Join(ids, ","), nil
+}
@@ -0,0 +1,217 @@
+package redisstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-redis/redis/v8"
+)
+
+// addrPendingKey returns the key of the sorted set of pool transactions sent
+// from or to an address, scored by sender nonce.
+func (k keyspace) addrPendingKey(addr common.Address) string {
+	return fmt.Sprintf("%saddr:%s:pending", k.prefix, strings.ToLower(addr.Hex()))
+}
+
+// addrMinedKey returns the key of the sorted set of canonical transactions sent
+// from or to an address, scored by block number.
+func (k keyspace) addrMinedKey(addr common.Address) string {
+	return fmt.Sprintf("%saddr:%s:mined", k.prefix, strings.ToLower(addr.Hex()))
+}
+
+// txBlockKey returns the key of the pointer from a canonical transaction to the
+// block including it.
+func (k keyspace) txBlockKey(hash common.Hash) string {
+	return fmt.Sprintf("%stxblock:%s", k.prefix, hash.Hex())
+}
+
+// txParties returns the addresses a transaction is indexed under: its sender,
+// its recipient or, for contract creations, the created contract.
+func txParties(from common.Address, to *common.Address, nonce uint64) []common.Address {
+	if to == nil {
+		return []common.Address{from, crypto.CreateAddress(from, nonce)}
+	}
+	if *to == from {
+		return []common.Address{from}
+	}
+	return []common.Address{from, *to}
+}
+
+// indexBlockTxs points the transactions of a canonical block at it and adds them
+// to the mined index of their parties.
+func (s *RedisBlockStore) indexBlockTxs(block *types.Block, signer types.Signer) error {
+	batch := newExportBatch()
+	if err := s.queueBlockTxs(batch, block, signer); err != nil {
+		return err
+	}
+	return s.commit(batch)
+}
+
+// queueBlockTxs adds the writes of indexBlockTxs to a batch.
+func (s *RedisBlockStore) queueBlockTxs(batch *exportBatch, block *types.Block, signer types.Signer) error {
+	var (
+		number = block.NumberU64()
+		writes = batch.writes
+		hash   = strings.ToLower(block.Hash().Hex())
+		age    = s.config.Retention.MinedTxs.Age
+	)
+	for i, tx := range block.Transactions() {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return fmt.Errorf("failed to recover sender of %x: %v", tx.Hash(), err)
+		}
+		key := s.keys.txBlockKey(tx.Hash())
+		writes.add(key, "HSET", key, "blockNumber", number, "blockHash", hash, "transactionIndex", i)
+		writes.expire(key, age)
+
+		for _, addr := range txParties(from, tx.To(), tx.Nonce()) {
+			key := s.keys.addrMinedKey(addr)
+			writes.add(key, "ZADD", key, number, tx.Hash().Hex())
+			writes.expire(key, age)
+		}
+	}
+	return nil
+}
+
+// unindexBlockTxs reverts indexBlockTxs for a block dropped by a reorg. Pointers
+// already overwritten by a block of the new chain are left alone.
+func (s *RedisBlockStore) unindexBlockTxs(block *types.Block) error {
+	var (
+		pipe = s.client.Pipeline()
+		hash = strings.ToLower(block.Hash().Hex())
+	)
+	for _, tx := range block.Transactions() {
+		from, err := types.Sender(txSigner(tx), tx)
+		if err != nil {
+			return fmt.Errorf("failed to recover sender of %x: %v", tx.Hash(), err)
+		}
+		pipe.Eval(s.ctx, unindexPointerScript, []string{s.keys.txBlockKey(tx.Hash())}, hash)
+		for _, addr := range txParties(from, tx.To(), tx.Nonce()) {
+			pipe.Eval(s.ctx, unindexEntryScript, []string{s.keys.addrMinedKey(addr)}, tx.Hash().Hex(), block.NumberU64())
+		}
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to unindex block transactions: %v", err)
+	}
+	return nil
+}
+
+// unindexPointerScript deletes the block pointer of a transaction, unless it was
+// already updated to a block of the new chain.
+//
+//	KEYS[1]  block pointer key
+//	ARGV[1]  dropped block hash
+const unindexPointerScript = `
+if redis.call('HGET', KEYS[1], 'blockHash') == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// unindexEntryScript removes a transaction from the mined index of a party,
+// unless it was already re-added for a block of the new chain.
+//
+//	KEYS[1]  mined index key
+//	ARGV[1]  transaction hash
+//	ARGV[2]  dropped block number
+const unindexEntryScript = `
+if tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1])) == tonumber(ARGV[2]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`
+
+// queueIndexPendingTx adds the writes adding a pool transaction to the pending
+// index of its parties to a batch.
+func (tm *TxManager) queueIndexPendingTx(batch *slotBatch, tx *types.Transaction, from common.Address) {
+	for _, addr := range txParties(from, tx.To(), tx.Nonce()) {
+		key := tm.store.keys.addrPendingKey(addr)
+		batch.add(key, "ZADD", key, tx.Nonce(), tx.Hash().Hex())
+		batch.expire(key, tm.store.config.Retention.PendingTxs.Age)
+	}
+}
+
+// queueUnindexPendingTxs adds the writes removing mirrored transactions from the
+// pending index of their parties to a batch. The parties are looked up from the
+// mirror itself.
+func (tm *TxManager) queueUnindexPendingTxs(batch *slotBatch, hashes []common.Hash) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	pipe := tm.client.Pipeline()
+	lookups := make([]*redis.SliceCmd, len(hashes))
+	for i, hash := range hashes {
+		lookups[i] = pipe.HMGet(tm.ctx, tm.store.keys.txKey(hash), "from", "to", "contractAddress")
+	}
+	if _, err := pipe.Exec(tm.ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to look up transaction parties: %v", err)
+	}
+	for i, lookup := range lookups {
+		for _, party := range lookup.Val() {
+			if addr, ok := party.(string); ok && common.IsHexAddress(addr) {
+				key := tm.store.keys.addrPendingKey(common.HexToAddress(addr))
+				batch.add(key, "ZREM", key, hashes[i].Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// PendingTxsByAddress returns the hashes of the pool transactions sent from or
+// to an address, ordered by sender nonce.
+func (tm *TxManager) PendingTxsByAddress(addr common.Address) ([]common.Hash, error) {
+	members, err := tm.client.ZRange(tm.ctx, tm.store.keys.addrPendingKey(addr), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending index: %v", err)
+	}
+	return parseHashes(members), nil
+}
+
+// MinedTxsByAddress returns the hashes of the canonical transactions sent from
+// or to an address within a block range, ordered by block number.
+func (s *RedisBlockStore) MinedTxsByAddress(addr common.Address, from, to uint64) ([]common.Hash, error) {
+	members, err := s.client.ZRangeByScore(s.ctx, s.keys.addrMinedKey(addr), &redis.ZRangeBy{
+		Min: strconv.FormatUint(from, 10),
+		Max: strconv.FormatUint(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mined index: %v", err)
+	}
+	return parseHashes(members), nil
+}
+
+// GetTxBlock returns the number, hash and position of the canonical block
+// including a transaction. A zero hash is returned if the transaction is not
+// known to be mined.
+func (s *RedisBlockStore) GetTxBlock(hash common.Hash) (uint64, common.Hash, uint, error) {
+	fields, err := s.client.HGetAll(s.ctx, s.keys.txBlockKey(hash)).Result()
+	if err != nil {
+		return 0, common.Hash{}, 0, fmt.Errorf("failed to read transaction block: %v", err)
+	}
+	if len(fields) == 0 {
+		return 0, common.Hash{}, 0, nil
+	}
+	number, err := strconv.ParseUint(fields["blockNumber"], 10, 64)
+	if err != nil {
+		return 0, common.Hash{}, 0, fmt.Errorf("invalid transaction block number: %v", err)
+	}
+	index, err := strconv.ParseUint(fields["transactionIndex"], 10, 64)
+	if err != nil {
+		return 0, common.Hash{}, 0, fmt.Errorf("invalid transaction index: %v", err)
+	}
+	return number, common.HexToHash(fields["blockHash"]), uint(index), nil
+}
+
+// parseHashes converts sorted set members into transaction hashes.
+func parseHashes(members []string) []common.Hash {
+	hashes := make([]common.Hash, len(members))
+	for i, member := range members {
+		hashes[i] = common.HexToHash(member)
+	}
+	return hashes
+}
@@ -0,0 +1,109 @@
+package redisstore
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that pool transactions are indexed under their sender and recipient, or
+// created contract, for as long as they are mirrored.
+func TestPendingAddressIndex(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	txMgr := NewTxManager(store)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		to     = common.BytesToAddress(crypto.Keccak256(sender.Bytes()))
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+
+		call   = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 1, To: &to, Gas: 21000, GasPrice: big.NewInt(1)})
+		create = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 53000, GasPrice: big.NewInt(1)})
+	)
+	for _, tx := range []*types.Transaction{call, create} {
+		if err := txMgr.storeTxSync(tx); err != nil {
+			t.Fatalf("Failed to store transaction: %v", err)
+		}
+	}
+	check := func(addr common.Address, want ...common.Hash) {
+		t.Helper()
+		have, err := txMgr.PendingTxsByAddress(addr)
+		if err != nil {
+			t.Fatalf("Failed to read pending index of %x: %v", addr, err)
+		}
+		if !slices.Equal(have, want) {
+			t.Errorf("Pending index of %x mismatch: have %x, want %x", addr, have, want)
+		}
+	}
+	check(sender, create.Hash(), call.Hash()) // ordered by nonce
+	check(to, call.Hash())
+	check(crypto.CreateAddress(sender, 0), create.Hash())
+
+	if err := txMgr.RemoveTxs([]common.Hash{call.Hash(), create.Hash()}); err != nil {
+		t.Fatalf("Failed to remove transactions: %v", err)
+	}
+	check(sender)
+	check(to)
+	check(crypto.CreateAddress(sender, 0))
+}
+
+// Tests that exported block transactions are indexed by block and address, and
+// that reorgs only revert the index entries of the dropped block.
+func TestMinedAddressIndex(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	var (
+		key, _ = crypto.GenerateKey()
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		to     = common.BytesToAddress(crypto.Keccak256(sender.Bytes()))
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+		number = uint64(1)
+
+		tx     = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, To: &to, Gas: 21000, GasPrice: big.NewInt(1)})
+		blockA = types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte("a")}, &types.Body{Transactions: types.Transactions{tx}}, nil, trie.NewStackTrie(nil))
+		blockB = types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(number + 1), Extra: []byte("b")}, &types.Body{Transactions: types.Transactions{tx}}, nil, trie.NewStackTrie(nil))
+	)
+	if err := store.indexBlockTxs(blockA, signer); err != nil {
+		t.Fatalf("Failed to index block: %v", err)
+	}
+	n, hash, index, err := store.GetTxBlock(tx.Hash())
+	if err != nil || n != number || hash != blockA.Hash() || index != 0 {
+		t.Errorf("Transaction block mismatch: have %d %x %d (%v), want %d %x 0", n, hash, index, err, number, blockA.Hash())
+	}
+	for _, addr := range []common.Address{sender, to} {
+		if have, _ := store.MinedTxsByAddress(addr, number, number); !slices.Equal(have, []common.Hash{tx.Hash()}) {
+			t.Errorf("Mined index of %x mismatch: have %x", addr, have)
+		}
+		if have, _ := store.MinedTxsByAddress(addr, number+1, number+10); len(have) != 0 {
+			t.Errorf("Mined index of %x out of range: have %x", addr, have)
+		}
+	}
+	// Reorg the transaction into a later block, indexing the new block first
+	if err := store.indexBlockTxs(blockB, signer); err != nil {
+		t.Fatalf("Failed to index block: %v", err)
+	}
+	if err := store.unindexBlockTxs(blockA); err != nil {
+		t.Fatalf("Failed to unindex block: %v", err)
+	}
+	if n, hash, _, _ := store.GetTxBlock(tx.Hash()); n != number+1 || hash != blockB.Hash() {
+		t.Errorf("Transaction block mismatch after reorg: have %d %x, want %d %x", n, hash, number+1, blockB.Hash())
+	}
+	// Dropping the last block including it removes the transaction entirely
+	if err := store.unindexBlockTxs(blockB); err != nil {
+		t.Fatalf("Failed to unindex block: %v", err)
+	}
+	if _, hash, _, _ := store.GetTxBlock(tx.Hash()); hash != (common.Hash{}) {
+		t.Errorf("Transaction block pointer left after reorg: %x", hash)
+	}
+	if have, _ := store.MinedTxsByAddress(sender, 0, number+10); len(have) != 0 {
+		t.Errorf("Mined index left after reorg: have %x", have)
+	}
+}
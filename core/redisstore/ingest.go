@@ -0,0 +1,294 @@
+package redisstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/txpool/locals"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// Services running next to Redis may submit signed transactions to the pool
+// without access to the node's RPC endpoints, by appending them to the ingest
+// stream of the chain. The nodes read the stream in a shared consumer group, so
+// every entry is submitted by a single node, and publish the outcome of every
+// submission on the ingest results stream.
+//
+// Entries of the ingest stream have the fields:
+//
+//	raw    hex encoded signed transaction, in its network encoding for blob transactions
+//	local  1 to submit the transaction as a local one, tracked until included and
+//	       never gossiped to peers
+//
+// Entries of the ingest results stream have the fields:
+//
+//	id      id of the ingest stream entry
+//	hash    transaction hash, empty if the transaction could not be decoded
+//	status  accepted, tracked (local transaction not yet accepted by the pool, but
+//	        resubmitted until it is) or rejected
+//	error   reason of the rejection, or the pool's error for tracked transactions
+//
+// An entry is acknowledged once its result is published. Entries delivered to a
+// node that stopped before acknowledging them are submitted again when the node
+// restarts with the same NodeID.
+
+// Names of the streams transactions are ingested through.
+const (
+	IngestStream        = "ingest"        // Signed transactions submitted to the pool
+	IngestResultsStream = "ingestResults" // Outcome of every ingested transaction
+)
+
+// Outcomes of ingested transactions.
+const (
+	IngestAccepted = "accepted" // Accepted by the pool
+	IngestTracked  = "tracked"  // Temporarily rejected local transaction, resubmitted until accepted
+	IngestRejected = "rejected" // Rejected by the pool or undecodable
+)
+
+const (
+	// ingestBatch is the maximum number of entries read from the ingest stream
+	// and submitted to the pool at once.
+	ingestBatch = 64
+
+	// ingestWait is the time a read of the ingest stream waits for new entries,
+	// bounding the time it takes to notice the exporter stopping.
+	ingestWait = time.Second
+
+	// privateTxsSize is the number of local ingested transactions remembered as
+	// not to be gossiped.
+	privateTxsSize = 1 << 16
+)
+
+var (
+	ingestAcceptedMeter = metrics.NewRegisteredMeter("redis/ingest/accepted", nil)
+	ingestRejectedMeter = metrics.NewRegisteredMeter("redis/ingest/rejected", nil)
+)
+
+// LocalTracker tracks locally submitted transactions, resubmitting them to the
+// pool until they are included.
+type LocalTracker interface {
+	// Track adds a transaction to the tracked set.
+	Track(tx *types.Transaction)
+}
+
+// CreateIngestGroup creates the consumer group the ingest stream of the store's
+// chain is read in, starting with the oldest entry retained. An existing group
+// is left as is.
+func (s *RedisBlockStore) CreateIngestGroup(group string) error {
+	err := s.client.XGroupCreateMkStream(s.ctx, s.keys.streamKey(IngestStream), group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create ingest group %s: %v", group, err)
+	}
+	return nil
+}
+
+// readIngest reads the next entries of the ingest stream delivered to a consumer,
+// waiting for them for a while. If pending is set, the entries delivered to the
+// consumer before but not yet acknowledged are returned instead.
+func (s *RedisBlockStore) readIngest(group, consumer string, pending bool) ([]redis.XMessage, error) {
+	id := ">"
+	if pending {
+		id = "0"
+	}
+	streams, err := s.client.XReadGroup(s.ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{s.keys.streamKey(IngestStream), id},
+		Count:    ingestBatch,
+		Block:    ingestWait,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to read ingest stream: %v", err)
+	}
+	var msgs []redis.XMessage
+	for _, stream := range streams {
+		msgs = append(msgs, stream.Messages...)
+	}
+	return msgs, nil
+}
+
+// ackIngest acknowledges processed entries of the ingest stream.
+func (s *RedisBlockStore) ackIngest(group string, ids ...string) error {
+	if err := s.client.XAck(s.ctx, s.keys.streamKey(IngestStream), group, ids...).Err(); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to acknowledge ingested transactions: %v", err)
+	}
+	return nil
+}
+
+// ingestResult is the outcome of an entry of the ingest stream.
+type ingestResult struct {
+	id     string      // Id of the ingest stream entry
+	hash   common.Hash // Transaction hash, zero if undecodable
+	status string      // Outcome of the submission
+	err    error       // Rejection reason, or the pool's error for tracked transactions
+}
+
+// publishIngestResult announces the outcome of an ingested transaction. Nodes
+// ingest whether elected or not, so results are never fenced.
+func (s *RedisBlockStore) publishIngestResult(res *ingestResult) error {
+	var hash, reason string
+	if res.hash != (common.Hash{}) {
+		hash = strings.ToLower(res.hash.Hex())
+	}
+	if res.err != nil {
+		reason = res.err.Error()
+	}
+	return s.publishFenced(0, IngestResultsStream,
+		"id", res.id,
+		"hash", hash,
+		"status", res.status,
+		"error", reason,
+	)
+}
+
+// IsPrivate returns whether a transaction was ingested as a local one, and must
+// therefore not be gossiped to peers.
+func (e *Exporter) IsPrivate(hash common.Hash) bool {
+	return e.private.Contains(hash)
+}
+
+// SetLocalTracker sets the tracker local ingested transactions are handed to. It
+// must be called before the exporter is started. Without one, local transactions
+// are only kept from being gossiped.
+func (e *Exporter) SetLocalTracker(tracker LocalTracker) {
+	e.locals = tracker
+}
+
+// ingestLoop submits the transactions appended to the ingest stream to the pool
+// until the exporter is stopped. Entries left unacknowledged by a previous run
+// of the node are submitted first.
+func (e *Exporter) ingestLoop() {
+	defer e.wg.Done()
+
+	pending := true
+	for {
+		select {
+		case <-e.quit:
+			return
+		default:
+		}
+		// Redis is left alone while paused
+		if e.paused.Load() {
+			select {
+			case <-time.After(ingestWait):
+				continue
+			case <-e.quit:
+				return
+			}
+		}
+		msgs, err := e.store.readIngest(e.config.IngestGroup, e.node, pending)
+		if err != nil {
+			log.Warn("Failed to read Redis ingest stream", "err", err)
+			select {
+			case <-time.After(ingestWait):
+			case <-e.quit:
+				return
+			}
+			continue
+		}
+		if len(msgs) == 0 {
+			pending = false
+			continue
+		}
+		results := e.ingest(msgs)
+
+		ids := make([]string, 0, len(results))
+		for _, res := range results {
+			if err := e.store.publishIngestResult(res); err != nil {
+				log.Warn("Failed to publish Redis ingest result", "id", res.id, "hash", res.hash, "err", err)
+				break
+			}
+			ids = append(ids, res.id)
+		}
+		if len(ids) > 0 {
+			if err := e.store.ackIngest(e.config.IngestGroup, ids...); err != nil {
+				log.Warn("Failed to acknowledge Redis ingest entries", "count", len(ids), "err", err)
+			}
+		}
+		// Entries whose result was not published are still pending, retry
+		// them first
+		if len(ids) < len(results) {
+			pending = true
+		}
+	}
+}
+
+// ingest decodes a batch of ingest stream entries and submits the transactions
+// to the pool, returning the outcome of every entry.
+func (e *Exporter) ingest(msgs []redis.XMessage) []*ingestResult {
+	var (
+		results = make([]*ingestResult, len(msgs))
+		txs     []*types.Transaction
+		local   []bool
+		index   []int // Result index of every submitted transaction
+	)
+	for i, msg := range msgs {
+		results[i] = &ingestResult{id: msg.ID, status: IngestRejected}
+
+		raw, _ := msg.Values["raw"].(string)
+		blob, err := hexutil.Decode(raw)
+		if err != nil {
+			results[i].err = fmt.Errorf("invalid raw transaction: %v", err)
+			continue
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(blob); err != nil {
+			results[i].err = fmt.Errorf("invalid raw transaction: %v", err)
+			continue
+		}
+		results[i].hash = tx.Hash()
+
+		flag, _ := msg.Values["local"].(string)
+		isLocal := flag == "1" || flag == "true"
+		if isLocal {
+			// Keep the transaction off the network before the pool
+			// announces it
+			e.private.Add(tx.Hash(), struct{}{})
+		}
+		txs = append(txs, tx)
+		local = append(local, isLocal)
+		index = append(index, i)
+	}
+	if len(txs) == 0 {
+		ingestRejectedMeter.Mark(int64(len(msgs)))
+		return results
+	}
+	errs := e.pool.Add(txs, false)
+	for j, tx := range txs {
+		res, err := results[index[j]], errs[j]
+		switch {
+		case err == nil:
+			res.status = IngestAccepted
+		case local[j] && e.locals != nil && locals.IsTemporaryReject(err):
+			res.status, res.err = IngestTracked, err
+		default:
+			res.err = err
+		}
+		if local[j] {
+			if res.status == IngestRejected {
+				e.private.Remove(tx.Hash())
+			} else if e.locals != nil {
+				e.locals.Track(tx)
+			}
+		}
+	}
+	for _, res := range results {
+		if res.status == IngestRejected {
+			ingestRejectedMeter.Mark(1)
+		} else {
+			ingestAcceptedMeter.Mark(1)
+		}
+	}
+	return results
+}
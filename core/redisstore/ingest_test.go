@@ -0,0 +1,94 @@
+package redisstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-redis/redis/v8"
+)
+
+// Tests that transactions appended to the ingest stream are submitted to the
+// pool, and that the outcome of every entry is published and acknowledged.
+func TestIngest(t *testing.T) {
+	node := newTestNode(t, func(config *Config) {
+		config.Ingest = true
+	})
+	store := node.exporter.store
+
+	submit := func(raw string, local bool) string {
+		values := map[string]interface{}{"raw": raw}
+		if local {
+			values["local"] = "1"
+		}
+		id, err := node.backend.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: store.keys.streamKey(IngestStream),
+			Values: values,
+		}).Result()
+		if err != nil {
+			t.Fatalf("Failed to append to ingest stream: %v", err)
+		}
+		return id
+	}
+	encode := func(tx *types.Transaction) string {
+		blob, _ := tx.MarshalBinary()
+		return hexutil.Encode(blob)
+	}
+	var (
+		remote = emitTx(0)
+		local  = emitTx(1)
+		ids    = []string{
+			submit(encode(remote), false),
+			submit(encode(remote), false),
+			submit("0xc0ffee", false),
+			submit(encode(local), true),
+		}
+	)
+	var results []map[string]interface{}
+	waitFor(t, "ingest results", func() bool {
+		results = node.stream(t, IngestResultsStream)
+		return len(results) == len(ids)
+	})
+	tests := []struct {
+		hash   string
+		status string
+		reason string
+	}{
+		{hash: strings.ToLower(remote.Hash().Hex()), status: IngestAccepted},
+		{hash: strings.ToLower(remote.Hash().Hex()), status: IngestRejected, reason: "already known"},
+		{hash: "", status: IngestRejected, reason: "invalid raw transaction"},
+		{hash: strings.ToLower(local.Hash().Hex()), status: IngestAccepted},
+	}
+	for i, tt := range tests {
+		res := results[i]
+		if res["id"] != ids[i] {
+			t.Errorf("result %d: id mismatch: have %v, want %s", i, res["id"], ids[i])
+		}
+		if res["hash"] != tt.hash {
+			t.Errorf("result %d: hash mismatch: have %v, want %s", i, res["hash"], tt.hash)
+		}
+		if res["status"] != tt.status {
+			t.Errorf("result %d: status mismatch: have %v, want %s", i, res["status"], tt.status)
+		}
+		if reason, _ := res["error"].(string); !strings.Contains(reason, tt.reason) || (tt.reason == "" && reason != "") {
+			t.Errorf("result %d: error mismatch: have %q, want %q", i, reason, tt.reason)
+		}
+	}
+	for _, tx := range []*types.Transaction{remote, local} {
+		if !node.pool.Has(tx.Hash()) {
+			t.Errorf("Ingested transaction %x not pooled", tx.Hash())
+		}
+	}
+	if node.exporter.IsPrivate(remote.Hash()) {
+		t.Errorf("Remote transaction kept from gossip")
+	}
+	if !node.exporter.IsPrivate(local.Hash()) {
+		t.Errorf("Local transaction not kept from gossip")
+	}
+	// Every entry was acknowledged
+	if pending, err := store.readIngest(node.exporter.config.IngestGroup, node.exporter.node, true); err != nil || len(pending) != 0 {
+		t.Errorf("Unacknowledged ingest entries: %v, %v", pending, err)
+	}
+}
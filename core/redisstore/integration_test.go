@@ -0,0 +1,284 @@
+package redisstore
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/txpool/legacypool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testEmitter = common.HexToAddress("0xe1e1")
+
+	// testGenesis funds the test account and deploys a contract emitting a log
+	// with topic 0xff on every call.
+	testGenesis = &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: types.GenesisAlloc{
+			testAddr:    {Balance: big.NewInt(params.Ether)},
+			testEmitter: {Code: []byte{0x60, 0xff, 0x60, 0x00, 0x60, 0x00, 0xa1, 0x00}}, // LOG1(0, 0, 0xff)
+		},
+		BaseFee: big.NewInt(params.InitialBaseFee),
+	}
+	testSigner = types.LatestSigner(params.TestChainConfig)
+)
+
+// testNode is a full chain and transaction pool exporting into an in-process
+// backend.
+type testNode struct {
+	chain    *core.BlockChain
+	pool     *txpool.TxPool
+	exporter *Exporter
+	backend  *MemoryBackend
+}
+
+// newTestNode starts the export of a new chain initialized with testGenesis,
+// applying the given changes to the default configuration.
+func newTestNode(t *testing.T, configure ...func(*Config)) *testNode {
+	t.Helper()
+
+	db := rawdb.NewMemoryDatabase()
+	chain, err := core.NewBlockChain(db, testGenesis, ethash.NewFaker(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	txconfig := legacypool.DefaultConfig
+	txconfig.Journal = ""
+	pool, err := txpool.New(txconfig.PriceLimit, chain, []txpool.SubPool{legacypool.New(txconfig, chain)})
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	config := DefaultConfig
+	config.Spool = ""
+	for _, fn := range configure {
+		fn(&config)
+	}
+
+	node := &testNode{chain: chain, pool: pool, backend: NewMemoryBackend()}
+	node.exporter = NewExporter(&config, db, chain, pool)
+	node.exporter.backend = node.backend
+	if err := node.exporter.Start(); err != nil || node.exporter.store == nil {
+		t.Fatalf("Failed to start exporter: %v", err)
+	}
+	t.Cleanup(func() {
+		node.exporter.Stop()
+		pool.Close()
+		chain.Stop()
+	})
+	waitExported(t, node.exporter, chain.CurrentBlock())
+	return node
+}
+
+// insert imports blocks and waits for the export to catch up with the new head.
+func (n *testNode) insert(t *testing.T, blocks []*types.Block) {
+	t.Helper()
+
+	if _, err := n.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to insert blocks: %v", err)
+	}
+	waitExported(t, n.exporter, n.chain.CurrentBlock())
+}
+
+// stream returns the entries of a stream of the exported chain.
+func (n *testNode) stream(t *testing.T, name string) []map[string]interface{} {
+	t.Helper()
+
+	store := n.exporter.store
+	msgs, err := store.client.XRange(store.ctx, store.keys.streamKey(name), "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read %s stream: %v", name, err)
+	}
+	entries := make([]map[string]interface{}, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = msg.Values
+	}
+	return entries
+}
+
+// waitFor polls a condition until it holds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+// emitTx creates a call of the log emitting contract.
+func emitTx(nonce uint64) *types.Transaction {
+	return types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &testEmitter,
+		Gas:      50000,
+		GasPrice: big.NewInt(2 * params.InitialBaseFee),
+	})
+}
+
+// makeChain generates blocks on top of the genesis, calling the log emitting
+// contract in the given blocks.
+func makeChain(n int, calls ...int) []*types.Block {
+	_, blocks, _ := core.GenerateChainWithGenesis(testGenesis, ethash.NewFaker(), n, func(i int, gen *core.BlockGen) {
+		if slices.Contains(calls, i) {
+			gen.AddTx(emitTx(gen.TxNonce(testAddr)))
+		}
+	})
+	return blocks
+}
+
+// Tests that imported blocks are exported with their receipts, logs and indexes
+// and announced on the streams.
+func TestIntegrationExport(t *testing.T) {
+	node := newTestNode(t)
+	store := node.exporter.store
+
+	blocks := makeChain(4, 0, 1, 2, 3)
+	node.insert(t, blocks)
+
+	for _, block := range blocks {
+		if hash, _ := store.GetCanonicalHash(block.NumberU64()); hash != block.Hash() {
+			t.Errorf("Block #%d canonical hash mismatch: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+		if logs, err := store.GetLogs(block.Hash()); err != nil || len(logs) != 1 || logs[0].Topics[0] != common.BytesToHash([]byte{0xff}) {
+			t.Errorf("Block #%d logs mismatch: %v, %v", block.NumberU64(), logs, err)
+		}
+		tx := block.Transactions()[0]
+		if receipt, err := store.GetTxReceipt(tx.Hash()); err != nil || receipt == nil {
+			t.Errorf("Block #%d receipt missing: %v", block.NumberU64(), err)
+		}
+		if number, hash, _, _ := store.GetTxBlock(tx.Hash()); number != block.NumberU64() || hash != block.Hash() {
+			t.Errorf("Block #%d transaction pointer mismatch: have #%d %x", block.NumberU64(), number, hash)
+		}
+	}
+	if mined, _ := store.MinedTxsByAddress(testAddr, 0, 4); len(mined) != 4 {
+		t.Errorf("Mined index mismatch: have %d transactions, want 4", len(mined))
+	}
+	// The genesis is exported on startup
+	if entries := node.stream(t, BlocksStream); len(entries) != 5 {
+		t.Errorf("Block events mismatch: have %d, want 5", len(entries))
+	}
+	if entries := node.stream(t, LogsStream); len(entries) != 4 {
+		t.Errorf("Log events mismatch: have %d, want 4", len(entries))
+	}
+	if number, hash, _ := store.ExportCursor(); hash != blocks[3].Hash() {
+		t.Errorf("Export cursor mismatch: have #%d %x", number, hash)
+	}
+}
+
+// Tests that a reorg demotes the dropped blocks, unindexes their transactions and
+// is announced before the blocks of the new chain.
+func TestIntegrationReorg(t *testing.T) {
+	node := newTestNode(t)
+	store := node.exporter.store
+
+	var (
+		main = makeChain(4, 0, 1, 2, 3)
+		fork = makeChain(5, 0)
+	)
+	node.insert(t, main)
+	node.insert(t, fork[1:])
+
+	for _, block := range fork {
+		if hash, _ := store.GetCanonicalHash(block.NumberU64()); hash != block.Hash() {
+			t.Errorf("Block #%d canonical hash mismatch: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+	}
+	for _, block := range main[1:] {
+		if logs, _ := store.GetRemovedLogs(block.Hash()); len(logs) != 1 || !logs[0].Removed {
+			t.Errorf("Block #%d removed logs mismatch: %v", block.NumberU64(), logs)
+		}
+		tx := block.Transactions()[0]
+		if number, _, _, _ := store.GetTxBlock(tx.Hash()); number != 0 {
+			t.Errorf("Reorged transaction %x still points to block #%d", tx.Hash(), number)
+		}
+		waitFor(t, "reorged transaction history", func() bool {
+			history, _ := node.exporter.txMgr.TxHistory(tx.Hash())
+			return slices.ContainsFunc(history, func(tr *TxTransition) bool { return tr.Status == TxStatusReorged })
+		})
+	}
+	// The fork becomes canonical with its first block
+	reorgs := node.stream(t, ReorgsStream)
+	if len(reorgs) != 1 || reorgs[0]["ancestor"] != "1" || reorgs[0]["dropped"] != "3" || reorgs[0]["newHash"] != fork[1].Hash().Hex() {
+		t.Errorf("Reorg events mismatch: %v", reorgs)
+	}
+}
+
+// Tests that pool transactions are mirrored, and leave the mirror once mined.
+func TestIntegrationTxPool(t *testing.T) {
+	node := newTestNode(t)
+	store, txMgr := node.exporter.store, node.exporter.txMgr
+
+	var (
+		blocks = makeChain(2, 0)
+		mined  = blocks[0].Transactions()[0]
+		next   = emitTx(1)
+	)
+	for _, err := range node.pool.Add([]*types.Transaction{mined, next}, true) {
+		if err != nil {
+			t.Fatalf("Failed to add transaction: %v", err)
+		}
+	}
+	waitFor(t, "mirrored transactions", func() bool {
+		pending, _ := txMgr.PendingTxsByAddress(testAddr)
+		return len(pending) == 2
+	})
+	if stored, err := txMgr.GetTx(next.Hash()); err != nil || stored.Nonce != 1 {
+		t.Fatalf("Mirrored transaction mismatch: %v, %v", stored, err)
+	}
+	node.insert(t, blocks)
+
+	waitFor(t, "mined transaction removal", func() bool {
+		pending, _ := txMgr.PendingTxsByAddress(testAddr)
+		return len(pending) == 1 && pending[0] == next.Hash()
+	})
+	history, _ := txMgr.TxHistory(mined.Hash())
+	if len(history) == 0 || history[len(history)-1].Status != TxStatusMined {
+		t.Errorf("Mined transaction history mismatch: %v", history)
+	}
+	if n, _ := store.client.Exists(store.ctx, store.keys.txKey(mined.Hash())).Result(); n != 0 {
+		t.Errorf("Mined transaction left in mirror")
+	}
+	if entries := node.stream(t, PendingTxsStream); len(entries) != 2 {
+		t.Errorf("Pending transaction events mismatch: have %d, want 2", len(entries))
+	}
+}
+
+// Tests that log queries are served from the log index over the connection of
+// the exporter, and only while it is connected.
+func TestIntegrationLogQueries(t *testing.T) {
+	node := newTestNode(t, func(config *Config) { config.LogIndex = true })
+
+	blocks := makeChain(4, 0, 1, 2, 3)
+	node.insert(t, blocks)
+
+	hashOf := func(number uint64) common.Hash { return node.chain.GetCanonicalHash(number) }
+	logs, ok, err := node.exporter.FilterLogs(context.Background(), 1, 4, hashOf, []common.Address{testEmitter}, nil)
+	if err != nil || !ok || len(logs) != 4 {
+		t.Fatalf("Log query mismatch: %d logs, served %v, %v", len(logs), ok, err)
+	}
+	for i, log := range logs {
+		if log.BlockHash != blocks[i].Hash() {
+			t.Errorf("Log %d block mismatch: have %x, want %x", i, log.BlockHash, blocks[i].Hash())
+		}
+	}
+	// An exporter not connected serves nothing
+	idle := NewExporter(&DefaultConfig, rawdb.NewMemoryDatabase(), node.chain, node.pool)
+	if _, ok, err := idle.FilterLogs(context.Background(), 1, 4, hashOf, []common.Address{testEmitter}, nil); ok || err != nil {
+		t.Errorf("Log query served without connection: %v", err)
+	}
+}
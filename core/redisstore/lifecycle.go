@@ -0,0 +1,548 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// Lifecycle statuses of a mirrored transaction.
+const (
+	TxStatusPending  = "pending"  // Executable in the pool
+	TxStatusQueued   = "queued"   // Waiting in the pool for a nonce gap to close
+	TxStatusReplaced = "replaced" // Superseded by another transaction with the same sender nonce
+	TxStatusDropped  = "dropped"  // Removed from the pool without being mined
+	TxStatusMined    = "mined"    // Included in a canonical block
+	TxStatusReorged  = "reorged"  // Included in a block that was reorged out
+)
+
+// Reasons recorded for dropped transactions. The pool does not report why it
+// discards a transaction, so the reason is inferred from the sender's nonce.
+const (
+	DropReasonNonceTooLow = "nonce too low" // Nonce consumed by a transaction the mirror did not see mined
+	DropReasonEvicted     = "evicted"       // Discarded due to pool limits, lifetime or balance
+)
+
+const (
+	// txTTL is the default expiry of mirrored transactions and their lifecycle
+	// history.
+	txTTL = 10 * 24 * time.Hour
+
+	// syncGrace is the number of consecutive pool checks a tracked transaction
+	// may be missing from the pool before it is considered dropped. It covers
+	// the window between the pool resetting to a new head and the exporter
+	// marking the transactions of that head as mined.
+	syncGrace = 2
+
+	// reconcileLimit is the maximum number of tracked transactions checked for
+	// presence in the pool after every exported head.
+	reconcileLimit = 1024
+
+	// minedRetention is the number of blocks mined transactions are remembered
+	// for, so stale pool views do not resurrect them and reorgs can be tracked.
+	minedRetention = 64
+)
+
+var (
+	redisTxReplacedMeter = metrics.NewRegisteredMeter("redis/txreplaced", nil)
+	redisTxEvictedMeter  = metrics.NewRegisteredMeter("redis/txevicted", nil)
+	redisTxMinedMeter    = metrics.NewRegisteredMeter("redis/txmined", nil)
+)
+
+// TxTransition is a single entry in the lifecycle history of a transaction.
+type TxTransition struct {
+	Status    string       `json:"status"`
+	Time      uint64       `json:"time"`
+	By        *common.Hash `json:"by,omitempty"`        // Replacement, for replaced transactions
+	Reason    string       `json:"reason,omitempty"`    // Inferred cause, for dropped transactions
+	Block     uint64       `json:"block,omitempty"`     // Block number, for mined and reorged transactions
+	BlockHash *common.Hash `json:"blockHash,omitempty"` // Block hash, for mined and reorged transactions
+}
+
+// txSlot is a sender nonce, held by at most one pool transaction at a time.
+type txSlot struct {
+	from  common.Address
+	nonce uint64
+}
+
+// liveTx is the tracked state of a transaction currently in the pool.
+type liveTx struct {
+	slot    txSlot
+	status  string
+	missing int // Number of consecutive checks the transaction was not in the pool
+}
+
+// blobSidecarKey returns the key of the sidecar commitments and proofs of a blob
+// transaction.
+func (k keyspace) blobSidecarKey(hash common.Hash) string {
+	return fmt.Sprintf("%sblobsidecar:%s", k.prefix, hash.Hex())
+}
+
+// txHistoryKey returns the key of the lifecycle history of a transaction.
+func (k keyspace) txHistoryKey(hash common.Hash) string {
+	return fmt.Sprintf("%stxhistory:%s", k.prefix, hash.Hex())
+}
+
+// admit records a transaction as being in the pool with the given status,
+// storing it if it is not mirrored yet. A different transaction holding the
+// same sender nonce is marked as replaced.
+func (tm *TxManager) admit(tx *types.Transaction, status string) error {
+	hash := tx.Hash()
+	from, err := types.Sender(txSigner(tx), tx)
+	if err != nil {
+		return fmt.Errorf("failed to recover sender: %v", err)
+	}
+	slot := txSlot{from: from, nonce: tx.Nonce()}
+
+	tm.liveLock.Lock()
+	if _, ok := tm.mined[hash]; ok {
+		// Stale pool view of a transaction already exported as mined
+		tm.liveLock.Unlock()
+		return nil
+	}
+	current := tm.live[hash]
+	if current != nil {
+		current.missing = 0
+		if current.status == status {
+			tm.liveLock.Unlock()
+			return nil
+		}
+		current.status = status
+	} else {
+		tm.live[hash] = &liveTx{slot: slot, status: status}
+	}
+	replaced, ok := tm.slots[slot]
+	if ok && replaced != hash {
+		delete(tm.live, replaced)
+	} else {
+		replaced = common.Hash{}
+	}
+	tm.slots[slot] = hash
+	tm.liveLock.Unlock()
+
+	// Store the transaction or update its status
+	if current == nil && !tm.stored(hash)[0] {
+		err = tm.writeTx(tx, status)
+	} else {
+		err = tm.setStatus(hash, status)
+	}
+	if err != nil {
+		tm.untrack(hash)
+		return err
+	}
+	if status == TxStatusPending && tm.sim != nil {
+		tm.sim.add(tx)
+	}
+	if replaced != (common.Hash{}) {
+		redisTxReplacedMeter.Mark(1)
+		return tm.leave(replaced, &TxTransition{Status: TxStatusReplaced, By: &hash})
+	}
+	return nil
+}
+
+// stored reports which of the given transactions are currently stored in Redis.
+// Transactions missing from the duplicate cache are looked up in Redis, and
+// cached until their keys expire.
+func (tm *TxManager) stored(hashes ...common.Hash) []bool {
+	var (
+		found  = make([]bool, len(hashes))
+		misses []int
+		ttls   []*redis.DurationCmd
+		pipe   = tm.client.Pipeline()
+	)
+	for i, hash := range hashes {
+		if tm.dupCache.contains(hash) {
+			found[i] = true
+			continue
+		}
+		misses = append(misses, i)
+		ttls = append(ttls, pipe.PTTL(tm.ctx, tm.store.keys.txKey(hash)))
+	}
+	if len(misses) == 0 {
+		return found
+	}
+	if _, err := pipe.Exec(tm.ctx); err != nil {
+		log.Debug("Failed to look up transactions in Redis", "count", len(misses), "err", err)
+		return found
+	}
+	for j, i := range misses {
+		// PTTL is -2 for missing keys and -1 for keys without expiry
+		switch ttl := ttls[j].Val(); {
+		case ttl == -1:
+			found[i] = true
+			tm.dupCache.add(hashes[i], 0)
+		case ttl > 0:
+			found[i] = true
+			tm.dupCache.add(hashes[i], ttl)
+		}
+	}
+	return found
+}
+
+// untrack forgets a transaction whose status failed to be written, so the next
+// pool event or sync retries it.
+func (tm *TxManager) untrack(hash common.Hash) {
+	tm.liveLock.Lock()
+	defer tm.liveLock.Unlock()
+
+	if live, ok := tm.live[hash]; ok {
+		if tm.slots[live.slot] == hash {
+			delete(tm.slots, live.slot)
+		}
+		delete(tm.live, hash)
+	}
+}
+
+// setStatus updates the status of a mirrored transaction and appends it to its
+// lifecycle history.
+func (tm *TxManager) setStatus(hash common.Hash, status string) error {
+	tr := &TxTransition{Status: status, Time: uint64(time.Now().Unix())}
+	if err := tm.client.HSet(tm.ctx, tm.store.keys.txKey(hash), "status", status, "statusTime", tr.Time).Err(); err != nil {
+		redisTxErrorCounter.Inc(1)
+		return fmt.Errorf("failed to update transaction status: %v", err)
+	}
+	return tm.record(hash, tr)
+}
+
+// record appends a transition to the lifecycle history of a transaction.
+func (tm *TxManager) record(hash common.Hash, tr *TxTransition) error {
+	batch := new(slotBatch)
+	if err := tm.queueRecord(batch, hash, tr); err != nil {
+		return err
+	}
+	if err := tm.store.pipeline(batch); err != nil {
+		redisTxErrorCounter.Inc(1)
+		return fmt.Errorf("failed to record transaction %s: %v", tr.Status, err)
+	}
+	return nil
+}
+
+// queueRecord adds the writes of record to a batch.
+func (tm *TxManager) queueRecord(batch *slotBatch, hash common.Hash, tr *TxTransition) error {
+	if tr.Time == 0 {
+		tr.Time = uint64(time.Now().Unix())
+	}
+	blob, err := json.Marshal(tr)
+	if err != nil {
+		return err
+	}
+	key := tm.store.keys.txHistoryKey(hash)
+	batch.add(key, "RPUSH", key, blob)
+	batch.expire(key, tm.store.config.Retention.PendingTxs.Age)
+	return nil
+}
+
+// leave removes a transaction that left the pool without being mined from the
+// mirror, recording the transition and announcing it on the dropped stream.
+func (tm *TxManager) leave(hash common.Hash, tr *TxTransition) error {
+	tm.untrack(hash)
+	if err := tm.RemoveTxs([]common.Hash{hash}); err != nil {
+		return err
+	}
+	if err := tm.record(hash, tr); err != nil {
+		return err
+	}
+	return tm.store.publishDroppedTx(hash, tr)
+}
+
+// Sync reconciles the tracked transactions with the full contents of the pool:
+// new and promoted or demoted transactions are recorded with their status, and
+// transactions missing for more than syncGrace consecutive checks are marked
+// dropped. Enumerating the pool is expensive, so it is only done whenever pool
+// events may have been missed, the mirror otherwise follows the events and is
+// checked with Reconcile.
+func (tm *TxManager) Sync() error {
+	if tm.pool == nil {
+		return nil
+	}
+	pending, queued := tm.pool.Content()
+
+	seen := make(map[common.Hash]struct{})
+	for status, content := range map[string]map[common.Address][]*types.Transaction{TxStatusPending: pending, TxStatusQueued: queued} {
+		for _, txs := range content {
+			for _, tx := range txs {
+				seen[tx.Hash()] = struct{}{}
+				if err := tm.admit(tx, status); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// Transactions of subpools not enumerating their content are only checked
+	// for presence
+	var unseen []common.Hash
+	tm.liveLock.Lock()
+	for hash := range tm.live {
+		if _, ok := seen[hash]; !ok {
+			unseen = append(unseen, hash)
+		}
+	}
+	tm.liveLock.Unlock()
+
+	return tm.checkPresence(unseen)
+}
+
+// Reconcile checks a bounded sample of the tracked transactions for presence in
+// the pool, marking those missing for more than syncGrace consecutive checks as
+// dropped. The pool announces the transactions it accepts or promotes, but not
+// the ones it evicts, so this catches the latter without enumerating the pool.
+func (tm *TxManager) Reconcile() error {
+	if tm.pool == nil {
+		return nil
+	}
+	hashes := make([]common.Hash, 0, reconcileLimit)
+
+	tm.liveLock.Lock()
+	for hash := range tm.live {
+		if len(hashes) == reconcileLimit {
+			break
+		}
+		hashes = append(hashes, hash)
+	}
+	tm.liveLock.Unlock()
+
+	return tm.checkPresence(hashes)
+}
+
+// Refresh records the status of the pool transactions of the senders of recently
+// mined transactions. Mined nonces and spent balances may demote the remaining
+// transactions of a sender to the queue, which the pool does not announce. As
+// the pool may not have caught up with the mined block yet, senders are checked
+// again on the following syncGrace calls.
+func (tm *TxManager) Refresh() error {
+	if tm.pool == nil {
+		return nil
+	}
+	tm.liveLock.Lock()
+	senders := make([]common.Address, 0, len(tm.touched))
+	for addr, left := range tm.touched {
+		senders = append(senders, addr)
+		if left <= 1 {
+			delete(tm.touched, addr)
+		} else {
+			tm.touched[addr] = left - 1
+		}
+	}
+	tm.liveLock.Unlock()
+
+	for _, addr := range senders {
+		pending, queued := tm.pool.ContentFrom(addr)
+		for status, txs := range map[string][]*types.Transaction{TxStatusPending: pending, TxStatusQueued: queued} {
+			for _, tx := range txs {
+				if err := tm.admit(tx, status); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkPresence checks whether the given tracked transactions are still in the
+// pool, and removes those missing for more than syncGrace consecutive checks from
+// the mirror as dropped.
+func (tm *TxManager) checkPresence(hashes []common.Hash) error {
+	present := make(map[common.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		present[hash] = tm.pool.Has(hash)
+	}
+	// Collect the transactions that disappeared from the pool
+	var (
+		gone  []common.Hash
+		slots []txSlot
+	)
+	tm.liveLock.Lock()
+	for _, hash := range hashes {
+		live, ok := tm.live[hash]
+		if !ok {
+			continue
+		}
+		if present[hash] {
+			live.missing = 0
+			continue
+		}
+		if live.missing++; live.missing >= syncGrace {
+			gone = append(gone, hash)
+			slots = append(slots, live.slot)
+		}
+	}
+	tm.liveLock.Unlock()
+
+	for i, hash := range gone {
+		reason := DropReasonEvicted
+		if tm.pool.Nonce(slots[i].from) > slots[i].nonce {
+			reason = DropReasonNonceTooLow
+		}
+		redisTxEvictedMeter.Mark(1)
+		if err := tm.leave(hash, &TxTransition{Status: TxStatusDropped, Reason: reason}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MinedTxs records the mirrored transactions of a newly exported canonical block
+// as mined and removes all of its transactions from the mirror. Transactions in
+// the pool holding the nonce of a mined one are marked as replaced by it.
+func (tm *TxManager) MinedTxs(block *types.Block, signer types.Signer) error {
+	batch := newExportBatch()
+	if err := tm.queueMinedTxs(batch, block, signer); err != nil {
+		return err
+	}
+	return tm.store.commit(batch)
+}
+
+// queueMinedTxs adds the writes of MinedTxs to the batch exporting a block.
+func (tm *TxManager) queueMinedTxs(batch *exportBatch, block *types.Block, signer types.Signer) error {
+	var (
+		number    = block.NumberU64()
+		blockHash = block.Hash()
+		txs       = block.Transactions()
+		hashes    = make([]common.Hash, len(txs))
+		tracked   = make([]bool, len(txs))
+		mined     []common.Hash
+		replaced  = make(map[common.Hash]common.Hash)
+	)
+	tm.liveLock.Lock()
+	for i, tx := range txs {
+		hash := tx.Hash()
+		hashes[i] = hash
+
+		_, tracked[i] = tm.live[hash]
+		if from, err := types.Sender(signer, tx); err == nil {
+			slot := txSlot{from: from, nonce: tx.Nonce()}
+			if holder, ok := tm.slots[slot]; ok && holder != hash {
+				replaced[holder] = hash
+			}
+			tm.touched[from] = syncGrace
+		}
+		if live, ok := tm.live[hash]; ok {
+			if tm.slots[live.slot] == hash {
+				delete(tm.slots, live.slot)
+			}
+			delete(tm.live, hash)
+		}
+		tm.mined[hash] = number
+	}
+	for hash, at := range tm.mined {
+		if at+minedRetention < number {
+			delete(tm.mined, hash)
+		}
+	}
+	tm.liveLock.Unlock()
+
+	// Transactions not tracked in this run may still be mirrored from an earlier one
+	var untracked []common.Hash
+	for i, hash := range hashes {
+		if !tracked[i] {
+			untracked = append(untracked, hash)
+		}
+	}
+	stored := tm.stored(untracked...)
+	for i, hash := range hashes {
+		if !tracked[i] {
+			tracked[i], stored = stored[0], stored[1:]
+		}
+		if tracked[i] {
+			mined = append(mined, hash)
+		}
+	}
+	// Remove the mined transactions and the replaced ones from the mirror
+	removed := hashes
+	for holder := range replaced {
+		tm.untrack(holder)
+		removed = append(removed, holder)
+	}
+	if err := tm.queueRemoval(batch.writes, removed); err != nil {
+		return err
+	}
+	for _, hash := range mined {
+		if err := tm.queueRecord(batch.writes, hash, &TxTransition{Status: TxStatusMined, Block: number, BlockHash: &blockHash}); err != nil {
+			return err
+		}
+	}
+	for holder, by := range replaced {
+		tr := &TxTransition{Status: TxStatusReplaced, By: &by}
+		if err := tm.queueRecord(batch.writes, holder, tr); err != nil {
+			return err
+		}
+		tm.store.queueEvent(batch.chain, DroppedTxsStream, droppedTxEvent(holder, tr)...)
+	}
+	batch.onCommit(func() {
+		redisTxMinedMeter.Mark(int64(len(mined)))
+		redisTxReplacedMeter.Mark(int64(len(replaced)))
+		redisStreamMeter.Mark(int64(len(replaced)))
+	})
+	return nil
+}
+
+// ReorgedTxs records the recently mined mirrored transactions of a block dropped
+// by a reorg. Those returning to the pool are mirrored again once the pool
+// reinjects them.
+func (tm *TxManager) ReorgedTxs(block *types.Block) error {
+	var (
+		number    = block.NumberU64()
+		blockHash = block.Hash()
+		reorged   []common.Hash
+	)
+	tm.liveLock.Lock()
+	for _, tx := range block.Transactions() {
+		if at, ok := tm.mined[tx.Hash()]; ok && at == number {
+			delete(tm.mined, tx.Hash())
+			reorged = append(reorged, tx.Hash())
+		}
+	}
+	tm.liveLock.Unlock()
+
+	for _, hash := range reorged {
+		if err := tm.record(hash, &TxTransition{Status: TxStatusReorged, Block: number, BlockHash: &blockHash}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TxHistory retrieves the lifecycle history of a transaction, oldest first.
+func (tm *TxManager) TxHistory(hash common.Hash) ([]*TxTransition, error) {
+	blobs, err := tm.client.LRange(tm.ctx, tm.store.keys.txHistoryKey(hash), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction history: %v", err)
+	}
+	history := make([]*TxTransition, 0, len(blobs))
+	for _, blob := range blobs {
+		tr := new(TxTransition)
+		if err := json.Unmarshal([]byte(blob), tr); err != nil {
+			log.Warn("Skipping corrupt transaction history entry", "hash", hash, "err", err)
+			continue
+		}
+		history = append(history, tr)
+	}
+	return history, nil
+}
+
+// statusOf returns the tracked pool status of a transaction, or an empty string
+// if it is not in the pool.
+func (tm *TxManager) statusOf(hash common.Hash) string {
+	tm.liveLock.Lock()
+	defer tm.liveLock.Unlock()
+
+	if live, ok := tm.live[hash]; ok {
+		return live.status
+	}
+	return ""
+}
+
+// lowerHex formats an optional hash the way all other hashes are stored.
+func lowerHex(hash *common.Hash) string {
+	if hash == nil {
+		return ""
+	}
+	return strings.ToLower(hash.Hex())
+}
@@ -0,0 +1,409 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+)
+
+// testPool is a transaction pool with fixed contents.
+type testPool struct {
+	pending map[common.Address][]*types.Transaction
+	queued  map[common.Address][]*types.Transaction
+	hidden  map[common.Hash]*types.Transaction // Pooled, but not enumerated (e.g. blob transactions)
+	nonce   uint64
+
+	contents int // Number of times the contents were enumerated
+}
+
+func (p *testPool) SubscribeTransactions(ch chan<- core.NewTxsEvent, reorgs bool) event.Subscription {
+	return nil
+}
+
+func (p *testPool) Content() (map[common.Address][]*types.Transaction, map[common.Address][]*types.Transaction) {
+	p.contents++
+	return p.pending, p.queued
+}
+
+func (p *testPool) ContentFrom(addr common.Address) ([]*types.Transaction, []*types.Transaction) {
+	return p.pending[addr], p.queued[addr]
+}
+
+func (p *testPool) Has(hash common.Hash) bool {
+	return p.Get(hash) != nil
+}
+
+func (p *testPool) Get(hash common.Hash) *types.Transaction {
+	if tx, ok := p.hidden[hash]; ok {
+		return tx
+	}
+	for _, content := range []map[common.Address][]*types.Transaction{p.pending, p.queued} {
+		for _, txs := range content {
+			for _, tx := range txs {
+				if tx.Hash() == hash {
+					return tx
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *testPool) Nonce(addr common.Address) uint64 {
+	return p.nonce
+}
+
+func (p *testPool) Add(txs []*types.Transaction, sync bool) []error {
+	return make([]error, len(txs))
+}
+
+// checkHistory verifies the statuses recorded in the lifecycle history of a
+// transaction, returning the last transition.
+func checkHistory(t *testing.T, txMgr *TxManager, hash common.Hash, want ...string) *TxTransition {
+	t.Helper()
+
+	history, err := txMgr.TxHistory(hash)
+	if err != nil {
+		t.Fatalf("Failed to read history of %x: %v", hash, err)
+	}
+	if len(history) != len(want) {
+		t.Fatalf("History length mismatch for %x: have %d, want %d", hash, len(history), len(want))
+	}
+	for i, tr := range history {
+		if tr.Status != want[i] {
+			t.Errorf("History mismatch for %x at %d: have %s, want %s", hash, i, tr.Status, want[i])
+		}
+		if tr.Time == 0 {
+			t.Errorf("History of %x at %d missing timestamp", hash, i)
+		}
+	}
+	return history[len(history)-1]
+}
+
+// Tests that pool syncs, replacements, mined blocks and reorgs drive the status
+// of mirrored transactions through their lifecycle.
+func TestTxLifecycle(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	txMgr := NewTxManager(store)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+
+		exec    = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(1)})
+		replace = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(2)})
+		gapped  = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 2, Gas: 21000, GasPrice: big.NewInt(1)})
+		pool    = &testPool{nonce: 1}
+	)
+	txMgr.SetPool(pool)
+
+	// A pending and a queued transaction enter the pool
+	if err := txMgr.storeTxSync(exec); err != nil {
+		t.Fatalf("Failed to store pending transaction: %v", err)
+	}
+	pool.pending = map[common.Address][]*types.Transaction{sender: {exec}}
+	pool.queued = map[common.Address][]*types.Transaction{sender: {gapped}}
+	if err := txMgr.Sync(); err != nil {
+		t.Fatalf("Failed to sync pool: %v", err)
+	}
+	checkHistory(t, txMgr, exec.Hash(), TxStatusPending)
+	checkHistory(t, txMgr, gapped.Hash(), TxStatusQueued)
+
+	fields, err := store.client.HGetAll(store.ctx, store.keys.txKey(gapped.Hash())).Result()
+	if err != nil {
+		t.Fatalf("Failed to read queued transaction: %v", err)
+	}
+	if fields["status"] != TxStatusQueued || fields["statusTime"] == "" {
+		t.Errorf("Queued transaction status mismatch: have %s at %s", fields["status"], fields["statusTime"])
+	}
+	// The pending transaction gets replaced with a higher priced one
+	if err := txMgr.storeTxSync(replace); err != nil {
+		t.Fatalf("Failed to store replacement: %v", err)
+	}
+	if tr := checkHistory(t, txMgr, exec.Hash(), TxStatusPending, TxStatusReplaced); tr.By == nil || *tr.By != replace.Hash() {
+		t.Errorf("Replacement mismatch: have %v, want %x", tr.By, replace.Hash())
+	}
+	if tx, _ := txMgr.GetTx(exec.Hash()); tx != nil {
+		t.Errorf("Replaced transaction still mirrored")
+	}
+	// The replacement gets mined, then reorged out
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, &types.Body{Transactions: types.Transactions{replace}}, nil, trie.NewStackTrie(nil))
+	if err := txMgr.MinedTxs(block, signer); err != nil {
+		t.Fatalf("Failed to mark mined transactions: %v", err)
+	}
+	if tr := checkHistory(t, txMgr, replace.Hash(), TxStatusPending, TxStatusMined); tr.Block != 1 || tr.BlockHash == nil || *tr.BlockHash != block.Hash() {
+		t.Errorf("Mined block mismatch: have %d %v, want %d %x", tr.Block, tr.BlockHash, 1, block.Hash())
+	}
+	if tx, _ := txMgr.GetTx(replace.Hash()); tx != nil {
+		t.Errorf("Mined transaction still mirrored")
+	}
+	// A stale pool view still containing the mined transaction is ignored
+	pool.pending = map[common.Address][]*types.Transaction{sender: {replace}}
+	if err := txMgr.Sync(); err != nil {
+		t.Fatalf("Failed to sync pool: %v", err)
+	}
+	checkHistory(t, txMgr, replace.Hash(), TxStatusPending, TxStatusMined)
+
+	if err := txMgr.ReorgedTxs(block); err != nil {
+		t.Fatalf("Failed to mark reorged transactions: %v", err)
+	}
+	checkHistory(t, txMgr, replace.Hash(), TxStatusPending, TxStatusMined, TxStatusReorged)
+
+	// The queued transaction disappears from the pool and is dropped after
+	// the grace period
+	pool.pending, pool.queued = nil, nil
+	for i := 0; i < syncGrace; i++ {
+		checkHistory(t, txMgr, gapped.Hash(), TxStatusQueued)
+		if err := txMgr.Sync(); err != nil {
+			t.Fatalf("Failed to sync pool: %v", err)
+		}
+	}
+	if tr := checkHistory(t, txMgr, gapped.Hash(), TxStatusQueued, TxStatusDropped); tr.Reason != DropReasonEvicted {
+		t.Errorf("Drop reason mismatch: have %q, want %q", tr.Reason, DropReasonEvicted)
+	}
+	if tx, _ := txMgr.GetTx(gapped.Hash()); tx != nil {
+		t.Errorf("Dropped transaction still mirrored")
+	}
+}
+
+// Tests that blob transactions, which the pool only announces without sidecars
+// and never enumerates, are mirrored with their sidecar and tracked by presence.
+func TestTxLifecycleBlobs(t *testing.T) {
+	config := testConfig()
+	config.BlobSidecars = true
+
+	store := newTestStore(t, config)
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		key, _  = crypto.GenerateKey()
+		signer  = types.LatestSignerForChainID(big.NewInt(1))
+		sidecar = &types.BlobTxSidecar{
+			Blobs:       []kzg4844.Blob{{}},
+			Commitments: []kzg4844.Commitment{{0x01}},
+			Proofs:      []kzg4844.Proof{{0x02}},
+		}
+		tx = types.MustSignNewTx(key, signer, &types.BlobTx{
+			ChainID:    uint256.NewInt(1),
+			Gas:        21000,
+			GasFeeCap:  uint256.NewInt(1),
+			BlobFeeCap: uint256.NewInt(1),
+			BlobHashes: []common.Hash{{0x01}},
+			Sidecar:    sidecar,
+		})
+		pool = &testPool{hidden: map[common.Hash]*types.Transaction{tx.Hash(): tx}}
+	)
+	txMgr := NewTxManager(store)
+	txMgr.SetPool(pool)
+
+	// The pool announces the transaction without its sidecar
+	if err := txMgr.storeTxSync(tx.WithoutBlobTxSidecar()); err != nil {
+		t.Fatalf("Failed to store blob transaction: %v", err)
+	}
+	fields, err := store.client.HGetAll(store.ctx, store.keys.txKey(tx.Hash())).Result()
+	if err != nil {
+		t.Fatalf("Failed to read blob transaction: %v", err)
+	}
+	raw, _ := tx.WithoutBlobTxSidecar().MarshalBinary()
+	if fields["raw"] != fmt.Sprintf("0x%x", raw) {
+		t.Errorf("Blob transaction stored with sidecar")
+	}
+	stored, err := store.client.HGetAll(store.ctx, store.keys.blobSidecarKey(tx.Hash())).Result()
+	if err != nil {
+		t.Fatalf("Failed to read blob sidecar: %v", err)
+	}
+	var commitments []kzg4844.Commitment
+	if err := json.Unmarshal([]byte(stored["commitments"]), &commitments); err != nil || len(commitments) != 1 || commitments[0] != sidecar.Commitments[0] {
+		t.Errorf("Blob sidecar commitments mismatch: have %s", stored["commitments"])
+	}
+	if _, ok := stored["blobs"]; ok {
+		t.Errorf("Blob sidecar stored with blobs")
+	}
+	// The transaction is kept while the pool has it, even if not enumerated
+	for i := 0; i <= syncGrace; i++ {
+		if err := txMgr.Sync(); err != nil {
+			t.Fatalf("Failed to sync pool: %v", err)
+		}
+	}
+	checkHistory(t, txMgr, tx.Hash(), TxStatusPending)
+
+	// Once gone from the pool, it is dropped along with its sidecar
+	pool.hidden = nil
+	for i := 0; i < syncGrace; i++ {
+		if err := txMgr.Sync(); err != nil {
+			t.Fatalf("Failed to sync pool: %v", err)
+		}
+	}
+	checkHistory(t, txMgr, tx.Hash(), TxStatusPending, TxStatusDropped)
+	if n, _ := store.client.Exists(store.ctx, store.keys.blobSidecarKey(tx.Hash())).Result(); n != 0 {
+		t.Errorf("Blob sidecar of dropped transaction still stored")
+	}
+}
+
+// Tests that the exporter only enumerates the pool contents on startup and after
+// resyncs, and otherwise detects transactions leaving the pool by presence.
+func TestTxPoolReconcile(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+		tx     = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(1)})
+		pool   = &testPool{hidden: map[common.Hash]*types.Transaction{tx.Hash(): tx}}
+		chain  = newTestChain()
+
+		exporter = NewExporter(testConfig(), rawdb.NewMemoryDatabase(), chain, pool)
+	)
+	chain.extend(nil, 3, 0)
+	exporter.store, exporter.txMgr = store, NewTxManager(store)
+	exporter.txMgr.SetPool(pool)
+
+	// The transaction is announced by the pool, and kept while pooled
+	if err := exporter.txMgr.storeTxSync(tx); err != nil {
+		t.Fatalf("Failed to store transaction: %v", err)
+	}
+	for i := 0; i <= syncGrace; i++ {
+		exporter.syncPool()
+	}
+	if pool.contents != 1 {
+		t.Errorf("Pool enumerations mismatch: have %d, want 1", pool.contents)
+	}
+	checkHistory(t, exporter.txMgr, tx.Hash(), TxStatusPending)
+
+	// A resync enumerates the pool again, once
+	if err := exporter.rewind(1); err != nil {
+		t.Fatalf("Failed to rewind export: %v", err)
+	}
+	exporter.syncPool()
+	exporter.syncPool()
+	if pool.contents != 2 {
+		t.Errorf("Pool enumerations after resync mismatch: have %d, want 2", pool.contents)
+	}
+	// Once evicted, the transaction is dropped without enumerating the pool
+	pool.hidden = nil
+	for i := 0; i < syncGrace; i++ {
+		exporter.syncPool()
+	}
+	checkHistory(t, exporter.txMgr, tx.Hash(), TxStatusPending, TxStatusDropped)
+	if pool.contents != 2 {
+		t.Errorf("Pool enumerated while reconciling: have %d, want 2", pool.contents)
+	}
+}
+
+// Tests that pool transactions dropped on a full transaction queue are mirrored
+// by a full sync on the next head.
+func TestTxPoolQueueOverflow(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+		tx     = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(1)})
+		from   = crypto.PubkeyToAddress(key.PublicKey)
+		pool   = &testPool{}
+		chain  = newTestChain()
+
+		exporter = NewExporter(testConfig(), rawdb.NewMemoryDatabase(), chain, pool)
+	)
+	chain.extend(nil, 3, 0)
+	exporter.store, exporter.txMgr = store, NewTxManager(store)
+	exporter.txMgr.SetPool(pool)
+	exporter.syncPool()
+
+	// Without workers draining it, the queue rejects the announced transaction
+	exporter.txMgr.txQueue = make(chan *types.Transaction)
+	pool.pending = map[common.Address][]*types.Transaction{from: {tx}}
+
+	exporter.mirrorTxs([]*types.Transaction{tx})
+	exporter.syncPool()
+	if pool.contents != 2 {
+		t.Errorf("Pool enumerations mismatch: have %d, want 2", pool.contents)
+	}
+	checkHistory(t, exporter.txMgr, tx.Hash(), TxStatusPending)
+
+	// Once mirrored, the pool events are followed again
+	exporter.syncPool()
+	if pool.contents != 2 {
+		t.Errorf("Pool enumerated after sync: have %d, want 2", pool.contents)
+	}
+}
+
+// Tests that transactions the pool demotes or queues without announcing them
+// are mirrored as queued: demotions when their sender gets a transaction mined,
+// and others with the periodic sync of the full pool contents.
+func TestTxPoolQueued(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.LatestSignerForChainID(big.NewInt(1))
+		mined    = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(1)})
+		demoted  = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+		gapped   = types.MustSignNewTx(other, signer, &types.LegacyTx{Nonce: 5, Gas: 21000, GasPrice: big.NewInt(1)})
+		pool     = &testPool{pending: map[common.Address][]*types.Transaction{sender: {mined, demoted}}}
+		chain    = newTestChain()
+
+		exporter = NewExporter(testConfig(), rawdb.NewMemoryDatabase(), chain, pool)
+	)
+	chain.extend(nil, 3, 0)
+	exporter.store, exporter.txMgr = store, NewTxManager(store)
+	exporter.txMgr.SetPool(pool)
+	exporter.syncPool()
+
+	// Mining the first transaction demotes the second one, e.g. as its sender
+	// no longer affords it
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, &types.Body{Transactions: types.Transactions{mined}}, nil, trie.NewStackTrie(nil))
+	if err := exporter.txMgr.MinedTxs(block, signer); err != nil {
+		t.Fatalf("Failed to mark mined transactions: %v", err)
+	}
+	pool.pending = nil
+	pool.queued = map[common.Address][]*types.Transaction{sender: {demoted}}
+	exporter.syncPool()
+
+	checkHistory(t, exporter.txMgr, demoted.Hash(), TxStatusPending, TxStatusQueued)
+	if status := exporter.txMgr.statusOf(demoted.Hash()); status != TxStatusQueued {
+		t.Errorf("Demoted transaction status mismatch: have %s, want %s", status, TxStatusQueued)
+	}
+	if pool.contents != 1 {
+		t.Errorf("Pool enumerated on demotion: have %d, want 1", pool.contents)
+	}
+	// A transaction queued without announcement is picked up by the next
+	// periodic sync of the full pool contents
+	pool.queued[crypto.PubkeyToAddress(other.PublicKey)] = []*types.Transaction{gapped}
+	for i := 1; i < poolSyncInterval; i++ {
+		exporter.syncPool()
+	}
+	if have := exporter.txMgr.statusOf(gapped.Hash()); have != "" {
+		t.Errorf("Unannounced transaction mirrored early: %s", have)
+	}
+	exporter.syncPool()
+	if pool.contents != 2 {
+		t.Errorf("Pool enumerations mismatch: have %d, want 2", pool.contents)
+	}
+	checkHistory(t, exporter.txMgr, gapped.Hash(), TxStatusQueued)
+}
@@ -0,0 +1,324 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-redis/redis/v8"
+)
+
+// maxLogIndexRange is the maximum number of blocks a single log index query may
+// span.
+const maxLogIndexRange = 10000
+
+// logIndexTailKey returns the key holding the first block the log index may
+// cover, raised as blocks fall out of the retention window.
+func (k keyspace) logIndexTailKey() string {
+	return k.prefix + "logindex:tail"
+}
+
+// logIndexKeysKey returns the key of the sorted set of all address and topic
+// keys of the log index, scored by the last block that added an entry to them.
+func (k keyspace) logIndexKeysKey() string {
+	return k.prefix + "logindex:keys"
+}
+
+// logAddrKey returns the key of the sorted set of canonical logs emitted by an
+// address, scored by block number.
+func (k keyspace) logAddrKey(addr common.Address) string {
+	return fmt.Sprintf("%slogaddr:%s", k.prefix, strings.ToLower(addr.Hex()))
+}
+
+// logTopicKey returns the key of the sorted set of canonical logs with the given
+// first topic, scored by block number.
+func (k keyspace) logTopicKey(topic common.Hash) string {
+	return fmt.Sprintf("%slogtopic:%s", k.prefix, strings.ToLower(topic.Hex()))
+}
+
+// logIndexBlockKey returns the key holding the hash of the block whose logs are
+// indexed at a height.
+func (k keyspace) logIndexBlockKey(number uint64) string {
+	return fmt.Sprintf("%slogindex:{%d}", k.prefix, number)
+}
+
+// logMember returns the sorted set member pointing at a log.
+func logMember(number uint64, index uint) string {
+	return fmt.Sprintf("%d:%d", number, index)
+}
+
+// parseLogMember splits a sorted set member into the block number and log index
+// it points at.
+func parseLogMember(member string) (uint64, uint, error) {
+	number, index, ok := strings.Cut(member, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid log index entry %q", member)
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid log index entry %q: %v", member, err)
+	}
+	i, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid log index entry %q: %v", member, err)
+	}
+	return n, uint(i), nil
+}
+
+// indexBlockLogs adds the logs of a canonical block to the index of their address
+// and first topic, and trims the entries falling out of the retention window.
+func (s *RedisBlockStore) indexBlockLogs(block *types.Block, logs []*types.Log) error {
+	batch := newExportBatch()
+	if err := s.queueBlockLogs(batch, block, logs); err != nil {
+		return err
+	}
+	return s.commit(batch)
+}
+
+// queueBlockLogs adds the writes of indexBlockLogs to a batch.
+func (s *RedisBlockStore) queueBlockLogs(batch *exportBatch, block *types.Block, logs []*types.Log) error {
+	var (
+		number = block.NumberU64()
+		writes = batch.writes
+		keys   = make(map[string]struct{})
+	)
+	for _, log := range logs {
+		member := logMember(number, log.Index)
+
+		key := s.keys.logAddrKey(log.Address)
+		writes.add(key, "ZADD", key, number, member)
+		keys[key] = struct{}{}
+
+		if len(log.Topics) > 0 {
+			key := s.keys.logTopicKey(log.Topics[0])
+			writes.add(key, "ZADD", key, number, member)
+			keys[key] = struct{}{}
+		}
+	}
+	// Entries below the tail are trimmed whenever a key is written to. The tail
+	// is raised here if a number of recent blocks is retained, and by the
+	// janitor if the index is retained to a depth behind the finalized block
+	tail, err := s.client.Get(s.ctx, s.keys.logIndexTailKey()).Uint64()
+	if err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to read log index tail: %v", err)
+	}
+	cutoff := tail
+	if retention := s.config.LogIndexRetention; retention != 0 && number >= retention {
+		cutoff = max(cutoff, number-retention+1)
+	}
+	var (
+		age     = s.config.Retention.Logs.Age
+		keysKey = s.keys.logIndexKeysKey()
+	)
+	for key := range keys {
+		if cutoff > 0 {
+			writes.add(key, "ZREMRANGEBYSCORE", key, "-inf", "("+strconv.FormatUint(cutoff, 10))
+		}
+		writes.expire(key, age)
+		writes.add(keysKey, "ZADD", keysKey, number, key)
+	}
+	writes.expire(keysKey, age)
+
+	blockKey := s.keys.logIndexBlockKey(number)
+	writes.add(blockKey, setArgs(blockKey, strings.ToLower(block.Hash().Hex()), age)...)
+	if cutoff > tail {
+		return s.queueLogTrim(writes, cutoff, keys)
+	}
+	return nil
+}
+
+// queueLogTrim adds the writes raising the tail of the log index to cutoff to a
+// batch. The keys not touched since are dropped altogether, unless being written
+// to by the batch, the stale entries of the others are trimmed when next written.
+func (s *RedisBlockStore) queueLogTrim(writes *slotBatch, cutoff uint64, keep map[string]struct{}) error {
+	var (
+		below   = "(" + strconv.FormatUint(cutoff, 10)
+		keysKey = s.keys.logIndexKeysKey()
+		tailKey = s.keys.logIndexTailKey()
+	)
+	pipe := s.client.Pipeline()
+	tail := pipe.Get(s.ctx, tailKey)
+	stale := pipe.ZRangeByScore(s.ctx, keysKey, &redis.ZRangeBy{Min: "-inf", Max: below})
+	if _, err := pipe.Exec(s.ctx); err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to read log index keys: %v", err)
+	}
+	if current, _ := strconv.ParseUint(tail.Val(), 10, 64); current < cutoff {
+		writes.add(tailKey, "SET", tailKey, cutoff)
+	}
+	for _, key := range stale.Val() {
+		if _, ok := keep[key]; !ok {
+			writes.add(key, "DEL", key)
+		}
+	}
+	writes.add(keysKey, "ZREMRANGEBYSCORE", keysKey, "-inf", below)
+	return nil
+}
+
+// unindexBlockLogs reverts indexBlockLogs for a block dropped by a reorg. If a
+// block of the new chain was already indexed at the same height, its entries
+// are left alone.
+func (s *RedisBlockStore) unindexBlockLogs(block *types.Block, logs []*types.Log) error {
+	number := block.NumberU64()
+
+	// The entries are spread across slots, so release the height first and only
+	// touch them if it was still held by the dropped block
+	held, err := s.client.Eval(s.ctx, deleteIfEqualScript, []string{s.keys.logIndexBlockKey(number)}, strings.ToLower(block.Hash().Hex())).Int()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to unindex block logs: %v", err)
+	}
+	if held == 0 {
+		return nil
+	}
+	pipe := s.client.Pipeline()
+	for _, log := range logs {
+		member := logMember(number, log.Index)
+
+		pipe.ZRem(s.ctx, s.keys.logAddrKey(log.Address), member)
+		if len(log.Topics) > 0 {
+			pipe.ZRem(s.ctx, s.keys.logTopicKey(log.Topics[0]), member)
+		}
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to unindex block logs: %v", err)
+	}
+	return nil
+}
+
+// FilterLogs returns the logs of the blocks in [begin, end] emitted by one of the
+// addresses and carrying one of the first topics, as far as either is given.
+// The remaining topics are not checked. The blocks are identified by hashOf,
+// ok is false if the index does not cover all of them, or if the query has
+// neither an address nor a first topic constraint to look up.
+func (s *RedisBlockStore) FilterLogs(ctx context.Context, begin, end uint64, hashOf func(uint64) common.Hash, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, bool, error) {
+	if begin > end || end-begin >= maxLogIndexRange {
+		return nil, false, nil
+	}
+	var addrKeys, topicKeys []string
+	for _, addr := range addresses {
+		addrKeys = append(addrKeys, s.keys.logAddrKey(addr))
+	}
+	if len(topics) > 0 {
+		for _, topic := range topics[0] {
+			topicKeys = append(topicKeys, s.keys.logTopicKey(topic))
+		}
+	}
+	if len(addrKeys) == 0 && len(topicKeys) == 0 {
+		return nil, false, nil
+	}
+	// Check that every block of the range is indexed on the requested chain
+	var (
+		pipe    = s.client.Pipeline()
+		tail    = pipe.Get(ctx, s.keys.logIndexTailKey())
+		indexed = make([]*redis.StringCmd, 0, end-begin+1)
+	)
+	for n := begin; n <= end; n++ {
+		indexed = append(indexed, pipe.Get(ctx, s.keys.logIndexBlockKey(n)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return nil, false, fmt.Errorf("failed to read log index coverage: %v", err)
+	}
+	if first, err := tail.Uint64(); err == nil && begin < first {
+		return nil, false, nil
+	}
+	for i, cmd := range indexed {
+		if cmd.Val() != strings.ToLower(hashOf(begin+uint64(i)).Hex()) {
+			return nil, false, nil
+		}
+	}
+	// Collect the candidate logs of either constraint and intersect them
+	addrMatches, err := s.logCandidates(ctx, addrKeys, begin, end)
+	if err != nil {
+		return nil, false, err
+	}
+	topicMatches, err := s.logCandidates(ctx, topicKeys, begin, end)
+	if err != nil {
+		return nil, false, err
+	}
+	candidates := addrMatches
+	switch {
+	case candidates == nil:
+		candidates = topicMatches
+	case topicMatches != nil:
+		for member := range candidates {
+			if _, ok := topicMatches[member]; !ok {
+				delete(candidates, member)
+			}
+		}
+	}
+	blocks := make(map[uint64]map[uint]struct{})
+	for member := range candidates {
+		number, index, err := parseLogMember(member)
+		if err != nil {
+			return nil, false, err
+		}
+		if blocks[number] == nil {
+			blocks[number] = make(map[uint]struct{})
+		}
+		blocks[number][index] = struct{}{}
+	}
+	numbers := make([]uint64, 0, len(blocks))
+	for number := range blocks {
+		numbers = append(numbers, number)
+	}
+	slices.Sort(numbers)
+
+	// Resolve the candidates from the logs of their blocks
+	var matches []*types.Log
+	for _, number := range numbers {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		logs, err := s.getLogsFromKey(s.keys.blockKey(number))
+		if err != nil {
+			return nil, false, err
+		}
+		if len(logs) == 0 || logs[0].BlockHash != hashOf(number) {
+			return nil, false, nil // block expired or reorged meanwhile
+		}
+		for _, log := range logs {
+			if _, ok := blocks[number][log.Index]; ok {
+				matches = append(matches, log)
+			}
+		}
+	}
+	return matches, true, nil
+}
+
+// logCandidates returns the members of the given log index keys within a block
+// range, or nil if no keys were given.
+func (s *RedisBlockStore) logCandidates(ctx context.Context, keys []string, begin, end uint64) (map[string]struct{}, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	var (
+		pipe  = s.client.Pipeline()
+		cmds  = make([]*redis.StringSliceCmd, len(keys))
+		scope = &redis.ZRangeBy{
+			Min: strconv.FormatUint(begin, 10),
+			Max: strconv.FormatUint(end, 10),
+		}
+	)
+	for i, key := range keys {
+		cmds[i] = pipe.ZRangeByScore(ctx, key, scope)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to read log index: %v", err)
+	}
+	members := make(map[string]struct{})
+	for _, cmd := range cmds {
+		for _, member := range cmd.Val() {
+			members[member] = struct{}{}
+		}
+	}
+	return members, nil
+}
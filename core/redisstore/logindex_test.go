@@ -0,0 +1,142 @@
+package redisstore
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that logs are indexed by address and first topic, that queries are only
+// served for ranges indexed on the requested chain, and that reorgs and the
+// retention window remove index entries.
+func TestLogIndex(t *testing.T) {
+	config := testConfig()
+	config.LogIndex = true
+
+	store := newTestStore(t, config)
+	defer store.Close()
+
+	var (
+		addr1  = common.Address{0x01}
+		addr2  = common.Address{0x02}
+		topic1 = common.Hash{0x01}
+		topic2 = common.Hash{0x02}
+		number = uint64(1)
+
+		logs = []*types.Log{
+			{Address: addr1, Topics: []common.Hash{topic1}, Index: 0},
+			{Address: addr2, Topics: []common.Hash{topic2, topic1}, Index: 1},
+			{Address: addr1, Topics: []common.Hash{topic2}, Index: 2},
+		}
+		blocks = []*types.Block{
+			types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)}),
+			types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number + 1)}),
+		}
+		hashes = map[uint64]common.Hash{number: blocks[0].Hash(), number + 1: blocks[1].Hash()}
+		hashOf = func(n uint64) common.Hash { return hashes[n] }
+	)
+	for i, block := range blocks {
+		var blockLogs []*types.Log
+		if i == 0 {
+			blockLogs = logs
+		}
+		if err := store.StoreBlock(block, blockLogs, params.TestChainConfig); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+		if err := store.indexBlockLogs(block, blockLogs); err != nil {
+			t.Fatalf("Failed to index block logs: %v", err)
+		}
+	}
+	check := func(begin, end uint64, addresses []common.Address, topics [][]common.Hash, ok bool, want ...uint) {
+		t.Helper()
+		have, served, err := store.FilterLogs(context.Background(), begin, end, hashOf, addresses, topics)
+		if err != nil {
+			t.Fatalf("Failed to filter logs: %v", err)
+		}
+		if served != ok {
+			t.Fatalf("Coverage mismatch for [%d, %d]: have %v, want %v", begin, end, served, ok)
+		}
+		if len(have) != len(want) {
+			t.Fatalf("Log count mismatch: have %d, want %d", len(have), len(want))
+		}
+		for i, log := range have {
+			if log.Index != want[i] || log.BlockHash != blocks[0].Hash() {
+				t.Errorf("Log %d mismatch: have %d in %x, want %d", i, log.Index, log.BlockHash, want[i])
+			}
+		}
+	}
+	check(number, number+1, []common.Address{addr1}, nil, true, 0, 2)
+	check(number, number+1, nil, [][]common.Hash{{topic2}}, true, 1, 2)
+	check(number, number+1, []common.Address{addr1, addr2}, [][]common.Hash{{topic2}}, true, 1, 2)
+	check(number, number+1, []common.Address{addr1}, [][]common.Hash{{topic2}}, true, 2)
+	check(number+1, number+1, []common.Address{addr1}, nil, true)
+
+	// Unconstrained queries, unindexed blocks and other chains are not served
+	check(number, number+1, nil, [][]common.Hash{nil, {topic1}}, false)
+	check(number, number+2, []common.Address{addr1}, nil, false)
+
+	hashes[number+1] = common.Hash{0x01}
+	check(number, number+1, []common.Address{addr1}, nil, false)
+	hashes[number+1] = blocks[1].Hash()
+
+	// Reorging out the block removes its entries
+	if err := store.RemoveBlock(blocks[0], logs); err != nil {
+		t.Fatalf("Failed to remove block: %v", err)
+	}
+	check(number, number+1, []common.Address{addr1}, nil, false)
+	if n, _ := store.client.ZCard(store.ctx, store.keys.logAddrKey(addr1)).Result(); n != 0 {
+		t.Errorf("Log index entries left after reorg: %d", n)
+	}
+}
+
+// Tests that blocks falling out of the retention window are no longer served and
+// that keys not touched within it are dropped.
+func TestLogIndexRetention(t *testing.T) {
+	config := testConfig()
+	config.LogIndex = true
+	config.LogIndexRetention = 2
+
+	store := newTestStore(t, config)
+	defer store.Close()
+
+	var (
+		stale  = common.Address{0x01}
+		live   = common.Address{0x02}
+		number = uint64(1)
+		hashes = make(map[uint64]common.Hash)
+	)
+	for i := uint64(0); i < 4; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number + i)})
+		hashes[number+i] = block.Hash()
+
+		logs := []*types.Log{{Address: live, Topics: []common.Hash{}, Index: 0}}
+		if i == 0 {
+			logs = append(logs, &types.Log{Address: stale, Topics: []common.Hash{}, Index: 1})
+		}
+		if err := store.StoreBlock(block, logs, params.TestChainConfig); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+		if err := store.indexBlockLogs(block, logs); err != nil {
+			t.Fatalf("Failed to index block logs: %v", err)
+		}
+	}
+	hashOf := func(n uint64) common.Hash { return hashes[n] }
+
+	if _, ok, _ := store.FilterLogs(context.Background(), number+1, number+3, hashOf, []common.Address{live}, nil); ok {
+		t.Errorf("Range beyond retention served")
+	}
+	logs, ok, err := store.FilterLogs(context.Background(), number+2, number+3, hashOf, []common.Address{live}, nil)
+	if err != nil || !ok || len(logs) != 2 {
+		t.Errorf("Retained range mismatch: have %d logs, served %v (%v)", len(logs), ok, err)
+	}
+	if n, _ := store.client.ZCard(store.ctx, store.keys.logAddrKey(live)).Result(); n != 2 {
+		t.Errorf("Live key not trimmed: have %d entries, want 2", n)
+	}
+	if n, _ := store.client.Exists(store.ctx, store.keys.logAddrKey(stale)).Result(); n != 0 {
+		t.Errorf("Stale key not dropped")
+	}
+}
@@ -0,0 +1,1757 @@
+package redisstore
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The in-process backend emulates the part of Redis the store relies on: keys
+// holding strings, hashes, lists, sets, sorted sets or streams with consumer groups,
+// key expiry, and pipelines, which it executes atomically. Lua scripts are not
+// interpreted, the scripts of this package are replaced by the Go equivalents
+// in memoryScripts instead.
+
+var (
+	errMemoryWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errMemoryNotInt    = errors.New("ERR value is not an integer or out of range")
+	errMemoryNoKey     = errors.New("ERR no such key")
+	errMemorySyntax    = errors.New("ERR syntax error")
+)
+
+// memoryEntry is the value of a key of the in-process backend.
+type memoryEntry struct {
+	value  interface{} // string, map[string]string, *memoryList, *memorySet, *memoryZSet or *memoryStream
+	expiry time.Time   // Time the key expires, zero if it does not
+}
+
+// memoryList is a list value.
+type memoryList struct {
+	items []string
+}
+
+// memorySet is a set value.
+type memorySet struct {
+	members map[string]struct{}
+}
+
+// memoryZSet is a sorted set value.
+type memoryZSet struct {
+	scores map[string]float64
+}
+
+// sorted returns the members of the set ordered by score, then lexicographically.
+func (z *memoryZSet) sorted() []redis.Z {
+	members := make([]redis.Z, 0, len(z.scores))
+	for member, score := range z.scores {
+		members = append(members, redis.Z{Score: score, Member: member})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member.(string) < members[j].Member.(string)
+	})
+	return members
+}
+
+// memoryStreamID is the id of a stream entry.
+type memoryStreamID struct {
+	ms, seq uint64
+}
+
+// parseStreamID parses a stream entry id, filling in the sequence number of ids
+// given as milliseconds only with fill.
+func parseStreamID(id string, fill uint64) (memoryStreamID, error) {
+	switch id {
+	case "-":
+		return memoryStreamID{}, nil
+	case "+":
+		return memoryStreamID{math.MaxUint64, math.MaxUint64}, nil
+	}
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return memoryStreamID{}, errors.New("ERR Invalid stream ID specified as stream command argument")
+	}
+	seq := fill
+	if found {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return memoryStreamID{}, errors.New("ERR Invalid stream ID specified as stream command argument")
+		}
+	}
+	return memoryStreamID{ms, seq}, nil
+}
+
+func (id memoryStreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id memoryStreamID) less(other memoryStreamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// memoryStream is a stream value.
+type memoryStream struct {
+	entries []memoryStreamEntry
+	last    memoryStreamID
+	groups  map[string]*memoryGroup
+}
+
+// memoryStreamEntry is an entry of a stream.
+type memoryStreamEntry struct {
+	id     memoryStreamID
+	values []string // Field/value pairs
+}
+
+// message converts the entry into its go-redis representation.
+func (e *memoryStreamEntry) message() redis.XMessage {
+	values := make(map[string]interface{}, len(e.values)/2)
+	for i := 0; i+1 < len(e.values); i += 2 {
+		values[e.values[i]] = e.values[i+1]
+	}
+	return redis.XMessage{ID: e.id.String(), Values: values}
+}
+
+// memoryGroup is a consumer group of a stream.
+type memoryGroup struct {
+	last    memoryStreamID            // Last entry delivered to the group
+	pending map[memoryStreamID]string // Delivered but unacknowledged entries and their consumers
+}
+
+// memoryDB is the keyspace of the in-process backend.
+type memoryDB struct {
+	keys   map[string]*memoryEntry
+	offset time.Duration // Clock offset, see FastForward
+	notify chan struct{} // Closed and replaced whenever a stream is appended to
+	runID  string        // Identity of the emulated server
+
+	lock sync.Mutex
+}
+
+// now returns the current time of the keyspace, which expiry is checked against.
+func (db *memoryDB) now() time.Time {
+	return time.Now().Add(db.offset)
+}
+
+// lookup returns the entry of a key, dropping it if it expired.
+func (db *memoryDB) lookup(key string) *memoryEntry {
+	entry := db.keys[key]
+	if entry != nil && !entry.expiry.IsZero() && !db.now().Before(entry.expiry) {
+		delete(db.keys, key)
+		return nil
+	}
+	return entry
+}
+
+// lookupAs returns the value of a key if it holds the requested type, creating
+// it if missing and create is given.
+func lookupAs[T any](db *memoryDB, key string, create func() T) (T, bool, error) {
+	var zero T
+	entry := db.lookup(key)
+	if entry == nil {
+		if create == nil {
+			return zero, false, nil
+		}
+		value := create()
+		db.keys[key] = &memoryEntry{value: value}
+		return value, true, nil
+	}
+	value, ok := entry.value.(T)
+	if !ok {
+		return zero, false, errMemoryWrongType
+	}
+	return value, true, nil
+}
+
+func newMemoryHash() map[string]string { return make(map[string]string) }
+func newMemoryList() *memoryList       { return new(memoryList) }
+func newMemorySet() *memorySet         { return &memorySet{members: make(map[string]struct{})} }
+func newMemoryZSet() *memoryZSet       { return &memoryZSet{scores: make(map[string]float64)} }
+func newMemoryStream() *memoryStream   { return &memoryStream{groups: make(map[string]*memoryGroup)} }
+
+func (db *memoryDB) get(key string) (string, error) {
+	value, ok, err := lookupAs[string](db, key, nil)
+	if err == nil && !ok {
+		err = redis.Nil
+	}
+	return value, err
+}
+
+func (db *memoryDB) set(key, value string, ttl time.Duration, nx bool) bool {
+	if nx && db.lookup(key) != nil {
+		return false
+	}
+	entry := &memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiry = db.now().Add(ttl)
+	}
+	db.keys[key] = entry
+	return true
+}
+
+func (db *memoryDB) del(keys ...string) int64 {
+	var n int64
+	for _, key := range keys {
+		if db.lookup(key) != nil {
+			delete(db.keys, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (db *memoryDB) exists(keys ...string) int64 {
+	var n int64
+	for _, key := range keys {
+		if db.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (db *memoryDB) expire(key string, ttl time.Duration) bool {
+	entry := db.lookup(key)
+	if entry == nil {
+		return false
+	}
+	if ttl <= 0 {
+		delete(db.keys, key)
+	} else {
+		entry.expiry = db.now().Add(ttl)
+	}
+	return true
+}
+
+func (db *memoryDB) pttl(key string) time.Duration {
+	entry := db.lookup(key)
+	switch {
+	case entry == nil:
+		return -2
+	case entry.expiry.IsZero():
+		return -1
+	default:
+		return entry.expiry.Sub(db.now()).Truncate(time.Millisecond)
+	}
+}
+
+func (db *memoryDB) rename(src, dst string, nx bool) (bool, error) {
+	entry := db.lookup(src)
+	if entry == nil {
+		return false, errMemoryNoKey
+	}
+	if nx && db.lookup(dst) != nil {
+		return false, nil
+	}
+	delete(db.keys, src)
+	db.keys[dst] = entry
+	return true, nil
+}
+
+func (db *memoryDB) incr(key string) (int64, error) {
+	entry := db.lookup(key)
+	if entry == nil {
+		db.keys[key] = &memoryEntry{value: "1"}
+		return 1, nil
+	}
+	value, ok := entry.value.(string)
+	if !ok {
+		return 0, errMemoryWrongType
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errMemoryNotInt
+	}
+	entry.value = strconv.FormatInt(n+1, 10)
+	return n + 1, nil
+}
+
+func (db *memoryDB) hset(key string, pairs []string) (int64, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return 0, errors.New("ERR wrong number of arguments for 'hset' command")
+	}
+	hash, _, err := lookupAs(db, key, newMemoryHash)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := hash[pairs[i]]; !ok {
+			added++
+		}
+		hash[pairs[i]] = pairs[i+1]
+	}
+	return added, nil
+}
+
+func (db *memoryDB) hget(key, field string) (string, error) {
+	hash, _, err := lookupAs[map[string]string](db, key, nil)
+	if err != nil {
+		return "", err
+	}
+	value, ok := hash[field]
+	if !ok {
+		return "", redis.Nil
+	}
+	return value, nil
+}
+
+func (db *memoryDB) hgetall(key string) (map[string]string, error) {
+	hash, _, err := lookupAs[map[string]string](db, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(hash))
+	for field, value := range hash {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+func (db *memoryDB) hmget(key string, fields []string) ([]interface{}, error) {
+	hash, _, err := lookupAs[map[string]string](db, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if value, ok := hash[field]; ok {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+func (db *memoryDB) hdel(key string, fields []string) (int64, error) {
+	hash, ok, err := lookupAs[map[string]string](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var n int64
+	for _, field := range fields {
+		if _, ok := hash[field]; ok {
+			delete(hash, field)
+			n++
+		}
+	}
+	if len(hash) == 0 {
+		delete(db.keys, key)
+	}
+	return n, nil
+}
+
+// span converts a Redis index range into slice bounds over n elements.
+func span(start, stop int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+func (db *memoryDB) rpush(key string, values []string) (int64, error) {
+	list, _, err := lookupAs(db, key, newMemoryList)
+	if err != nil {
+		return 0, err
+	}
+	list.items = append(list.items, values...)
+	return int64(len(list.items)), nil
+}
+
+func (db *memoryDB) lrange(key string, start, stop int64) ([]string, error) {
+	list, ok, err := lookupAs[*memoryList](db, key, nil)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+	from, to := span(start, stop, len(list.items))
+	return append([]string{}, list.items[from:to]...), nil
+}
+
+func (db *memoryDB) sadd(key string, members []string) (int64, error) {
+	set, _, err := lookupAs(db, key, newMemorySet)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for _, member := range members {
+		if _, ok := set.members[member]; !ok {
+			set.members[member] = struct{}{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (db *memoryDB) srem(key string, members []string) (int64, error) {
+	set, ok, err := lookupAs[*memorySet](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var n int64
+	for _, member := range members {
+		if _, ok := set.members[member]; ok {
+			delete(set.members, member)
+			n++
+		}
+	}
+	if len(set.members) == 0 {
+		delete(db.keys, key)
+	}
+	return n, nil
+}
+
+func (db *memoryDB) smembers(key string) ([]string, error) {
+	set, ok, err := lookupAs[*memorySet](db, key, nil)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+	members := make([]string, 0, len(set.members))
+	for member := range set.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (db *memoryDB) zadd(key string, members []redis.Z) (int64, error) {
+	zset, _, err := lookupAs(db, key, newMemoryZSet)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for _, member := range members {
+		name := member.Member.(string)
+		if _, ok := zset.scores[name]; !ok {
+			added++
+		}
+		zset.scores[name] = member.Score
+	}
+	return added, nil
+}
+
+func (db *memoryDB) zrem(key string, members []string) (int64, error) {
+	zset, ok, err := lookupAs[*memoryZSet](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var n int64
+	for _, member := range members {
+		if _, ok := zset.scores[member]; ok {
+			delete(zset.scores, member)
+			n++
+		}
+	}
+	if len(zset.scores) == 0 {
+		delete(db.keys, key)
+	}
+	return n, nil
+}
+
+func (db *memoryDB) zcard(key string) (int64, error) {
+	zset, ok, err := lookupAs[*memoryZSet](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return int64(len(zset.scores)), nil
+}
+
+func (db *memoryDB) zscore(key, member string) (float64, error) {
+	zset, ok, err := lookupAs[*memoryZSet](db, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		if score, ok := zset.scores[member]; ok {
+			return score, nil
+		}
+	}
+	return 0, redis.Nil
+}
+
+func (db *memoryDB) zrange(key string, start, stop int64) ([]redis.Z, error) {
+	zset, ok, err := lookupAs[*memoryZSet](db, key, nil)
+	if err != nil || !ok {
+		return []redis.Z{}, err
+	}
+	members := zset.sorted()
+	from, to := span(start, stop, len(members))
+	return members[from:to], nil
+}
+
+// scoreBound parses a sorted set score bound as given to ZRANGEBYSCORE.
+func scoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return score, exclusive, nil
+}
+
+// zscan returns the members of a sorted set within a score range, in order.
+func (db *memoryDB) zscan(key, min, max string) ([]redis.Z, error) {
+	lo, loEx, err := scoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, hiEx, err := scoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+	zset, ok, err := lookupAs[*memoryZSet](db, key, nil)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var members []redis.Z
+	for _, member := range zset.sorted() {
+		if member.Score < lo || (loEx && member.Score == lo) || member.Score > hi || (hiEx && member.Score == hi) {
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (db *memoryDB) zrangebyscore(key string, opt *redis.ZRangeBy) ([]string, error) {
+	members, err := db.zscan(key, opt.Min, opt.Max)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Offset > 0 {
+		if opt.Offset >= int64(len(members)) {
+			members = nil
+		} else {
+			members = members[opt.Offset:]
+		}
+	}
+	if opt.Count > 0 && opt.Count < int64(len(members)) {
+		members = members[:opt.Count]
+	}
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.Member.(string)
+	}
+	return names, nil
+}
+
+func (db *memoryDB) zremrangebyscore(key, min, max string) (int64, error) {
+	members, err := db.zscan(key, min, max)
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.Member.(string)
+	}
+	return db.zrem(key, names)
+}
+
+func (db *memoryDB) xadd(key, id string, maxLen int64, values []string) (string, error) {
+	if len(values) == 0 || len(values)%2 != 0 {
+		return "", errors.New("ERR wrong number of arguments for 'xadd' command")
+	}
+	stream, _, err := lookupAs(db, key, newMemoryStream)
+	if err != nil {
+		return "", err
+	}
+	var next memoryStreamID
+	if id == "" || id == "*" {
+		next = memoryStreamID{ms: uint64(db.now().UnixMilli())}
+		if !stream.last.less(next) {
+			next = memoryStreamID{stream.last.ms, stream.last.seq + 1}
+		}
+	} else {
+		if next, err = parseStreamID(id, 0); err != nil {
+			return "", err
+		}
+		if !stream.last.less(next) {
+			return "", errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+	stream.entries = append(stream.entries, memoryStreamEntry{id: next, values: values})
+	stream.last = next
+	if maxLen > 0 && int64(len(stream.entries)) > maxLen {
+		stream.entries = append([]memoryStreamEntry{}, stream.entries[int64(len(stream.entries))-maxLen:]...)
+	}
+	close(db.notify)
+	db.notify = make(chan struct{})
+	return next.String(), nil
+}
+
+func (db *memoryDB) xlen(key string) (int64, error) {
+	stream, ok, err := lookupAs[*memoryStream](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return int64(len(stream.entries)), nil
+}
+
+func (db *memoryDB) xrange(key, start, stop string) ([]redis.XMessage, error) {
+	from, err := parseStreamID(start, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseStreamID(stop, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok, err := lookupAs[*memoryStream](db, key, nil)
+	if err != nil || !ok {
+		return []redis.XMessage{}, err
+	}
+	msgs := []redis.XMessage{}
+	for i := range stream.entries {
+		if id := stream.entries[i].id; !id.less(from) && !to.less(id) {
+			msgs = append(msgs, stream.entries[i].message())
+		}
+	}
+	return msgs, nil
+}
+
+func (db *memoryDB) xgroupcreate(key, group, start string, mkstream bool) error {
+	create := newMemoryStream
+	if !mkstream {
+		create = nil
+	}
+	stream, ok, err := lookupAs(db, key, create)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("ERR The XGROUP subcommand requires the key to exist")
+	}
+	if _, ok := stream.groups[group]; ok {
+		return errors.New("BUSYGROUP Consumer Group name already exists")
+	}
+	last := stream.last
+	if start != "$" {
+		if last, err = parseStreamID(start, 0); err != nil {
+			return err
+		}
+	}
+	stream.groups[group] = &memoryGroup{last: last, pending: make(map[memoryStreamID]string)}
+	return nil
+}
+
+func (db *memoryDB) xreadgroup(a *redis.XReadGroupArgs) ([]redis.XStream, error) {
+	if len(a.Streams) == 0 || len(a.Streams)%2 != 0 {
+		return nil, errMemorySyntax
+	}
+	var (
+		n       = len(a.Streams) / 2
+		streams []redis.XStream
+	)
+	for i := 0; i < n; i++ {
+		key, id := a.Streams[i], a.Streams[n+i]
+
+		stream, ok, err := lookupAs[*memoryStream](db, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		var group *memoryGroup
+		if ok {
+			group = stream.groups[a.Group]
+		}
+		if group == nil {
+			return nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, a.Group)
+		}
+		msgs := []redis.XMessage{}
+		if id == ">" {
+			// Deliver new entries, tracking them as pending
+			for j := range stream.entries {
+				entry := &stream.entries[j]
+				if !group.last.less(entry.id) {
+					continue
+				}
+				if a.Count > 0 && int64(len(msgs)) >= a.Count {
+					break
+				}
+				msgs = append(msgs, entry.message())
+				group.last = entry.id
+				if !a.NoAck {
+					group.pending[entry.id] = a.Consumer
+				}
+			}
+			if len(msgs) > 0 {
+				streams = append(streams, redis.XStream{Stream: key, Messages: msgs})
+			}
+			continue
+		}
+		// Deliver the history of the consumer, i.e. its pending entries
+		after, err := parseStreamID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		for j := range stream.entries {
+			entry := &stream.entries[j]
+			if group.pending[entry.id] != a.Consumer || entry.id.less(after) {
+				continue
+			}
+			if a.Count > 0 && int64(len(msgs)) >= a.Count {
+				break
+			}
+			msgs = append(msgs, entry.message())
+		}
+		streams = append(streams, redis.XStream{Stream: key, Messages: msgs})
+	}
+	if len(streams) == 0 {
+		return nil, redis.Nil
+	}
+	return streams, nil
+}
+
+func (db *memoryDB) xread(a *redis.XReadArgs) ([]redis.XStream, error) {
+	var (
+		n       = len(a.Streams) / 2
+		streams []redis.XStream
+	)
+	for i := 0; i < n; i++ {
+		key := a.Streams[i]
+		after, err := parseStreamID(a.Streams[n+i], 0)
+		if err != nil {
+			return nil, err
+		}
+		stream, ok, err := lookupAs[*memoryStream](db, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		var msgs []redis.XMessage
+		for j := range stream.entries {
+			entry := &stream.entries[j]
+			if !after.less(entry.id) {
+				continue
+			}
+			if a.Count > 0 && int64(len(msgs)) >= a.Count {
+				break
+			}
+			msgs = append(msgs, entry.message())
+		}
+		if len(msgs) > 0 {
+			streams = append(streams, redis.XStream{Stream: key, Messages: msgs})
+		}
+	}
+	if len(streams) == 0 {
+		return nil, redis.Nil
+	}
+	return streams, nil
+}
+
+func (db *memoryDB) xack(key, group string, ids []string) (int64, error) {
+	stream, ok, err := lookupAs[*memoryStream](db, key, nil)
+	if err != nil || !ok {
+		return 0, err
+	}
+	g := stream.groups[group]
+	if g == nil {
+		return 0, nil
+	}
+	var n int64
+	for _, id := range ids {
+		parsed, err := parseStreamID(id, 0)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := g.pending[parsed]; ok {
+			delete(g.pending, parsed)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// call executes a command given as a list of arguments, as issued by Do and the
+// fenced batches of writeSlot.
+func (db *memoryDB) call(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("ERR empty command")
+	}
+	name, args := strings.ToUpper(args[0]), args[1:]
+	arity := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+		}
+		return nil
+	}
+	switch name {
+	case "GET":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		return db.get(args[0])
+
+	case "SET":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		var (
+			ttl time.Duration
+			nx  bool
+		)
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				if i+1 == len(args) {
+					return nil, errMemorySyntax
+				}
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					return nil, errors.New("ERR invalid expire time in 'set' command")
+				}
+				ttl = time.Duration(n) * time.Millisecond
+				if strings.ToUpper(args[i]) == "EX" {
+					ttl = time.Duration(n) * time.Second
+				}
+				i++
+			default:
+				return nil, errMemorySyntax
+			}
+		}
+		if !db.set(args[0], args[1], ttl, nx) {
+			return nil, redis.Nil
+		}
+		return "OK", nil
+
+	case "DEL":
+		return db.del(args...), nil
+
+	case "EXISTS":
+		return db.exists(args...), nil
+
+	case "INCR":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		return db.incr(args[0])
+
+	case "RENAME":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if _, err := db.rename(args[0], args[1], false); err != nil {
+			return nil, err
+		}
+		return "OK", nil
+
+	case "EXPIRE", "PEXPIRE":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errMemoryNotInt
+		}
+		ttl := time.Duration(n) * time.Millisecond
+		if name == "EXPIRE" {
+			ttl = time.Duration(n) * time.Second
+		}
+		if db.expire(args[0], ttl) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+
+	case "HSET":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		return db.hset(args[0], args[1:])
+
+	case "HGET":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.hget(args[0], args[1])
+
+	case "HDEL":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.hdel(args[0], args[1:])
+
+	case "SADD":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.sadd(args[0], args[1:])
+
+	case "SREM":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.srem(args[0], args[1:])
+
+	case "ZADD":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		members := make([]redis.Z, 0, len(args)/2)
+		for i := 1; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return nil, errors.New("ERR value is not a valid float")
+			}
+			members = append(members, redis.Z{Score: score, Member: args[i+1]})
+		}
+		return db.zadd(args[0], members)
+
+	case "ZREMRANGEBYSCORE":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		return db.zremrangebyscore(args[0], args[1], args[2])
+
+	case "ZREM":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.zrem(args[0], args[1:])
+
+	case "ZSCORE":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		score, err := db.zscore(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strconv.FormatFloat(score, 'f', -1, 64), nil
+
+	case "RPUSH":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		return db.rpush(args[0], args[1:])
+	}
+	return nil, fmt.Errorf("ERR unknown command '%s'", strings.ToLower(name))
+}
+
+// memoryScript is the Go equivalent of a Lua script of this package, run with
+// the keyspace locked.
+type memoryScript func(db *memoryDB, keys []string, args []string) (interface{}, error)
+
+// memoryScripts maps the source of the Lua scripts of this package to their Go
+// equivalents. Every script run through Eval must be listed here.
+var memoryScripts = map[string]memoryScript{
+	deleteIfEqualScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		if value, err := db.get(keys[0]); err == nil && value == args[0] {
+			return db.del(keys[0]), nil
+		}
+		return int64(0), nil
+	},
+	acquireLeaseScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		lease, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if held, err := db.get(keys[0]); err == nil {
+			token, node, _ := strings.Cut(held, ":")
+			if node != args[0] {
+				return int64(0), nil
+			}
+			db.expire(keys[0], time.Duration(lease)*time.Millisecond)
+			return strconv.ParseInt(token, 10, 64)
+		}
+		token, err := db.incr(keys[1])
+		if err != nil {
+			return nil, err
+		}
+		db.set(keys[0], fmt.Sprintf("%d:%s", token, args[0]), time.Duration(lease)*time.Millisecond, false)
+		return token, nil
+	},
+	batchScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		fences, err := strconv.Atoi(args[1])
+		if err != nil || 2+fences > len(args) {
+			return nil, errMemorySyntax
+		}
+		if args[0] != "0" {
+			for _, key := range keys[:fences] {
+				if err := checkFence(db, key, args[0]); err != nil {
+					return nil, err
+				}
+			}
+			for i, key := range keys[:fences] {
+				if err := raiseFence(db, key, args[0], args[2+i]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for i := 2 + fences; i < len(args); {
+			n, err := strconv.Atoi(args[i])
+			if err != nil || i+1+n > len(args) {
+				return nil, errMemorySyntax
+			}
+			cmd := args[i+1 : i+1+n]
+			if cmd[0] == "XPUBLISH" {
+				_, err = memoryPublish(db, cmd[1], cmd[2], cmd[3], cmd[4:])
+			} else {
+				_, err = db.call(cmd)
+			}
+			if err != nil && err != redis.Nil {
+				return nil, err
+			}
+			i += n + 1
+		}
+		return int64(0), nil
+	},
+	publishScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		if args[0] != "0" {
+			if err := raiseFence(db, keys[2], args[0], "0"); err != nil {
+				return nil, err
+			}
+		}
+		return memoryPublish(db, keys[0], keys[1], args[1], args[2:])
+	},
+	unindexPointerScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		if hash, err := db.hget(keys[0], "blockHash"); err == nil && hash == args[0] {
+			db.del(keys[0])
+		}
+		return int64(0), nil
+	},
+	unindexEntryScript: func(db *memoryDB, keys []string, args []string) (interface{}, error) {
+		number, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		if score, err := db.zscore(keys[0], args[0]); err == nil && score == number {
+			db.zrem(keys[0], args[:1])
+		}
+		return int64(0), nil
+	},
+}
+
+// checkFence checks a fencing token against the one recorded at a fence key as
+// done by batchScript.
+func checkFence(db *memoryDB, key string, token string) error {
+	have, err := db.get(key)
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	fence, _ := strconv.ParseUint(have, 10, 64)
+	next, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return err
+	}
+	if fence > next {
+		return fmt.Errorf("FENCED %d", fence)
+	}
+	return nil
+}
+
+// raiseFence checks a fencing token against the one recorded at a fence key,
+// recording it if newer.
+func raiseFence(db *memoryDB, key string, token string, ttl string) error {
+	if err := checkFence(db, key, token); err != nil {
+		return err
+	}
+	have, _ := db.get(key)
+	fence, _ := strconv.ParseUint(have, 10, 64)
+	if next, _ := strconv.ParseUint(token, 10, 64); fence < next {
+		ms, _ := strconv.ParseInt(ttl, 10, 64)
+		db.set(key, token, time.Duration(ms)*time.Millisecond, false)
+	}
+	return nil
+}
+
+// memoryPublish appends a stream entry with the next cursor of a chain as done
+// by publishScript, returning the cursor.
+func memoryPublish(db *memoryDB, cursorKey, streamKey string, maxLen string, values []string) (int64, error) {
+	cursor, err := db.incr(cursorKey)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(maxLen, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	values = append([]string{"cursor", strconv.FormatInt(cursor, 10)}, values...)
+	if _, err := db.xadd(streamKey, "*", n, values); err != nil {
+		return 0, err
+	}
+	return cursor, nil
+}
+
+// memoryArg formats a command argument the way go-redis sends it.
+func memoryArg(arg interface{}) (string, error) {
+	switch arg := arg.(type) {
+	case string:
+		return arg, nil
+	case []byte:
+		return string(arg), nil
+	case int:
+		return strconv.FormatInt(int64(arg), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(arg), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(arg), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(arg), 10), nil
+	case int64:
+		return strconv.FormatInt(arg, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(arg), 10), nil
+	case uint64:
+		return strconv.FormatUint(arg, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(arg), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(arg, 'f', -1, 64), nil
+	case bool:
+		if arg {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return arg.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(int64(arg), 10), nil
+	case nil:
+		return "", nil
+	case encoding.BinaryMarshaler:
+		blob, err := arg.MarshalBinary()
+		return string(blob), err
+	}
+	return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", arg)
+}
+
+// memoryArgs flattens and formats command arguments the way go-redis does.
+func memoryArgs(args ...interface{}) ([]string, error) {
+	if len(args) == 1 {
+		switch arg := args[0].(type) {
+		case []string:
+			return arg, nil
+		case []interface{}:
+			args = arg
+		case map[string]interface{}:
+			args = make([]interface{}, 0, 2*len(arg))
+			for k, v := range arg {
+				args = append(args, k, v)
+			}
+		case map[string]string:
+			args = make([]interface{}, 0, 2*len(arg))
+			for k, v := range arg {
+				args = append(args, k, v)
+			}
+		}
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, err := memoryArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// memoryCmdable implements the commands of the in-process backend, either run
+// right away or queued in a pipeline.
+type memoryCmdable struct {
+	db    *memoryDB
+	run   func(cmd redis.Cmder, fn func() error) // Runs or queues a command
+	block bool                                   // Whether XREAD and XREADGROUP may block
+}
+
+func (c memoryCmdable) Ping(ctx context.Context) *redis.StatusCmd {
+	cmd := redis.NewStatusCmd(ctx, "ping")
+	c.run(cmd, func() error {
+		cmd.SetVal("PONG")
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx, "get", key)
+	c.run(cmd, func() error {
+		value, err := c.db.get(key)
+		cmd.SetVal(value)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	cmd := redis.NewStatusCmd(ctx, "set", key, value)
+	c.run(cmd, func() error {
+		arg, err := memoryArg(value)
+		if err != nil {
+			return err
+		}
+		c.db.set(key, arg, expiration, false)
+		cmd.SetVal("OK")
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx, "set", key, value, "nx")
+	c.run(cmd, func() error {
+		arg, err := memoryArg(value)
+		if err != nil {
+			return err
+		}
+		cmd.SetVal(c.db.set(key, arg, expiration, true))
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "del")
+	c.run(cmd, func() error {
+		cmd.SetVal(c.db.del(keys...))
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "exists")
+	c.run(cmd, func() error {
+		cmd.SetVal(c.db.exists(keys...))
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx, "expire", key)
+	c.run(cmd, func() error {
+		cmd.SetVal(c.db.expire(key, expiration))
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	cmd := redis.NewDurationCmd(ctx, time.Millisecond, "pttl", key)
+	c.run(cmd, func() error {
+		cmd.SetVal(c.db.pttl(key))
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) RenameNX(ctx context.Context, key, newkey string) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx, "renamenx", key, newkey)
+	c.run(cmd, func() error {
+		ok, err := c.db.rename(key, newkey, true)
+		cmd.SetVal(ok)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx, "hget", key, field)
+	c.run(cmd, func() error {
+		value, err := c.db.hget(key, field)
+		cmd.SetVal(value)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	cmd := redis.NewStringStringMapCmd(ctx, "hgetall", key)
+	c.run(cmd, func() error {
+		fields, err := c.db.hgetall(key)
+		cmd.SetVal(fields)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	cmd := redis.NewSliceCmd(ctx, "hmget", key)
+	c.run(cmd, func() error {
+		values, err := c.db.hmget(key, fields)
+		cmd.SetVal(values)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "hset", key)
+	c.run(cmd, func() error {
+		pairs, err := memoryArgs(values...)
+		if err != nil {
+			return err
+		}
+		n, err := c.db.hset(key, pairs)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) HMSet(ctx context.Context, key string, values ...interface{}) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx, "hmset", key)
+	c.run(cmd, func() error {
+		pairs, err := memoryArgs(values...)
+		if err != nil {
+			return err
+		}
+		_, err = c.db.hset(key, pairs)
+		cmd.SetVal(err == nil)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	cmd := redis.NewStringSliceCmd(ctx, "lrange", key, start, stop)
+	c.run(cmd, func() error {
+		items, err := c.db.lrange(key, start, stop)
+		cmd.SetVal(items)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "rpush", key)
+	c.run(cmd, func() error {
+		items, err := memoryArgs(values...)
+		if err != nil {
+			return err
+		}
+		n, err := c.db.rpush(key, items)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	cmd := redis.NewStringSliceCmd(ctx, "smembers", key)
+	c.run(cmd, func() error {
+		members, err := c.db.smembers(key)
+		cmd.SetVal(members)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "zadd", key)
+	c.run(cmd, func() error {
+		zs := make([]redis.Z, len(members))
+		for i, member := range members {
+			name, err := memoryArg(member.Member)
+			if err != nil {
+				return err
+			}
+			zs[i] = redis.Z{Score: member.Score, Member: name}
+		}
+		n, err := c.db.zadd(key, zs)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "zrem", key)
+	c.run(cmd, func() error {
+		names, err := memoryArgs(members...)
+		if err != nil {
+			return err
+		}
+		n, err := c.db.zrem(key, names)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "zcard", key)
+	c.run(cmd, func() error {
+		n, err := c.db.zcard(key)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	cmd := redis.NewFloatCmd(ctx, "zscore", key, member)
+	c.run(cmd, func() error {
+		score, err := c.db.zscore(key, member)
+		cmd.SetVal(score)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	cmd := redis.NewStringSliceCmd(ctx, "zrange", key, start, stop)
+	c.run(cmd, func() error {
+		members, err := c.db.zrange(key, start, stop)
+		names := make([]string, len(members))
+		for i, member := range members {
+			names[i] = member.Member.(string)
+		}
+		cmd.SetVal(names)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	cmd := redis.NewZSliceCmd(ctx, "zrange", key, start, stop, "withscores")
+	c.run(cmd, func() error {
+		members, err := c.db.zrange(key, start, stop)
+		cmd.SetVal(members)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	cmd := redis.NewStringSliceCmd(ctx, "zrangebyscore", key, opt.Min, opt.Max)
+	c.run(cmd, func() error {
+		names, err := c.db.zrangebyscore(key, opt)
+		cmd.SetVal(names)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "zremrangebyscore", key, min, max)
+	c.run(cmd, func() error {
+		n, err := c.db.zremrangebyscore(key, min, max)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx, "xadd", a.Stream)
+	c.run(cmd, func() error {
+		if a.NoMkStream && c.db.lookup(a.Stream) == nil {
+			return redis.Nil
+		}
+		values, err := memoryArgs(a.Values)
+		if err != nil {
+			return err
+		}
+		maxLen := a.MaxLen
+		if maxLen == 0 {
+			maxLen = a.MaxLenApprox
+		}
+		id, err := c.db.xadd(a.Stream, a.ID, maxLen, values)
+		cmd.SetVal(id)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) XLen(ctx context.Context, stream string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "xlen", stream)
+	c.run(cmd, func() error {
+		n, err := c.db.xlen(stream)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) XRange(ctx context.Context, stream, start, stop string) *redis.XMessageSliceCmd {
+	cmd := redis.NewXMessageSliceCmd(ctx, "xrange", stream, start, stop)
+	c.run(cmd, func() error {
+		msgs, err := c.db.xrange(stream, start, stop)
+		cmd.SetVal(msgs)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	cmd := redis.NewStatusCmd(ctx, "xgroup", "create", stream, group, start, "mkstream")
+	c.run(cmd, func() error {
+		if err := c.db.xgroupcreate(stream, group, start, true); err != nil {
+			return err
+		}
+		cmd.SetVal("OK")
+		return nil
+	})
+	return cmd
+}
+
+func (c memoryCmdable) XRead(ctx context.Context, a *redis.XReadArgs) *redis.XStreamSliceCmd {
+	cmd := redis.NewXStreamSliceCmd(ctx, "xread")
+	if len(a.Streams) == 0 || len(a.Streams)%2 != 0 {
+		cmd.SetErr(errMemorySyntax)
+		return cmd
+	}
+	// Resolve the ID of the last entry once, so that blocking reads deliver the
+	// entries added meanwhile
+	args := *a
+	args.Streams = append([]string{}, a.Streams...)
+	c.db.lock.Lock()
+	for i, n := 0, len(args.Streams)/2; i < n; i++ {
+		if args.Streams[n+i] == "$" {
+			last := "0-0"
+			if stream, ok, err := lookupAs[*memoryStream](c.db, args.Streams[i], nil); err == nil && ok {
+				last = stream.last.String()
+			}
+			args.Streams[n+i] = last
+		}
+	}
+	c.db.lock.Unlock()
+
+	return c.readStreams(ctx, cmd, a.Block, func() ([]redis.XStream, error) {
+		return c.db.xread(&args)
+	})
+}
+
+func (c memoryCmdable) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	cmd := redis.NewXStreamSliceCmd(ctx, "xreadgroup", "group", a.Group, a.Consumer)
+	return c.readStreams(ctx, cmd, a.Block, func() ([]redis.XStream, error) {
+		return c.db.xreadgroup(a)
+	})
+}
+
+// readStreams runs a stream read, waiting up to block for new entries if there
+// are none yet. A zero block waits forever, a negative one not at all.
+func (c memoryCmdable) readStreams(ctx context.Context, cmd *redis.XStreamSliceCmd, block time.Duration, read func() ([]redis.XStream, error)) *redis.XStreamSliceCmd {
+	if !c.block || block < 0 {
+		c.run(cmd, func() error {
+			streams, err := read()
+			cmd.SetVal(streams)
+			return err
+		})
+		return cmd
+	}
+	// Wait for new entries, without holding the keyspace meanwhile
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		c.db.lock.Lock()
+		streams, err := read()
+		notify := c.db.notify
+		c.db.lock.Unlock()
+
+		if err != redis.Nil {
+			cmd.SetVal(streams)
+			cmd.SetErr(err)
+			return cmd
+		}
+		select {
+		case <-notify:
+		case <-timeout:
+			cmd.SetErr(redis.Nil)
+			return cmd
+		case <-ctx.Done():
+			cmd.SetErr(ctx.Err())
+			return cmd
+		}
+	}
+}
+
+func (c memoryCmdable) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx, "xack", stream, group)
+	c.run(cmd, func() error {
+		n, err := c.db.xack(stream, group, ids)
+		cmd.SetVal(n)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, "eval", script, len(keys))
+	c.run(cmd, func() error {
+		fn, ok := memoryScripts[script]
+		if !ok {
+			return errors.New("NOSCRIPT No matching script")
+		}
+		strs, err := memoryArgs(args...)
+		if err != nil {
+			return err
+		}
+		result, err := fn(c.db, keys, strs)
+		cmd.SetVal(result)
+		return err
+	})
+	return cmd
+}
+
+func (c memoryCmdable) Do(ctx context.Context, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, args...)
+	c.run(cmd, func() error {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			s, err := memoryArg(arg)
+			if err != nil {
+				return err
+			}
+			strs[i] = s
+		}
+		result, err := c.db.call(strs)
+		cmd.SetVal(result)
+		return err
+	})
+	return cmd
+}
+
+// MemoryBackend is a Backend keeping all data in process memory, standing in for
+// a Redis deployment in tests.
+type MemoryBackend struct {
+	memoryCmdable
+}
+
+var _ Backend = (*MemoryBackend)(nil)
+
+// NewMemoryBackend creates an empty in-process backend.
+func NewMemoryBackend() *MemoryBackend {
+	db := &memoryDB{
+		keys:   make(map[string]*memoryEntry),
+		notify: make(chan struct{}),
+		runID:  lockToken(),
+	}
+	b := &MemoryBackend{memoryCmdable{db: db, block: true}}
+	b.run = func(cmd redis.Cmder, fn func() error) {
+		db.lock.Lock()
+		err := fn()
+		db.lock.Unlock()
+		if err != nil {
+			cmd.SetErr(err)
+		}
+	}
+	return b
+}
+
+// FastForward advances the clock of the backend, expiring keys as if the given
+// time passed.
+func (b *MemoryBackend) FastForward(d time.Duration) {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	b.db.offset += d
+}
+
+// Pipeline implements Backend, starting a pipeline executed atomically.
+func (b *MemoryBackend) Pipeline() Pipeliner {
+	p := &memoryPipeline{}
+	p.memoryCmdable = memoryCmdable{db: b.db, run: p.queue}
+	return p
+}
+
+// Scan implements Backend, returning all matching keys at once.
+func (b *MemoryBackend) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	var keys []string
+	for key := range b.db.keys {
+		if ok, _ := path.Match(match, key); (match == "" || ok) && b.db.lookup(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return redis.NewScanCmdResult(keys, 0, nil)
+}
+
+// Info implements Backend, reporting the run id of the emulated server.
+func (b *MemoryBackend) Info(ctx context.Context, section ...string) *redis.StringCmd {
+	return redis.NewStringResult(fmt.Sprintf("# Server\r\nrun_id:%s\r\n", b.db.runID), nil)
+}
+
+// PoolStats implements Backend. The in-process backend has no connections.
+func (b *MemoryBackend) PoolStats() *redis.PoolStats {
+	return new(redis.PoolStats)
+}
+
+// Close implements Backend. The data is retained, as it may be shared by other
+// stores.
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+// memoryPipeline queues the commands of an in-process pipeline.
+type memoryPipeline struct {
+	memoryCmdable
+	cmds []redis.Cmder
+	fns  []func() error
+}
+
+// queue adds a command to the pipeline.
+func (p *memoryPipeline) queue(cmd redis.Cmder, fn func() error) {
+	p.cmds = append(p.cmds, cmd)
+	p.fns = append(p.fns, fn)
+}
+
+// Exec implements Pipeliner, running all queued commands atomically.
+func (p *memoryPipeline) Exec(ctx context.Context) ([]redis.Cmder, error) {
+	if len(p.cmds) == 0 {
+		return nil, nil
+	}
+	cmds, fns := p.cmds, p.fns
+	p.cmds, p.fns = nil, nil
+
+	p.db.lock.Lock()
+	for i, fn := range fns {
+		if err := fn(); err != nil {
+			cmds[i].SetErr(err)
+		}
+	}
+	p.db.lock.Unlock()
+
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return cmds, err
+		}
+	}
+	return cmds, nil
+}
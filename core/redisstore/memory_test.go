@@ -0,0 +1,164 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/go-redis/redis/v8"
+)
+
+// Tests that keys of the in-process backend expire, and that their type is
+// enforced.
+func TestMemoryExpiry(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		backend = NewMemoryBackend()
+	)
+	backend.Set(ctx, "short", "1", time.Second)
+	backend.HSet(ctx, "long", "field", "value")
+	backend.Expire(ctx, "long", time.Hour)
+	backend.Set(ctx, "forever", "1", 0)
+
+	if ttl := backend.PTTL(ctx, "long").Val(); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expiry mismatch: have %v", ttl)
+	}
+	if ttl := backend.PTTL(ctx, "forever").Val(); ttl != -1 {
+		t.Errorf("Persistent key expiry mismatch: have %v", ttl)
+	}
+	backend.FastForward(time.Minute)
+
+	if n := backend.Exists(ctx, "short", "long", "forever").Val(); n != 2 {
+		t.Errorf("Live key count mismatch: have %d, want 2", n)
+	}
+	if _, err := backend.Get(ctx, "short").Result(); err != redis.Nil {
+		t.Errorf("Expired key readable: %v", err)
+	}
+	if _, err := backend.Get(ctx, "long").Result(); err == nil {
+		t.Errorf("Hash read as string")
+	}
+	keys, _ := backend.Scan(ctx, 0, "*o*", 0).Val()
+	if len(keys) != 2 {
+		t.Errorf("Scanned keys mismatch: have %v", keys)
+	}
+}
+
+// Tests that pipelines run in order and report the first failure.
+func TestMemoryPipeline(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		backend = NewMemoryBackend()
+		pipe    = backend.Pipeline()
+	)
+	pipe.ZAdd(ctx, "set", &redis.Z{Score: 2, Member: "b"}, &redis.Z{Score: 1, Member: "a"}, &redis.Z{Score: 3, Member: "c"})
+	pipe.ZRemRangeByScore(ctx, "set", "(2", "+inf")
+	rng := pipe.ZRangeByScore(ctx, "set", &redis.ZRangeBy{Min: "-inf", Max: "+inf"})
+	missing := pipe.Get(ctx, "missing")
+	pipe.RPush(ctx, "list", "x", "y")
+
+	if _, err := pipe.Exec(ctx); err != redis.Nil {
+		t.Errorf("Pipeline error mismatch: have %v, want %v", err, redis.Nil)
+	}
+	if have := rng.Val(); len(have) != 2 || have[0] != "a" || have[1] != "b" {
+		t.Errorf("Range mismatch: have %v", have)
+	}
+	if missing.Err() != redis.Nil {
+		t.Errorf("Missing key error mismatch: %v", missing.Err())
+	}
+	if items := backend.LRange(ctx, "list", 0, -1).Val(); len(items) != 2 {
+		t.Errorf("Commands after failure not run: %v", items)
+	}
+}
+
+// Tests that stream entries are delivered to consumer groups once, and that
+// blocking reads wake up on new entries.
+func TestMemoryStreams(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		backend = NewMemoryBackend()
+	)
+	if err := backend.XGroupCreateMkStream(ctx, "events", "group", "0").Err(); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := backend.XGroupCreateMkStream(ctx, "events", "group", "0").Err(); err == nil {
+		t.Errorf("Group created twice")
+	}
+	for i := 0; i < 3; i++ {
+		backend.XAdd(ctx, &redis.XAddArgs{Stream: "events", MaxLen: 2, Values: []interface{}{"n", i}})
+	}
+	read := func(block time.Duration) ([]redis.XStream, error) {
+		return backend.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "group", Consumer: "c", Streams: []string{"events", ">"}, Block: block}).Result()
+	}
+	streams, err := read(-1)
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 2 || streams[0].Messages[0].Values["n"] != "1" {
+		t.Fatalf("Trimmed stream delivery mismatch: %v, %v", streams, err)
+	}
+	if _, err := read(-1); err != redis.Nil {
+		t.Errorf("Entries delivered twice: %v", err)
+	}
+	if _, err := read(10 * time.Millisecond); err != redis.Nil {
+		t.Errorf("Blocking read without entries: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		backend.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"n": 3}})
+	}()
+	if streams, err = read(0); err != nil || streams[0].Messages[0].Values["n"] != "3" {
+		t.Errorf("Blocking read mismatch: %v, %v", streams, err)
+	}
+}
+
+// Tests that the store runs on the in-process backend, including the writes
+// done by the Lua scripts.
+func TestMemoryStore(t *testing.T) {
+	stores := make([]*RedisBlockStore, 2)
+	backend := NewMemoryBackend()
+	for i := range stores {
+		store, err := NewStore(testConfig(), backend)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		store.SetChainID(big.NewInt(1))
+		stores[i] = store
+	}
+	stale, fresh := stores[0], stores[1]
+
+	old, _ := stale.AcquireLease("stale", time.Minute)
+	if token, _ := fresh.AcquireLease("fresh", time.Minute); token != 0 {
+		t.Fatalf("Lease acquired while held")
+	}
+	backend.FastForward(time.Minute)
+	token, _ := fresh.AcquireLease("fresh", time.Minute)
+	if token <= old {
+		t.Fatalf("Takeover token not increased: have %d, previous %d", token, old)
+	}
+	stale.SetFence(old)
+	fresh.SetFence(token)
+
+	var (
+		block = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+		fork  = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Extra: []byte{1}})
+	)
+	if err := fresh.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block: %v", err)
+	}
+	if err := stale.StoreBlock(fork, nil, params.TestChainConfig); !errors.Is(err, errFenced) {
+		t.Errorf("Stale block write not fenced: %v", err)
+	}
+	if hash, _ := fresh.GetCanonicalHash(1); hash != block.Hash() {
+		t.Errorf("Canonical block mismatch: have %x, want %x", hash, block.Hash())
+	}
+	if n, _ := backend.XLen(context.Background(), fresh.keys.streamKey(BlocksStream)).Result(); n != 1 {
+		t.Errorf("Block events mismatch: have %d, want 1", n)
+	}
+	// Block keys expire with the store's TTL
+	backend.FastForward(blockTTL)
+	if hash, _ := fresh.GetCanonicalHash(1); hash != (common.Hash{}) {
+		t.Errorf("Canonical marker did not expire")
+	}
+}
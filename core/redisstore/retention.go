@@ -0,0 +1,346 @@
+package redisstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// Exported data is divided into classes, each retained according to its own
+// policy. Data may expire a while after it was written, and it may be pruned
+// once its block falls a number of blocks behind the finalized block. The
+// expiry is set along with every write, the pruning is done by the exporter's
+// janitor after every exported head, from the height it last pruned up to the
+// one the finalized block allows. The last pruned height of each class is kept
+// in Redis, so that the janitor resumes after restarts and failovers.
+
+// Classes of exported data, each with a retention policy of its own.
+const (
+	BlocksClass     = "blocks"     // Block hashes, canonical markers, hash index and removed logs
+	LogsClass       = "logs"       // Log index
+	ReceiptsClass   = "receipts"   // Receipts of canonical transactions
+	PendingTxsClass = "pendingTxs" // Mempool mirror, its address index and the transaction histories
+	MinedTxsClass   = "minedTxs"   // Block pointers and address index of canonical transactions
+)
+
+// maxPruneHeights is the maximum number of heights the janitor prunes per class
+// after an exported head. Larger backlogs are worked off over subsequent heads.
+const maxPruneHeights = 128
+
+var pruneMeter = metrics.NewRegisteredMeter("redis/export/pruned", nil)
+
+// RetentionPolicy defines how long a class of exported data is kept. The data
+// expires Age after it was last written, and is pruned as soon as its block is
+// more than Depth blocks behind the finalized block, whichever comes first. A
+// zero limit is not enforced, the zero policy keeps the data until purged.
+type RetentionPolicy struct {
+	Age   time.Duration // Expiry after the data was written, 0 for none
+	Depth uint64        // Number of blocks retained behind the finalized block, 0 for all
+}
+
+// ParseRetentionPolicy parses a retention policy given as a duration (e.g. 24h),
+// a block depth (e.g. 128) or both, separated by a comma. An empty policy or 0
+// keeps the data until purged.
+func ParseRetentionPolicy(s string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "0" {
+			continue
+		}
+		if depth, err := strconv.ParseUint(part, 10, 64); err == nil {
+			policy.Depth = depth
+			continue
+		}
+		age, err := time.ParseDuration(part)
+		if err != nil || age < 0 {
+			return RetentionPolicy{}, fmt.Errorf("invalid retention %q, neither a duration nor a block depth", part)
+		}
+		policy.Age = age
+	}
+	return policy, nil
+}
+
+// String implements fmt.Stringer, formatting the policy as accepted by
+// ParseRetentionPolicy.
+func (p RetentionPolicy) String() string {
+	var parts []string
+	if p.Age != 0 {
+		parts = append(parts, p.Age.String())
+	}
+	if p.Depth != 0 {
+		parts = append(parts, strconv.FormatUint(p.Depth, 10))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Retention holds the retention policies of the classes of exported data. The
+// number of entries retained per event stream is configured by StreamMaxLen.
+type Retention struct {
+	Blocks     RetentionPolicy // Block hashes, canonical markers, hash index and removed logs of dropped blocks
+	Logs       RetentionPolicy // Log index, if enabled
+	Receipts   RetentionPolicy // Receipts of canonical transactions
+	PendingTxs RetentionPolicy // Mempool mirror, its address index and the transaction histories, by age only
+	MinedTxs   RetentionPolicy // Block pointers and address index of canonical transactions
+}
+
+// sanitize checks the retention policies and drops any limit that cannot be
+// enforced.
+func (r Retention) sanitize() Retention {
+	for class, policy := range r.policies() {
+		if policy.Age < 0 {
+			log.Warn("Sanitizing invalid redis retention age", "class", class, "provided", policy.Age, "updated", 0)
+			policy.Age = 0
+		}
+	}
+	if r.PendingTxs.Depth != 0 {
+		log.Warn("Sanitizing invalid redis retention depth of pending transactions", "provided", r.PendingTxs.Depth, "updated", 0)
+		r.PendingTxs.Depth = 0
+	}
+	return r
+}
+
+// policies returns the policies of all classes by name.
+func (r *Retention) policies() map[string]*RetentionPolicy {
+	return map[string]*RetentionPolicy{
+		BlocksClass:     &r.Blocks,
+		LogsClass:       &r.Logs,
+		ReceiptsClass:   &r.Receipts,
+		PendingTxsClass: &r.PendingTxs,
+		MinedTxsClass:   &r.MinedTxs,
+	}
+}
+
+// retentionKey returns the key of the hash holding the last height pruned per
+// class of data of a chain.
+func (k keyspace) retentionKey() string {
+	return fmt.Sprintf("%sretention:{%s}", k.prefix, k.chainID)
+}
+
+// expireArgs returns the arguments of a PEXPIRE command applying an age limit
+// to a key, nil if there is none.
+func expireArgs(key string, age time.Duration) []interface{} {
+	if age == 0 {
+		return nil
+	}
+	return []interface{}{"PEXPIRE", key, age.Milliseconds()}
+}
+
+// setArgs returns the arguments of a SET command storing a value, expiring
+// after the given age unless zero.
+func setArgs(key string, value interface{}, age time.Duration) []interface{} {
+	if age == 0 {
+		return []interface{}{"SET", key, value}
+	}
+	return []interface{}{"SET", key, value, "PX", age.Milliseconds()}
+}
+
+// expire adds a PEXPIRE of a key to a batch, unless the age limit is zero.
+func (b *slotBatch) expire(key string, age time.Duration) {
+	if args := expireArgs(key, age); args != nil {
+		b.add(key, args...)
+	}
+}
+
+// PrunedHeights returns the last height pruned per class of data, omitting the
+// classes never pruned.
+func (s *RedisBlockStore) PrunedHeights() (map[string]uint64, error) {
+	fields, err := s.client.HGetAll(s.ctx, s.keys.retentionKey()).Result()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to read pruned heights: %v", err)
+	}
+	pruned := make(map[string]uint64, len(fields))
+	for class, field := range fields {
+		number, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pruned height of %s: %v", class, err)
+		}
+		pruned[class] = number
+	}
+	return pruned, nil
+}
+
+// setPruned records the last pruned height of a class of data.
+func (s *RedisBlockStore) setPruned(class string, number uint64) error {
+	if err := s.client.HSet(s.ctx, s.keys.retentionKey(), class, number).Err(); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to record pruned height: %v", err)
+	}
+	return nil
+}
+
+// unprune lowers the last pruned height of every class to the given one, so that
+// blocks exported again below it are pruned once more.
+func (s *RedisBlockStore) unprune(number uint64) error {
+	pruned, err := s.PrunedHeights()
+	if err != nil {
+		return err
+	}
+	for class, last := range pruned {
+		if last > number {
+			if err := s.setPruned(class, number); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Prune drops the data of a class at the heights in [from, to] and records to
+// as pruned. The canonical blocks of the heights are needed to locate the data
+// of their transactions, heights whose block is nil only have the data keyed by
+// height dropped.
+func (s *RedisBlockStore) Prune(class string, from, to uint64, blocks []*types.Block) error {
+	batch := new(slotBatch)
+	switch class {
+	case BlocksClass:
+		if err := s.queuePruneBlocks(batch, from, to); err != nil {
+			return err
+		}
+	case LogsClass:
+		for number := from; number <= to; number++ {
+			batch.add(s.keys.logIndexBlockKey(number), "DEL", s.keys.logIndexBlockKey(number))
+		}
+		if err := s.queueLogTrim(batch, to+1, nil); err != nil {
+			return err
+		}
+	case ReceiptsClass:
+		for _, block := range blocks {
+			if block == nil {
+				continue
+			}
+			for _, tx := range block.Transactions() {
+				batch.add(s.keys.receiptKey(tx.Hash()), "DEL", s.keys.receiptKey(tx.Hash()))
+			}
+		}
+	case MinedTxsClass:
+		for _, block := range blocks {
+			if block == nil {
+				continue
+			}
+			for _, tx := range block.Transactions() {
+				from, err := types.Sender(txSigner(tx), tx)
+				if err != nil {
+					return fmt.Errorf("failed to recover sender of %x: %v", tx.Hash(), err)
+				}
+				batch.add(s.keys.txBlockKey(tx.Hash()), "DEL", s.keys.txBlockKey(tx.Hash()))
+				for _, addr := range txParties(from, tx.To(), tx.Nonce()) {
+					batch.add(s.keys.addrMinedKey(addr), "ZREM", s.keys.addrMinedKey(addr), tx.Hash().Hex())
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("class %s not pruned by depth", class)
+	}
+	if err := s.pipeline(batch); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to prune %s: %v", class, err)
+	}
+	pruneMeter.Mark(int64(to - from + 1))
+	return s.setPruned(class, to)
+}
+
+// queuePruneBlocks adds the writes dropping all blocks stored at the heights in
+// [from, to] to a batch, canonical or not.
+func (s *RedisBlockStore) queuePruneBlocks(batch *slotBatch, from, to uint64) error {
+	var (
+		pipe      = s.client.Pipeline()
+		canonical = make([]*redis.StringCmd, 0, to-from+1)
+		siblings  = make([]*redis.StringSliceCmd, 0, to-from+1)
+	)
+	for number := from; number <= to; number++ {
+		canonical = append(canonical, pipe.Get(s.ctx, s.keys.canonicalKey(number)))
+		siblings = append(siblings, pipe.SMembers(s.ctx, s.keys.siblingsKey(number)))
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to look up stored blocks: %v", err)
+	}
+	for i, number := 0, from; number <= to; i, number = i+1, number+1 {
+		for _, key := range []string{s.keys.blockKey(number), s.keys.canonicalKey(number), s.keys.siblingsKey(number), s.keys.heightFenceKey(number)} {
+			batch.add(key, "DEL", key)
+		}
+		if hash := canonical[i].Val(); hash != "" {
+			for _, key := range []string{s.keys.blockHashKey(common.HexToHash(hash)), s.keys.stateDiffKey(common.HexToHash(hash))} {
+				batch.add(key, "DEL", key)
+			}
+		}
+		for _, sibling := range siblings[i].Val() {
+			hash := common.HexToHash(sibling)
+			for _, key := range []string{s.keys.siblingKey(number, hash), s.keys.blockHashKey(hash), s.keys.removedLogsKey(hash), s.keys.stateDiffKey(hash)} {
+				batch.add(key, "DEL", key)
+			}
+		}
+	}
+	return nil
+}
+
+// prune enforces the depth limits of the retention policies, pruning the data
+// of the heights that fell too far behind the finalized block since the last
+// run. Heights are pruned for the first time once their class got a depth limit,
+// older data is left to expire.
+func (e *Exporter) prune() error {
+	final := e.chain.CurrentFinalBlock()
+	if final == nil {
+		return nil
+	}
+	var pruned map[string]uint64
+	for class, policy := range e.store.config.Retention.policies() {
+		if policy.Depth == 0 || final.Number.Uint64() <= policy.Depth {
+			continue
+		}
+		if class == LogsClass && !e.store.config.LogIndex {
+			continue
+		}
+		if pruned == nil {
+			var err error
+			if pruned, err = e.store.PrunedHeights(); err != nil {
+				return err
+			}
+		}
+		cutoff := final.Number.Uint64() - policy.Depth - 1
+		last, ok := pruned[class]
+		if !ok {
+			log.Info("Starting Redis retention", "class", class, "depth", policy.Depth, "from", cutoff+1)
+			if err := e.store.setPruned(class, cutoff); err != nil {
+				return err
+			}
+			continue
+		}
+		if last >= cutoff {
+			continue
+		}
+		from, to := last+1, min(cutoff, last+maxPruneHeights)
+
+		var blocks []*types.Block
+		if class == ReceiptsClass || class == MinedTxsClass {
+			blocks = make([]*types.Block, 0, to-from+1)
+			for number := from; number <= to; number++ {
+				var block *types.Block
+				if header := e.chain.GetHeaderByNumber(number); header != nil {
+					block = e.chain.GetBlock(header.Hash(), number)
+				}
+				if block == nil {
+					log.Debug("Pruned Redis block unavailable locally", "class", class, "number", number)
+				}
+				blocks = append(blocks, block)
+			}
+		}
+		if err := e.store.Prune(class, from, to, blocks); err != nil {
+			return err
+		}
+		log.Debug("Pruned Redis data", "class", class, "from", from, "to", to, "finalized", final.Number)
+	}
+	return nil
+}
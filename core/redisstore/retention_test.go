@@ -0,0 +1,203 @@
+package redisstore
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	tests := []struct {
+		input string
+		want  RetentionPolicy
+		fail  bool
+	}{
+		{input: "", want: RetentionPolicy{}},
+		{input: "0", want: RetentionPolicy{}},
+		{input: "90s", want: RetentionPolicy{Age: 90 * time.Second}},
+		{input: "128", want: RetentionPolicy{Depth: 128}},
+		{input: "24h, 128", want: RetentionPolicy{Age: 24 * time.Hour, Depth: 128}},
+		{input: "-1h", fail: true},
+		{input: "one week", fail: true},
+	}
+	for _, tt := range tests {
+		have, err := ParseRetentionPolicy(tt.input)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tt.input, have)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: failed to parse: %v", tt.input, err)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("%q: policy mismatch: have %+v, want %+v", tt.input, have, tt.want)
+		}
+		if again, _ := ParseRetentionPolicy(have.String()); again != have {
+			t.Errorf("%q: policy not preserved by String: have %+v, want %+v", tt.input, again, have)
+		}
+	}
+}
+
+// Tests that every class of data expires after its own age.
+func TestRetentionAge(t *testing.T) {
+	backend := NewMemoryBackend()
+
+	config := testConfig()
+	config.Retention = Retention{
+		Blocks:   RetentionPolicy{Age: time.Minute},
+		Receipts: RetentionPolicy{Age: time.Hour},
+	}
+	store, err := NewStore(config, backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(big.NewInt(1))
+
+	_, blocks, receipts := core.GenerateChainWithGenesis(testGenesis, ethash.NewFaker(), 1, func(i int, gen *core.BlockGen) {
+		gen.AddTx(emitTx(0))
+	})
+	block, tx := blocks[0], blocks[0].Transactions()[0]
+	if err := store.ExportBlock(block, receipts[0], testGenesis.Config); err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+	backend.FastForward(2 * time.Minute)
+
+	if hash, _ := store.GetCanonicalHash(1); hash != (common.Hash{}) {
+		t.Errorf("Block did not expire")
+	}
+	if receipt, _ := store.GetTxReceipt(tx.Hash()); receipt == nil {
+		t.Errorf("Receipt expired with the block")
+	}
+	if n, _ := backend.Exists(context.Background(), store.keys.txBlockKey(tx.Hash())).Result(); n != 1 {
+		t.Errorf("Block pointer without age limit expired")
+	}
+	backend.FastForward(time.Hour)
+
+	if receipt, _ := store.GetTxReceipt(tx.Hash()); receipt != nil {
+		t.Errorf("Receipt did not expire")
+	}
+}
+
+// Tests that all blocks stored at a height are pruned, canonical or not.
+func TestPruneBlocks(t *testing.T) {
+	backend := NewMemoryBackend()
+
+	store, err := NewStore(testConfig(), backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(big.NewInt(1))
+	store.SetTTL(0)
+
+	var (
+		main = makeChain(2)
+		fork = makeChain(2, 1)
+	)
+	for _, block := range []*types.Block{main[0], main[1], fork[1]} {
+		if err := store.StoreBlock(block, nil, testGenesis.Config); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+	}
+	if err := store.RemoveBlock(fork[1], nil); err != nil {
+		t.Fatalf("Failed to remove block: %v", err)
+	}
+	if err := store.Prune(BlocksClass, 1, 2, nil); err != nil {
+		t.Fatalf("Failed to prune blocks: %v", err)
+	}
+	for _, key := range []string{
+		store.keys.blockKey(1),
+		store.keys.blockKey(2),
+		store.keys.canonicalKey(2),
+		store.keys.siblingKey(2, main[1].Hash()),
+		store.keys.siblingKey(2, fork[1].Hash()),
+		store.keys.siblingsKey(2),
+		store.keys.heightFenceKey(2),
+		store.keys.blockHashKey(main[1].Hash()),
+		store.keys.blockHashKey(fork[1].Hash()),
+		store.keys.removedLogsKey(fork[1].Hash()),
+	} {
+		if n, _ := backend.Exists(context.Background(), key).Result(); n != 0 {
+			t.Errorf("Pruned key %s left behind", key)
+		}
+	}
+	if pruned, _ := store.PrunedHeights(); pruned[BlocksClass] != 2 {
+		t.Errorf("Pruned height mismatch: have %d, want 2", pruned[BlocksClass])
+	}
+}
+
+// Tests that the exporter prunes the data of the heights falling behind the
+// finalized block, as far as retained by depth.
+func TestRetentionDepth(t *testing.T) {
+	node := newTestNode(t, func(config *Config) {
+		config.LogIndex = true
+		config.Retention = Retention{
+			Blocks:   RetentionPolicy{Depth: 2},
+			Logs:     RetentionPolicy{Depth: 2},
+			Receipts: RetentionPolicy{Depth: 2},
+			MinedTxs: RetentionPolicy{Depth: 2, Age: time.Hour},
+		}
+	})
+	var (
+		store  = node.exporter.store
+		blocks = makeChain(8, 1, 4)
+		early  = blocks[1].Transactions()[0]
+		late   = blocks[4].Transactions()[0]
+	)
+	// The janitor starts at the height first falling behind the finalized block
+	node.insert(t, blocks[:4])
+	node.chain.SetFinalized(blocks[2].Header())
+	node.insert(t, blocks[4:5])
+	waitFor(t, "retention start", func() bool {
+		pruned, _ := store.PrunedHeights()
+		return pruned[BlocksClass] == 0 && len(pruned) == 4
+	})
+	// Moving the finalized block prunes everything more than two blocks behind
+	node.chain.SetFinalized(blocks[5].Header())
+	node.insert(t, blocks[5:])
+	waitFor(t, "pruning", func() bool {
+		pruned, _ := store.PrunedHeights()
+		return pruned[BlocksClass] == 3 && pruned[LogsClass] == 3 && pruned[ReceiptsClass] == 3 && pruned[MinedTxsClass] == 3
+	})
+	for n := uint64(1); n <= 3; n++ {
+		if hash, _ := store.GetCanonicalHash(n); hash != (common.Hash{}) {
+			t.Errorf("Block #%d not pruned", n)
+		}
+		if exists, _ := node.backend.Exists(context.Background(), store.keys.logIndexBlockKey(n)).Result(); exists != 0 {
+			t.Errorf("Log index of #%d not pruned", n)
+		}
+	}
+	if receipt, _ := store.GetTxReceipt(early.Hash()); receipt != nil {
+		t.Errorf("Receipt not pruned")
+	}
+	if n, _ := node.backend.Exists(context.Background(), store.keys.txBlockKey(early.Hash())).Result(); n != 0 {
+		t.Errorf("Block pointer not pruned")
+	}
+	if _, err := node.backend.ZScore(context.Background(), store.keys.addrMinedKey(testAddr), early.Hash().Hex()).Result(); err == nil {
+		t.Errorf("Address index entry not pruned")
+	}
+	hashOf := func(n uint64) common.Hash { return blocks[n-1].Hash() }
+	if logs, ok, err := store.FilterLogs(context.Background(), 2, 2, hashOf, nil, [][]common.Hash{{common.HexToHash("0xff")}}); err != nil || ok {
+		t.Errorf("Pruned logs still covered by the index: %v, %v", logs, err)
+	}
+	// Everything above is retained
+	for n := uint64(4); n <= 8; n++ {
+		if hash, _ := store.GetCanonicalHash(n); hash != blocks[n-1].Hash() {
+			t.Errorf("Block #%d pruned", n)
+		}
+	}
+	if receipt, _ := store.GetTxReceipt(late.Hash()); receipt == nil {
+		t.Errorf("Retained receipt pruned")
+	}
+	if pttl, _ := node.backend.PTTL(context.Background(), store.keys.txBlockKey(late.Hash())).Result(); pttl <= 0 {
+		t.Errorf("Block pointer written without age limit")
+	}
+}
@@ -0,0 +1,146 @@
+package redisstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/redisstore/client"
+	"github.com/go-redis/redis/v8"
+)
+
+// schemaKey returns the key of the descriptor of the data stored under the
+// prefix.
+func (k keyspace) schemaKey() string {
+	return k.prefix + "schema"
+}
+
+// Schema describes the data stored under a key prefix, so that consumers can
+// tell which chain and layout they are reading.
+type Schema = client.Schema
+
+// WriteSchema records the descriptor of the data written by the store.
+func (s *RedisBlockStore) WriteSchema() error {
+	err := s.client.HSet(s.ctx, s.keys.schemaKey(),
+		"version", SchemaVersion,
+		"chainId", s.keys.chainID.String(),
+		"prefix", s.keys.prefix,
+		"compressed", s.config.CompressEnabled,
+		"updated", time.Now().Unix(),
+	).Err()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to store schema descriptor: %v", err)
+	}
+	return nil
+}
+
+// ReadSchema returns the descriptor of the data stored under the prefix of the
+// store, or nil if none was recorded.
+func (s *RedisBlockStore) ReadSchema() (*Schema, error) {
+	schema, err := client.ReadSchema(s.ctx, s.client, s.keys.prefix)
+	if err != nil {
+		redisErrorCounter.Inc(1)
+	}
+	return schema, err
+}
+
+// legacyPatterns returns the patterns of the keys written before keys carried a
+// prefix. Keys not tied to a chain are attributed to the chain of the keyspace.
+func (k keyspace) legacyPatterns() []string {
+	return []string{
+		"block:*", "blockhash:*", "canonical:*", "removedlogs:*", "receipt:*",
+		"txblock:*", "addr:*", "fence:*",
+		"logaddr:*", "logtopic:*", "logindex:*",
+		"tx:*", "txhistory:*", "blobsidecar:*",
+		fmt.Sprintf("stream:{%s}:*", k.chainID),
+		fmt.Sprintf("exportcursor:{%s}", k.chainID),
+		fmt.Sprintf("exportlease:{%s}", k.chainID),
+		fmt.Sprintf("exportfence:{%s}", k.chainID),
+	}
+}
+
+// MigrateLegacyKeys moves the data written without key prefix under the prefix
+// of the store and records the schema descriptor. Keys already present under
+// the prefix are kept, their unprefixed counterparts dropped. The number of
+// moved keys is returned. No exporter may write meanwhile.
+func (s *RedisBlockStore) MigrateLegacyKeys() (int, error) {
+	cluster, _ := clusterClient(s.client)
+
+	var moved int
+	for _, pattern := range s.keys.legacyPatterns() {
+		err := scanKeys(s.ctx, s.client, pattern, func(key string) error {
+			ok, err := s.moveKey(key, s.keys.prefix+key, cluster)
+			if err != nil {
+				return err
+			}
+			if ok {
+				moved++
+			}
+			return nil
+		})
+		if err != nil {
+			redisErrorCounter.Inc(1)
+			return moved, fmt.Errorf("failed to migrate %s keys: %v", pattern, err)
+		}
+	}
+	// The log index tracks its keys by name, point it at the moved ones
+	keysKey := s.keys.logIndexKeysKey()
+	entries, err := s.client.ZRangeWithScores(s.ctx, keysKey, 0, -1).Result()
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return moved, fmt.Errorf("failed to read log index keys: %v", err)
+	}
+	pipe := s.client.Pipeline()
+	for _, entry := range entries {
+		member := entry.Member.(string)
+		if strings.HasPrefix(member, s.keys.prefix) {
+			continue
+		}
+		pipe.ZRem(s.ctx, keysKey, member)
+		pipe.ZAdd(s.ctx, keysKey, &redis.Z{Score: entry.Score, Member: s.keys.prefix + member})
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		redisErrorCounter.Inc(1)
+		return moved, fmt.Errorf("failed to migrate log index keys: %v", err)
+	}
+	return moved, s.WriteSchema()
+}
+
+// moveKey renames a key, unless the destination exists already in which case
+// the source is dropped. In cluster mode the keys may map to different slots,
+// so the value is copied over with its expiry instead.
+func (s *RedisBlockStore) moveKey(src, dst string, cluster *redis.ClusterClient) (bool, error) {
+	if cluster == nil {
+		ok, err := s.client.RenameNX(s.ctx, src, dst).Result()
+		if err != nil && strings.Contains(err.Error(), "no such key") {
+			return false, nil // expired meanwhile
+		}
+		if err != nil || ok {
+			return ok, err
+		}
+		return false, s.client.Del(s.ctx, src).Err()
+	}
+	dump, err := cluster.Dump(s.ctx, src).Result()
+	if err == redis.Nil {
+		return false, nil // expired meanwhile
+	}
+	if err != nil {
+		return false, err
+	}
+	ttl, err := cluster.PTTL(s.ctx, src).Result()
+	if err != nil {
+		return false, err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	moved := true
+	if err := cluster.Restore(s.ctx, dst, ttl, dump).Err(); err != nil {
+		if !strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, err
+		}
+		moved = false
+	}
+	return moved, cluster.Del(s.ctx, src).Err()
+}
@@ -0,0 +1,112 @@
+package redisstore
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/go-redis/redis/v8"
+)
+
+// Tests that the keys of different chains do not collide, and that every prefix
+// describes its data.
+func TestKeyPrefix(t *testing.T) {
+	var (
+		backend = NewMemoryBackend()
+		stores  = make([]*RedisBlockStore, 2)
+		base    = int64(1)
+		number  = big.NewInt(1)
+	)
+	for i := range stores {
+		store, err := NewStore(testConfig(), backend)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		defer store.Close()
+		store.SetChainID(big.NewInt(base + int64(i)))
+
+		block := types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte{byte(i)}})
+		if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+		if err := store.WriteSchema(); err != nil {
+			t.Fatalf("Failed to write schema: %v", err)
+		}
+		stores[i] = store
+	}
+	for i, store := range stores {
+		if want := fmt.Sprintf("%d:", base+int64(i)); store.keys.prefix != want {
+			t.Errorf("Store %d prefix mismatch: have %q, want %q", i, store.keys.prefix, want)
+		}
+		block := types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte{byte(i)}})
+		if hash, _ := store.GetCanonicalHash(number.Uint64()); hash != block.Hash() {
+			t.Errorf("Store %d canonical block mismatch: have %x, want %x", i, hash, block.Hash())
+		}
+		schema, err := store.ReadSchema()
+		if err != nil || schema == nil {
+			t.Fatalf("Failed to read schema: %v", err)
+		}
+		if schema.Version != SchemaVersion || schema.ChainID.Int64() != base+int64(i) || schema.Prefix != store.keys.prefix {
+			t.Errorf("Store %d schema mismatch: %+v", i, schema)
+		}
+	}
+}
+
+// Tests that keys written without prefix are moved under the prefix of a chain,
+// without overwriting data already present there.
+func TestMigrateLegacyKeys(t *testing.T) {
+	config := testConfig()
+	config.KeyPrefix = "migrate:"
+
+	store := newTestStore(t, config)
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+	store.SetTTL(0)
+
+	var (
+		number = uint64(1)
+		hash   = common.Hash{0x01}
+		addr   = common.Address{0x02}
+		stream = fmt.Sprintf("stream:{%s}:%s", store.keys.chainID, BlocksStream)
+		legacy = keyspace{chainID: store.keys.chainID}
+	)
+	store.client.HSet(store.ctx, legacy.blockKey(number), "hash", "legacy")
+	store.client.HSet(store.ctx, legacy.txKey(hash), "hash", hash.Hex())
+	store.client.ZAdd(store.ctx, legacy.logAddrKey(addr), &redis.Z{Score: float64(number), Member: "1:0"})
+	store.client.ZAdd(store.ctx, legacy.logIndexKeysKey(), &redis.Z{Score: float64(number), Member: legacy.logAddrKey(addr)})
+	store.client.XAdd(store.ctx, &redis.XAddArgs{Stream: stream, Values: []interface{}{"cursor", 1}})
+
+	// Data already under the prefix takes precedence
+	store.client.Set(store.ctx, legacy.canonicalKey(number), "legacy", 0)
+	store.client.Set(store.ctx, store.keys.canonicalKey(number), "current", 0)
+
+	if _, err := store.MigrateLegacyKeys(); err != nil {
+		t.Fatalf("Failed to migrate keys: %v", err)
+	}
+	for _, key := range []string{legacy.blockKey(number), legacy.txKey(hash), legacy.logAddrKey(addr), stream, legacy.canonicalKey(number)} {
+		if n, _ := store.client.Exists(store.ctx, key).Result(); n != 0 {
+			t.Errorf("Legacy key %s left", key)
+		}
+	}
+	if have, _ := store.client.HGet(store.ctx, store.keys.blockKey(number), "hash").Result(); have != "legacy" {
+		t.Errorf("Block not moved: have %q", have)
+	}
+	if have, _ := store.client.HGet(store.ctx, store.keys.txKey(hash), "hash").Result(); have != hash.Hex() {
+		t.Errorf("Transaction not moved: have %q", have)
+	}
+	if n, _ := store.client.XLen(store.ctx, store.keys.streamKey(BlocksStream)).Result(); n != 1 {
+		t.Errorf("Stream not moved: have %d entries", n)
+	}
+	if have, _ := store.client.Get(store.ctx, store.keys.canonicalKey(number)).Result(); have != "current" {
+		t.Errorf("Prefixed key overwritten: have %q", have)
+	}
+	if _, err := store.client.ZScore(store.ctx, store.keys.logIndexKeysKey(), store.keys.logAddrKey(addr)).Result(); err != nil {
+		t.Errorf("Log index key not renamed: %v", err)
+	}
+	if schema, _ := store.ReadSchema(); schema == nil || schema.Prefix != config.KeyPrefix {
+		t.Errorf("Schema not recorded: %+v", schema)
+	}
+}
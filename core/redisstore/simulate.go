@@ -0,0 +1,407 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// maxSimulatedTxs is the maximum number of pending transactions kept
+	// simulated at once. Transactions admitted beyond it are not simulated.
+	maxSimulatedTxs = 1 << 14
+
+	// simSlotTime is the time assumed between the head and the block pending
+	// transactions are simulated in.
+	simSlotTime = 12
+
+	// simTracerConfig configures the tracers run along every simulation: the
+	// call tracer for the call tree and the prestate tracer for the storage
+	// slots touched.
+	simTracerConfig = `{"callTracer": {}, "prestateTracer": {"disableCode": true, "includeEmpty": true}}`
+)
+
+var (
+	simTxMeter    = metrics.NewRegisteredMeter("redis/simulate/txs", nil)
+	simErrorMeter = metrics.NewRegisteredMeter("redis/simulate/errors", nil)
+	simTimer      = metrics.NewRegisteredTimer("redis/simulate/time", nil)
+	simDeferGauge = metrics.NewRegisteredGauge("redis/simulate/deferred", nil)
+)
+
+// SimulationChain defines the chain access needed to simulate transactions.
+// It is implemented by core.BlockChain.
+type SimulationChain interface {
+	core.ChainContext
+
+	// StateAt returns a mutable state based on a particular point in time.
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// txSimKey returns the key of the simulated outcome of a pending transaction.
+func (k keyspace) txSimKey(hash common.Hash) string {
+	return fmt.Sprintf("%stxsim:%s", k.prefix, hash.Hex())
+}
+
+// simulator executes the pending transactions of the mirror against the state
+// of the chain head and stores their outcome. Every transaction is simulated as
+// soon as it becomes pending, and again whenever the head changes, for as long
+// as it stays in the pool.
+//
+// Execution time is bounded by a budget per head. Newly pending transactions go
+// first, transactions not simulated within the budget are deferred to the next
+// head.
+type simulator struct {
+	chain  SimulationChain
+	pool   TxPool
+	store  *RedisBlockStore
+	budget time.Duration
+
+	lock    sync.Mutex
+	head    *types.Header                      // Head the transactions are simulated on
+	txs     map[common.Hash]*types.Transaction // Pending transactions kept simulated
+	fresh   []*types.Transaction               // Transactions never simulated
+	stale   []*types.Transaction               // Transactions simulated on a previous head
+	spent   time.Duration                      // Execution time spent on the current head
+	refresh bool                               // Whether the head changed since the last run
+
+	wake chan struct{}
+}
+
+func newSimulator(chain SimulationChain, pool TxPool, store *RedisBlockStore, budget time.Duration) *simulator {
+	return &simulator{
+		chain:  chain,
+		pool:   pool,
+		store:  store,
+		budget: budget,
+		txs:    make(map[common.Hash]*types.Transaction),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// add schedules a newly pending transaction for simulation.
+func (s *simulator) add(tx *types.Transaction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.txs[tx.Hash()]; ok || len(s.txs) >= maxSimulatedTxs {
+		return
+	}
+	s.txs[tx.Hash()] = tx
+	s.fresh = append(s.fresh, tx)
+	s.signal()
+}
+
+// setHead schedules all tracked transactions for simulation on a new head.
+func (s *simulator) setHead(head *types.Header) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.head, s.spent, s.refresh = head, 0, true
+	s.signal()
+}
+
+// signal wakes the simulation loop up. The lock must be held.
+func (s *simulator) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop runs simulations whenever there is work, until quit is closed.
+func (s *simulator) loop(quit chan struct{}) {
+	for {
+		select {
+		case <-s.wake:
+			s.run(quit)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// run simulates the scheduled transactions on the current head, until either
+// all are done, the budget is spent or the head changes.
+func (s *simulator) run(quit chan struct{}) {
+	s.lock.Lock()
+	head, refresh := s.head, s.refresh
+	s.refresh = false
+
+	var tracked []*types.Transaction
+	if refresh {
+		tracked = make([]*types.Transaction, 0, len(s.txs))
+		for _, tx := range s.txs {
+			tracked = append(tracked, tx)
+		}
+	}
+	s.lock.Unlock()
+
+	if refresh {
+		// Re-simulate everything that stayed in the pool on the new head,
+		// checking the pool outside the lock
+		var left []common.Hash
+		for _, tx := range tracked {
+			if !s.pool.Has(tx.Hash()) {
+				left = append(left, tx.Hash())
+			}
+		}
+		s.lock.Lock()
+		for _, hash := range left {
+			delete(s.txs, hash)
+		}
+		fresh := make(map[common.Hash]bool, len(s.fresh))
+		for _, tx := range s.fresh {
+			fresh[tx.Hash()] = true
+		}
+		s.stale = s.stale[:0]
+		for hash, tx := range s.txs {
+			if !fresh[hash] {
+				s.stale = append(s.stale, tx)
+			}
+		}
+		s.lock.Unlock()
+	}
+	if head == nil {
+		return
+	}
+	statedb, err := s.chain.StateAt(head.Root)
+	if err != nil {
+		log.Debug("Head state unavailable for simulations", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		s.lock.Lock()
+		if s.head != head || s.spent >= s.budget {
+			simDeferGauge.Update(int64(len(s.fresh) + len(s.stale)))
+			s.lock.Unlock()
+			return
+		}
+		var tx *types.Transaction
+		switch {
+		case len(s.fresh) > 0:
+			tx, s.fresh = s.fresh[0], s.fresh[1:]
+		case len(s.stale) > 0:
+			tx, s.stale = s.stale[0], s.stale[1:]
+		}
+		s.lock.Unlock()
+
+		if tx == nil {
+			simDeferGauge.Update(0)
+			return
+		}
+		if !s.pool.Has(tx.Hash()) {
+			s.lock.Lock()
+			delete(s.txs, tx.Hash())
+			s.lock.Unlock()
+			continue
+		}
+		start := time.Now()
+		res, err := s.simulate(head, statedb.Copy(), tx)
+		elapsed := time.Since(start)
+
+		s.lock.Lock()
+		s.spent += elapsed
+		s.lock.Unlock()
+
+		simTimer.Update(elapsed)
+		if err != nil {
+			simErrorMeter.Mark(1)
+			log.Debug("Failed to simulate transaction", "hash", tx.Hash(), "err", err)
+			continue
+		}
+		simTxMeter.Mark(1)
+		if err := s.store.writeSimulation(tx.Hash(), res); err != nil {
+			log.Warn("Failed to store transaction simulation", "hash", tx.Hash(), "err", err)
+		}
+	}
+}
+
+// simulation is the outcome of executing a pending transaction on a head.
+type simulation struct {
+	head         *types.Header
+	gasUsed      uint64
+	err          error  // Execution error, or the reason the transaction is invalid on the head
+	revertReason string // Decoded revert reason, if any
+	logs         []*types.Log
+	calls        json.RawMessage                                // Call tree as returned by the callTracer
+	storage      map[common.Address]map[common.Hash]common.Hash // Touched storage slots with their values on the head
+}
+
+// pendingHeader returns the header of the block following the head, the one
+// pending transactions are simulated in.
+func (s *simulator) pendingHeader(head *types.Header) *types.Header {
+	config := s.chain.Config()
+
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Coinbase:   head.Coinbase,
+		Difficulty: head.Difficulty,
+		Number:     new(big.Int).Add(head.Number, common.Big1),
+		GasLimit:   head.GasLimit,
+		Time:       head.Time + simSlotTime,
+		MixDigest:  head.MixDigest,
+	}
+	if config.IsLondon(header.Number) {
+		header.BaseFee = eip1559.CalcBaseFee(config, head)
+	}
+	if config.IsCancun(header.Number, header.Time) {
+		excess := eip4844.CalcExcessBlobGas(config, head, header.Time)
+		header.ExcessBlobGas = &excess
+	}
+	return header
+}
+
+// simulate executes a transaction on a copy of the head state, in the block
+// following the head. Nonces are not checked, so transactions following others
+// of the same sender in the pool are executed too, but on a state without them.
+func (s *simulator) simulate(head *types.Header, statedb *state.StateDB, tx *types.Transaction) (*simulation, error) {
+	var (
+		config  = s.chain.Config()
+		pending = s.pendingHeader(head)
+	)
+	msg, err := core.TransactionToMessage(tx, types.MakeSigner(config, pending.Number, pending.Time), pending.BaseFee)
+	if err != nil {
+		return nil, err
+	}
+	msg.SkipNonceChecks = true
+
+	tracer, err := tracers.DefaultDirectory.New("muxTracer", &tracers.Context{
+		BlockNumber: pending.Number,
+		TxHash:      tx.Hash(),
+	}, json.RawMessage(simTracerConfig), config)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		blockCtx = core.NewEVMBlockContext(pending, s.chain, nil)
+		evm      = vm.NewEVM(blockCtx, state.NewHookedState(statedb, tracer.Hooks), config, vm.Config{Tracer: tracer.Hooks, NoBaseFee: true})
+	)
+	// Never let a single execution overrun the budget of a head by far
+	timer := time.AfterFunc(s.budget, func() {
+		tracer.Stop(errors.New("execution timeout"))
+		evm.Cancel()
+	})
+	defer timer.Stop()
+
+	statedb.SetTxContext(tx.Hash(), 0)
+	tracer.OnTxStart(evm.GetVMContext(), tx, msg.From)
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if err != nil {
+		// Not executable on the head, e.g. insufficient funds
+		tracer.OnTxEnd(nil, err)
+		return &simulation{head: head, err: err}, nil
+	}
+	tracer.OnTxEnd(&types.Receipt{GasUsed: result.UsedGas}, nil)
+	if evm.Cancelled() {
+		return nil, errors.New("execution timeout")
+	}
+	sim := &simulation{
+		head:    head,
+		gasUsed: result.UsedGas,
+		err:     result.Err,
+		logs:    statedb.GetLogs(tx.Hash(), pending.Number.Uint64(), common.Hash{}, pending.Time),
+	}
+	if reason, err := abi.UnpackRevert(result.Revert()); err == nil {
+		sim.revertReason = reason
+	}
+	traces, err := tracer.GetResult()
+	if err != nil {
+		return nil, err
+	}
+	var output struct {
+		Calls    json.RawMessage `json:"callTracer"`
+		Prestate map[common.Address]struct {
+			Storage map[common.Hash]common.Hash `json:"storage"`
+		} `json:"prestateTracer"`
+	}
+	if err := json.Unmarshal(traces, &output); err != nil {
+		return nil, err
+	}
+	sim.calls = output.Calls
+	sim.storage = make(map[common.Address]map[common.Hash]common.Hash)
+	for addr, account := range output.Prestate {
+		if len(account.Storage) > 0 {
+			sim.storage[addr] = account.Storage
+		}
+	}
+	return sim, nil
+}
+
+// writeSimulation stores the simulated outcome of a pending transaction, for as
+// long as the transaction itself is kept.
+func (s *RedisBlockStore) writeSimulation(hash common.Hash, sim *simulation) error {
+	var reason string
+	if sim.err != nil {
+		reason = sim.err.Error()
+	}
+	status := 1
+	if sim.err != nil {
+		status = 0
+	}
+	logs := sim.logs
+	if logs == nil {
+		logs = []*types.Log{}
+	}
+	fields := []interface{}{
+		"schema_version", SchemaVersion,
+		"head", sim.head.Number.String(),
+		"headHash", strings.ToLower(sim.head.Hash().Hex()),
+		"status", status,
+		"gasUsed", sim.gasUsed,
+		"error", reason,
+		"revertReason", sim.revertReason,
+		"time", time.Now().Unix(),
+	}
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"logs", logs},
+		{"calls", sim.calls},
+		{"storage", sim.storage},
+	} {
+		blob, err := json.Marshal(field.value)
+		if err != nil {
+			return fmt.Errorf("failed to encode simulated %s: %v", field.name, err)
+		}
+		if blob, err = Compress(blob); err != nil {
+			return fmt.Errorf("failed to compress simulated %s: %v", field.name, err)
+		}
+		fields = append(fields, field.name, blob)
+	}
+	var (
+		key  = s.keys.txSimKey(hash)
+		pipe = s.client.Pipeline()
+	)
+	pipe.HSet(s.ctx, key, fields...)
+	if age := s.config.Retention.PendingTxs.Age; age != 0 {
+		pipe.Expire(s.ctx, key, age)
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to store simulation: %v", err)
+	}
+	return nil
+}
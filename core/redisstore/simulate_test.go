@@ -0,0 +1,171 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	// Register the native tracers the simulations run
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+)
+
+// revertCode returns init code reverting with the given Error(string) reason.
+func revertCode(reason string) []byte {
+	data := append(common.FromHex("0x08c379a0"), common.LeftPadBytes([]byte{0x20}, 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(reason))).Bytes(), 32)...)
+	data = append(data, common.RightPadBytes([]byte(reason), 32)...)
+
+	var code []byte
+	for offset := 0; offset < len(data); offset += 32 {
+		chunk := common.RightPadBytes(data[offset:min(offset+32, len(data))], 32)
+		code = append(code, byte(vm.PUSH32))
+		code = append(code, chunk...)
+		code = append(code, byte(vm.PUSH1), byte(offset), byte(vm.MSTORE))
+	}
+	return append(code, byte(vm.PUSH1), byte(len(data)), byte(vm.PUSH1), 0, byte(vm.REVERT))
+}
+
+// createTx creates a contract creation with the given init code.
+func createTx(nonce uint64, code []byte) *types.Transaction {
+	return types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		Nonce:    nonce,
+		Gas:      200000,
+		GasPrice: big.NewInt(2 * params.InitialBaseFee),
+		Data:     code,
+	})
+}
+
+// Tests that pending transactions are executed on the head state, and their
+// outcome refreshed whenever the head changes.
+func TestSimulate(t *testing.T) {
+	node := newTestNode(t, func(config *Config) {
+		config.Simulate = true
+	})
+	var (
+		emit   = emitTx(0)
+		store  = createTx(1, []byte{byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x07, byte(vm.SSTORE)}) // SSTORE(7, 1)
+		revert = createTx(2, revertCode("nope"))
+	)
+	for _, err := range node.pool.Add([]*types.Transaction{emit, store, revert}, true) {
+		if err != nil {
+			t.Fatalf("Failed to add transaction: %v", err)
+		}
+	}
+	read := func(tx *types.Transaction, head uint64) map[string]string {
+		var fields map[string]string
+		waitFor(t, "simulation", func() bool {
+			fields, _ = node.backend.HGetAll(context.Background(), node.exporter.store.keys.txSimKey(tx.Hash())).Result()
+			return fields["head"] == new(big.Int).SetUint64(head).String()
+		})
+		return fields
+	}
+	decode := func(fields map[string]string, name string, v interface{}) {
+		blob, err := Decompress([]byte(fields[name]))
+		if err != nil {
+			t.Fatalf("Failed to decompress %s: %v", name, err)
+		}
+		if err := json.Unmarshal(blob, v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", name, err)
+		}
+	}
+	// The log emitting call succeeds and emits its log
+	fields := read(emit, 0)
+	if fields["status"] != "1" || fields["error"] != "" {
+		t.Errorf("Call failed: status %s, error %q", fields["status"], fields["error"])
+	}
+	if fields["gasUsed"] == "" || fields["gasUsed"] == "0" {
+		t.Errorf("Gas used missing")
+	}
+	var logs []*types.Log
+	decode(fields, "logs", &logs)
+	if len(logs) != 1 || logs[0].Address != testEmitter || logs[0].Topics[0] != common.HexToHash("0xff") {
+		t.Errorf("Logs mismatch: %v", logs)
+	}
+	var calls struct {
+		Type string `json:"type"`
+		To   common.Address
+	}
+	decode(fields, "calls", &calls)
+	if calls.Type != "CALL" || calls.To != testEmitter {
+		t.Errorf("Call tree mismatch: %+v", calls)
+	}
+	// The storage writing creation reports the slot it touched
+	fields = read(store, 0)
+	var storage map[common.Address]map[common.Hash]common.Hash
+	decode(fields, "storage", &storage)
+	created := crypto.CreateAddress(testAddr, 0) // Earlier pool transactions are not applied
+	if _, ok := storage[created][common.HexToHash("0x07")]; !ok || len(storage) != 1 {
+		t.Errorf("Touched storage mismatch: %v", storage)
+	}
+	// The reverting creation reports its reason
+	fields = read(revert, 0)
+	if fields["status"] != "0" || fields["error"] != vm.ErrExecutionReverted.Error() || fields["revertReason"] != "nope" {
+		t.Errorf("Revert mismatch: status %s, error %q, reason %q", fields["status"], fields["error"], fields["revertReason"])
+	}
+	// A new head refreshes every simulation
+	node.insert(t, makeChain(1))
+	for _, tx := range []*types.Transaction{emit, store, revert} {
+		if fields := read(tx, 1); fields["headHash"] != node.chain.CurrentBlock().Hash().Hex() {
+			t.Errorf("%x: head hash mismatch: have %s", tx.Hash(), fields["headHash"])
+		}
+	}
+}
+
+// Tests that pending transactions are simulated in the block following the head
+// rather than in the head itself.
+func TestSimulatePendingBlock(t *testing.T) {
+	node := newTestNode(t, func(config *Config) {
+		config.Simulate = true
+	})
+	// Log the number, time and base fee of the block executed in
+	var code []byte
+	for i, op := range []vm.OpCode{vm.NUMBER, vm.TIMESTAMP, vm.BASEFEE} {
+		code = append(code, byte(op), byte(vm.PUSH1), byte(i*32), byte(vm.MSTORE))
+	}
+	code = append(code, byte(vm.PUSH1), 96, byte(vm.PUSH1), 0, byte(vm.LOG0))
+
+	tx := createTx(0, code)
+	if err := node.pool.Add([]*types.Transaction{tx}, true)[0]; err != nil {
+		t.Fatalf("Failed to add transaction: %v", err)
+	}
+	var fields map[string]string
+	waitFor(t, "simulation", func() bool {
+		fields, _ = node.backend.HGetAll(context.Background(), node.exporter.store.keys.txSimKey(tx.Hash())).Result()
+		return fields["head"] == "0"
+	})
+	blob, err := Decompress([]byte(fields["logs"]))
+	if err != nil {
+		t.Fatalf("Failed to decompress logs: %v", err)
+	}
+	var logs []*types.Log
+	if err := json.Unmarshal(blob, &logs); err != nil {
+		t.Fatalf("Failed to decode logs: %v", err)
+	}
+	if len(logs) != 1 || len(logs[0].Data) != 96 {
+		t.Fatalf("Logs mismatch: %v", logs)
+	}
+	var (
+		head = node.chain.CurrentBlock()
+		data = logs[0].Data
+	)
+	if have := new(big.Int).SetBytes(data[:32]); have.Uint64() != head.Number.Uint64()+1 {
+		t.Errorf("Block number mismatch: have %v, want %d", have, head.Number.Uint64()+1)
+	}
+	if have := new(big.Int).SetBytes(data[32:64]); have.Uint64() != head.Time+simSlotTime {
+		t.Errorf("Block time mismatch: have %v, want %d", have, head.Time+simSlotTime)
+	}
+	if have, want := new(big.Int).SetBytes(data[64:]), eip1559.CalcBaseFee(node.chain.Config(), head); have.Cmp(want) != 0 {
+		t.Errorf("Base fee mismatch: have %v, want %v", have, want)
+	}
+	if logs[0].BlockNumber != head.Number.Uint64()+1 {
+		t.Errorf("Log block number mismatch: have %d, want %d", logs[0].BlockNumber, head.Number.Uint64()+1)
+	}
+}
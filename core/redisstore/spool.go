@@ -0,0 +1,193 @@
+package redisstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var spoolGauge = metrics.NewRegisteredGauge("redis/spool", nil)
+
+// errNoActiveSpool is returned if a write is attempted to be spooled, but no
+// spool file is currently open.
+var errNoActiveSpool = errors.New("no active spool")
+
+// spoolEntry is a single mempool mirror write that failed to reach Redis.
+type spoolEntry struct {
+	Txs    []*types.Transaction // Transactions to store
+	Hashes []common.Hash        // Transactions to remove
+}
+
+// spool is an append-only disk log of mempool mirror writes that failed to reach
+// Redis, allowing them to be replayed in order once the connection recovers or
+// the node is restarted. Block data is not spooled, it is re-exported from the
+// chain database starting at the last acknowledged block instead.
+type spool struct {
+	path    string         // Filesystem path to store the entries at
+	writer  io.WriteCloser // Output stream to append new entries to
+	entries int            // Number of entries currently in the spool
+	lock    sync.Mutex
+}
+
+// newSpool creates a spool at the given path. An empty path disables spooling.
+func newSpool(path string) *spool {
+	return &spool{path: path}
+}
+
+// open loads any entries left over from a previous run and opens the spool for
+// appending.
+func (s *spool) open() error {
+	if s.path == "" {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		log.Info("Loaded Redis spool", "entries", len(entries))
+	}
+	return s.rewrite(entries)
+}
+
+// append adds a failed write to the end of the spool.
+func (s *spool) append(entry *spoolEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.writer == nil {
+		return errNoActiveSpool
+	}
+	if err := rlp.Encode(s.writer, entry); err != nil {
+		return err
+	}
+	s.entries++
+	spoolGauge.Update(int64(s.entries))
+	return nil
+}
+
+// size returns the number of entries waiting for replay.
+func (s *spool) size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.entries
+}
+
+// replay applies all spooled entries in order, stopping at the first failure.
+// Successfully applied entries are removed from the spool, the rest are kept
+// for the next attempt.
+func (s *spool) replay(apply func(*spoolEntry) error) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.writer == nil || s.entries == 0 {
+		return 0, nil
+	}
+	entries, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		done    int
+		failure error
+	)
+	for ; done < len(entries); done++ {
+		if failure = apply(entries[done]); failure != nil {
+			break
+		}
+	}
+	if err := s.rewrite(entries[done:]); err != nil {
+		return done, err
+	}
+	return done, failure
+}
+
+// read parses all entries currently stored in the spool file. A corrupt tail
+// (e.g. due to a crash mid-write) is discarded.
+func (s *spool) read() ([]*spoolEntry, error) {
+	input, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var (
+		stream  = rlp.NewStream(input, 0)
+		entries []*spoolEntry
+	)
+	for {
+		entry := new(spoolEntry)
+		if err := stream.Decode(entry); err != nil {
+			if err != io.EOF {
+				log.Warn("Discarding corrupt Redis spool tail", "entries", len(entries), "err", err)
+			}
+			return entries, nil
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// rewrite replaces the spool file with the given entries and reopens it for
+// appending.
+func (s *spool) rewrite(entries []*spoolEntry) error {
+	// Close the current spool (if any is open)
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return err
+		}
+		s.writer = nil
+	}
+	// Generate a new spool with the remaining entries
+	replacement, err := os.OpenFile(s.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = rlp.Encode(replacement, entry); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	replacement.Close()
+
+	// Replace the live spool with the newly generated one
+	if err = os.Rename(s.path+".new", s.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.writer = sink
+	s.entries = len(entries)
+	spoolGauge.Update(int64(s.entries))
+	return nil
+}
+
+// close flushes the spool contents to disk and closes the file.
+func (s *spool) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	if s.writer != nil {
+		err = s.writer.Close()
+		s.writer = nil
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package redisstore
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSpoolReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.rlp")
+
+	sp := newSpool(path)
+	if err := sp.open(); err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	var txs []*types.Transaction
+	for i := 0; i < 3; i++ {
+		tx := types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		txs = append(txs, tx)
+		if err := sp.append(&spoolEntry{Txs: []*types.Transaction{tx}}); err != nil {
+			t.Fatalf("failed to spool transaction: %v", err)
+		}
+	}
+	if err := sp.append(&spoolEntry{Hashes: []common.Hash{txs[0].Hash()}}); err != nil {
+		t.Fatalf("failed to spool removal: %v", err)
+	}
+	sp.close()
+
+	// Reopen the spool and fail halfway through the replay
+	sp = newSpool(path)
+	if err := sp.open(); err != nil {
+		t.Fatalf("failed to reopen spool: %v", err)
+	}
+	if sp.size() != 4 {
+		t.Fatalf("spool size mismatch: have %d, want 4", sp.size())
+	}
+	var applied []*spoolEntry
+	failure := errors.New("unreachable")
+	done, err := sp.replay(func(entry *spoolEntry) error {
+		if len(applied) == 2 {
+			return failure
+		}
+		applied = append(applied, entry)
+		return nil
+	})
+	if done != 2 || err != failure {
+		t.Fatalf("replay mismatch: have %d, %v, want 2, %v", done, err, failure)
+	}
+	if sp.size() != 2 {
+		t.Fatalf("spool size mismatch: have %d, want 2", sp.size())
+	}
+	// Finish the replay, the remaining entries must come in order
+	applied = applied[:0]
+	if _, err := sp.replay(func(entry *spoolEntry) error {
+		applied = append(applied, entry)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to replay spool: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Txs[0].Hash() != txs[2].Hash() || applied[1].Hashes[0] != txs[0].Hash() {
+		t.Fatalf("replayed entries mismatch: %v", applied)
+	}
+	if sp.size() != 0 {
+		t.Fatalf("spool not empty after replay: %d", sp.size())
+	}
+	sp.close()
+}
@@ -0,0 +1,342 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/redisstore/client"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// stateDiffCacheSize is the number of recorded state diffs kept until their
+// blocks are exported. Blocks the exporter falls further behind on are exported
+// with their diff marked unavailable.
+const stateDiffCacheSize = 128
+
+var stateDiffMissMeter = metrics.NewRegisteredMeter("redis/statediff/missed", nil)
+
+// StateDiffRecorder hands the state diffs of processed blocks over from the
+// state diff tracer to the exporter, which stores and announces them along with
+// their blocks.
+type StateDiffRecorder struct {
+	diffs *lru.Cache[common.Hash, *StateDiff]
+}
+
+// NewStateDiffRecorder creates a recorder keeping the diffs of the most recently
+// processed blocks until they are exported.
+func NewStateDiffRecorder() *StateDiffRecorder {
+	return &StateDiffRecorder{diffs: lru.NewCache[common.Hash, *StateDiff](stateDiffCacheSize)}
+}
+
+// Record hands the state diff of a processed block over to the exporter. It is
+// meant to be called by a live tracer once a block was processed successfully.
+func (r *StateDiffRecorder) Record(diff *StateDiff) {
+	diff.compact()
+	r.diffs.Add(diff.Hash, diff)
+}
+
+// SetStateDiffRecorder sets the recorder of the state diffs to export along with
+// their blocks, fed by the state diff live tracer. It must be called before the
+// exporter is started. Without one, no state diffs are exported.
+func (e *Exporter) SetStateDiffRecorder(recorder *StateDiffRecorder) {
+	e.stateDiffs = recorder
+}
+
+// StateDiff is the net change a block made to the state: for every account it
+// touched, the balance, nonce, code and storage slots it left different, with
+// their values before and after the block. Changes reverted within the block
+// are not included.
+type StateDiff struct {
+	Number     uint64
+	Hash       common.Hash
+	ParentHash common.Hash
+	Accounts   map[common.Address]*AccountDiff
+}
+
+// Types of the changes of a state diff, shared with the client package.
+type (
+	AccountDiff = client.AccountDiff
+	BalanceDiff = client.BalanceDiff
+	NonceDiff   = client.NonceDiff
+	CodeDiff    = client.CodeDiff
+	StorageDiff = client.StorageDiff
+)
+
+// NewStateDiff creates an empty state diff of a block.
+func NewStateDiff(header *types.Header) *StateDiff {
+	return &StateDiff{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		ParentHash: header.ParentHash,
+		Accounts:   make(map[common.Address]*AccountDiff),
+	}
+}
+
+// account returns the diff of an account, creating it if needed.
+func (d *StateDiff) account(addr common.Address) *AccountDiff {
+	account := d.Accounts[addr]
+	if account == nil {
+		account = new(AccountDiff)
+		d.Accounts[addr] = account
+	}
+	return account
+}
+
+// BalanceChange records a change of the balance of an account. The first value
+// before and the last value after a change are kept.
+func (d *StateDiff) BalanceChange(addr common.Address, prev, new *big.Int) {
+	account := d.account(addr)
+	if account.Balance == nil {
+		account.Balance = &BalanceDiff{From: (*hexutil.Big)(cloneBig(prev))}
+	}
+	account.Balance.To = (*hexutil.Big)(cloneBig(new))
+}
+
+// NonceChange records a change of the nonce of an account.
+func (d *StateDiff) NonceChange(addr common.Address, prev, new uint64) {
+	account := d.account(addr)
+	if account.Nonce == nil {
+		account.Nonce = &NonceDiff{From: hexutil.Uint64(prev)}
+	}
+	account.Nonce.To = hexutil.Uint64(new)
+}
+
+// CodeChange records a change of the code of an account.
+func (d *StateDiff) CodeChange(addr common.Address, prevHash common.Hash, prev []byte, hash common.Hash, code []byte) {
+	account := d.account(addr)
+	if account.Code == nil {
+		account.Code = &CodeDiff{From: prevHash, FromCode: common.CopyBytes(prev)}
+	}
+	account.Code.To, account.Code.ToCode = hash, common.CopyBytes(code)
+}
+
+// StorageChange records a change of a storage slot of an account.
+func (d *StateDiff) StorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+	account := d.account(addr)
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]*StorageDiff)
+	}
+	if account.Storage[slot] == nil {
+		account.Storage[slot] = &StorageDiff{From: prev}
+	}
+	account.Storage[slot].To = new
+}
+
+// AccountDeleted records the deletion of an account, e.g. one self-destructed in
+// the transaction creating it, which resets its state without reporting the
+// individual changes. The values after the block of all its recorded changes
+// are cleared.
+func (d *StateDiff) AccountDeleted(addr common.Address) {
+	account := d.Accounts[addr]
+	if account == nil {
+		return
+	}
+	if account.Balance != nil {
+		account.Balance.To = (*hexutil.Big)(new(big.Int))
+	}
+	if account.Nonce != nil {
+		account.Nonce.To = 0
+	}
+	if account.Code != nil {
+		account.Code.To, account.Code.ToCode = types.EmptyCodeHash, nil
+	}
+	for _, change := range account.Storage {
+		change.To = common.Hash{}
+	}
+}
+
+// compact drops the changes a block reverted, such as a balance raised and
+// lowered back, and the accounts left without changes.
+func (d *StateDiff) compact() {
+	for addr, account := range d.Accounts {
+		if account.Balance != nil && account.Balance.From.ToInt().Cmp(account.Balance.To.ToInt()) == 0 {
+			account.Balance = nil
+		}
+		if account.Nonce != nil && account.Nonce.From == account.Nonce.To {
+			account.Nonce = nil
+		}
+		if account.Code != nil && account.Code.From == account.Code.To {
+			account.Code = nil
+		}
+		for slot, change := range account.Storage {
+			if change.From == change.To {
+				delete(account.Storage, slot)
+			}
+		}
+		if len(account.Storage) == 0 {
+			account.Storage = nil
+		}
+		if account.Balance == nil && account.Nonce == nil && account.Code == nil && account.Storage == nil {
+			delete(d.Accounts, addr)
+		}
+	}
+}
+
+// Invert returns the diff rolling the changes of d back.
+func (d *StateDiff) Invert() *StateDiff {
+	inverted := &StateDiff{
+		Number:     d.Number,
+		Hash:       d.Hash,
+		ParentHash: d.ParentHash,
+		Accounts:   make(map[common.Address]*AccountDiff, len(d.Accounts)),
+	}
+	for addr, account := range d.Accounts {
+		cpy := new(AccountDiff)
+		if account.Balance != nil {
+			cpy.Balance = &BalanceDiff{From: account.Balance.To, To: account.Balance.From}
+		}
+		if account.Nonce != nil {
+			cpy.Nonce = &NonceDiff{From: account.Nonce.To, To: account.Nonce.From}
+		}
+		if account.Code != nil {
+			cpy.Code = &CodeDiff{From: account.Code.To, To: account.Code.From, FromCode: account.Code.ToCode, ToCode: account.Code.FromCode}
+		}
+		if account.Storage != nil {
+			cpy.Storage = make(map[common.Hash]*StorageDiff, len(account.Storage))
+			for slot, change := range account.Storage {
+				cpy.Storage[slot] = &StorageDiff{From: change.To, To: change.From}
+			}
+		}
+		inverted.Accounts[addr] = cpy
+	}
+	return inverted
+}
+
+func cloneBig(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(v)
+}
+
+// stateDiffKey returns the key of the state diff of a block.
+func (k keyspace) stateDiffKey(hash common.Hash) string {
+	return fmt.Sprintf("%sstatediff:%s", k.prefix, strings.ToLower(hash.Hex()))
+}
+
+// stateDiffEvent returns the fields of the stream entry announcing a state diff,
+// or rolling it back if removed is set.
+func stateDiffEvent(diff *StateDiff, removed bool) ([]interface{}, error) {
+	blob, err := json.Marshal(diff.Accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state diff: %v", err)
+	}
+	return []interface{}{
+		"number", diff.Number,
+		"hash", strings.ToLower(diff.Hash.Hex()),
+		"parentHash", strings.ToLower(diff.ParentHash.Hex()),
+		"removed", removed,
+		"accounts", blob,
+	}, nil
+}
+
+// stateDiffUnavailableEvent returns the fields of the stream entry announcing
+// that the state diff of a block was not recorded, or rolling such a block back
+// if removed is set.
+func stateDiffUnavailableEvent(block *types.Block, removed bool) []interface{} {
+	return []interface{}{
+		"number", block.NumberU64(),
+		"hash", strings.ToLower(block.Hash().Hex()),
+		"parentHash", strings.ToLower(block.ParentHash().Hex()),
+		"removed", removed,
+		"unavailable", true,
+	}
+}
+
+// queueStateDiff adds the writes storing and announcing the state diff of a
+// block to a batch. Blocks exported before are not executed again when they
+// become canonical anew, their diff is taken from the store instead. Blocks
+// without a recorded diff are announced with the diff marked unavailable.
+// Nothing is written unless state diffs are recorded.
+func (s *RedisBlockStore) queueStateDiff(batch *exportBatch, block *types.Block) error {
+	if s.stateDiffs == nil {
+		return nil
+	}
+	hash := block.Hash()
+	diff, ok := s.stateDiffs.diffs.Peek(hash)
+	if !ok {
+		stored, err := s.storedStateDiff(block)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			s.queueEvent(batch.chain, StateDiffsStream, stateDiffUnavailableEvent(block, false)...)
+			batch.onCommit(func() {
+				stateDiffMissMeter.Mark(1)
+				redisStreamMeter.Mark(1)
+			})
+			return nil
+		}
+		diff = stored
+	}
+	blob, err := json.Marshal(diff.Accounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode state diff: %v", err)
+	}
+	if blob, err = Compress(blob); err != nil {
+		return fmt.Errorf("failed to compress state diff: %v", err)
+	}
+	key := s.keys.stateDiffKey(hash)
+	batch.writes.add(key, setArgs(key, blob, s.config.Retention.Blocks.Age)...)
+
+	values, err := stateDiffEvent(diff, false)
+	if err != nil {
+		return err
+	}
+	s.queueEvent(batch.chain, StateDiffsStream, values...)
+	batch.onCommit(func() {
+		s.stateDiffs.diffs.Remove(hash)
+		redisStreamMeter.Mark(1)
+	})
+	return nil
+}
+
+// storedStateDiff returns the stored state diff of a block, nil if there is
+// none.
+func (s *RedisBlockStore) storedStateDiff(block *types.Block) (*StateDiff, error) {
+	blob, err := s.client.Get(s.ctx, s.keys.stateDiffKey(block.Hash())).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to read state diff: %v", err)
+	}
+	if blob, err = Decompress(blob); err != nil {
+		return nil, fmt.Errorf("failed to decompress state diff: %v", err)
+	}
+	diff := &StateDiff{Number: block.NumberU64(), Hash: block.Hash(), ParentHash: block.ParentHash()}
+	if err := json.Unmarshal(blob, &diff.Accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode state diff: %v", err)
+	}
+	return diff, nil
+}
+
+// publishStateDiffRollback announces that the state diff of a block was rolled
+// back, along with the inverted diff. Blocks exported without a diff are rolled
+// back with the diff marked unavailable while state diffs are recorded, and not
+// announced otherwise.
+func (s *RedisBlockStore) publishStateDiffRollback(block *types.Block) error {
+	diff, err := s.storedStateDiff(block)
+	if err != nil {
+		return err
+	}
+	if diff == nil {
+		if s.stateDiffs == nil {
+			return nil
+		}
+		return s.publish(StateDiffsStream, stateDiffUnavailableEvent(block, true)...)
+	}
+	values, err := stateDiffEvent(diff.Invert(), true)
+	if err != nil {
+		return err
+	}
+	return s.publish(StateDiffsStream, values...)
+}
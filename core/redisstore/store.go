@@ -2,30 +2,115 @@ package redisstore
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/redisstore/client"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/go-redis/redis/v8"
 )
 
 var (
 	redisBlockStoreTimer = metrics.NewRegisteredTimer("redis/blockstore", nil)
 	redisErrorCounter    = metrics.NewRegisteredCounter("redis/errors", nil)
+
+	redisReceiptStoreTimer = metrics.NewRegisteredTimer("redis/receiptstore", nil)
 )
 
+// blockTTL is the default expiry of all block related keys.
+const blockTTL = 60 * time.Second
+
+// DefaultKeyPrefix returns the prefix of the keys of a chain, unless another one
+// is configured.
+func DefaultKeyPrefix(chainID *big.Int) string {
+	return chainID.String() + ":"
+}
+
+// keyspace derives the keys of the data of a chain. All keys share a common
+// prefix, so that several chains can be stored in the same database.
+type keyspace struct {
+	prefix  string   // Prefix of all keys
+	chainID *big.Int // Chain the data belongs to
+}
+
+// newKeyspace creates the keyspace of a chain, using the default prefix of the
+// chain if none is given.
+func newKeyspace(prefix string, chainID *big.Int) keyspace {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix(chainID)
+	}
+	return keyspace{prefix: prefix, chainID: new(big.Int).Set(chainID)}
+}
+
+// The keys of a height are hash tagged with the block number, so that they all
+// map to the same slot of a Redis Cluster and can be renamed or scripted
+// together.
+
+// blockKey returns the key of the canonical block at a height.
+func (k keyspace) blockKey(number uint64) string {
+	return fmt.Sprintf("%sblock:{%d}", k.prefix, number)
+}
+
+// siblingKey returns the key of a non-canonical block.
+func (k keyspace) siblingKey(number uint64, hash common.Hash) string {
+	return fmt.Sprintf("%sblock:{%d}:%s", k.prefix, number, strings.ToLower(hash.Hex()))
+}
+
+// blockHashKey returns the key of the hash to number index.
+func (k keyspace) blockHashKey(hash common.Hash) string {
+	return fmt.Sprintf("%sblockhash:%s", k.prefix, strings.ToLower(hash.Hex()))
+}
+
+// siblingsKey returns the key of the set of non-canonical blocks at a height.
+func (k keyspace) siblingsKey(number uint64) string {
+	return fmt.Sprintf("%ssiblings:{%d}", k.prefix, number)
+}
+
+// canonicalKey returns the key of the canonical marker at a height.
+func (k keyspace) canonicalKey(number uint64) string {
+	return fmt.Sprintf("%scanonical:{%d}", k.prefix, number)
+}
+
+// lockToken returns a random value identifying the holder of a lock.
+func lockToken() string {
+	var token [16]byte
+	rand.Read(token[:])
+	return hex.EncodeToString(token[:])
+}
+
+// removedLogsKey returns the key of the removed logs of a dropped block.
+func (k keyspace) removedLogsKey(hash common.Hash) string {
+	return fmt.Sprintf("%sremovedlogs:%s", k.prefix, strings.ToLower(hash.Hex()))
+}
+
+// receiptKey returns the key of the receipt of a canonical transaction.
+func (k keyspace) receiptKey(hash common.Hash) string {
+	return fmt.Sprintf("%sreceipt:%s", k.prefix, strings.ToLower(hash.Hex()))
+}
+
 // RedisBlockStore handles storage of blocks and logs in Redis
 type RedisBlockStore struct {
-	client    *redis.Client
-	config    *Config
-	ctx       context.Context
-	txManager *TxManager
+	client     Backend
+	config     *Config
+	ctx        context.Context
+	txManager  *TxManager
+	keys       keyspace           // Keys of the chain's data
+	token      atomic.Uint64      // Fencing token carried by writes, 0 if unfenced
+	stateDiffs *StateDiffRecorder // Source of the state diffs exported with blocks, nil if not recorded
 }
 
 // NewRedisStore creates a new Redis block store
@@ -34,154 +119,433 @@ func NewRedisStore(cfg *Config) (*RedisBlockStore, error) {
 		return nil, fmt.Errorf("redis storage is disabled")
 	}
 
+	conf := cfg.sanitize()
+	client, err := conf.newClient()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(&conf, NewRedisBackend(client))
+}
+
+// NewStore creates a block store writing to the given backend, configured like
+// a Redis store apart from the connection settings.
+func NewStore(cfg *Config, backend Backend) (*RedisBlockStore, error) {
+	conf := cfg.sanitize()
+
 	// Set compression config
-	SetConfig(cfg)
-
-	client := redis.NewClient(&redis.Options{
-		Network:         cfg.Network,
-		Addr:            cfg.Address,
-		Username:        cfg.Username,
-		Password:        cfg.Password,
-		DB:              cfg.DB,
-		PoolSize:        cfg.PoolSize,
-		MinIdleConns:    cfg.MinIdle,
-		MaxRetries:      cfg.MaxRetries,
-		MinRetryBackoff: cfg.RetryDelay,
-		MaxRetryBackoff: cfg.RetryDelay * 2,
-	})
+	SetConfig(&conf)
 
 	ctx := context.Background()
-	if err := client.Ping(ctx).Err(); err != nil {
+	if err := backend.Ping(ctx).Err(); err != nil {
+		backend.Close()
 		return nil, fmt.Errorf("redis connection failed: %v", err)
 	}
 
 	store := &RedisBlockStore{
-		client: client,
-		config: cfg,
+		client: backend,
+		config: &conf,
 		ctx:    ctx,
+		keys:   newKeyspace(conf.KeyPrefix, new(big.Int)),
 	}
 
 	return store, nil
 }
 
+// SetTTL sets the expiry of the block related keys written from now on, those
+// of the blocks, logs, receipts and mined transactions classes. A zero TTL keeps
+// the keys until they are pruned or explicitly purged.
+func (s *RedisBlockStore) SetTTL(ttl time.Duration) {
+	retention := &s.config.Retention
+	retention.Blocks.Age, retention.Logs.Age, retention.Receipts.Age, retention.MinedTxs.Age = ttl, ttl, ttl, ttl
+}
+
+// SetChainID sets the chain whose data is stored, deriving the key prefix from
+// it unless one is configured.
+func (s *RedisBlockStore) SetChainID(chainID *big.Int) {
+	s.keys = newKeyspace(s.config.KeyPrefix, chainID)
+}
+
+// SetStateDiffRecorder sets the recorder the state diffs of exported blocks are
+// taken from. Without one, no state diffs are exported.
+func (s *RedisBlockStore) SetStateDiffRecorder(recorder *StateDiffRecorder) {
+	s.stateDiffs = recorder
+}
+
 // SetTxManager sets the transaction manager reference for block number updates
 func (s *RedisBlockStore) SetTxManager(txManager *TxManager) {
 	s.txManager = txManager
 }
 
-func (s *RedisBlockStore) StoreBlock(block *types.Block, logs []*types.Log) error {
+// StoreBlock stores a block along with its logs as the canonical block at its
+// height. The chain config is needed to derive the senders of the transactions.
+func (s *RedisBlockStore) StoreBlock(block *types.Block, logs []*types.Log, config *params.ChainConfig) error {
 	defer redisBlockStoreTimer.UpdateSince(time.Now())
 
-	blockKey := fmt.Sprintf("block:%d", block.NumberU64())
+	batch := newExportBatch()
+	if err := s.queueBlock(batch, block, logs, config); err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	return s.commit(batch)
+}
 
-	// Use atomic SET operation with NX (Not eXists) to prevent race conditions
-	// This creates a lock key that prevents duplicate processing of the same block
-	lockKey := fmt.Sprintf("lock:%d", block.NumberU64())
-	set, err := s.client.SetNX(s.ctx, lockKey, "1", 5*time.Second).Result()
+// queueBlock adds the writes storing a block as the canonical block at its height
+// and announcing it to a batch.
+func (s *RedisBlockStore) queueBlock(batch *exportBatch, block *types.Block, logs []*types.Log, config *params.ChainConfig) error {
+	txsBlob, err := encodeTxs(block, config)
 	if err != nil {
-		redisErrorCounter.Inc(1)
-		return fmt.Errorf("failed to acquire block lock: %v", err)
+		return err
 	}
-	if !set {
-		// Another process is already storing this block, skip to prevent duplicates
-		return nil
+
+	// Get block gas price (base fee or 0 if not available)
+	var blockGasPrice string
+	if block.BaseFee() != nil {
+		blockGasPrice = block.BaseFee().String()
+	} else {
+		blockGasPrice = "0"
 	}
 
-	// Ensure lock is cleaned up even if function exits early
-	defer s.client.Del(s.ctx, lockKey)
-
-	// Extract full transaction data from block
-	txsData := make([]map[string]interface{}, len(block.Transactions()))
-	for i, tx := range block.Transactions() {
-		// Serialize transaction data to JSON-compatible format
-		txData := map[string]interface{}{
-			"hash":                 strings.ToLower(tx.Hash().Hex()),
-			"type":                 tx.Type(),
-			"nonce":                tx.Nonce(),
-			"gasPrice":             uint64(0), // Will be set below based on tx type
-			"maxFeePerGas":         uint64(0), // For EIP-1559 transactions
-			"maxPriorityFeePerGas": uint64(0), // For EIP-1559 transactions
-			"gasLimit":             tx.Gas(),
-			"value":                tx.Value().Uint64(),
-			"input":                fmt.Sprintf("0x%x", tx.Data()),
+	logsBlob, err := encodeLogs(block, logs)
+	if err != nil {
+		return err
+	}
+	header, err := rlp.EncodeToBytes(block.Header())
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %v", err)
+	}
+	body, err := rlp.EncodeToBytes(&types.Body{Uncles: block.Uncles(), Withdrawals: block.Withdrawals()})
+	if err != nil {
+		return fmt.Errorf("failed to encode body: %v", err)
+	}
+
+	// Create block hash with all fields including logs (single HSET operation)
+	number, hash := block.NumberU64(), block.Hash()
+	blockKey := s.keys.blockKey(number)
+	blockFields := []interface{}{"HSET", blockKey,
+		"schema_version", SchemaVersion,
+		"hash", strings.ToLower(hash.Hex()),
+		"parentHash", strings.ToLower(block.ParentHash().Hex()),
+		"number", number,
+		"timestamp", block.Time(),
+		"gasPrice", blockGasPrice,
+		"header", header,
+		"body", body,
+		"txs", txsBlob,
+		"logs", logsBlob,
+		"canonical", 1,
+	}
+	// If another block is canonical at this height, demote it to a sibling.
+	// Then store all block data of the height at once, dropping any stale
+	// sibling copy of the same block
+	var (
+		height = batch.height
+		age    = s.config.Retention.Blocks.Age
+	)
+	height.fence(s.keys.heightFenceKey(number), age)
+	if err := s.demoteCanonical(height, number, hash); err != nil {
+		return err
+	}
+	height.add(blockKey, blockFields...)
+	height.add(s.keys.siblingKey(number, hash), "DEL", s.keys.siblingKey(number, hash))
+	height.add(s.keys.siblingsKey(number), "SREM", s.keys.siblingsKey(number), strings.ToLower(hash.Hex()))
+	height.add(s.keys.canonicalKey(number), setArgs(s.keys.canonicalKey(number), strings.ToLower(hash.Hex()), age)...)
+	height.expire(blockKey, age)
+
+	// Update the hash index and drop the removed logs of an earlier reorg
+	batch.writes.add(s.keys.removedLogsKey(hash), "DEL", s.keys.removedLogsKey(hash))
+	batch.writes.add(s.keys.blockHashKey(hash), setArgs(s.keys.blockHashKey(hash), number, age)...)
+
+	// Announce the block and its logs
+	s.queueEvent(batch.chain, BlocksStream, blockEvent(block)...)
+	events := 1
+	if len(logs) > 0 {
+		values, err := logsEvent(block, logs, false)
+		if err != nil {
+			return err
 		}
+		s.queueEvent(batch.chain, LogsStream, values...)
+		events++
+	}
+	batch.onCommit(func() {
+		redisStreamMeter.Mark(int64(events))
 
-		// Set to address (can be nil for contract creation)
-		if tx.To() != nil {
-			txData["to"] = strings.ToLower(tx.To().Hex())
-			txData["contractAddress"] = nil
-		} else {
-			txData["to"] = nil
-			// For contract creation transactions, calculate the contract address
-			// We need to get the sender address to calculate the contract address
-			chainID := tx.ChainId()
-			if chainID != nil && chainID.Cmp(big.NewInt(0)) > 0 {
-				if from, err := types.Sender(types.LatestSignerForChainID(chainID), tx); err == nil {
-					contractAddr := crypto.CreateAddress(from, tx.Nonce())
-					txData["contractAddress"] = strings.ToLower(contractAddr.Hex())
-				} else {
-					txData["contractAddress"] = nil
-				}
-			} else {
-				txData["contractAddress"] = nil
-			}
+		// Update current blockchain number in transaction manager if available
+		if s.txManager != nil {
+			s.txManager.UpdateCurrentBlockNumber(number)
 		}
+	})
+	return nil
+}
 
-		// Handle different transaction types for gas pricing
-		if tx.Type() == 2 { // EIP-1559 transaction
-			if tx.GasFeeCap() != nil {
-				txData["maxFeePerGas"] = tx.GasFeeCap().Uint64()
-				// For EIP-1559 transactions, use maxFeePerGas as gasPrice for consistency
-				txData["gasPrice"] = tx.GasFeeCap().Uint64()
-			}
-			if tx.GasTipCap() != nil {
-				txData["maxPriorityFeePerGas"] = tx.GasTipCap().Uint64()
-			}
-		} else {
-			// Legacy transaction
-			if tx.GasPrice() != nil {
-				txData["gasPrice"] = tx.GasPrice().Uint64()
-			}
+// ExportBlock stores a block along with its receipts and logs, and records its
+// transactions as mined in the mempool mirror if a transaction manager is attached.
+// All writes are committed at once.
+func (s *RedisBlockStore) ExportBlock(block *types.Block, receipts types.Receipts, config *params.ChainConfig) error {
+	return s.exportBlock(block, receipts, config, false)
+}
+
+// CommitBlock exports a block like ExportBlock and, along with it, records the
+// block as the last one exported for the store's chain. This is the write path
+// of the live exporter.
+func (s *RedisBlockStore) CommitBlock(block *types.Block, receipts types.Receipts, config *params.ChainConfig) error {
+	return s.exportBlock(block, receipts, config, true)
+}
+
+// exportBlock collects all writes of a block export into a single batch and
+// commits it, optionally moving the export cursor to the block.
+func (s *RedisBlockStore) exportBlock(block *types.Block, receipts types.Receipts, config *params.ChainConfig, cursor bool) error {
+	defer redisBlockStoreTimer.UpdateSince(time.Now())
+
+	var (
+		batch  = newExportBatch()
+		logs   = blockLogs(receipts)
+		signer = types.MakeSigner(config, block.Number(), block.Time())
+	)
+	if err := s.queueBlock(batch, block, logs, config); err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	if err := s.queueReceipts(batch, s.keys.blockKey(block.NumberU64()), block, receipts, signer); err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	if err := s.queueBlockTxs(batch, block, signer); err != nil {
+		return err
+	}
+	if err := s.queueStateDiff(batch, block); err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	if s.config.LogIndex {
+		if err := s.queueBlockLogs(batch, block, logs); err != nil {
+			return err
 		}
+	}
+	if s.txManager != nil {
+		if err := s.txManager.queueMinedTxs(batch, block, signer); err != nil {
+			return err
+		}
+	}
+	if cursor {
+		s.setCursor(batch.chain, block.NumberU64(), block.Hash())
+	}
+	return s.commit(batch)
+}
 
-		// Add access list for EIP-2930 and EIP-1559 transactions
-		if tx.Type() == 1 || tx.Type() == 2 {
-			accessList := tx.AccessList()
-			if len(accessList) > 0 {
-				accessListData := make([]map[string]interface{}, len(accessList))
-				for j, access := range accessList {
-					storageKeys := make([]string, len(access.StorageKeys))
-					for k, key := range access.StorageKeys {
-						storageKeys[k] = strings.ToLower(key.Hex())
-					}
-					accessListData[j] = map[string]interface{}{
-						"address":     strings.ToLower(access.Address.Hex()),
-						"storageKeys": storageKeys,
-					}
-				}
-				txData["accessList"] = accessListData
-			}
+// StoreReceipts stores the receipts of a block previously written by StoreBlock,
+// both as a list in the block hash and individually per transaction. The JSON
+// format is identical to the one of eth_getBlockReceipts.
+func (s *RedisBlockStore) StoreReceipts(block *types.Block, receipts types.Receipts, signer types.Signer) error {
+	blockKey, err := s.findBlockKeyByHash(block.Hash())
+	if err != nil {
+		return err
+	}
+	if blockKey == "" {
+		return fmt.Errorf("block %d [%x] not stored", block.NumberU64(), block.Hash())
+	}
+	batch := newExportBatch()
+	if err := s.queueReceipts(batch, blockKey, block, receipts, signer); err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	return s.commit(batch)
+}
+
+// queueReceipts adds the writes storing the receipts of a block to a batch, the
+// list of them going into the given block hash.
+func (s *RedisBlockStore) queueReceipts(batch *exportBatch, blockKey string, block *types.Block, receipts types.Receipts, signer types.Signer) error {
+	defer redisReceiptStoreTimer.UpdateSince(time.Now())
+
+	txs := block.Transactions()
+	if len(txs) != len(receipts) {
+		return fmt.Errorf("receipts length mismatch: %d vs %d", len(txs), len(receipts))
+	}
+	var (
+		hash   = block.Hash()
+		number = block.NumberU64()
+		fields = make([]map[string]interface{}, len(receipts))
+	)
+	for i, receipt := range receipts {
+		fields[i] = marshalReceipt(receipt, hash, number, signer, txs[i], i)
+
+		blob, err := json.Marshal(fields[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode receipt: %v", err)
 		}
+		key := s.keys.receiptKey(txs[i].Hash())
+		batch.writes.add(key, setArgs(key, blob, s.config.Retention.Receipts.Age)...)
+	}
+	blob, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipts: %v", err)
+	}
+	if blob, err = Compress(blob); err != nil {
+		return fmt.Errorf("failed to compress receipts: %v", err)
+	}
+	batch.height.add(blockKey, "HSET", blockKey, "receipts", blob)
+	return nil
+}
 
-		txsData[i] = txData
+// GetReceipts retrieves the JSON encoded receipts of a block, as returned by
+// eth_getBlockReceipts. Nil is returned if the block or its receipts are not
+// stored.
+func (s *RedisBlockStore) GetReceipts(hash common.Hash) (json.RawMessage, error) {
+	blockKey, err := s.findBlockKeyByHash(hash)
+	if err != nil || blockKey == "" {
+		return nil, err
+	}
+	blob, err := s.client.HGet(s.ctx, blockKey, "receipts").Bytes()
+	if err == redis.Nil {
+		return nil, nil
 	}
-	txsDataJSON, _ := json.Marshal(txsData)
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to get receipts: %v", err)
+	}
+	if blob, err = Decompress(blob); err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to decompress receipts: %v", err)
+	}
+	return blob, nil
+}
 
-	// Get block gas price (base fee or 0 if not available)
-	var blockGasPrice string
-	if block.BaseFee() != nil {
-		blockGasPrice = block.BaseFee().String()
-	} else {
-		blockGasPrice = "0"
+// GetTxReceipt retrieves the JSON encoded receipt of a canonical transaction,
+// as returned by eth_getTransactionReceipt. Nil is returned if not stored.
+func (s *RedisBlockStore) GetTxReceipt(hash common.Hash) (json.RawMessage, error) {
+	blob, err := s.client.Get(s.ctx, s.keys.receiptKey(hash)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return nil, fmt.Errorf("failed to get receipt: %v", err)
+	}
+	return blob, nil
+}
+
+// RemoveBlock marks a previously exported block as no longer canonical. The
+// block data is moved to its sibling key and the given logs are recorded with
+// the removed flag set, allowing consumers to roll back their state. The state
+// diff of the block, if exported, is announced again inverted.
+func (s *RedisBlockStore) RemoveBlock(block *types.Block, logs []*types.Log) error {
+	number, hash := block.NumberU64(), block.Hash()
+
+	removed := make([]*types.Log, len(logs))
+	for i, log := range logs {
+		cpy := *log
+		cpy.Removed = true
+		removed[i] = &cpy
 	}
+	blob, err := encodeLogs(block, removed)
+	if err != nil {
+		redisErrorCounter.Inc(1)
+		return err
+	}
+	canonical, err := s.client.Get(s.ctx, s.keys.canonicalKey(number)).Result()
+	if err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to read canonical marker: %v", err)
+	}
+	if canonical == strings.ToLower(hash.Hex()) {
+		batch := new(slotBatch)
+		if err := s.demoteCanonical(batch, number, common.Hash{}); err != nil {
+			redisErrorCounter.Inc(1)
+			return err
+		}
+		batch.add(s.keys.canonicalKey(number), "DEL", s.keys.canonicalKey(number))
+		batch.fence(s.keys.heightFenceKey(number), s.config.Retention.Blocks.Age)
+		if err := s.writeSlot(batch); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to demote canonical block: %w", err)
+		}
+	}
+	if err := s.client.Set(s.ctx, s.keys.removedLogsKey(hash), blob, s.config.Retention.Blocks.Age).Err(); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to store removed logs: %v", err)
+	}
+	// Drop the receipts of the block, transactions included again in the new
+	// chain get theirs rewritten when the new blocks are stored
+	if txs := block.Transactions(); len(txs) > 0 {
+		pipe := s.client.Pipeline()
+		for _, tx := range txs {
+			pipe.Del(s.ctx, s.keys.receiptKey(tx.Hash()))
+		}
+		if _, err := pipe.Exec(s.ctx); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to remove receipts: %v", err)
+		}
+	}
+	if err := s.unindexBlockTxs(block); err != nil {
+		return err
+	}
+	if s.config.LogIndex {
+		if err := s.unindexBlockLogs(block, logs); err != nil {
+			return err
+		}
+	}
+	if err := s.publishLogs(block, removed, true); err != nil {
+		return err
+	}
+	if err := s.publishStateDiffRollback(block); err != nil {
+		return err
+	}
+	if s.txManager != nil {
+		if err := s.txManager.ReorgedTxs(block); err != nil {
+			log.Error("Failed to mark reorged transactions in Redis", "number", number, "hash", hash, "err", err)
+		}
+	}
+	return nil
+}
 
-	// Create a map of transaction hashes to their indices for efficient lookup
-	txHashToIndex := make(map[common.Hash]uint)
-	for i, tx := range block.Transactions() {
-		txHashToIndex[tx.Hash()] = uint(i)
+// demoteCanonical adds the writes moving the canonical block data at the given
+// height to its sibling key to a batch, unless the canonical block is the one
+// being kept.
+func (s *RedisBlockStore) demoteCanonical(batch *slotBatch, number uint64, keep common.Hash) error {
+	blockKey := s.keys.blockKey(number)
+
+	current, err := s.client.HGet(s.ctx, blockKey, "hash").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read canonical block: %v", err)
 	}
+	if current == strings.ToLower(keep.Hex()) {
+		return nil
+	}
+	var (
+		age      = s.config.Retention.Blocks.Age
+		sibling  = s.keys.siblingKey(number, common.HexToHash(current))
+		siblings = s.keys.siblingsKey(number)
+	)
+	batch.add(blockKey, "RENAME", blockKey, sibling)
+	batch.add(sibling, "HSET", sibling, "canonical", 0)
+	batch.expire(sibling, age)
+	batch.add(siblings, "SADD", siblings, current)
+	batch.expire(siblings, age)
+	return nil
+}
 
-	// Process logs - they should already have correct transaction associations from blockchain.go
+// encodeTxs converts the transactions of a block into their stored JSON format,
+// identical to the one of eth_getBlockByHash with full transactions.
+func encodeTxs(block *types.Block, config *params.ChainConfig) ([]byte, error) {
+	txs := make([]*storedTx, len(block.Transactions()))
+	for i := range txs {
+		txs[i] = newStoredTx(block, i, config)
+	}
+	blob, err := json.Marshal(txs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transactions: %v", err)
+	}
+	if blob, err = Compress(blob); err != nil {
+		return nil, fmt.Errorf("failed to compress transactions: %v", err)
+	}
+	return blob, nil
+}
+
+// encodeLogs converts the logs of a block into their stored JSON format.
+func encodeLogs(block *types.Block, logs []*types.Log) ([]byte, error) {
+	// Process logs - they should already have correct transaction associations from the receipts
 	fixedLogs := make([]*types.Log, len(logs))
 	for i, log := range logs {
 		// Create a copy of the log to avoid modifying the original
@@ -208,124 +572,95 @@ func (s *RedisBlockStore) StoreBlock(block *types.Block, logs []*types.Log) erro
 		fixedLogs[i] = fixedLog
 	}
 
-	// Convert fixed logs to JSON format with lowercase hashes
-	logsForJSON := make([]map[string]interface{}, len(fixedLogs))
-	for i, log := range fixedLogs {
-		logMap := map[string]interface{}{
-			"address":          strings.ToLower(log.Address.Hex()),
-			"topics":           make([]string, len(log.Topics)),
-			"data":             fmt.Sprintf("0x%x", log.Data),
-			"blockNumber":      log.BlockNumber,
-			"transactionHash":  strings.ToLower(log.TxHash.Hex()),
-			"transactionIndex": fmt.Sprintf("0x%x", log.TxIndex),
-			"blockHash":        strings.ToLower(log.BlockHash.Hex()),
-			"logIndex":         log.Index,
-			"removed":          log.Removed,
-		}
-		// Convert topics to lowercase hex strings
-		for j, topic := range log.Topics {
-			logMap["topics"].([]string)[j] = strings.ToLower(topic.Hex())
-		}
-		logsForJSON[i] = logMap
-	}
-
-	logsData, err := json.Marshal(logsForJSON)
+	// Encode the logs in the same JSON format as the RPC API and receipts
+	logsData, err := json.Marshal(fixedLogs)
 	if err != nil {
-		redisErrorCounter.Inc(1)
-		return fmt.Errorf("failed to encode logs: %v", err)
-	}
-
-	// Create block hash with all fields including logs (single HSET operation)
-	blockFields := map[string]interface{}{
-		"hash":     strings.ToLower(block.Hash().Hex()),
-		"number":   block.NumberU64(),
-		"gasPrice": blockGasPrice,
-		"txs":      string(txsDataJSON),
-		"logs":     logsData,
+		return nil, fmt.Errorf("failed to encode logs: %v", err)
 	}
-
-	// Store all block data in a single atomic operation
-	if err := s.client.HMSet(s.ctx, blockKey, blockFields).Err(); err != nil {
-		redisErrorCounter.Inc(1)
-		return fmt.Errorf("failed to store block data: %v", err)
+	logsBlob, err := Compress(logsData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress logs: %v", err)
 	}
+	return logsBlob, nil
+}
 
-	// Set TTL for block (60 seconds)
-	if err := s.client.Expire(s.ctx, blockKey, 60*time.Second).Err(); err != nil {
-		redisErrorCounter.Inc(1)
-		return fmt.Errorf("failed to set block TTL: %v", err)
+// GetBlock retrieves a stored block, canonical or not, reconstructed from its
+// stored header, body and transactions. Nil is returned if it is not stored.
+func (s *RedisBlockStore) GetBlock(hash common.Hash) (*types.Block, error) {
+	block, err := s.reader().BlockByHash(s.ctx, hash)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, nil
 	}
+	return block, err
+}
 
-	// Update current blockchain number in transaction manager if available
-	if s.txManager != nil {
-		s.txManager.UpdateCurrentBlockNumber(block.NumberU64())
+// GetBlockByNumber retrieves the canonical block at a height like GetBlock.
+func (s *RedisBlockStore) GetBlockByNumber(blockNumber uint64) (*types.Block, error) {
+	block, err := s.reader().BlockByNumber(s.ctx, blockNumber)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, nil
 	}
+	return block, err
+}
 
-	return nil
+// reader returns a client reading the data written by the store.
+func (s *RedisBlockStore) reader() *client.Client {
+	return client.New(s.client, &client.Schema{
+		Version:    SchemaVersion,
+		ChainID:    s.keys.chainID,
+		Prefix:     s.keys.prefix,
+		Compressed: s.config.CompressEnabled,
+	})
 }
 
-// GetBlock retrieves a block from Redis hash structure
-func (s *RedisBlockStore) GetBlock(hash common.Hash) (*types.Block, error) {
-	// First try to find by hash - scan through block keys to find matching hash
-	blockKey, err := s.findBlockKeyByHash(hash)
+// findBlockKeyByHash finds the key of a block, canonical or not, via the hash
+// index.
+func (s *RedisBlockStore) findBlockKeyByHash(hash common.Hash) (string, error) {
+	number, err := s.client.Get(s.ctx, s.keys.blockHashKey(hash)).Uint64()
+	if err == redis.Nil {
+		return "", nil // Not found
+	}
 	if err != nil {
-		return nil, err
+		redisErrorCounter.Inc(1)
+		return "", fmt.Errorf("failed to read block hash index: %v", err)
 	}
-	if blockKey == "" {
-		return nil, nil // Block not found
+	canonical, err := s.client.Get(s.ctx, s.keys.canonicalKey(number)).Result()
+	if err != nil && err != redis.Nil {
+		redisErrorCounter.Inc(1)
+		return "", fmt.Errorf("failed to read canonical marker: %v", err)
 	}
-
-	// Since we no longer store RLP data, we cannot reconstruct the full block
-	// This method now returns nil to indicate blocks should be retrieved from other sources
-	return nil, fmt.Errorf("block reconstruction not available - RLP data not stored")
+	if canonical == strings.ToLower(hash.Hex()) {
+		return s.keys.blockKey(number), nil
+	}
+	return s.keys.siblingKey(number, hash), nil
 }
 
-// GetBlockByNumber retrieves a block by number from Redis hash structure
-func (s *RedisBlockStore) GetBlockByNumber(blockNumber uint64) (*types.Block, error) {
-	blockKey := fmt.Sprintf("block:%d", blockNumber)
-
-	// Check if block exists
-	exists, err := s.client.Exists(s.ctx, blockKey).Result()
+// GetCanonicalHash returns the hash of the exported canonical block at the
+// given height, or the zero hash if none is known.
+func (s *RedisBlockStore) GetCanonicalHash(number uint64) (common.Hash, error) {
+	hash, err := s.client.Get(s.ctx, s.keys.canonicalKey(number)).Result()
+	if err == redis.Nil {
+		return common.Hash{}, nil
+	}
 	if err != nil {
 		redisErrorCounter.Inc(1)
-		return nil, fmt.Errorf("failed to check block existence: %v", err)
-	}
-	if exists == 0 {
-		return nil, nil // Block not found
+		return common.Hash{}, fmt.Errorf("failed to read canonical marker: %v", err)
 	}
-
-	// Since we no longer store RLP data, we cannot reconstruct the full block
-	// This method now returns nil to indicate blocks should be retrieved from other sources
-	return nil, fmt.Errorf("block reconstruction not available - RLP data not stored")
+	return common.HexToHash(hash), nil
 }
 
-// findBlockKeyByHash finds a block key by searching for the hash in stored blocks
-func (s *RedisBlockStore) findBlockKeyByHash(hash common.Hash) (string, error) {
-	hashStr := strings.ToLower(hash.Hex())
-
-	// Use SCAN to iterate through block keys and check for matching hash
-	iter := s.client.Scan(s.ctx, 0, "block:*", 1000).Iterator()
-	for iter.Next(s.ctx) {
-		key := iter.Val()
-		// Get the hash field (updated field name)
-		storedHash, err := s.client.HGet(s.ctx, key, "hash").Result()
-		if err != nil {
-			if err == redis.Nil {
-				continue // No hash field, skip
-			}
-			continue // Error getting hash, skip
-		}
-		if storedHash == hashStr {
-			return key, nil
-		}
+// GetRemovedLogs retrieves the logs of a block dropped by a reorg, all flagged
+// as removed. Nil is returned if no removal was recorded for the block.
+func (s *RedisBlockStore) GetRemovedLogs(hash common.Hash) ([]*types.Log, error) {
+	blob, err := s.client.Get(s.ctx, s.keys.removedLogsKey(hash)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
 	}
-
-	if err := iter.Err(); err != nil {
+	if err != nil {
 		redisErrorCounter.Inc(1)
-		return "", fmt.Errorf("failed to scan block keys: %v", err)
+		return nil, fmt.Errorf("failed to get removed logs: %v", err)
 	}
-
-	return "", nil // Not found
+	return decodeLogs(blob)
 }
 
 // GetLogs retrieves logs for a block from Redis hash structure
@@ -344,7 +679,7 @@ func (s *RedisBlockStore) GetLogs(hash common.Hash) ([]*types.Log, error) {
 
 // GetLogsByNumber retrieves logs for a block by number from Redis hash structure
 func (s *RedisBlockStore) GetLogsByNumber(blockNumber uint64) ([]*types.Log, error) {
-	blockKey := fmt.Sprintf("block:%d", blockNumber)
+	blockKey := s.keys.blockKey(blockNumber)
 	return s.getLogsFromKey(blockKey)
 }
 
@@ -360,13 +695,25 @@ func (s *RedisBlockStore) getLogsFromKey(blockKey string) ([]*types.Log, error)
 		return nil, fmt.Errorf("failed to get logs: %v", err)
 	}
 
-	// Decode logs (stored as uncompressed JSON)
-	var logs []*types.Log
-	if err := json.Unmarshal(logsData, &logs); err != nil {
+	logs, err := decodeLogs(logsData)
+	if err != nil {
 		redisErrorCounter.Inc(1)
-		return nil, fmt.Errorf("failed to decode logs: %v", err)
+		return nil, err
 	}
+	return logs, nil
+}
 
+// decodeLogs parses logs stored by encodeLogs.
+func decodeLogs(blob []byte) ([]*types.Log, error) {
+	// Decode logs (stored as JSON, optionally compressed)
+	blob, err := Decompress(blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress logs: %v", err)
+	}
+	var logs []*types.Log
+	if err := json.Unmarshal(blob, &logs); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %v", err)
+	}
 	return logs, nil
 }
 
@@ -386,7 +733,7 @@ func (s *RedisBlockStore) GetBlockFields(hash common.Hash, fields ...string) (ma
 
 // GetBlockFieldsByNumber retrieves specific block fields by number from Redis hash
 func (s *RedisBlockStore) GetBlockFieldsByNumber(blockNumber uint64, fields ...string) (map[string]string, error) {
-	blockKey := fmt.Sprintf("block:%d", blockNumber)
+	blockKey := s.keys.blockKey(blockNumber)
 	return s.getBlockFieldsFromKey(blockKey, fields...)
 }
 
@@ -419,6 +766,110 @@ func (s *RedisBlockStore) getBlockFieldsFromKey(blockKey string, fields ...strin
 	return fieldMap, nil
 }
 
+// BlockNumbers returns the numbers of all canonical blocks stored in Redis, in
+// ascending order. It scans the keyspace and is meant for maintenance only.
+func (s *RedisBlockStore) BlockNumbers() ([]uint64, error) {
+	var numbers []uint64
+	err := scanKeys(s.ctx, s.client, s.keys.prefix+"block:*", func(key string) error {
+		// Skip sibling blocks, only block:{<number>} is canonical
+		tag, ok := strings.CutPrefix(key, s.keys.prefix+"block:{")
+		if !ok {
+			return nil
+		}
+		if number, err := strconv.ParseUint(strings.TrimSuffix(tag, "}"), 10, 64); err == nil {
+			numbers = append(numbers, number)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan block keys: %v", err)
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+// Purge deletes all blocks and pending transactions stored before the given
+// time, along with their indices, receipts, removed logs, state diffs and
+// address index entries. Blocks written before the schema carried timestamps
+// are left alone. It scans the keyspace and is meant for maintenance only.
+func (s *RedisBlockStore) Purge(before time.Time) (blocks int, txs int, err error) {
+	cutoff := uint64(before.Unix())
+
+	err = scanKeys(s.ctx, s.client, s.keys.prefix+"block:*", func(key string) error {
+		fields, err := s.getBlockFieldsFromKey(key, "hash", "number", "timestamp", "txs")
+		if err != nil {
+			return err
+		}
+		timestamp, err := strconv.ParseUint(fields["timestamp"], 10, 64)
+		if err != nil || timestamp >= cutoff {
+			return nil
+		}
+		hash := common.HexToHash(fields["hash"])
+		keys := []string{key, s.keys.blockHashKey(hash), s.keys.removedLogsKey(hash), s.keys.stateDiffKey(hash)}
+		if number, err := strconv.ParseUint(fields["number"], 10, 64); err == nil && key == s.keys.blockKey(number) {
+			keys = append(keys, s.keys.canonicalKey(number))
+		}
+		pipe := s.client.Pipeline()
+		if blob, err := Decompress([]byte(fields["txs"])); err == nil {
+			var list []struct {
+				Hash            common.Hash     `json:"hash"`
+				From            common.Address  `json:"from"`
+				To              *common.Address `json:"to"`
+				ContractAddress *common.Address `json:"contractAddress"`
+			}
+			if json.Unmarshal(blob, &list) == nil {
+				for _, tx := range list {
+					keys = append(keys, s.keys.receiptKey(tx.Hash), s.keys.txBlockKey(tx.Hash))
+					for _, addr := range []*common.Address{&tx.From, tx.To, tx.ContractAddress} {
+						if addr != nil {
+							pipe.ZRem(s.ctx, s.keys.addrMinedKey(*addr), tx.Hash.Hex())
+						}
+					}
+				}
+			}
+		}
+		for _, key := range keys {
+			pipe.Del(s.ctx, key)
+		}
+		if _, err := pipe.Exec(s.ctx); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to purge block: %v", err)
+		}
+		blocks++
+		return nil
+	})
+	if err != nil {
+		return blocks, txs, fmt.Errorf("failed to purge blocks: %v", err)
+	}
+	err = scanKeys(s.ctx, s.client, s.keys.prefix+"tx:*", func(key string) error {
+		fields, err := s.client.HMGet(s.ctx, key, "timestamp", "from", "to", "contractAddress").Result()
+		if err != nil {
+			return nil
+		}
+		stamp, _ := fields[0].(string)
+		if timestamp, err := strconv.ParseUint(stamp, 10, 64); err != nil || timestamp >= cutoff {
+			return nil
+		}
+		pipe := s.client.Pipeline()
+		for _, party := range fields[1:] {
+			if addr, ok := party.(string); ok && common.IsHexAddress(addr) {
+				pipe.ZRem(s.ctx, s.keys.addrPendingKey(common.HexToAddress(addr)), strings.TrimPrefix(key, s.keys.prefix+"tx:"))
+			}
+		}
+		pipe.Del(s.ctx, key)
+		if _, err := pipe.Exec(s.ctx); err != nil {
+			redisErrorCounter.Inc(1)
+			return fmt.Errorf("failed to purge transaction: %v", err)
+		}
+		txs++
+		return nil
+	})
+	if err != nil {
+		return blocks, txs, fmt.Errorf("failed to purge transactions: %v", err)
+	}
+	return blocks, txs, nil
+}
+
 // Close closes the Redis connection
 func (s *RedisBlockStore) Close() error {
 	return s.client.Close()
@@ -2,7 +2,10 @@ package redisstore
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -10,16 +13,33 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
 )
 
-func TestDoubleStoreBlock(t *testing.T) {
-	// Create Redis store
-	cfg := DefaultConfig()
-	store, err := NewRedisStore(cfg)
+// testConfig returns the configuration the tests run with, without spooling.
+func testConfig() *Config {
+	cfg := DefaultConfig
+	cfg.Enabled = true
+	cfg.Spool = ""
+	return &cfg
+}
+
+// newTestStore creates a store writing to an empty in-process backend.
+func newTestStore(t *testing.T, cfg *Config) *RedisBlockStore {
+	t.Helper()
+
+	store, err := NewStore(cfg, NewMemoryBackend())
 	if err != nil {
-		t.Fatalf("Failed to create Redis store: %v", err)
+		t.Fatalf("Failed to create store: %v", err)
 	}
+	return store
+}
+
+func TestDoubleStoreBlock(t *testing.T) {
+	// Create store
+	store := newTestStore(t, testConfig())
 	defer store.Close()
 
 	// Create a test block
@@ -41,7 +61,7 @@ func TestDoubleStoreBlock(t *testing.T) {
 	}
 
 	// Store block first time
-	if err := store.StoreBlock(block, logs); err != nil {
+	if err := store.StoreBlock(block, logs, params.TestChainConfig); err != nil {
 		t.Fatalf("Failed to store block first time: %v", err)
 	}
 
@@ -52,7 +72,7 @@ func TestDoubleStoreBlock(t *testing.T) {
 	}
 
 	// Store block second time
-	if err := store.StoreBlock(block, logs); err != nil {
+	if err := store.StoreBlock(block, logs, params.TestChainConfig); err != nil {
 		t.Fatalf("Failed to store block second time: %v", err)
 	}
 
@@ -74,12 +94,8 @@ func TestDoubleStoreBlock(t *testing.T) {
 }
 
 func TestStoreTransactionData(t *testing.T) {
-	// Create Redis store
-	cfg := DefaultConfig()
-	store, err := NewRedisStore(cfg)
-	if err != nil {
-		t.Fatalf("Failed to create Redis store: %v", err)
-	}
+	// Create store
+	store := newTestStore(t, testConfig())
 	defer store.Close()
 
 	// Create a private key for signing transactions
@@ -136,7 +152,7 @@ func TestStoreTransactionData(t *testing.T) {
 	block := types.NewBlock(header, body, nil, trie.NewStackTrie(nil))
 
 	// Store block
-	if err := store.StoreBlock(block, nil); err != nil {
+	if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
 		t.Fatalf("Failed to store block: %v", err)
 	}
 
@@ -168,7 +184,7 @@ func TestStoreTransactionData(t *testing.T) {
 		t.Errorf("Legacy transaction hash mismatch: got %s, want %s",
 			legacyTxData["hash"], strings.ToLower(signedLegacyTx.Hash().Hex()))
 	}
-	if legacyTxData["type"] != float64(0) {
+	if legacyTxData["type"] != "0x0" {
 		t.Errorf("Legacy transaction type mismatch: got %v, want 0", legacyTxData["type"])
 	}
 	if legacyTxData["to"] != "0x0000000000000000000000001234567890abcdef" {
@@ -181,15 +197,384 @@ func TestStoreTransactionData(t *testing.T) {
 		t.Errorf("EIP-1559 transaction hash mismatch: got %s, want %s",
 			eip1559TxData["hash"], strings.ToLower(signedEip1559Tx.Hash().Hex()))
 	}
-	if eip1559TxData["type"] != float64(2) {
+	if eip1559TxData["type"] != "0x2" {
 		t.Errorf("EIP-1559 transaction type mismatch: got %v, want 2", eip1559TxData["type"])
 	}
-	if eip1559TxData["maxFeePerGas"] == float64(0) {
-		t.Errorf("EIP-1559 transaction maxFeePerGas should not be 0")
+	if eip1559TxData["maxFeePerGas"] != "0x6fc23ac00" {
+		t.Errorf("EIP-1559 transaction maxFeePerGas mismatch: got %v", eip1559TxData["maxFeePerGas"])
 	}
-	if eip1559TxData["maxPriorityFeePerGas"] == float64(0) {
-		t.Errorf("EIP-1559 transaction maxPriorityFeePerGas should not be 0")
+	if eip1559TxData["maxPriorityFeePerGas"] != "0x77359400" {
+		t.Errorf("EIP-1559 transaction maxPriorityFeePerGas mismatch: got %v", eip1559TxData["maxPriorityFeePerGas"])
+	}
+	from := strings.ToLower(crypto.PubkeyToAddress(privateKey.PublicKey).Hex())
+	for i, txData := range txsData {
+		if txData["from"] != from {
+			t.Errorf("Transaction %d sender mismatch: got %v, want %s", i, txData["from"], from)
+		}
+		if txData["chainId"] != "0x1" {
+			t.Errorf("Transaction %d chain id mismatch: got %v", i, txData["chainId"])
+		}
+		for _, field := range []string{"v", "r", "s"} {
+			if _, ok := txData[field].(string); !ok {
+				t.Errorf("Transaction %d signature value %s missing", i, field)
+			}
+		}
 	}
 
 	t.Logf("Successfully stored and verified transaction data for %d transactions", len(txsData))
 }
+
+func TestStoreBlockReorg(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	// Create two competing blocks at the same height
+	var (
+		number = big.NewInt(1)
+		logs   = []*types.Log{{
+			Address: common.HexToAddress("0x1234567890"),
+			Topics:  []common.Hash{common.HexToHash("0xabcdef")},
+			Data:    []byte("reorged log"),
+		}}
+		blockA = types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte("a")})
+		blockB = types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte("b")})
+	)
+	if err := store.StoreBlock(blockA, logs, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block A: %v", err)
+	}
+	// Reorg A out and B in
+	if err := store.RemoveBlock(blockA, logs); err != nil {
+		t.Fatalf("Failed to remove block A: %v", err)
+	}
+	if err := store.StoreBlock(blockB, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block B: %v", err)
+	}
+	// The canonical pointer and the number key must point to B
+	canonical, err := store.GetCanonicalHash(number.Uint64())
+	if err != nil {
+		t.Fatalf("Failed to get canonical hash: %v", err)
+	}
+	if canonical != blockB.Hash() {
+		t.Errorf("Canonical hash mismatch: have %x, want %x", canonical, blockB.Hash())
+	}
+	fields, err := store.GetBlockFieldsByNumber(number.Uint64(), "hash")
+	if err != nil {
+		t.Fatalf("Failed to get canonical block: %v", err)
+	}
+	if fields["hash"] != strings.ToLower(blockB.Hash().Hex()) {
+		t.Errorf("Canonical block mismatch: have %s, want %x", fields["hash"], blockB.Hash())
+	}
+	// Block A must still be retrievable by hash as a non-canonical sibling
+	fields, err = store.GetBlockFields(blockA.Hash(), "hash", "canonical")
+	if err != nil {
+		t.Fatalf("Failed to get sibling block: %v", err)
+	}
+	if fields["hash"] != strings.ToLower(blockA.Hash().Hex()) || fields["canonical"] != "0" {
+		t.Errorf("Sibling block mismatch: have %v", fields)
+	}
+	// The logs of A must be recorded as removed
+	removed, err := store.GetRemovedLogs(blockA.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get removed logs: %v", err)
+	}
+	if len(removed) != 1 || !removed[0].Removed {
+		t.Errorf("Removed logs mismatch: have %v", removed)
+	}
+}
+
+func TestStoreReceipts(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	key, _ := crypto.GenerateKey()
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	tx := types.MustSignNewTx(key, signer, &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Gas:       53000,
+		GasFeeCap: big.NewInt(2000000000),
+		GasTipCap: big.NewInt(1000000000),
+		Data:      []byte{0x60, 0x00},
+	})
+	from, _ := types.Sender(signer, tx)
+	receipt := &types.Receipt{
+		Type:              types.DynamicFeeTxType,
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 53000,
+		GasUsed:           53000,
+		EffectiveGasPrice: big.NewInt(1500000000),
+		ContractAddress:   crypto.CreateAddress(from, 0),
+		TxHash:            tx.Hash(),
+		Logs:              []*types.Log{},
+	}
+	header := &types.Header{
+		Number:  big.NewInt(1),
+		BaseFee: big.NewInt(500000000),
+	}
+	block := types.NewBlock(header, &types.Body{Transactions: []*types.Transaction{tx}}, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+
+	if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block: %v", err)
+	}
+	if err := store.StoreReceipts(block, types.Receipts{receipt}, signer); err != nil {
+		t.Fatalf("Failed to store receipts: %v", err)
+	}
+	blob, err := store.GetTxReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("Failed to decode receipt: %v", err)
+	}
+	want := map[string]interface{}{
+		"status":            "0x1",
+		"gasUsed":           "0xcf08",
+		"cumulativeGasUsed": "0xcf08",
+		"effectiveGasPrice": "0x59682f00",
+		"contractAddress":   strings.ToLower(receipt.ContractAddress.Hex()),
+		"from":              strings.ToLower(from.Hex()),
+		"transactionHash":   tx.Hash().Hex(),
+	}
+	for name, value := range want {
+		if have, _ := fields[name].(string); strings.ToLower(have) != strings.ToLower(value.(string)) {
+			t.Errorf("Receipt field %s mismatch: have %v, want %v", name, fields[name], value)
+		}
+	}
+	blob, err = store.GetReceipts(block.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get block receipts: %v", err)
+	}
+	var list []map[string]interface{}
+	if err := json.Unmarshal(blob, &list); err != nil || len(list) != 1 {
+		t.Fatalf("Failed to decode block receipts: %v, %d items", err, len(list))
+	}
+}
+
+func TestStoreTypedTransactions(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	txMgr := NewTxManager(store)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		signer = types.LatestSignerForChainID(params.TestChainConfig.ChainID)
+		huge   = new(big.Int).Lsh(big.NewInt(1), 80) // beyond 64 bits
+		to     = common.HexToAddress("0x1234567890abcdef")
+	)
+	signed, err := types.SignSetCode(key, types.SetCodeAuthorization{ChainID: *uint256.NewInt(1), Address: to, Nonce: 6})
+	if err != nil {
+		t.Fatalf("Failed to sign authorization: %v", err)
+	}
+	blobTx := types.MustSignNewTx(key, signer, &types.BlobTx{
+		ChainID:    uint256.MustFromBig(params.TestChainConfig.ChainID),
+		To:         to,
+		Value:      uint256.MustFromBig(huge),
+		Gas:        21000,
+		GasFeeCap:  uint256.MustFromBig(huge),
+		GasTipCap:  uint256.NewInt(1),
+		BlobFeeCap: uint256.NewInt(7),
+		BlobHashes: []common.Hash{{0x01, 0xaa}},
+	})
+	setCodeTx := types.MustSignNewTx(key, signer, &types.SetCodeTx{
+		ChainID:   uint256.MustFromBig(params.TestChainConfig.ChainID),
+		Nonce:     1,
+		To:        to,
+		Gas:       50000,
+		GasFeeCap: uint256.NewInt(2),
+		GasTipCap: uint256.NewInt(1),
+		AuthList:  []types.SetCodeAuthorization{{ChainID: *uint256.NewInt(1), Address: to, Nonce: 5}, signed},
+	})
+	block := types.NewBlock(&types.Header{
+		Number:  big.NewInt(1),
+		BaseFee: big.NewInt(1),
+	}, &types.Body{Transactions: []*types.Transaction{blobTx, setCodeTx}}, nil, trie.NewStackTrie(nil))
+
+	// Block transactions are stored in the RPC format without truncation
+	if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block: %v", err)
+	}
+	fields, err := store.GetBlockFields(block.Hash(), "txs", "schema_version")
+	if err != nil {
+		t.Fatalf("Failed to get block fields: %v", err)
+	}
+	if fields["schema_version"] != fmt.Sprint(SchemaVersion) {
+		t.Errorf("Schema version mismatch: have %s, want %d", fields["schema_version"], SchemaVersion)
+	}
+	var txs []map[string]interface{}
+	if err := json.Unmarshal([]byte(fields["txs"]), &txs); err != nil {
+		t.Fatalf("Failed to parse transaction data: %v", err)
+	}
+	if have := txs[0]["value"]; have != "0x100000000000000000000" {
+		t.Errorf("Blob transaction value mismatch: have %v", have)
+	}
+	if have := txs[0]["maxFeePerBlobGas"]; have != "0x7" {
+		t.Errorf("Blob transaction blob fee cap mismatch: have %v", have)
+	}
+	if have, _ := txs[0]["blobVersionedHashes"].([]interface{}); len(have) != 1 {
+		t.Errorf("Blob transaction blob hashes mismatch: have %v", have)
+	}
+	if have, _ := txs[1]["authorizationList"].([]interface{}); len(have) != 2 {
+		t.Errorf("Set code transaction authorizations mismatch: have %v", have)
+	}
+
+	// The block is reconstructed in full from the stored fields
+	stored, err := store.GetBlock(block.Hash())
+	if err != nil || stored == nil {
+		t.Fatalf("Failed to get block: %v", err)
+	}
+	if stored.Hash() != block.Hash() || len(stored.Transactions()) != 2 {
+		t.Fatalf("Block mismatch: have %x with %d txs, want %x", stored.Hash(), len(stored.Transactions()), block.Hash())
+	}
+	for i, tx := range stored.Transactions() {
+		if tx.Hash() != block.Transactions()[i].Hash() {
+			t.Errorf("Transaction %d mismatch: have %x, want %x", i, tx.Hash(), block.Transactions()[i].Hash())
+		}
+	}
+	// Pending transactions are stored with decimal quantities
+	for _, tx := range []*types.Transaction{blobTx, setCodeTx} {
+		if err := txMgr.storeTxSync(tx); err != nil {
+			t.Fatalf("Failed to store transaction: %v", err)
+		}
+	}
+	blobFields, _ := store.client.HGetAll(store.ctx, store.keys.txKey(blobTx.Hash())).Result()
+	want := map[string]string{
+		"schema_version":   fmt.Sprint(SchemaVersion),
+		"type":             "3",
+		"chainId":          params.TestChainConfig.ChainID.String(),
+		"value":            huge.String(),
+		"maxFeePerGas":     huge.String(),
+		"maxFeePerBlobGas": "7",
+		"from":             strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex()),
+	}
+	for name, value := range want {
+		if blobFields[name] != value {
+			t.Errorf("Blob transaction field %s mismatch: have %q, want %q", name, blobFields[name], value)
+		}
+	}
+	var hashes []common.Hash
+	if err := json.Unmarshal([]byte(blobFields["blobVersionedHashes"]), &hashes); err != nil || len(hashes) != 1 || hashes[0] != blobTx.BlobHashes()[0] {
+		t.Errorf("Blob transaction blob hashes mismatch: have %s", blobFields["blobVersionedHashes"])
+	}
+	setCodeFields, _ := store.client.HGetAll(store.ctx, store.keys.txKey(setCodeTx.Hash())).Result()
+	var auths []types.SetCodeAuthorization
+	if err := json.Unmarshal([]byte(setCodeFields["authorizationList"]), &auths); err != nil || len(auths) != 2 || auths[0].Nonce != 5 {
+		t.Errorf("Set code transaction authorizations mismatch: have %s", setCodeFields["authorizationList"])
+	}
+	// Only the signed authorization has a recoverable authority
+	var authorities []*common.Address
+	if err := json.Unmarshal([]byte(setCodeFields["authorities"]), &authorities); err != nil || len(authorities) != 2 ||
+		authorities[0] != nil || authorities[1] == nil || *authorities[1] != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("Set code transaction authorities mismatch: have %s", setCodeFields["authorities"])
+	}
+}
+
+func TestTxManagerCloseDrains(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	txMgr := NewTxManager(store)
+
+	// Queue up transactions before the workers run, then close
+	key, _ := crypto.GenerateKey()
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	var hashes []common.Hash
+	for i := 0; i < 100; i++ {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: uint64(i), Gas: 21000, GasPrice: big.NewInt(1)})
+		if err := txMgr.StoreTx(tx); err != nil {
+			t.Fatalf("Failed to queue transaction: %v", err)
+		}
+		hashes = append(hashes, tx.Hash())
+	}
+	if err := txMgr.Init(); err != nil {
+		t.Fatalf("Failed to start transaction manager: %v", err)
+	}
+	txMgr.Close()
+
+	for _, hash := range hashes {
+		if tx, err := txMgr.GetTx(hash); err != nil || tx == nil {
+			t.Fatalf("Queued transaction %x lost on close: %v", hash, err)
+		}
+	}
+	txMgr.RemoveTxs(hashes)
+}
+
+// Tests that a transaction whose write is rejected leaves nothing behind, and is
+// not considered stored until written successfully.
+func TestTxManagerFailedWrite(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	txMgr := NewTxManager(store)
+
+	var (
+		key, _ = crypto.GenerateKey()
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.LatestSignerForChainID(big.NewInt(1))
+		tx     = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 21000, GasPrice: big.NewInt(1)})
+	)
+	// A newer exporter published meanwhile, fencing off the writes of the store
+	store.client.Set(store.ctx, store.keys.streamFenceKey(), 2, 0)
+	store.SetFence(1)
+
+	if err := txMgr.storeTxSync(tx); !errors.Is(err, errFenced) {
+		t.Fatalf("Fenced write error mismatch: have %v, want %v", err, errFenced)
+	}
+	if txMgr.dupCache.contains(tx.Hash()) {
+		t.Errorf("Transaction cached as stored after failed write")
+	}
+	for _, key := range []string{store.keys.txKey(tx.Hash()), store.keys.addrPendingKey(sender), store.keys.txHistoryKey(tx.Hash())} {
+		if n, _ := store.client.Exists(store.ctx, key).Result(); n != 0 {
+			t.Errorf("Key %s left by failed write", key)
+		}
+	}
+	// Once the write succeeds, the transaction is stored and cached
+	store.SetFence(0)
+	if err := txMgr.storeTxSync(tx); err != nil {
+		t.Fatalf("Failed to store transaction: %v", err)
+	}
+	if !txMgr.dupCache.contains(tx.Hash()) {
+		t.Errorf("Transaction not cached as stored")
+	}
+	if stored, err := txMgr.GetTx(tx.Hash()); err != nil || stored == nil {
+		t.Errorf("Transaction not stored: %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+	store.SetTTL(0)
+
+	var (
+		now    = time.Now()
+		number = uint64(1)
+		old    = types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number), Time: uint64(now.Add(-2 * time.Hour).Unix())})
+		recent = types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number + 1), Time: uint64(now.Unix())})
+	)
+	for _, block := range []*types.Block{old, recent} {
+		if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+			t.Fatalf("Failed to store block: %v", err)
+		}
+	}
+	numbers, err := store.BlockNumbers()
+	if err != nil {
+		t.Fatalf("Failed to list blocks: %v", err)
+	}
+	if !slices.Contains(numbers, number) || !slices.Contains(numbers, number+1) {
+		t.Fatalf("Stored blocks missing from listing")
+	}
+	if _, _, err := store.Purge(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if hash, _ := store.GetCanonicalHash(number); hash != (common.Hash{}) {
+		t.Errorf("Old block not purged")
+	}
+	if fields, _ := store.GetBlockFields(old.Hash()); len(fields) != 0 {
+		t.Errorf("Old block still reachable by hash: %v", fields)
+	}
+	if hash, _ := store.GetCanonicalHash(number + 1); hash != recent.Hash() {
+		t.Errorf("Recent block purged")
+	}
+	store.Purge(now.Add(time.Hour))
+}
@@ -0,0 +1,230 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Names of the event streams published for every chain.
+const (
+	BlocksStream     = "blocks"     // New canonical blocks
+	LogsStream       = "logs"       // Logs of new canonical blocks, and removed logs of reorged ones
+	PendingTxsStream = "pendingTxs" // Transactions entering the mempool mirror
+	DroppedTxsStream = "droppedTxs" // Transactions leaving the mempool mirror without being mined
+	ReorgsStream     = "reorgs"     // Chain reorganisations
+	StateDiffsStream = "stateDiffs" // State diffs of new canonical blocks, and rollbacks of reorged ones
+)
+
+var redisStreamMeter = metrics.NewRegisteredMeter("redis/stream/entries", nil)
+
+// publishScript atomically assigns the next value of the chain's cursor to a
+// stream entry and appends it, so that cursors are strictly increasing both
+// within a stream and across all streams of a chain. Fenced entries are
+// rejected if a newer fencing token published before.
+//
+//	KEYS[1]  cursor key
+//	KEYS[2]  stream key
+//	KEYS[3]  stream fence key
+//	ARGV[1]  fencing token, 0 if unfenced
+//	ARGV[2]  maximum stream length, 0 for no trimming
+//	ARGV[3:] entry field/value pairs
+const publishScript = `
+local token = tonumber(ARGV[1])
+if token > 0 then
+	local fence = tonumber(redis.call('GET', KEYS[3]) or 0)
+	if fence > token then
+		return redis.error_reply('FENCED ' .. fence)
+	end
+	if fence < token then
+		redis.call('SET', KEYS[3], token)
+	end
+end
+local cursor = redis.call('INCR', KEYS[1])
+local args = {'XADD', KEYS[2]}
+local maxlen = tonumber(ARGV[2])
+if maxlen > 0 then
+	table.insert(args, 'MAXLEN')
+	table.insert(args, '~')
+	table.insert(args, maxlen)
+end
+table.insert(args, '*')
+table.insert(args, 'cursor')
+table.insert(args, cursor)
+for i = 3, #ARGV do
+	table.insert(args, ARGV[i])
+end
+redis.call(unpack(args))
+return cursor
+`
+
+// StreamKey returns the key of the named event stream of a chain, stored under
+// the given key prefix. The streams and the cursor of a chain are hash tagged
+// with the chain id, keeping them in one cluster slot for publishScript.
+func StreamKey(prefix string, chainID *big.Int, name string) string {
+	return fmt.Sprintf("%sstream:{%s}:%s", prefix, chainID, name)
+}
+
+// streamKey returns the key of the named event stream of the chain.
+func (k keyspace) streamKey(name string) string {
+	return StreamKey(k.prefix, k.chainID, name)
+}
+
+// streamCursorKey returns the key of the event cursor shared by all streams of
+// a chain.
+func (k keyspace) streamCursorKey() string {
+	return fmt.Sprintf("%sstream:{%s}:cursor", k.prefix, k.chainID)
+}
+
+// streamFenceKey returns the key of the highest fencing token that published to
+// the streams of a chain.
+func (k keyspace) streamFenceKey() string {
+	return fmt.Sprintf("%sstream:{%s}:fence", k.prefix, k.chainID)
+}
+
+// publish appends an entry with the given field/value pairs to the named stream
+// of the store's chain.
+func (s *RedisBlockStore) publish(name string, values ...interface{}) error {
+	return s.publishFenced(s.fence(), name, values...)
+}
+
+// publishFenced appends an entry to the named stream of the store's chain,
+// checked against the given fencing token, 0 for none.
+func (s *RedisBlockStore) publishFenced(token uint64, name string, values ...interface{}) error {
+	keys := []string{s.keys.streamCursorKey(), s.keys.streamKey(name), s.keys.streamFenceKey()}
+	args := append([]interface{}{token, s.config.StreamMaxLen}, values...)
+	if err := s.client.Eval(s.ctx, publishScript, keys, args...).Err(); err != nil {
+		redisErrorCounter.Inc(1)
+		return fmt.Errorf("failed to publish %s event: %w", name, fencedError(err))
+	}
+	redisStreamMeter.Mark(1)
+	return nil
+}
+
+// queueEvent adds an entry with the given field/value pairs for the named stream
+// of the store's chain to a batch of writes to the chain's slot.
+func (s *RedisBlockStore) queueEvent(batch *slotBatch, name string, values ...interface{}) {
+	cursor, stream := s.keys.streamCursorKey(), s.keys.streamKey(name)
+
+	batch.fence(s.keys.streamFenceKey(), 0)
+	batch.keys = append(batch.keys, cursor)
+	batch.add(stream, append([]interface{}{"XPUBLISH", cursor, stream, s.config.StreamMaxLen}, values...)...)
+}
+
+// blockEvent returns the fields of the entry announcing a new canonical block.
+func blockEvent(block *types.Block) []interface{} {
+	return []interface{}{
+		"schema_version", SchemaVersion,
+		"number", block.NumberU64(),
+		"hash", strings.ToLower(block.Hash().Hex()),
+		"parentHash", strings.ToLower(block.ParentHash().Hex()),
+		"timestamp", block.Time(),
+		"txs", len(block.Transactions()),
+	}
+}
+
+// logsEvent returns the fields of the entry announcing the logs of a block, in
+// the uncompressed JSON format of eth_getLogs. Logs of blocks dropped by a reorg
+// are expected to be flagged as removed already.
+func logsEvent(block *types.Block, logs []*types.Log, removed bool) ([]interface{}, error) {
+	blob, err := json.Marshal(logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode logs: %v", err)
+	}
+	return []interface{}{
+		"number", block.NumberU64(),
+		"hash", strings.ToLower(block.Hash().Hex()),
+		"removed", removed,
+		"logs", blob,
+	}, nil
+}
+
+// publishLogs announces the logs of a block. Nothing is published for blocks
+// without logs.
+func (s *RedisBlockStore) publishLogs(block *types.Block, logs []*types.Log, removed bool) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	values, err := logsEvent(block, logs, removed)
+	if err != nil {
+		return err
+	}
+	return s.publish(LogsStream, values...)
+}
+
+// PublishReorg announces a chain reorganisation, before the dropped blocks are
+// removed and the new ones stored. Dropped headers are expected in descending,
+// added ones in ascending order.
+func (s *RedisBlockStore) PublishReorg(dropped, added []*types.Header) error {
+	if len(dropped) == 0 {
+		return nil
+	}
+	var (
+		oldHead  = dropped[0]
+		ancestor = dropped[len(dropped)-1].Number.Uint64() - 1
+		newHash  common.Hash
+		newNum   = ancestor
+	)
+	if len(added) > 0 {
+		newHash, newNum = added[len(added)-1].Hash(), added[len(added)-1].Number.Uint64()
+	}
+	return s.publish(ReorgsStream,
+		"ancestor", ancestor,
+		"oldNumber", oldHead.Number.Uint64(),
+		"oldHash", strings.ToLower(oldHead.Hash().Hex()),
+		"newNumber", newNum,
+		"newHash", strings.ToLower(newHash.Hex()),
+		"dropped", len(dropped),
+		"added", len(added),
+	)
+}
+
+// pendingTxEvent returns the fields of the entry announcing a transaction
+// entering the mempool mirror.
+func pendingTxEvent(tx *types.Transaction, stored *StoredTransaction, status string) []interface{} {
+	return []interface{}{
+		"hash", strings.ToLower(tx.Hash().Hex()),
+		"from", strings.ToLower(stored.From.Hex()),
+		"nonce", tx.Nonce(),
+		"type", tx.Type(),
+		"status", status,
+		"timestamp", stored.Timestamp,
+		"peer", stored.Peer,
+		"source", stored.Source,
+	}
+}
+
+// droppedTxEvent returns the fields of the entry announcing a transaction leaving
+// the mempool mirror without being mined, either replaced or dropped.
+func droppedTxEvent(hash common.Hash, tr *TxTransition) []interface{} {
+	return []interface{}{
+		"hash", strings.ToLower(hash.Hex()),
+		"status", tr.Status,
+		"reason", tr.Reason,
+		"by", lowerHex(tr.By),
+		"timestamp", tr.Time,
+	}
+}
+
+// publishDroppedTx announces a transaction leaving the mempool mirror without
+// being mined.
+func (s *RedisBlockStore) publishDroppedTx(hash common.Hash, tr *TxTransition) error {
+	return s.publish(DroppedTxsStream, droppedTxEvent(hash, tr)...)
+}
+
+// CreateStreamGroup creates a consumer group on every stream of the store's
+// chain, delivering all entries still retained. Existing groups are left as is.
+func (s *RedisBlockStore) CreateStreamGroup(group string) error {
+	for _, name := range []string{BlocksStream, LogsStream, PendingTxsStream, DroppedTxsStream, ReorgsStream, StateDiffsStream} {
+		err := s.client.XGroupCreateMkStream(s.ctx, s.keys.streamKey(name), group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group %s on %s: %v", group, name, err)
+		}
+	}
+	return nil
+}
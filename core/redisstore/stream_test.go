@@ -0,0 +1,140 @@
+package redisstore
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/go-redis/redis/v8"
+)
+
+// Tests that chain events are published to their streams with a cursor that is
+// strictly increasing in publishing order across all streams.
+func TestStreamPublish(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	var (
+		number = big.NewInt(1)
+		logs   = []*types.Log{{
+			Address: common.HexToAddress("0x1234567890"),
+			Topics:  []common.Hash{common.HexToHash("0xabcdef")},
+			Data:    []byte("streamed log"),
+		}}
+		blockA = types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte("a")})
+		blockB = types.NewBlockWithHeader(&types.Header{Number: number, Extra: []byte("b")})
+	)
+	if err := store.StoreBlock(blockA, logs, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block A: %v", err)
+	}
+	if err := store.PublishReorg([]*types.Header{blockA.Header()}, []*types.Header{blockB.Header()}); err != nil {
+		t.Fatalf("Failed to publish reorg: %v", err)
+	}
+	if err := store.RemoveBlock(blockA, logs); err != nil {
+		t.Fatalf("Failed to remove block A: %v", err)
+	}
+	if err := store.StoreBlock(blockB, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block B: %v", err)
+	}
+	// Check the contents of every stream, collecting the cursors
+	cursors := make(map[string][]int)
+	read := func(name string, want int) []redis.XMessage {
+		t.Helper()
+		msgs, err := store.client.XRange(store.ctx, store.keys.streamKey(name), "-", "+").Result()
+		if err != nil {
+			t.Fatalf("Failed to read %s stream: %v", name, err)
+		}
+		if len(msgs) != want {
+			t.Fatalf("%s stream length mismatch: have %d, want %d", name, len(msgs), want)
+		}
+		for _, msg := range msgs {
+			cursor, err := strconv.Atoi(msg.Values["cursor"].(string))
+			if err != nil {
+				t.Fatalf("Invalid cursor in %s stream: %v", name, msg.Values)
+			}
+			cursors[name] = append(cursors[name], cursor)
+		}
+		return msgs
+	}
+	blocks := read(BlocksStream, 2)
+	if blocks[0].Values["hash"] != blockA.Hash().Hex() || blocks[1].Values["hash"] != blockB.Hash().Hex() {
+		t.Errorf("Block events mismatch: have %v", blocks)
+	}
+	logged := read(LogsStream, 2)
+	if logged[0].Values["removed"] != "0" || logged[1].Values["removed"] != "1" {
+		t.Errorf("Log events mismatch: have %v", logged)
+	}
+	reorgs := read(ReorgsStream, 1)
+	if reorgs[0].Values["oldHash"] != blockA.Hash().Hex() || reorgs[0].Values["newHash"] != blockB.Hash().Hex() {
+		t.Errorf("Reorg event mismatch: have %v", reorgs[0].Values)
+	}
+	// Block A with its logs, the reorg, the removed logs and block B
+	want := map[string][]int{
+		BlocksStream: {1, 5},
+		LogsStream:   {2, 4},
+		ReorgsStream: {3},
+	}
+	for name, seq := range want {
+		if len(cursors[name]) != len(seq) {
+			t.Fatalf("%s cursors mismatch: have %v, want %v", name, cursors[name], seq)
+		}
+		for i := range seq {
+			if cursors[name][i] != seq[i] {
+				t.Errorf("%s cursors mismatch: have %v, want %v", name, cursors[name], seq)
+				break
+			}
+		}
+	}
+}
+
+// Tests that consumer groups created on the streams deliver retained entries.
+func TestStreamGroup(t *testing.T) {
+	store := newTestStore(t, testConfig())
+	defer store.Close()
+
+	store.SetChainID(params.TestChainConfig.ChainID)
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	if err := store.StoreBlock(block, nil, params.TestChainConfig); err != nil {
+		t.Fatalf("Failed to store block: %v", err)
+	}
+	if err := store.CreateStreamGroup("indexer"); err != nil {
+		t.Fatalf("Failed to create consumer group: %v", err)
+	}
+	if err := store.CreateStreamGroup("indexer"); err != nil {
+		t.Fatalf("Failed to recreate consumer group: %v", err)
+	}
+	streams, err := store.client.XReadGroup(store.ctx, &redis.XReadGroupArgs{
+		Group:    "indexer",
+		Consumer: "test",
+		Streams:  []string{store.keys.streamKey(BlocksStream), ">"},
+		Count:    10,
+		Block:    -1,
+	}).Result()
+	if err != nil {
+		t.Fatalf("Failed to read consumer group: %v", err)
+	}
+	if len(streams) != 1 || len(streams[0].Messages) != 1 {
+		t.Fatalf("Consumer group delivery mismatch: have %v", streams)
+	}
+	if hash := streams[0].Messages[0].Values["hash"]; hash != block.Hash().Hex() {
+		t.Errorf("Delivered block mismatch: have %v, want %x", hash, block.Hash())
+	}
+	// The group exists on every stream, including those without entries yet
+	for _, name := range []string{LogsStream, PendingTxsStream, DroppedTxsStream, ReorgsStream, StateDiffsStream} {
+		err := store.client.XReadGroup(store.ctx, &redis.XReadGroupArgs{
+			Group:    "indexer",
+			Consumer: "test",
+			Streams:  []string{store.keys.streamKey(name), ">"},
+			Block:    -1,
+		}).Err()
+		if err != nil && err != redis.Nil {
+			t.Errorf("Failed to read consumer group on %s: %v", name, err)
+		}
+	}
+}
@@ -2,27 +2,34 @@ package redisstore
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/core/redisstore/client"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
-	"github.com/go-redis/redis/v8"
 )
 
 var (
 	redisTxStoreTimer   = metrics.NewRegisteredTimer("redis/txstore", nil)
 	redisTxErrorCounter = metrics.NewRegisteredCounter("redis/txerrors", nil)
 	redisTxQueueSize    = metrics.NewRegisteredGauge("redis/txqueue", nil)
+	redisTxDroppedMeter = metrics.NewRegisteredMeter("redis/txdropped", nil)
 )
 
+// errTxQueueFull is returned if a transaction could not be queued for storage.
+var errTxQueueFull = errors.New("redis transaction queue full")
+
 // StoredTransaction represents a transaction stored in Redis
 type StoredTransaction struct {
 	Hash        common.Hash     `json:"hash"`
@@ -38,13 +45,15 @@ type StoredTransaction struct {
 	TxIndex     uint            `json:"transactionIndex"`
 	RawData     string          `json:"rawData"`
 	Timestamp   uint64          `json:"timestamp"`
-	Status      uint64          `json:"status"`
+	Status      string          `json:"status"`
+	Peer        string          `json:"peer"`
+	Source      string          `json:"source"`
 }
 
 // TxManager handles high-performance transaction storage
 type TxManager struct {
 	store  *RedisBlockStore
-	client *redis.Client
+	client Backend
 	ctx    context.Context
 
 	// Worker pool
@@ -53,17 +62,35 @@ type TxManager struct {
 	wg       sync.WaitGroup
 	shutdown chan struct{}
 
-	// Duplicate cache (simple map for now, could use Ristretto)
-	dupCache map[common.Hash]bool
-	dupMutex sync.RWMutex
+	// Disk spool of writes that failed to reach Redis
+	spool *spool
+
+	// Transaction pool being mirrored, nil if only driven externally
+	pool TxPool
+
+	// Transactions known to be stored in Redis
+	dupCache *dupCache
+
+	// First arrivals of recently received transactions
+	arrivals *arrivalCache
+
+	// Simulator of pending transactions, nil if disabled
+	sim *simulator
+
+	// Lifecycle tracking of the transactions currently in the pool
+	live     map[common.Hash]*liveTx
+	slots    map[txSlot]common.Hash
+	mined    map[common.Hash]uint64 // Recently mined transactions and their block numbers
+	touched  map[common.Address]int // Senders of mined transactions, with the refreshes left
+	liveLock sync.Mutex
 
 	// Current blockchain number cache
 	currentBlockNumber uint64
 	blockNumberMutex   sync.RWMutex
 
 	// Metrics
-	processed uint64
-	errors    uint64
+	processed atomic.Uint64 // Transactions written
+	errors    atomic.Uint64 // Writes that failed and were spooled
 }
 
 // NewTxManager creates a new transaction manager
@@ -78,7 +105,13 @@ func NewTxManager(store *RedisBlockStore) *TxManager {
 		workers:            10,                                  // Configurable worker pool size
 		txQueue:            make(chan *types.Transaction, 1000), // Buffered channel
 		shutdown:           make(chan struct{}),
-		dupCache:           make(map[common.Hash]bool),
+		spool:              newSpool(store.config.Spool),
+		dupCache:           newDupCache(dupCacheSize, mclock.System{}),
+		arrivals:           newArrivalCache(),
+		live:               make(map[common.Hash]*liveTx),
+		slots:              make(map[txSlot]common.Hash),
+		mined:              make(map[common.Hash]uint64),
+		touched:            make(map[common.Address]int),
 		currentBlockNumber: 0, // Initialize to 0, will be updated when blocks are processed
 	}
 
@@ -88,32 +121,19 @@ func NewTxManager(store *RedisBlockStore) *TxManager {
 	return txManager
 }
 
-// loadExistingTxHashes loads existing transaction hashes from Redis to prevent duplicates
-func (tm *TxManager) loadExistingTxHashes() error {
-	// Use SCAN to iterate through all tx:* keys
-	iter := tm.client.Scan(tm.ctx, 0, "tx:*", 1000).Iterator()
-	loaded := 0
-
-	for iter.Next(tm.ctx) {
-		key := iter.Val()
-		// Extract hash from key (format: "tx:0x...")
-		if len(key) > 3 {
-			hashStr := key[3:]                                          // Remove "tx:" prefix
-			if len(hashStr) == 66 && strings.HasPrefix(hashStr, "0x") { // Valid hex hash length with 0x prefix
-				hash := common.HexToHash(hashStr)
-				tm.dupMutex.Lock()
-				tm.dupCache[hash] = true
-				tm.dupMutex.Unlock()
-				loaded++
-			}
-		}
-	}
+// txKey returns the key of a mirrored pool transaction.
+func (k keyspace) txKey(hash common.Hash) string {
+	return fmt.Sprintf("%stx:%s", k.prefix, hash.Hex())
+}
 
-	if err := iter.Err(); err != nil {
-		return fmt.Errorf("failed to scan transaction keys: %v", err)
+// txHash extracts the hash of a mirrored pool transaction from its key,
+// reporting false for keys of anything else.
+func (k keyspace) txHash(key string) (common.Hash, bool) {
+	hex, ok := strings.CutPrefix(key, k.prefix+"tx:")
+	if !ok || len(hex) != 66 || !strings.HasPrefix(hex, "0x") {
+		return common.Hash{}, false
 	}
-
-	return nil
+	return common.HexToHash(hex), true
 }
 
 // Init initializes the transaction manager
@@ -124,9 +144,9 @@ func (tm *TxManager) Init() error {
 		return fmt.Errorf("Redis connection failed: %v", err)
 	}
 
-	// Load existing transaction hashes from Redis to prevent duplicates
-	if err := tm.loadExistingTxHashes(); err != nil {
-		log.Warn("Failed to load existing transaction hashes", "err", err)
+	// Open the spool, retaining failed writes of a previous run for replay
+	if err := tm.spool.open(); err != nil {
+		log.Warn("Failed to open Redis spool", "path", tm.spool.path, "err", err)
 	}
 
 	// Start worker goroutines
@@ -138,25 +158,30 @@ func (tm *TxManager) Init() error {
 	return nil
 }
 
-// StoreTx stores a transaction (async if queue has space, sync if full)
+// SetPool sets the transaction pool being mirrored, used to reconcile the mirror
+// with the pool contents and to retrieve blob sidecars.
+func (tm *TxManager) SetPool(pool TxPool) {
+	tm.pool = pool
+}
+
+// StoreTx queues a transaction that became pending in the pool for storage. If
+// the queue is full, the transaction is dropped and errTxQueueFull returned.
 func (tm *TxManager) StoreTx(tx *types.Transaction) error {
 	// Check for duplicates
-	tm.dupMutex.RLock()
-	if tm.dupCache[tx.Hash()] {
-		tm.dupMutex.RUnlock()
+	if tm.statusOf(tx.Hash()) == TxStatusPending {
 		return nil // Already processed
 	}
-	tm.dupMutex.RUnlock()
 
-	// Try async first
+	// Queue the transaction, never blocking the caller
 	select {
 	case tm.txQueue <- tx:
 		// Successfully queued
 		redisTxQueueSize.Update(int64(len(tm.txQueue)))
 		return nil
 	default:
-		// Queue full, process synchronously
-		return tm.storeTxSync(tx)
+		// Queue full, drop the transaction rather than stall the pool
+		redisTxDroppedMeter.Mark(1)
+		return errTxQueueFull
 	}
 }
 
@@ -167,41 +192,93 @@ func (tm *TxManager) worker(id int) {
 	for {
 		select {
 		case tx := <-tm.txQueue:
-			if err := tm.storeTxSync(tx); err != nil {
-				log.Error("Worker failed to store transaction", "worker", id, "hash", tx.Hash(), "err", err)
-			}
-			redisTxQueueSize.Update(int64(len(tm.txQueue)))
+			tm.process(id, tx)
 
 		case <-tm.shutdown:
-			return
+			// Drain the queue before exiting, so no buffered transaction is lost
+			for {
+				select {
+				case tx := <-tm.txQueue:
+					tm.process(id, tx)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
-// storeTxSync synchronously stores a transaction
+// process stores a single queued transaction.
+func (tm *TxManager) process(id int, tx *types.Transaction) {
+	if err := tm.storeTxSync(tx); err != nil {
+		tm.errors.Add(1)
+		log.Error("Worker failed to store transaction", "worker", id, "hash", tx.Hash(), "err", err)
+	}
+	redisTxQueueSize.Update(int64(len(tm.txQueue)))
+}
+
+// storeTxSync synchronously stores a transaction, spooling it to disk if Redis
+// cannot be reached.
 func (tm *TxManager) storeTxSync(tx *types.Transaction) error {
-	defer redisTxStoreTimer.UpdateSince(time.Now())
+	if err := tm.admit(tx, TxStatusPending); err != nil {
+		tm.spoolWrite(&spoolEntry{Txs: []*types.Transaction{tx}})
+		return err
+	}
+	return nil
+}
 
-	// Mark as processed in duplicate cache
-	tm.dupMutex.Lock()
-	tm.dupCache[tx.Hash()] = true
-	tm.dupMutex.Unlock()
+// spoolWrite records a failed write for later replay.
+func (tm *TxManager) spoolWrite(entry *spoolEntry) {
+	if err := tm.spool.append(entry); err != nil {
+		log.Warn("Failed to spool Redis write", "txs", len(entry.Txs), "removed", len(entry.Hashes), "err", err)
+	}
+}
 
-	// Create stored transaction with proper rawdata encoding
-	rawTxData, err := tx.MarshalBinary()
+// FlushSpool replays all writes that previously failed to reach Redis, in the
+// order they were made. An error is returned if Redis is still unreachable.
+func (tm *TxManager) FlushSpool() error {
+	done, err := tm.spool.replay(func(entry *spoolEntry) error {
+		for _, tx := range entry.Txs {
+			if err := tm.admit(tx, TxStatusPending); err != nil {
+				return err
+			}
+		}
+		return tm.removeTxs(entry.Hashes)
+	})
+	if done > 0 {
+		log.Info("Replayed Redis spool", "entries", done, "remaining", tm.spool.size())
+	}
+	return err
+}
+
+// writeTx writes a transaction with its initial pool status into Redis. All of
+// its keys and its event are written in a single batch, and the transaction is
+// only considered stored once the batch succeeded.
+func (tm *TxManager) writeTx(tx *types.Transaction, status string) error {
+	defer redisTxStoreTimer.UpdateSince(time.Now())
+
+	// Create stored transaction with proper rawdata encoding, blob sidecars
+	// are stored separately if at all
+	sidecar := tx.BlobTxSidecar()
+	rawTxData, err := tx.WithoutBlobTxSidecar().MarshalBinary()
 	if err != nil {
 		redisTxErrorCounter.Inc(1)
 		return fmt.Errorf("failed to marshal transaction: %v", err)
 	}
 
+	var (
+		arrival = tm.arrivals.get(tx)
+		now     = uint64(time.Now().Unix())
+	)
 	storedTx := &StoredTransaction{
 		Hash:      tx.Hash(),
 		Gas:       tx.Gas(),
 		Nonce:     tx.Nonce(),
 		Data:      tx.Data(),
 		RawData:   fmt.Sprintf("0x%x", rawTxData),
-		Timestamp: uint64(time.Now().Unix()),
-		Status:    0, // Pending
+		Timestamp: uint64(arrival.Time.Unix()),
+		Peer:      arrival.Peer,
+		Source:    arrival.Source,
 	}
 
 	// Handle transaction fields safely
@@ -210,56 +287,76 @@ func (tm *TxManager) storeTxSync(tx *types.Transaction) error {
 	}
 
 	storedTx.Value = tx.Value()
-
-	// Handle gas price based on transaction type
-	if tx.Type() == 2 { // EIP-1559 transaction
-		// For EIP-1559 transactions, use maxFeePerGas as gasPrice for consistency
-		if tx.GasFeeCap() != nil {
-			storedTx.GasPrice = tx.GasFeeCap()
-		} else {
-			storedTx.GasPrice = big.NewInt(0)
-		}
-	} else {
-		// Legacy transaction
-		storedTx.GasPrice = tx.GasPrice()
-	}
+	storedTx.GasPrice = tx.GasPrice() // fee cap for dynamic fee transactions
 
 	// Get sender (this might fail for some transactions)
-	chainID := tx.ChainId()
-	if chainID != nil && chainID.Cmp(big.NewInt(0)) > 0 {
-		if from, err := types.Sender(types.LatestSignerForChainID(chainID), tx); err == nil {
-			storedTx.From = from
-		}
+	if from, err := types.Sender(txSigner(tx), tx); err == nil {
+		storedTx.From = from
 	}
 
-	txKey := fmt.Sprintf("tx:%s", tx.Hash().Hex())
+	txKey := tm.store.keys.txKey(tx.Hash())
 
 	// Get current blockchain number from cache
 	tm.blockNumberMutex.RLock()
 	currentBlockNum := tm.currentBlockNumber
 	tm.blockNumberMutex.RUnlock()
 
-	// Create transaction hash with only required fields for pending transactions
+	// Create transaction hash with the common fields of all transaction types
+	v, r, sig := tx.RawSignatureValues()
 	txFields := map[string]interface{}{
-		"hash":        strings.ToLower(storedTx.Hash.Hex()),
-		"nonce":       storedTx.Nonce,
-		"from":        strings.ToLower(storedTx.From.Hex()),
-		"raw":         storedTx.RawData,
-		"gasPrice":    storedTx.GasPrice.String(),
-		"gasLimit":    storedTx.Gas,
-		"value":       storedTx.Value.String(),
-		"type":        tx.Type(),       // Add transaction type (0=Legacy, 1=AccessList, 2=DynamicFee)
-		"blockNumber": currentBlockNum, // Add current blockchain number
-	}
-
-	// Add EIP-1559 fields for Type 2 transactions
-	if tx.Type() == 2 {
-		if tx.GasFeeCap() != nil {
-			txFields["maxFeePerGas"] = tx.GasFeeCap().String()
+		"schema_version": SchemaVersion,
+		"hash":           strings.ToLower(storedTx.Hash.Hex()),
+		"type":           tx.Type(),
+		"chainId":        tx.ChainId().String(),
+		"nonce":          storedTx.Nonce,
+		"from":           strings.ToLower(storedTx.From.Hex()),
+		"raw":            storedTx.RawData,
+		"gasPrice":       storedTx.GasPrice.String(),
+		"gasLimit":       storedTx.Gas,
+		"value":          storedTx.Value.String(),
+		"v":              v.String(),
+		"r":              r.String(),
+		"s":              sig.String(),
+		"blockNumber":    currentBlockNum, // Add current blockchain number
+		"timestamp":      storedTx.Timestamp,
+		"seenMs":         arrival.Time.UnixMilli(),
+		"peer":           storedTx.Peer,
+		"source":         storedTx.Source,
+		"status":         status,
+		"statusTime":     now,
+	}
+	// Add the fields specific to the typed transactions
+	if tx.Type() != types.LegacyTxType {
+		accessList := tx.AccessList()
+		if accessList == nil {
+			accessList = types.AccessList{}
 		}
-		if tx.GasTipCap() != nil {
-			txFields["maxPriorityFeePerGas"] = tx.GasTipCap().String()
+		blob, _ := json.Marshal(accessList)
+		txFields["accessList"] = string(blob)
+	}
+	switch tx.Type() {
+	case types.DynamicFeeTxType, types.BlobTxType, types.SetCodeTxType:
+		txFields["maxFeePerGas"] = tx.GasFeeCap().String()
+		txFields["maxPriorityFeePerGas"] = tx.GasTipCap().String()
+	}
+	switch tx.Type() {
+	case types.BlobTxType:
+		blob, _ := json.Marshal(tx.BlobHashes())
+		txFields["maxFeePerBlobGas"] = tx.BlobGasFeeCap().String()
+		txFields["blobVersionedHashes"] = string(blob)
+
+	case types.SetCodeTxType:
+		auths := tx.SetCodeAuthorizations()
+		authorities := make([]*common.Address, len(auths))
+		for i, auth := range auths {
+			if addr, err := auth.Authority(); err == nil {
+				authorities[i] = &addr
+			}
 		}
+		blob, _ := json.Marshal(auths)
+		txFields["authorizationList"] = string(blob)
+		blob, _ = json.Marshal(authorities)
+		txFields["authorities"] = string(blob)
 	}
 
 	// Add 'to' field if it exists
@@ -273,115 +370,111 @@ func (tm *TxManager) storeTxSync(tx *types.Transaction) error {
 		txFields["contractAddress"] = strings.ToLower(contractAddr.Hex())
 	}
 
-	// Store transaction header data as hash fields
-	if err := tm.client.HMSet(tm.ctx, txKey, txFields).Err(); err != nil {
-		redisTxErrorCounter.Inc(1)
-		return fmt.Errorf("failed to store transaction header: %v", err)
+	// Store the transaction header as hash fields, along with its pending index
+	// entries, sidecar, history and event
+	var (
+		batch = newExportBatch()
+		age   = tm.store.config.Retention.PendingTxs.Age
+		args  = []interface{}{"HSET", txKey}
+	)
+	for field, value := range txFields {
+		args = append(args, field, value)
+	}
+	batch.writes.add(txKey, args...)
+	batch.writes.expire(txKey, age)
+
+	tm.queueIndexPendingTx(batch.writes, tx, storedTx.From)
+	if tx.Type() == types.BlobTxType && tm.store.config.BlobSidecars {
+		if sidecar == nil && tm.pool != nil {
+			if pooled := tm.pool.Get(tx.Hash()); pooled != nil {
+				sidecar = pooled.BlobTxSidecar()
+			}
+		}
+		if sidecar != nil {
+			tm.queueSidecar(batch.writes, tx.Hash(), sidecar)
+		}
 	}
+	if err := tm.queueRecord(batch.writes, tx.Hash(), &TxTransition{Status: status, Time: now}); err != nil {
+		return err
+	}
+	tm.store.queueEvent(batch.chain, PendingTxsStream, pendingTxEvent(tx, storedTx, status)...)
 
-	// Note: Removed full_data storage to optimize Redis storage
-
-	// Set TTL for transaction (10 days)
-	if err := tm.client.Expire(tm.ctx, txKey, 10*24*time.Hour).Err(); err != nil {
+	if err := tm.store.commit(batch); err != nil {
 		redisTxErrorCounter.Inc(1)
-		return fmt.Errorf("failed to set transaction TTL: %v", err)
+		return fmt.Errorf("failed to store transaction: %w", err)
 	}
+	redisStreamMeter.Mark(1)
 
-	tm.processed++
+	// Mark as processed in duplicate cache
+	tm.dupCache.add(tx.Hash(), age)
+	tm.processed.Add(1)
 	return nil
 }
 
-// UpdateTxStatus updates transaction status (mined/dropped)
-func (tm *TxManager) UpdateTxStatus(hash common.Hash, blockHash common.Hash, blockNumber uint64, txIndex uint, status uint64) error {
-	txKey := fmt.Sprintf("tx:%s", hash.Hex())
-
-	// Check if transaction exists
-	exists, err := tm.client.Exists(tm.ctx, txKey).Result()
-	if err != nil {
-		return fmt.Errorf("failed to check transaction existence: %v", err)
-	}
-	if exists == 0 {
-		return nil // Transaction not found, ignore
-	}
+// queueSidecar adds the writes storing the commitments and proofs of a blob
+// transaction's sidecar to a batch. The blobs themselves are not stored.
+func (tm *TxManager) queueSidecar(batch *slotBatch, hash common.Hash, sidecar *types.BlobTxSidecar) {
+	commitments, _ := json.Marshal(sidecar.Commitments)
+	proofs, _ := json.Marshal(sidecar.Proofs)
 
-	// Update hash fields directly
-	updateFields := map[string]interface{}{
-		"block_hash":   strings.ToLower(blockHash.Hex()),
-		"block_number": blockNumber,
-		"tx_index":     txIndex,
-		"status":       status,
-	}
+	key := tm.store.keys.blobSidecarKey(hash)
+	batch.add(key, "HSET", key, "version", sidecar.Version, "commitments", commitments, "proofs", proofs)
+	batch.expire(key, tm.store.config.Retention.PendingTxs.Age)
+}
 
-	if err := tm.client.HMSet(tm.ctx, txKey, updateFields).Err(); err != nil {
-		return fmt.Errorf("failed to update transaction fields: %v", err)
+// txSigner returns a signer able to recover the sender of the transaction
+// without knowledge of the chain config.
+func txSigner(tx *types.Transaction) types.Signer {
+	if !tx.Protected() {
+		return types.HomesteadSigner{}
 	}
-
-	// Note: No need to update full_data since it's been removed for optimization
-	return nil
+	return types.LatestSignerForChainID(tx.ChainId())
 }
 
-// GetTx retrieves a transaction from Redis hash structure
+// GetTx retrieves a transaction of the mempool mirror, or nil if it is not
+// mirrored.
 func (tm *TxManager) GetTx(hash common.Hash) (*StoredTransaction, error) {
-	txKey := fmt.Sprintf("tx:%s", hash.Hex())
-
-	// Check if transaction exists
-	exists, err := tm.client.Exists(tm.ctx, txKey).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to check transaction existence: %v", err)
-	}
-	if exists == 0 {
-		return nil, nil // Transaction not found
+	ptx, err := tm.store.reader().PoolTransaction(tm.ctx, hash)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, nil
 	}
-
-	// Get transaction fields from hash
-	fields, err := tm.client.HGetAll(tm.ctx, txKey).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transaction fields: %v", err)
-	}
-	if len(fields) == 0 {
-		return nil, nil // Transaction not found
-	}
-
-	// Parse transaction fields
-	storedTx := &StoredTransaction{
-		Hash: common.HexToHash(fields["hash"]),
-		From: common.HexToAddress(fields["from"]),
-	}
-
-	if to := fields["to"]; to != "" {
-		addr := common.HexToAddress(to)
-		storedTx.To = &addr
+		return nil, err
 	}
-
-	if nonce, err := strconv.ParseUint(fields["nonce"], 10, 64); err == nil {
-		storedTx.Nonce = nonce
-	}
-	if gas, err := strconv.ParseUint(fields["gasLimit"], 10, 64); err == nil {
-		storedTx.Gas = gas
-	}
-	if value := fields["value"]; value != "" {
-		storedTx.Value = new(big.Int)
-		storedTx.Value.SetString(value, 10)
-	}
-	if gasPrice := fields["gasPrice"]; gasPrice != "" {
-		storedTx.GasPrice = new(big.Int)
-		storedTx.GasPrice.SetString(gasPrice, 10)
+	tx := ptx.Tx
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %v", err)
 	}
-
-	return storedTx, nil
+	return &StoredTransaction{
+		Hash:      tx.Hash(),
+		From:      ptx.From,
+		To:        tx.To(),
+		Value:     tx.Value(),
+		Gas:       tx.Gas(),
+		GasPrice:  tx.GasPrice(),
+		Nonce:     tx.Nonce(),
+		Data:      tx.Data(),
+		RawData:   fmt.Sprintf("0x%x", raw),
+		Timestamp: uint64(ptx.Seen.Unix()),
+		Status:    ptx.Status,
+		Peer:      ptx.Peer,
+		Source:    ptx.Source,
+	}, nil
 }
 
-// Close shuts down the transaction manager
+// Close shuts down the transaction manager once all queued transactions are
+// stored or spooled.
 func (tm *TxManager) Close() error {
 	close(tm.shutdown)
 	tm.wg.Wait()
 
 	log.Info("Redis transaction manager closed",
-		"processed", tm.processed,
-		"errors", tm.errors,
-		"queue_remaining", len(tm.txQueue))
+		"processed", tm.processed.Load(),
+		"errors", tm.errors.Load(),
+		"spooled", tm.spool.size())
 
-	return nil
+	return tm.spool.close()
 }
 
 // UpdateCurrentBlockNumber updates the cached current blockchain number
@@ -403,83 +496,97 @@ func (tm *TxManager) GetCurrentBlockNumber() uint64 {
 
 // Stats returns transaction manager statistics
 func (tm *TxManager) Stats() map[string]interface{} {
-	tm.dupMutex.RLock()
-	cacheSize := len(tm.dupCache)
-	tm.dupMutex.RUnlock()
+	cacheSize, hits, misses := tm.dupCache.stats()
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
 
 	tm.blockNumberMutex.RLock()
 	currentBlock := tm.currentBlockNumber
 	tm.blockNumberMutex.RUnlock()
 
 	return map[string]interface{}{
-		"processed":            tm.processed,
-		"errors":               tm.errors,
+		"processed":            tm.processed.Load(),
+		"errors":               tm.errors.Load(),
 		"queue_size":           len(tm.txQueue),
 		"cache_size":           cacheSize,
+		"cache_hits":           hits,
+		"cache_misses":         misses,
+		"cache_hit_rate":       hitRate,
 		"workers":              tm.workers,
 		"current_block_number": currentBlock,
 	}
 }
 
-// RemoveTx removes a transaction from Redis
-func (tm *TxManager) RemoveTx(hash common.Hash) error {
-	txKey := fmt.Sprintf("tx:%s", hash.Hex())
-
-	// Remove from duplicate cache
-	tm.dupMutex.Lock()
-	delete(tm.dupCache, hash)
-	tm.dupMutex.Unlock()
+// RemoveTx removes a transaction that left the pool without being mined from
+// Redis, recording it as dropped for the given reason.
+func (tm *TxManager) RemoveTx(hash common.Hash, reason string) error {
+	return tm.leave(hash, &TxTransition{Status: TxStatusDropped, Reason: reason})
+}
 
-	// Remove from Redis
-	if err := tm.client.Del(tm.ctx, txKey).Err(); err != nil {
-		log.Error("Failed to remove transaction from Redis", "hash", hash.Hex(), "key", txKey, "err", err)
-		return fmt.Errorf("failed to remove transaction from Redis: %v", err)
+// RemoveTxs removes multiple transactions from Redis (batch operation). If Redis
+// cannot be reached, the removal is spooled to disk.
+func (tm *TxManager) RemoveTxs(hashes []common.Hash) error {
+	if err := tm.removeTxs(hashes); err != nil {
+		tm.errors.Add(1)
+		tm.spoolWrite(&spoolEntry{Hashes: hashes})
+		return err
 	}
-
 	return nil
 }
 
-// RemoveTxs removes multiple transactions from Redis (batch operation)
-func (tm *TxManager) RemoveTxs(hashes []common.Hash) error {
+// removeTxs removes multiple transactions from Redis.
+func (tm *TxManager) removeTxs(hashes []common.Hash) error {
 	if len(hashes) == 0 {
 		return nil
 	}
+	batch := new(slotBatch)
+	if err := tm.queueRemoval(batch, hashes); err != nil {
+		log.Error("Failed to unindex transactions in Redis", "count", len(hashes), "err", err)
+		return err
+	}
+	// Batch remove from Redis, key by key as they span multiple cluster slots
+	if err := tm.store.pipeline(batch); err != nil {
+		log.Error("Failed to batch remove transactions from Redis", "count", len(hashes), "err", err)
+		return fmt.Errorf("failed to batch remove transactions from Redis: %v", err)
+	}
+	return nil
+}
 
+// queueRemoval adds the writes removing multiple transactions from Redis to a
+// batch. The parties of the transactions, needed to unindex them, are looked up
+// right away.
+func (tm *TxManager) queueRemoval(batch *slotBatch, hashes []common.Hash) error {
 	// Remove from duplicate cache
-	tm.dupMutex.Lock()
 	for _, hash := range hashes {
-		delete(tm.dupCache, hash)
+		tm.dupCache.remove(hash)
 	}
-	tm.dupMutex.Unlock()
-
-	// Prepare keys for batch deletion
-	keys := make([]string, len(hashes))
-	for i, hash := range hashes {
-		keys[i] = fmt.Sprintf("tx:%s", hash.Hex())
+	// Drop the transactions from the address index while still known
+	if err := tm.queueUnindexPendingTxs(batch, hashes); err != nil {
+		return err
 	}
-
-	// Batch remove from Redis
-	_, err := tm.client.Del(tm.ctx, keys...).Result()
-	if err != nil {
-		log.Error("Failed to batch remove transactions from Redis", "count", len(hashes), "err", err)
-		return fmt.Errorf("failed to batch remove transactions from Redis: %v", err)
+	// Delete the transactions, including any blob sidecars and simulations
+	for _, hash := range hashes {
+		batch.add(tm.store.keys.txKey(hash), "DEL", tm.store.keys.txKey(hash))
+		batch.add(tm.store.keys.blobSidecarKey(hash), "DEL", tm.store.keys.blobSidecarKey(hash))
+		batch.add(tm.store.keys.txSimKey(hash), "DEL", tm.store.keys.txSimKey(hash))
 	}
-
 	return nil
 }
 
 // ListRedisTransactions returns all transaction hashes currently in Redis (for debugging)
-func (tm *TxManager) ListRedisTransactions() ([]string, error) {
-	var keys []string
-	iter := tm.client.Scan(tm.ctx, 0, "tx:*", 1000).Iterator()
-
-	for iter.Next(tm.ctx) {
-		keys = append(keys, iter.Val())
-	}
-
-	if err := iter.Err(); err != nil {
+func (tm *TxManager) ListRedisTransactions() ([]common.Hash, error) {
+	var hashes []common.Hash
+	err := scanKeys(tm.ctx, tm.client, tm.store.keys.prefix+"tx:*", func(key string) error {
+		if hash, ok := tm.store.keys.txHash(key); ok {
+			hashes = append(hashes, hash)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to scan Redis keys: %v", err)
 	}
 
-	return keys, nil
+	return hashes, nil
 }
@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/filtermaps"
 	"github.com/ethereum/go-ethereum/core/history"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/redisstore"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/core/txpool/locals"
@@ -393,6 +394,12 @@ func (b *EthAPIBackend) TxPool() *txpool.TxPool {
 	return b.eth.txPool
 }
 
+// RedisExporter returns the Redis exporter of the node, or nil if the export is
+// disabled.
+func (b *EthAPIBackend) RedisExporter() *redisstore.Exporter {
+	return b.eth.redisExporter
+}
+
 func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
 	return b.eth.txPool.SubscribeTransactions(ch, true)
 }
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/filtermaps"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/redisstore"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/core/txpool/blobpool"
@@ -47,6 +48,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/eth/tracers/live"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -96,6 +98,7 @@ type Ethereum struct {
 	blobTxPool     *blobpool.BlobPool
 	localTxTracker *locals.TxTracker
 	blockchain     *core.BlockChain
+	redisExporter  *redisstore.Exporter
 
 	handler *handler
 	discmix *enode.FairMix
@@ -239,7 +242,19 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 	)
 
-	if config.VMTrace != "" {
+	// The state diff tracer hands its diffs over to the Redis exporter
+	var stateDiffs *redisstore.StateDiffRecorder
+	if config.VMTrace == "statediff" {
+		stateDiffs = redisstore.NewStateDiffRecorder()
+		t, err := live.NewStateDiffTracer(stateDiffs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tracer %s: %v", config.VMTrace, err)
+		}
+		options.VmConfig.Tracer = t
+		if !config.Redis.Enabled {
+			log.Warn("State diff tracer has no effect without the Redis export")
+		}
+	} else if config.VMTrace != "" {
 		traceConfig := json.RawMessage("{}")
 		if config.VMTraceJsonConfig != "" {
 			traceConfig = json.RawMessage(config.VMTraceJsonConfig)
@@ -319,6 +334,14 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		BloomCache:     uint64(cacheLimit),
 		EventMux:       eth.eventMux,
 		RequiredBlocks: config.RequiredBlocks,
+		Private: func(hash common.Hash) bool {
+			return eth.redisExporter != nil && eth.redisExporter.IsPrivate(hash)
+		},
+		TxArrival: func(peer string, txs []*types.Transaction, direct bool, arrival time.Time) {
+			if eth.redisExporter != nil {
+				eth.redisExporter.TxArrived(peer, txs, direct, arrival)
+			}
+		},
 	}); err != nil {
 		return nil, err
 	}
@@ -343,6 +366,23 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	stack.RegisterProtocols(eth.Protocols())
 	stack.RegisterLifecycle(eth)
 
+	// Mirror the chain and the pool into Redis if requested. The exporter is
+	// registered after the protocol so that it stops first and can drain.
+	if config.Redis.Enabled {
+		if config.Redis.Spool != "" {
+			config.Redis.Spool = stack.ResolvePath(config.Redis.Spool)
+		}
+		eth.redisExporter = redisstore.NewExporter(&config.Redis, chainDb, eth.blockchain, eth.txPool)
+		if eth.localTxTracker != nil {
+			eth.redisExporter.SetLocalTracker(eth.localTxTracker)
+		}
+		if stateDiffs != nil {
+			eth.redisExporter.SetStateDiffRecorder(stateDiffs)
+		}
+		stack.RegisterLifecycle(eth.redisExporter)
+		stack.RegisterAPIs(eth.redisExporter.APIs())
+	}
+
 	// Successful startup; push a marker and check previous unclean shutdowns.
 	eth.shutdownTracker.MarkStartup()
 
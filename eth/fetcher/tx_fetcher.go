@@ -204,6 +204,7 @@ type TxFetcher struct {
 	addTxs   func([]*types.Transaction) []error // Insert a batch of transactions into local txpool
 	fetchTxs func(string, []common.Hash) error  // Retrieves a set of txs from a remote peer
 	dropPeer func(string)                       // Drops a peer in case of announcement violation
+	arrived  TxArrivalHook                      // Observes every delivery before it is imported, if set
 
 	step     chan struct{}    // Notification channel when the fetcher loop iterates
 	clock    mclock.Clock     // Monotonic clock or simulated clock for tests
@@ -211,6 +212,11 @@ type TxFetcher struct {
 	rand     *mrand.Rand      // Randomizer to use in tests instead of map range loops (soft-random)
 }
 
+// TxArrivalHook is called with every batch of transactions delivered by a peer,
+// before they are imported into the pool. Direct deliveries are replies to
+// retrievals of announced transactions, the others are broadcasts.
+type TxArrivalHook func(peer string, txs []*types.Transaction, direct bool, arrival time.Time)
+
 // NewTxFetcher creates a transaction fetcher to retrieve transaction
 // based on hash announcements.
 func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error, dropPeer func(string)) *TxFetcher {
@@ -325,6 +331,11 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 	// Keep track of all the propagated transactions
 	inMeter.Mark(int64(len(txs)))
 
+	// Report the delivery before the pool announces any of the transactions
+	if f.arrived != nil {
+		f.arrived(peer, txs, direct, f.realTime())
+	}
+
 	// Push all the transactions into the pool, tracking underpriced ones to avoid
 	// re-requesting them and dropping the peer in case of malicious transfers.
 	var (
@@ -388,6 +399,12 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 	}
 }
 
+// SetArrivalHook sets the callback observing transaction deliveries. It must be
+// called before any transactions are enqueued.
+func (f *TxFetcher) SetArrivalHook(hook TxArrivalHook) {
+	f.arrived = hook
+}
+
 // Drop should be called when a peer disconnects. It cleans up all the internal
 // data structures of the given node.
 func (f *TxFetcher) Drop(peer string) error {
@@ -822,6 +822,69 @@ func TestTransactionFetcherBroadcasts(t *testing.T) {
 	})
 }
 
+// Tests that the arrival hook observes every delivery, with its origin and kind,
+// before the transactions are imported into the pool.
+func TestTransactionFetcherArrivalHook(t *testing.T) {
+	type arrival struct {
+		peer   string
+		hashes []common.Hash
+		direct bool
+		time   time.Time
+	}
+	var (
+		now      = time.Unix(1700000000, 0)
+		arrivals []arrival
+		imported int
+	)
+	fetcher := NewTxFetcherForTests(
+		func(common.Hash) bool { return false },
+		func(txs []*types.Transaction) []error {
+			if len(arrivals) == 0 {
+				t.Errorf("transactions imported before their arrival was reported")
+			}
+			imported += len(txs)
+			return make([]error, len(txs))
+		},
+		func(string, []common.Hash) error { return nil },
+		nil,
+		new(mclock.Simulated),
+		func() time.Time { return now },
+		rand.New(rand.NewSource(0x3a29)),
+	)
+	fetcher.SetArrivalHook(func(peer string, txs []*types.Transaction, direct bool, at time.Time) {
+		hashes := make([]common.Hash, len(txs))
+		for i, tx := range txs {
+			hashes[i] = tx.Hash()
+		}
+		arrivals = append(arrivals, arrival{peer, hashes, direct, at})
+	})
+	fetcher.Start()
+	defer fetcher.Stop()
+
+	if err := fetcher.Enqueue("A", []*types.Transaction{testTxs[0], testTxs[1]}, false); err != nil {
+		t.Fatalf("failed to enqueue broadcast: %v", err)
+	}
+	if err := fetcher.Enqueue("B", []*types.Transaction{testTxs[2]}, true); err != nil {
+		t.Fatalf("failed to enqueue reply: %v", err)
+	}
+	want := []arrival{
+		{peer: "A", hashes: []common.Hash{testTxsHashes[0], testTxsHashes[1]}, direct: false, time: now},
+		{peer: "B", hashes: []common.Hash{testTxsHashes[2]}, direct: true, time: now},
+	}
+	if len(arrivals) != len(want) {
+		t.Fatalf("arrival count mismatch: have %d, want %d", len(arrivals), len(want))
+	}
+	for i := range want {
+		have := arrivals[i]
+		if have.peer != want[i].peer || have.direct != want[i].direct || !have.time.Equal(want[i].time) || !slices.Equal(have.hashes, want[i].hashes) {
+			t.Errorf("arrival %d mismatch: have %+v, want %+v", i, have, want[i])
+		}
+	}
+	if imported != 3 {
+		t.Errorf("imported transaction count mismatch: have %d, want 3", imported)
+	}
+}
+
 // Tests that the waiting list timers properly reset and reschedule.
 func TestTransactionFetcherWaitTimerResets(t *testing.T) {
 	testTransactionFetcherParallel(t, txFetcherTest{
@@ -285,6 +285,14 @@ func (s *searchSession) searchInRange(r common.Range[uint64], indexed bool) (com
 		s.forceUnindexed = true
 		// fall through to unindexed case
 	}
+	if index := s.filter.sys.cfg.LogIndex; index != nil {
+		matches, ok, err := s.filter.externalLogs(s.ctx, index, s.chainView, r.First(), r.Last())
+		if err != nil {
+			log.Debug("External log search failed", "begin", r.First(), "end", r.Last(), "err", err)
+		} else if ok {
+			return r, matches, nil
+		}
+	}
 	if s.filter.rangeLogsTestHook != nil {
 		s.filter.rangeLogsTestHook <- rangeLogsTestEvent{rangeLogsTestUnindexed, r}
 	}
@@ -446,6 +454,22 @@ func (f *Filter) unindexedLogs(ctx context.Context, chainView *filtermaps.ChainV
 	return matches, nil
 }
 
+// externalLogs returns the logs matching the filter criteria from an external log
+// index, if it covers the whole range on the given chain view.
+func (f *Filter) externalLogs(ctx context.Context, index LogIndex, chainView *filtermaps.ChainView, begin, end uint64) ([]*types.Log, bool, error) {
+	if end > chainView.HeadNumber() {
+		return nil, false, nil
+	}
+	start := time.Now()
+	potentialMatches, ok, err := index.FilterLogs(ctx, begin, end, chainView.BlockHash, f.addresses, f.topics)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	matches := filterLogs(potentialMatches, nil, nil, f.addresses, f.topics)
+	log.Debug("Performed external log search", "begin", begin, "end", end, "matches", len(matches), "elapsed", common.PrettyDuration(time.Since(start)))
+	return matches, true, nil
+}
+
 // blockLogs returns the logs matching the filter criteria within a single block.
 func (f *Filter) blockLogs(ctx context.Context, header *types.Header) ([]*types.Log, error) {
 	if bloomFilter(header.Bloom, f.addresses, f.topics) {
@@ -43,6 +43,16 @@ import (
 type Config struct {
 	LogCacheSize int           // maximum number of cached blocks (default: 32)
 	Timeout      time.Duration // how long filters stay active (default: 5min)
+	LogIndex     LogIndex      // external index for ranges not indexed locally (optional)
+}
+
+// LogIndex is an external log index, consulted for ranges the local log index
+// does not cover (yet) before falling back to iterating the blocks.
+type LogIndex interface {
+	// FilterLogs returns the logs of the blocks in [begin, end] potentially
+	// matching the given criteria. The blocks are identified by their canonical
+	// hash; ok is false if the index cannot serve the whole range.
+	FilterLogs(ctx context.Context, begin, end uint64, hashOf func(uint64) common.Hash, addresses []common.Address, topics [][]common.Hash) (logs []*types.Log, ok bool, err error)
 }
 
 func (cfg Config) withDefaults() Config {
@@ -604,3 +604,77 @@ func TestRangeLogs(t *testing.T) {
 	expEvent(rangeLogsTestReorg, 400, 901)
 	expEvent(rangeLogsTestDone, 0, 0)
 }
+
+// testLogIndex is an external log index serving fixed logs within a block range.
+type testLogIndex struct {
+	begin, end uint64
+	logs       []*types.Log
+}
+
+func (idx *testLogIndex) FilterLogs(ctx context.Context, begin, end uint64, hashOf func(uint64) common.Hash, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, bool, error) {
+	if begin < idx.begin || end > idx.end {
+		return nil, false, nil
+	}
+	var logs []*types.Log
+	for _, log := range idx.logs {
+		if log.BlockNumber >= begin && log.BlockNumber <= end && log.BlockHash == hashOf(log.BlockNumber) {
+			logs = append(logs, log)
+		}
+	}
+	return logs, true, nil
+}
+
+// Tests that unindexed ranges are served from the external log index if it covers
+// them, falling back to iterating the blocks otherwise.
+func TestFiltersExternalIndex(t *testing.T) {
+	var (
+		db           = rawdb.NewMemoryDatabase()
+		index        = new(testLogIndex)
+		backend, sys = newTestFilterSystem(db, Config{LogIndex: index})
+		addr1        = common.BytesToAddress([]byte("jeff"))
+		addr2        = common.BytesToAddress([]byte("ethereum"))
+
+		gspec = &core.Genesis{
+			BaseFee: big.NewInt(params.InitialBaseFee),
+			Config:  params.TestChainConfig,
+		}
+	)
+	defer db.Close()
+	_, chain, receipts := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), 10, func(i int, gen *core.BlockGen) {
+		if i == 4 {
+			gen.AddUncheckedReceipt(makeReceipt(addr1))
+			gen.AddUncheckedTx(types.NewTransaction(999, common.HexToAddress("0x999"), big.NewInt(999), 999, gen.BaseFee(), nil))
+		}
+	})
+	gspec.MustCommit(db, triedb.NewDatabase(db, triedb.HashDefaults))
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	backend.startFilterMaps(0, true, filtermaps.DefaultParams)
+	defer backend.stopFilterMaps()
+
+	// The index holds logs unknown locally to tell the sources apart
+	index.begin, index.end = 8, 10
+	index.logs = []*types.Log{
+		{Address: addr2, BlockNumber: 9, BlockHash: chain[8].Hash()},
+		{Address: addr1, BlockNumber: 9, BlockHash: chain[8].Hash(), Index: 1},
+		{Address: addr2, BlockNumber: 10, BlockHash: common.Hash{0xff}},
+	}
+	logs, err := sys.NewRangeFilter(8, 10, []common.Address{addr2}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to filter logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Address != addr2 || logs[0].BlockNumber != 9 {
+		t.Errorf("Indexed range mismatch: have %v", logs)
+	}
+	logs, err = sys.NewRangeFilter(0, 10, []common.Address{addr1, addr2}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to filter logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Address != addr1 || logs[0].BlockNumber != 5 {
+		t.Errorf("Unindexed range mismatch: have %v", logs)
+	}
+}
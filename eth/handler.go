@@ -105,6 +105,8 @@ type handlerConfig struct {
 	BloomCache     uint64                 // Megabytes to alloc for snap sync bloom
 	EventMux       *event.TypeMux         // Legacy event mux, deprecate for `feed`
 	RequiredBlocks map[uint64]common.Hash // Hard coded map of required block hashes for sync challenges
+	Private        func(common.Hash) bool // Whether a pool transaction must not be propagated, nil if none
+	TxArrival      fetcher.TxArrivalHook  // Observes transactions delivered by peers before import, if set
 }
 
 type handler struct {
@@ -129,6 +131,7 @@ type handler struct {
 	blockRange *blockRangeState
 
 	requiredBlocks map[uint64]common.Hash
+	private        func(common.Hash) bool
 
 	// channels for fetcher, syncer, txsyncLoop
 	quitSync chan struct{}
@@ -154,6 +157,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		chain:          config.Chain,
 		peers:          newPeerSet(),
 		requiredBlocks: config.RequiredBlocks,
+		private:        config.Private,
 		quitSync:       make(chan struct{}),
 		handlerDoneCh:  make(chan struct{}),
 		handlerStartCh: make(chan struct{}),
@@ -204,6 +208,9 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		return h.txpool.Add(txs, false)
 	}
 	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, addTxs, fetchTx, h.removePeer)
+	if config.TxArrival != nil {
+		h.txFetcher.SetArrivalHook(config.TxArrival)
+	}
 	return h, nil
 }
 
@@ -492,6 +499,9 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 		hash   = make([]byte, 32)
 	)
 	for _, tx := range txs {
+		if h.private != nil && h.private(tx.Hash()) {
+			continue
+		}
 		var maybeDirect bool
 		switch {
 		case tx.Type() == types.BlobTxType:
@@ -355,6 +355,79 @@ func testSendTransactions(t *testing.T, protocol uint) {
 	}
 }
 
+// Tests that transactions marked private are neither broadcast nor announced to
+// newly connected peers.
+func TestSendPrivateTransactions68(t *testing.T) { testSendPrivateTransactions(t, eth.ETH68) }
+
+func testSendPrivateTransactions(t *testing.T, protocol uint) {
+	t.Parallel()
+
+	// Create a message handler keeping every other transaction private
+	handler := newTestHandler()
+	defer handler.close()
+
+	insert := make([]*types.Transaction, 10)
+	for nonce := range insert {
+		tx := types.NewTransaction(uint64(nonce), common.Address{}, big.NewInt(0), 100000, big.NewInt(0), nil)
+		tx, _ = types.SignTx(tx, types.HomesteadSigner{}, testKey)
+		insert[nonce] = tx
+	}
+	private := make(map[common.Hash]bool)
+	for i := 0; i < len(insert); i += 2 {
+		private[insert[i].Hash()] = true
+	}
+	handler.handler.private = func(hash common.Hash) bool { return private[hash] }
+
+	go handler.txpool.Add(insert, false) // Need goroutine to not block on feed
+	time.Sleep(250 * time.Millisecond)   // Wait until tx events get out of the system
+
+	// Connect a sink peer and collect everything it gets told about
+	p2pSrc, p2pSink := p2p.MsgPipe()
+	defer p2pSrc.Close()
+	defer p2pSink.Close()
+
+	src := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{1}, "", nil, p2pSrc), p2pSrc, handler.txpool)
+	sink := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{2}, "", nil, p2pSink), p2pSink, handler.txpool)
+	defer src.Close()
+	defer sink.Close()
+
+	go handler.handler.runEthPeer(src, func(peer *eth.Peer) error {
+		return eth.Handle((*ethHandler)(handler.handler), peer)
+	})
+	if err := sink.Handshake(1, handler.chain, eth.BlockRangeUpdatePacket{}); err != nil {
+		t.Fatalf("failed to run protocol handshake")
+	}
+	backend := new(testEthHandler)
+
+	anns := make(chan []common.Hash)
+	annSub := backend.txAnnounces.Subscribe(anns)
+	defer annSub.Unsubscribe()
+
+	go eth.Handle(backend, sink)
+
+	seen := make(map[common.Hash]struct{})
+	for timeout := time.After(time.Second); ; {
+		select {
+		case hashes := <-anns:
+			for _, hash := range hashes {
+				seen[hash] = struct{}{}
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	for _, tx := range insert {
+		_, ok := seen[tx.Hash()]
+		if private[tx.Hash()] && ok {
+			t.Errorf("private transaction announced: %x", tx.Hash())
+		}
+		if !private[tx.Hash()] && !ok {
+			t.Errorf("missing transaction: %x", tx.Hash())
+		}
+	}
+}
+
 // Tests that transactions get propagated to all attached peers, either via direct
 // broadcasts or via announcements/retrievals.
 func TestTransactionPropagation68(t *testing.T) { testTransactionPropagation(t, eth.ETH68) }
@@ -27,6 +27,9 @@ func (h *handler) syncTransactions(p *eth.Peer) {
 	var hashes []common.Hash
 	for _, batch := range h.txpool.Pending(txpool.PendingFilter{OnlyPlainTxs: true}) {
 		for _, tx := range batch {
+			if h.private != nil && h.private(tx.Hash) {
+				continue
+			}
 			hashes = append(hashes, tx.Hash)
 		}
 	}
@@ -0,0 +1,293 @@
+// Copyright 2026 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/redisstore"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/live"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the state diff tracer exports the net state changes of a block
+// through the Redis store, and their rollback when the block is removed.
+func TestStateDiffExport(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		receiver = common.Address{0xbb}
+		storer   = common.Address{0xcc} // SSTORE(1, 1)
+		reverter = common.Address{0xdd} // SSTORE(2, 1), REVERT
+		eth1     = big.NewInt(params.Ether)
+		config   = *params.MergedTestChainConfig
+		gspec    = &core.Genesis{
+			Config: &config,
+			Alloc: types.GenesisAlloc{
+				sender: {Balance: eth1},
+				storer: {Code: []byte{byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x01, byte(vm.SSTORE), byte(vm.STOP)}},
+				reverter: {Code: []byte{
+					byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x02, byte(vm.SSTORE),
+					byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.REVERT),
+				}},
+			},
+		}
+		engine = beacon.New(ethash.NewFaker())
+		signer = types.LatestSigner(&config)
+	)
+	recorder := redisstore.NewStateDiffRecorder()
+	tracer, err := live.NewStateDiffTracer(recorder)
+	if err != nil {
+		t.Fatalf("Failed to create state diff tracer: %v", err)
+	}
+	options := core.DefaultConfig().WithStateScheme(rawdb.PathScheme)
+	options.VmConfig = vm.Config{Tracer: tracer}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), gspec, engine, options)
+	if err != nil {
+		t.Fatalf("Failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, engine, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		b.SetPoS()
+		for nonce, to := range []common.Address{storer, reverter, receiver} {
+			value := common.Big0
+			if to == receiver {
+				value = common.Big1
+			}
+			b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{
+				Nonce:    uint64(nonce),
+				To:       &to,
+				Value:    value,
+				Gas:      100000,
+				GasPrice: b.BaseFee(),
+			}))
+		}
+	})
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	// Export the block and roll it back
+	backend := redisstore.NewMemoryBackend()
+	store, err := redisstore.NewStore(&redisstore.DefaultConfig, backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(config.ChainID)
+	store.SetStateDiffRecorder(recorder)
+
+	block := blocks[0]
+	receipts := chain.GetReceiptsByHash(block.Hash())
+	if err := store.CommitBlock(block, receipts, &config); err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	if err := store.RemoveBlock(block, logs); err != nil {
+		t.Fatalf("Failed to remove block: %v", err)
+	}
+	// Blocks becoming canonical again get their stored diff re-announced
+	if err := store.CommitBlock(block, receipts, &config); err != nil {
+		t.Fatalf("Failed to re-export block: %v", err)
+	}
+	stream := redisstore.StreamKey(redisstore.DefaultKeyPrefix(config.ChainID), config.ChainID, redisstore.StateDiffsStream)
+	entries, err := backend.XRange(context.Background(), stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read state diffs: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("State diff entry count mismatch: have %d, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		var (
+			removed  = i == 1
+			accounts map[common.Address]*redisstore.AccountDiff
+		)
+		if entry.Values["hash"] != block.Hash().Hex() || entry.Values["number"] != "1" {
+			t.Errorf("entry %d: block mismatch: have %v #%v", i, entry.Values["hash"], entry.Values["number"])
+		}
+		if have := entry.Values["removed"] == "1"; have != removed {
+			t.Errorf("entry %d: removed flag mismatch: have %v, want %v", i, have, removed)
+		}
+		if err := json.Unmarshal([]byte(entry.Values["accounts"].(string)), &accounts); err != nil {
+			t.Fatalf("entry %d: failed to decode accounts: %v", i, err)
+		}
+		if _, ok := accounts[reverter]; ok {
+			t.Errorf("entry %d: reverted changes exported: %+v", i, accounts[reverter])
+		}
+		nonces := [2]uint64{0, 3}
+		if removed {
+			nonces[0], nonces[1] = nonces[1], nonces[0]
+		}
+		if nonce := accounts[sender].Nonce; nonce == nil || uint64(nonce.From) != nonces[0] || uint64(nonce.To) != nonces[1] {
+			t.Errorf("entry %d: sender nonce mismatch: %+v", i, nonce)
+		}
+		want := &redisstore.StorageDiff{To: common.HexToHash("0x01")}
+		if removed {
+			want = &redisstore.StorageDiff{From: common.HexToHash("0x01")}
+		}
+		if have := accounts[storer].Storage[common.HexToHash("0x01")]; have == nil || *have != *want || len(accounts[storer].Storage) != 1 {
+			t.Errorf("entry %d: storage mismatch: have %+v, want %+v", i, accounts[storer].Storage, want)
+		}
+		balance := accounts[receiver].Balance
+		from, to := common.Big0, common.Big1
+		if removed {
+			from, to = to, from
+		}
+		if balance == nil || balance.From.ToInt().Cmp(from) != 0 || balance.To.ToInt().Cmp(to) != 0 {
+			t.Errorf("entry %d: receiver balance mismatch: %+v", i, balance)
+		}
+	}
+}
+
+// Tests that the storage of a contract self-destructed in the transaction that
+// created it is reported wiped, even though the state does not announce it.
+func TestStateDiffSelfDestruct(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		config = *params.MergedTestChainConfig
+		gspec  = &core.Genesis{
+			Config: &config,
+			Alloc:  types.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+		}
+		engine = beacon.New(ethash.NewFaker())
+		signer = types.LatestSigner(&config)
+
+		// SSTORE(1, 1), SELFDESTRUCT(sender)
+		initcode = append([]byte{byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x01, byte(vm.SSTORE), byte(vm.PUSH20)}, append(sender.Bytes(), byte(vm.SELFDESTRUCT))...)
+		created  = crypto.CreateAddress(sender, 0)
+	)
+	recorder := redisstore.NewStateDiffRecorder()
+	tracer, err := live.NewStateDiffTracer(recorder)
+	if err != nil {
+		t.Fatalf("Failed to create state diff tracer: %v", err)
+	}
+	options := core.DefaultConfig().WithStateScheme(rawdb.PathScheme)
+	options.VmConfig = vm.Config{Tracer: tracer}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), gspec, engine, options)
+	if err != nil {
+		t.Fatalf("Failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, engine, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		b.SetPoS()
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    0,
+			Value:    common.Big1,
+			Gas:      100000,
+			GasPrice: b.BaseFee(),
+			Data:     initcode,
+		}))
+	})
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	backend := redisstore.NewMemoryBackend()
+	store, err := redisstore.NewStore(&redisstore.DefaultConfig, backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(config.ChainID)
+	store.SetStateDiffRecorder(recorder)
+
+	block := blocks[0]
+	if err := store.CommitBlock(block, chain.GetReceiptsByHash(block.Hash()), &config); err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+	stream := redisstore.StreamKey(redisstore.DefaultKeyPrefix(config.ChainID), config.ChainID, redisstore.StateDiffsStream)
+	entries, err := backend.XRange(context.Background(), stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read state diffs: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("State diff entry count mismatch: have %d, want 1", len(entries))
+	}
+	var accounts map[common.Address]*redisstore.AccountDiff
+	if err := json.Unmarshal([]byte(entries[0].Values["accounts"].(string)), &accounts); err != nil {
+		t.Fatalf("Failed to decode accounts: %v", err)
+	}
+	if diff, ok := accounts[created]; ok {
+		t.Errorf("Self-destructed contract exported: %+v", diff)
+	}
+	if nonce := accounts[sender].Nonce; nonce == nil || nonce.From != 0 || nonce.To != 1 {
+		t.Errorf("Sender nonce mismatch: %+v", nonce)
+	}
+}
+
+// Tests that blocks whose state diff was not recorded are announced with the
+// diff marked unavailable, both when exported and when rolled back.
+func TestStateDiffUnavailable(t *testing.T) {
+	var (
+		config = *params.MergedTestChainConfig
+		gspec  = &core.Genesis{Config: &config}
+		engine = beacon.New(ethash.NewFaker())
+	)
+	_, blocks, receipts := core.GenerateChainWithGenesis(gspec, engine, 1, func(i int, b *core.BlockGen) {
+		b.SetPoS()
+	})
+	backend := redisstore.NewMemoryBackend()
+	store, err := redisstore.NewStore(&redisstore.DefaultConfig, backend)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetChainID(config.ChainID)
+	store.SetStateDiffRecorder(redisstore.NewStateDiffRecorder())
+
+	block := blocks[0]
+	if err := store.CommitBlock(block, receipts[0], &config); err != nil {
+		t.Fatalf("Failed to export block: %v", err)
+	}
+	if err := store.RemoveBlock(block, nil); err != nil {
+		t.Fatalf("Failed to remove block: %v", err)
+	}
+	stream := redisstore.StreamKey(redisstore.DefaultKeyPrefix(config.ChainID), config.ChainID, redisstore.StateDiffsStream)
+	entries, err := backend.XRange(context.Background(), stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read state diffs: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("State diff entry count mismatch: have %d, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Values["hash"] != block.Hash().Hex() || entry.Values["unavailable"] != "1" {
+			t.Errorf("entry %d: mismatch: have %v", i, entry.Values)
+		}
+		if _, ok := entry.Values["accounts"]; ok {
+			t.Errorf("entry %d: accounts of unavailable diff announced", i)
+		}
+		if have := entry.Values["removed"] == "1"; have != (i == 1) {
+			t.Errorf("entry %d: removed flag mismatch: have %v", i, have)
+		}
+	}
+}
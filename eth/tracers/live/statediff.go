@@ -0,0 +1,117 @@
+// Copyright 2026 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package live
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/redisstore"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// stateDiffTracer aggregates the net state changes of every processed block
+// and hands them over to the Redis exporter. It is wrapped with the journal, so
+// changes of reverted calls are reported undone and cancel out.
+type stateDiffTracer struct {
+	recorder *redisstore.StateDiffRecorder
+	diff     *redisstore.StateDiff // Diff of the block being processed, nil outside of blocks
+
+	state   tracing.StateDB             // State of the transaction being processed
+	touched map[common.Address]struct{} // Accounts changed by the transaction being processed
+}
+
+// NewStateDiffTracer creates a live tracer recording the state diff of every
+// processed block with the given recorder, which the Redis exporter takes them
+// from.
+func NewStateDiffTracer(recorder *redisstore.StateDiffRecorder) (*tracing.Hooks, error) {
+	t := &stateDiffTracer{
+		recorder: recorder,
+		touched:  make(map[common.Address]struct{}),
+	}
+	return tracing.WrapWithJournal(&tracing.Hooks{
+		OnBlockStart:    t.onBlockStart,
+		OnBlockEnd:      t.onBlockEnd,
+		OnTxStart:       t.onTxStart,
+		OnTxEnd:         t.onTxEnd,
+		OnBalanceChange: t.onBalanceChange,
+		OnNonceChange:   t.onNonceChange,
+		OnCodeChange:    t.onCodeChange,
+		OnStorageChange: t.onStorageChange,
+	})
+}
+
+func (t *stateDiffTracer) onBlockStart(ev tracing.BlockEvent) {
+	t.diff = redisstore.NewStateDiff(ev.Block.Header())
+}
+
+func (t *stateDiffTracer) onBlockEnd(err error) {
+	if err == nil && t.diff != nil {
+		t.recorder.Record(t.diff)
+	}
+	t.diff = nil
+}
+
+func (t *stateDiffTracer) onTxStart(vm *tracing.VMContext, tx *types.Transaction, from common.Address) {
+	t.state = vm.StateDB
+	clear(t.touched)
+}
+
+// onTxEnd clears the changes of the accounts the transaction deleted, such as
+// contracts self-destructed in the transaction creating them. Their storage is
+// wiped without reporting the individual slots. The state is finalised by the
+// time the transaction ends, so deleted accounts no longer exist.
+func (t *stateDiffTracer) onTxEnd(receipt *types.Receipt, err error) {
+	if t.diff != nil && t.state != nil {
+		for addr := range t.touched {
+			if !t.state.Exist(addr) {
+				t.diff.AccountDeleted(addr)
+			}
+		}
+	}
+	t.state = nil
+	clear(t.touched)
+}
+
+func (t *stateDiffTracer) onBalanceChange(addr common.Address, prev, new *big.Int, _ tracing.BalanceChangeReason) {
+	if t.diff != nil {
+		t.diff.BalanceChange(addr, prev, new)
+		t.touched[addr] = struct{}{}
+	}
+}
+
+func (t *stateDiffTracer) onNonceChange(addr common.Address, prev, new uint64) {
+	if t.diff != nil {
+		t.diff.NonceChange(addr, prev, new)
+		t.touched[addr] = struct{}{}
+	}
+}
+
+func (t *stateDiffTracer) onCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+	if t.diff != nil {
+		t.diff.CodeChange(addr, prevCodeHash, prevCode, codeHash, code)
+		t.touched[addr] = struct{}{}
+	}
+}
+
+func (t *stateDiffTracer) onStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+	if t.diff != nil {
+		t.diff.StorageChange(addr, slot, prev, new)
+		t.touched[addr] = struct{}{}
+	}
+}
@@ -24,6 +24,7 @@ var Modules = map[string]string{
 	"eth":    EthJs,
 	"miner":  MinerJs,
 	"net":    NetJs,
+	"redis":  RedisJs,
 	"rpc":    RpcJs,
 	"txpool": TxpoolJs,
 	"dev":    DevJs,
@@ -702,6 +703,36 @@ web3._extend({
 });
 `
 
+const RedisJs = `
+web3._extend({
+	property: 'redis',
+	methods:
+	[
+		new web3._extend.Method({
+			name: 'resync',
+			call: 'redis_resync',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'pause',
+			call: 'redis_pause',
+		}),
+		new web3._extend.Method({
+			name: 'resume',
+			call: 'redis_resume',
+		}),
+	],
+	properties:
+	[
+		new web3._extend.Property({
+			name: 'status',
+			getter: 'redis_status'
+		}),
+	]
+});
+`
+
 const DevJs = `
 web3._extend({
 	property: 'dev',